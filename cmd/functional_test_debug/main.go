@@ -4,6 +4,8 @@ import (
 	"context"
 	"github.com/joho/godotenv"
 	"github.com/s-turchinskiy/keeper/internal/client/config"
+	"github.com/s-turchinskiy/keeper/internal/client/crypto"
+	"github.com/s-turchinskiy/keeper/internal/client/repository"
 	"github.com/s-turchinskiy/keeper/internal/client/repository/mongodb"
 	"github.com/s-turchinskiy/keeper/internal/functional_tests"
 	serverconfig "github.com/s-turchinskiy/keeper/internal/server/config"
@@ -16,11 +18,11 @@ func main() {
 
 	ctx := context.Background()
 	_ = godotenv.Load("./cmd/server/.env")
-	serverCfg, err := serverconfig.LoadCfg()
+	serverCfg, err := serverconfig.LoadCfg(nil)
 	if err != nil {
 		log.Fatal(err)
 	}
-	db, err := postgres.NewPostgresStorage(ctx, serverCfg.DBURL)
+	db, err := postgres.NewPostgresStorage(ctx, serverCfg.DBURL, postgres.WithMigrations())
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -35,6 +37,8 @@ func main() {
 		&testing.T{},
 		postgres.NewUserRepository(db),
 		secretRepository,
+		postgres.NewSessionRepository(db),
+		postgres.NewDeviceRepository(db),
 		true)
 
 	err = secretRepository.TruncateAllTabs(ctx)
@@ -51,20 +55,21 @@ func main() {
 		log.Fatal(err)
 	}
 
-	mongoRepository, err := mongodb.NewMongoDBStorage(ctx, clientCfg.DBURL)
-	if err != nil {
-		log.Fatal(err)
-	}
+	newStorage := func(cryptor crypto.Cryptor) (repository.Repositorier, error) {
+		mongoRepository, err := mongodb.NewMongoDBStorage(ctx, clientCfg.DBURL, cryptor)
+		if err != nil {
+			return nil, err
+		}
 
-	err = mongoRepository.DeleteAll(ctx)
-	if err != nil {
-		log.Fatal(err)
+		return mongoRepository, mongoRepository.DeleteAll(ctx)
 	}
 
 	functional_tests.FunctionalTestAll(
 		&testing.T{},
 		postgres.NewUserRepository(db),
 		secretRepository,
-		mongoRepository,
+		postgres.NewSessionRepository(db),
+		postgres.NewDeviceRepository(db),
+		newStorage,
 		true)
 }
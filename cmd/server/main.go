@@ -1,12 +1,9 @@
 package main
 
 import (
-	"context"
-	"github.com/s-turchinskiy/keeper/internal/server/config"
-	"log"
-
 	"github.com/joho/godotenv"
-	"github.com/s-turchinskiy/keeper/internal/server"
+	"github.com/s-turchinskiy/keeper/internal/server/cmds"
+	"log"
 )
 
 func main() {
@@ -16,19 +13,7 @@ func main() {
 		_ = godotenv.Load("./cmd/server/.env")
 	}
 
-	cfg, err := config.LoadCfg(config.WithRedis(), config.WithJWT())
-	if err != nil {
-		log.Fatal("Failed to create app:", err)
-	}
-
-	ctx := context.Background()
-	app, err := server.NewApp(ctx, cfg)
-	if err != nil {
-		log.Fatal("Failed to create app:", err)
-	}
-	defer app.Stop(ctx)
-
-	if err := app.Run(); err != nil {
-		log.Fatal("Failed to run app:", err)
+	if err := cmds.New().Execute(nil); err != nil {
+		log.Fatal(err)
 	}
 }
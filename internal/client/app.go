@@ -1,61 +1,185 @@
 package client
 
 import (
+	"bufio"
 	"context"
+	"errors"
+	"fmt"
 	"github.com/s-turchinskiy/keeper/internal/client/cmds"
 	"github.com/s-turchinskiy/keeper/internal/client/crypto"
 	"github.com/s-turchinskiy/keeper/internal/client/grpcclient"
+	"github.com/s-turchinskiy/keeper/internal/client/repository"
+	"github.com/s-turchinskiy/keeper/internal/client/repository/filestorage"
+	"github.com/s-turchinskiy/keeper/internal/client/repository/memory"
 	"github.com/s-turchinskiy/keeper/internal/client/repository/mongodb"
 	"github.com/s-turchinskiy/keeper/internal/client/service"
+	"github.com/s-turchinskiy/keeper/internal/utils/tlsutils"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"io"
 	"log"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/s-turchinskiy/keeper/internal/client/config"
 )
 
 type CmdEr interface {
-	Run() error
+	Execute(args []string) error
 }
 
+type OptionApp func(*App)
+
 type App struct {
-	cfg     *config.Config
-	cmd     CmdEr
-	Service service.Servicer
+	cfg             *config.Config
+	cmd             CmdEr
+	Service         service.Servicer
+	args            []string
+	dialOptions     []grpc.DialOption
+	twoFactorPrompt grpcclient.TwoFactorPrompt
+}
+
+// WithArgs аргументы командной строки, по умолчанию аргументы процесса
+func WithArgs(args []string) OptionApp {
+	return func(a *App) {
+		a.args = args
+	}
+}
+
+// WithDialOptions дополнительные параметры подключения к серверу
+func WithDialOptions(opts ...grpc.DialOption) OptionApp {
+	return func(a *App) {
+		a.dialOptions = append(a.dialOptions, opts...)
+	}
 }
 
-func NewApp() (*App, error) {
+// WithTwoFactorPrompt откуда брать код второго фактора при входе, по умолчанию KEEPER_2FA_CODE или терминал
+func WithTwoFactorPrompt(prompt grpcclient.TwoFactorPrompt) OptionApp {
+	return func(a *App) {
+		a.twoFactorPrompt = prompt
+	}
+}
+
+func NewApp(opts ...OptionApp) (*App, error) {
+
+	app := &App{
+		args: os.Args[1:],
+	}
+
+	for _, opt := range opts {
+		opt(app)
+	}
 
-	cfg, err := config.LoadCfg(config.WithDB())
+	cfg, err := config.LoadCfg(config.WithDB(), config.WithEphemeral(app.args), config.WithKDF(), config.WithTLS())
+	if err != nil {
+		return nil, err
+	}
+
+	dialOptions, err := transportOptions(cfg)
 	if err != nil {
 		return nil, err
 	}
 
 	ctx := context.Background()
 
-	cryptor := crypto.NewCryptor(cfg.Password, cfg.Login)
+	cryptor := crypto.NewCryptor(cfg.Password, cfg.Login, crypto.WithKDFTarget(cfg.KDF))
 
-	repository, err := mongodb.NewMongoDBStorage(ctx, cfg.DBURL)
+	storage, err := newStorage(ctx, cfg.DBURL, cryptor)
 	if err != nil {
 		return nil, err
 	}
 
-	serverPassword := cryptor.GenerateServerPassword()
-	grpcClient, err := grpcclient.NewGRPCClient(ctx, cfg.ServerAddress, cfg.Login, serverPassword)
+	grpcClient, err := grpcclient.NewGRPCClient(ctx, cfg.ServerAddress, cfg.Login, "", append(dialOptions, app.dialOptions...)...)
 	if err != nil {
 		return nil, err
 	}
-	srvc := service.NewService(ctx, repository, grpcClient, service.WithCrypto(cryptor))
-	app := &App{
-		cfg:     cfg,
-		cmd:     cmds.New(srvc),
-		Service: srvc,
+
+	// соль и параметры KDF нужны до входа: пароль для сервера выводится из мастер-пароля с ними
+	kdf, err := grpcClient.GetKDFParams(ctx, cfg.Login)
+	if err != nil && !errors.Is(err, grpcclient.ErrUserNotFound) {
+		return nil, err
+	}
+	// сервер не должен заставить клиент вывести пароль с дешевыми параметрами
+	if err = kdf.Validate(); err != nil {
+		return nil, err
+	}
+	cryptor.SetKDFParams(kdf)
+	grpcClient.SetCredentials(cfg.Login, cryptor.GenerateServerPassword())
+
+	if app.twoFactorPrompt == nil {
+		app.twoFactorPrompt = terminalTwoFactorPrompt(cfg.TwoFactorCode, os.Stdin, os.Stderr)
+	}
+	grpcClient.SetTwoFactorPrompt(app.twoFactorPrompt)
+
+	srvc := service.NewService(ctx, storage, grpcClient, service.WithCrypto(cryptor), service.WithLogin(cfg.Login))
+	if err = srvc.InitDevice(ctx); err != nil {
+		return nil, err
 	}
+	app.cfg = cfg
+	app.cmd = cmds.New(srvc)
+	app.Service = srvc
 
 	return app, nil
 }
 
+// transportOptions TLS подключения к серверу, если он включен в конфигурации
+func transportOptions(cfg *config.Config) ([]grpc.DialOption, error) {
+
+	if !cfg.TLS {
+		return nil, nil
+	}
+
+	tlsConfig, err := tlsutils.ClientConfig(cfg.TLSCAFile, cfg.TLSServerName, cfg.TLSCertFile, cfg.TLSKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return []grpc.DialOption{grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig))}, nil
+}
+
+// terminalTwoFactorPrompt код второго фактора из настроек, а если его нет - из терминала.
+// Приглашение пишется в out, чтобы не смешиваться с выводом команды
+func terminalTwoFactorPrompt(code string, in io.Reader, out io.Writer) grpcclient.TwoFactorPrompt {
+
+	reader := bufio.NewReader(in)
+	return func(ctx context.Context) (string, error) {
+
+		if code != "" {
+			return code, nil
+		}
+
+		_, _ = fmt.Fprint(out, "Two-factor code (or recovery code): ")
+		answer, err := reader.ReadString('\n')
+		if err != nil && answer == "" {
+			return "", grpcclient.ErrTwoFactorRequired
+		}
+
+		return strings.TrimSpace(answer), nil
+	}
+}
+
+// newStorage создает локальное хранилище по схеме адреса
+func newStorage(ctx context.Context, dbURL string, cryptor crypto.Cryptor) (repository.Repositorier, error) {
+
+	if path, ok := strings.CutPrefix(dbURL, config.SchemeFile); ok {
+		return filestorage.NewFileStorage(path, cryptor)
+	}
+
+	if strings.HasPrefix(dbURL, config.SchemeMemory) {
+		return memory.NewMemoryStorage(), nil
+	}
+
+	return mongodb.NewMongoDBStorage(ctx, dbURL, cryptor)
+}
+
 func (a *App) Run() error {
-	return a.cmd.Run()
+	return a.cmd.Execute(a.args)
+}
+
+// Execute выполняет одну команду клиента с аргументами args
+func (a *App) Execute(args ...string) error {
+	return a.cmd.Execute(args)
 }
 
 func (a *App) Close() {
@@ -1,8 +1,11 @@
-package client
+package client_test
 
 import (
+	"context"
 	"github.com/golang/mock/gomock"
 	"github.com/s-turchinskiy/keeper/internal/functional_tests"
+	"github.com/s-turchinskiy/keeper/internal/server/repository/sqlite"
+	"github.com/stretchr/testify/require"
 	"testing"
 )
 
@@ -11,6 +14,53 @@ func TestFunctionalGRPC(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
-	functional_tests.FunctionalTestGRPC(t, functional_tests.UserMockRepository(ctrl), functional_tests.SecretMockRepository(ctrl), false)
+	functional_tests.FunctionalTestGRPC(t, functional_tests.UserMockRepository(ctrl), functional_tests.SecretMockRepository(ctrl),
+		functional_tests.SessionMockRepository(ctrl),
+		functional_tests.DeviceMockRepository(ctrl),
+		false)
+
+}
+
+func TestFunctionalApp(t *testing.T) {
+
+	ctx := context.Background()
+	db, err := sqlite.NewSQLiteStorage(ctx, ":memory:", sqlite.WithMigrations())
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close(ctx) })
+
+	functional_tests.FunctionalTestApp(t, sqlite.NewUserRepository(db), sqlite.NewSecretRepository(db), sqlite.NewSessionRepository(db), sqlite.NewDeviceRepository(db))
+
+}
+
+func TestFunctionalConflicts(t *testing.T) {
+
+	ctx := context.Background()
+	db, err := sqlite.NewSQLiteStorage(ctx, ":memory:", sqlite.WithMigrations())
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close(ctx) })
+
+	functional_tests.FunctionalTestConflicts(t, sqlite.NewUserRepository(db), sqlite.NewSecretRepository(db), sqlite.NewSessionRepository(db), sqlite.NewDeviceRepository(db))
+
+}
+
+func TestFunctionalVault(t *testing.T) {
+
+	ctx := context.Background()
+	db, err := sqlite.NewSQLiteStorage(ctx, ":memory:", sqlite.WithMigrations())
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close(ctx) })
+
+	functional_tests.FunctionalTestVault(t, sqlite.NewUserRepository(db), sqlite.NewSecretRepository(db), sqlite.NewSessionRepository(db), sqlite.NewDeviceRepository(db))
+
+}
+
+func TestFunctionalOTP(t *testing.T) {
+
+	ctx := context.Background()
+	db, err := sqlite.NewSQLiteStorage(ctx, ":memory:", sqlite.WithMigrations())
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close(ctx) })
+
+	functional_tests.FunctionalTestOTP(t, sqlite.NewUserRepository(db), sqlite.NewSecretRepository(db), sqlite.NewSessionRepository(db), sqlite.NewDeviceRepository(db))
 
 }
@@ -4,6 +4,8 @@ import (
 	"context"
 	"github.com/s-turchinskiy/keeper/internal/client/service"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"sync"
 )
 
 type contextKey string
@@ -12,6 +14,9 @@ const (
 	serviceContextKey contextKey = "app"
 )
 
+// setFlagsOnce флаги глобальных команд объявляются один раз на процесс, даже если клиентов несколько
+var setFlagsOnce sync.Once
+
 type CobraCommand struct {
 	rootCmd *cobra.Command
 }
@@ -25,13 +30,43 @@ func New(service service.Servicer) *CobraCommand {
 	ctx := context.WithValue(context.Background(), serviceContextKey, service)
 	rootCmd.SetContext(ctx)
 
-	setFlags()
+	// значение флага читается до разбора команды, при создании хранилища, здесь он только объявляется
+	rootCmd.PersistentFlags().Bool("ephemeral", false, "Keep secrets in memory only, nothing is saved to local storage")
+
+	setFlagsOnce.Do(setFlags)
 	addCommands(rootCmd)
 	return &CobraCommand{
 		rootCmd: rootCmd,
 	}
 }
 
-func (c *CobraCommand) Run() error {
+// Execute выполняет команду с аргументами args, при nil берутся аргументы процесса
+func (c *CobraCommand) Execute(args []string) error {
+	// глобальные команды принадлежат последнему созданному корню, а сервис команда берет из корня:
+	// в процессе с несколькими клиентами команды перед запуском возвращаются своему корню
+	commands := c.rootCmd.Commands()
+	c.rootCmd.RemoveCommand(commands...)
+	c.rootCmd.AddCommand(commands...)
+
+	resetFlags(c.rootCmd)
+	c.rootCmd.SetArgs(args)
 	return c.rootCmd.Execute()
 }
+
+// resetFlags возвращает флаги к значениям по умолчанию: команды объявлены глобально,
+// и без сброса флаги одной команды переходят в следующий Execute того же процесса
+func resetFlags(cmd *cobra.Command) {
+	cmd.Flags().VisitAll(func(flag *pflag.Flag) {
+		// Set добавляет к списку, а не заменяет его: списки очищаются отдельно
+		if slice, ok := flag.Value.(pflag.SliceValue); ok {
+			_ = slice.Replace(nil)
+		} else {
+			_ = flag.Value.Set(flag.DefValue)
+		}
+		flag.Changed = false
+	})
+
+	for _, child := range cmd.Commands() {
+		resetFlags(child)
+	}
+}
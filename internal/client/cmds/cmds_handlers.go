@@ -1,6 +1,7 @@
 package cmds
 
 import (
+	"bufio"
 	"context"
 	"encoding/base64"
 	"fmt"
@@ -10,6 +11,7 @@ import (
 	"github.com/spf13/cobra"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 func createVersionHandler() func(cmd *cobra.Command, args []string) {
@@ -24,10 +26,7 @@ func createRegisterHandler() func(cmd *cobra.Command, args []string) error {
 	return func(cmd *cobra.Command, args []string) error {
 		service := getServiceFromCommand(cmd)
 
-		login := getStringFlag(cmd, "login")
-		password := getStringFlag(cmd, "password")
-
-		err := service.Register(context.Background(), login, password)
+		err := service.Register(context.Background())
 		if err != nil {
 			return err
 		}
@@ -50,10 +49,31 @@ func createLoginHandler() func(cmd *cobra.Command, args []string) error {
 	}
 }
 
+func createLogoutHandler() func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		allSessions, _ := cmd.Flags().GetBool("all")
+
+		service := getServiceFromCommand(cmd)
+		revoked, err := service.Logout(context.Background(), allSessions)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("%d sessions ended\n", revoked)
+
+		return nil
+	}
+}
+
 func createSyncHandler() func(cmd *cobra.Command, args []string) error {
 	return func(cmd *cobra.Command, args []string) error {
+		resolution, err := models.ParseResolution(getStringFlag(cmd, "resolve"))
+		if err != nil {
+			return err
+		}
+
 		service := getServiceFromCommand(cmd)
-		err := service.SyncSecrets(context.Background())
+		err = service.SyncSecrets(context.Background(), createConflictResolver(cmd, resolution))
 		if err != nil {
 			return err
 		}
@@ -77,42 +97,9 @@ func createSecretHandler(secretType string) func(cmd *cobra.Command, args []stri
 			Metadata: getStringFlag(cmd, "metadata"),
 		}
 
-		var data models.SecretData
-		switch secretType {
-		case models.SecretTypePassword:
-			data = models.LoginData{
-				Username: getStringFlag(cmd, "username"),
-				Password: getStringFlag(cmd, "password"),
-				URL:      getStringFlag(cmd, "url"),
-			}
-		case models.SecretTypeText:
-			data = models.TextData{
-				Content: getStringFlag(cmd, "content"),
-			}
-		case models.SecretTypeBinary:
-			filePath := getStringFlag(cmd, "file")
-			checker := filecheckerutils.NewFileChecker()
-			if err := checker.CheckFileSize(filePath, models.MaxFileSize); err != nil {
-				return err
-			}
-			content, err := os.ReadFile(filePath)
-			if err != nil {
-				return fmt.Errorf("failed to read file: %w", err)
-			}
-			data = models.FileData{
-				FileName: filepath.Base(filePath),
-				FileSize: int64(len(content)),
-				Content:  base64.StdEncoding.EncodeToString(content),
-			}
-		case models.SecretTypeCard:
-			data = models.CardData{
-				Number: getStringFlag(cmd, "number"),
-				Holder: getStringFlag(cmd, "holder"),
-				Expiry: getStringFlag(cmd, "expiry"),
-				CVV:    getStringFlag(cmd, "cvv"),
-			}
-		default:
-			return fmt.Errorf("unsupported secret type: %s", secretType)
+		data, err := buildSecretData(cmd, secretType, nil)
+		if err != nil {
+			return err
 		}
 
 		service := getServiceFromCommand(cmd)
@@ -131,14 +118,179 @@ func createSecretHandler(secretType string) func(cmd *cobra.Command, args []stri
 	}
 }
 
+func createSecretEditCommand(secretType string) *cobra.Command {
+	return &cobra.Command{
+		Use:   fmt.Sprintf("%s [name]", secretType),
+		Short: fmt.Sprintf("Edit %s secret", secretType),
+		Args:  cobra.ExactArgs(1),
+		Run:   withErrorHandling(createSecretEditHandler(secretType)),
+	}
+}
+
+func createSecretEditHandler(secretType string) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+
+		var metadata *string
+		if clear, _ := cmd.Flags().GetBool("clear-metadata"); clear {
+			metadata = new(string)
+		} else if cmd.Flags().Changed("metadata") {
+			value := getStringFlag(cmd, "metadata")
+			metadata = &value
+		}
+
+		service := getServiceFromCommand(cmd)
+
+		editedSecret, err := service.EditSecret(context.Background(), name, secretType, metadata,
+			func(current models.SecretData) (models.SecretData, error) {
+				return buildSecretData(cmd, secretType, current)
+			})
+		if err != nil {
+			return err
+		}
+
+		return displaySecret(editedSecret, false)
+	}
+}
+
+// buildSecretData заполняет данные секрета из флагов, не указанные флаги сохраняют значения из current
+func buildSecretData(cmd *cobra.Command, secretType string, current models.SecretData) (models.SecretData, error) {
+	switch secretType {
+	case models.SecretTypePassword:
+		data, _ := current.(models.LoginData)
+		data.Username = getChangedStringFlag(cmd, "username", data.Username)
+		data.Password = getChangedStringFlag(cmd, "password", data.Password)
+		data.URL = getChangedStringFlag(cmd, "url", data.URL)
+		return data, nil
+
+	case models.SecretTypeText:
+		data, _ := current.(models.TextData)
+		data.Content = getChangedStringFlag(cmd, "content", data.Content)
+		return data, nil
+
+	case models.SecretTypeBinary:
+		data, _ := current.(models.FileData)
+		if !cmd.Flags().Changed("file") {
+			return data, nil
+		}
+
+		filePath := getStringFlag(cmd, "file")
+		checker := filecheckerutils.NewFileChecker()
+		if err := checker.CheckFileSize(filePath, models.MaxFileSize); err != nil {
+			return nil, err
+		}
+		content, err := os.ReadFile(filePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file: %w", err)
+		}
+		return models.FileData{
+			FileName: filepath.Base(filePath),
+			FileSize: int64(len(content)),
+			Content:  base64.StdEncoding.EncodeToString(content),
+		}, nil
+
+	case models.SecretTypeCard:
+		data, _ := current.(models.CardData)
+		data.Number = getChangedStringFlag(cmd, "number", data.Number)
+		data.Holder = getChangedStringFlag(cmd, "holder", data.Holder)
+		data.Expiry = getChangedStringFlag(cmd, "expiry", data.Expiry)
+		data.CVV = getChangedStringFlag(cmd, "cvv", data.CVV)
+		return data, nil
+
+	case models.SecretTypeOTP:
+		data, _ := current.(models.OTPData)
+		if cmd.Flags().Changed("uri") {
+			var err error
+			if data, err = models.ParseOTPURI(getStringFlag(cmd, "uri")); err != nil {
+				return nil, err
+			}
+		}
+
+		data.Type = getChangedStringFlag(cmd, "type", data.Type)
+		data.Issuer = getChangedStringFlag(cmd, "issuer", data.Issuer)
+		data.Account = getChangedStringFlag(cmd, "account", data.Account)
+		data.Secret = getChangedStringFlag(cmd, "secret", data.Secret)
+		data.Algorithm = getChangedStringFlag(cmd, "algorithm", data.Algorithm)
+		if cmd.Flags().Changed("digits") {
+			data.Digits, _ = cmd.Flags().GetInt("digits")
+		}
+		if cmd.Flags().Changed("period") {
+			data.Period, _ = cmd.Flags().GetInt("period")
+		}
+		if cmd.Flags().Changed("counter") {
+			data.Counter, _ = cmd.Flags().GetUint64("counter")
+		}
+		return data.WithDefaults(), nil
+
+	case models.SecretTypeSSHKey:
+		data, _ := current.(models.SSHKeyData)
+		if cmd.Flags().Changed("private-key-file") {
+			privateKey, err := readKeyFile(getStringFlag(cmd, "private-key-file"))
+			if err != nil {
+				return nil, err
+			}
+			// открытый ключ и отпечаток прежнего ключа к новому не относятся
+			data = models.SSHKeyData{PrivateKey: privateKey}
+		}
+		if cmd.Flags().Changed("public-key-file") {
+			publicKey, err := readKeyFile(getStringFlag(cmd, "public-key-file"))
+			if err != nil {
+				return nil, err
+			}
+			data.PublicKey = strings.TrimSpace(publicKey)
+		}
+		data.Passphrase = getChangedStringFlag(cmd, "passphrase", data.Passphrase)
+
+		data, err := data.WithDerivedFields()
+		if err != nil {
+			return nil, err
+		}
+		return data, nil
+
+	case models.SecretTypeAPIToken:
+		data, _ := current.(models.APITokenData)
+		data.Token = getChangedStringFlag(cmd, "token", data.Token)
+		if cmd.Flags().Changed("scope") {
+			data.Scopes, _ = cmd.Flags().GetStringSlice("scope")
+		}
+		if cmd.Flags().Changed("expires") {
+			var err error
+			if data.ExpiresAt, err = models.ParseTokenExpiry(getStringFlag(cmd, "expires")); err != nil {
+				return nil, err
+			}
+		}
+		return data, nil
+
+	case models.SecretTypeIdentity:
+		data, _ := current.(models.IdentityData)
+		data.FullName = getChangedStringFlag(cmd, "full-name", data.FullName)
+		data.Address = getChangedStringFlag(cmd, "address", data.Address)
+		if cmd.Flags().Changed("document") {
+			values, _ := cmd.Flags().GetStringArray("document")
+			data.Documents = make([]models.IdentityDocument, 0, len(values))
+			for _, value := range values {
+				document, err := models.ParseIdentityDocument(value)
+				if err != nil {
+					return nil, err
+				}
+				data.Documents = append(data.Documents, document)
+			}
+		}
+		return data, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported secret type: %s", secretType)
+	}
+}
+
 func createSecretGetCommand() func(cmd *cobra.Command, args []string) error {
 	return func(cmd *cobra.Command, args []string) error {
-		uuid := args[0]
+		name := args[0]
 		full, _ := cmd.Flags().GetBool("full")
 
 		service := getServiceFromCommand(cmd)
 
-		secret, err := service.ReadSecret(context.Background(), uuid)
+		secret, err := service.ReadSecret(context.Background(), name)
 		if err != nil {
 			return err
 		}
@@ -152,16 +304,47 @@ func createSecretGetCommand() func(cmd *cobra.Command, args []string) error {
 	}
 }
 
+// createOTPCommand текущий код TOTP и сколько он еще действует или следующий код HOTP
+func createOTPCommand() func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+
+		service := getServiceFromCommand(cmd)
+		code, err := service.GenerateOTP(context.Background(), name)
+		if code != nil {
+			displayOTPCode(code)
+		}
+
+		return err
+	}
+}
+
 func createSecretDeleteCommand() func(cmd *cobra.Command, args []string) error {
 	return func(cmd *cobra.Command, args []string) error {
-		uuid := args[0]
+		name := args[0]
+
+		service := getServiceFromCommand(cmd)
+		err := service.DeleteSecret(context.Background(), name)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	}
+}
+
+func createSecretRenameCommand() func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		name, newName := args[0], args[1]
 
 		service := getServiceFromCommand(cmd)
-		err := service.DeleteSecret(context.Background(), uuid)
+		secret, err := service.RenameSecret(context.Background(), name, newName)
 		if err != nil {
 			return err
 		}
 
+		fmt.Printf("Secret '%s' renamed to '%s'\n", name, secret.Name)
+
 		return nil
 	}
 }
@@ -180,3 +363,272 @@ func createSecretsListCommand() func(cmd *cobra.Command, args []string) error {
 		return nil
 	}
 }
+
+func createSecretHistoryCommand() func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+
+		service := getServiceFromCommand(cmd)
+		versions, err := service.ListSecretVersions(context.Background(), name)
+		if err != nil {
+			return err
+		}
+
+		displaySecretVersions(versions)
+
+		return nil
+	}
+}
+
+func createSecretRestoreCommand() func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		version, _ := cmd.Flags().GetInt64("version")
+
+		service := getServiceFromCommand(cmd)
+		secret, err := service.RestoreSecret(context.Background(), name, version)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Secret '%s' restored from version %d\n", name, version)
+
+		return displaySecret(secret, false)
+	}
+}
+
+func createTrashListCommand() func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+
+		service := getServiceFromCommand(cmd)
+		secrets, err := service.ListDeletedSecrets(context.Background())
+		if err != nil {
+			return err
+		}
+
+		displayDeletedSecrets(secrets)
+
+		return nil
+	}
+}
+
+func createTrashPurgeCommand() func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+
+		service := getServiceFromCommand(cmd)
+		purged, err := service.PurgeDeletedSecrets(context.Background())
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("%d secrets deleted permanently\n", purged)
+
+		return nil
+	}
+}
+
+func createDevicesListCommand() func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+
+		service := getServiceFromCommand(cmd)
+		devices, err := service.ListDevices(context.Background())
+		if err != nil {
+			return err
+		}
+
+		displayDevices(devices)
+
+		return nil
+	}
+}
+
+func createDeviceRevokeCommand() func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+
+		service := getServiceFromCommand(cmd)
+		revoked, err := service.RevokeDevice(context.Background(), args[0])
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Device revoked, %d sessions ended\n", revoked)
+
+		return nil
+	}
+}
+
+// createTwoFactorEnableCommand показывает otpauth URI для приложения-аутентификатора
+// и включает второй фактор после проверки первого кода из приложения
+func createTwoFactorEnableCommand() func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+
+		service := getServiceFromCommand(cmd)
+		secret, uri, err := service.EnableTwoFactor(context.Background())
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("Add this key to your authenticator app:")
+		fmt.Printf("  %s\n", uri)
+		fmt.Printf("Secret for manual entry: %s\n", secret)
+
+		code, err := readFlagOrPrompt(cmd, "code", "Code from the app: ")
+		if err != nil {
+			return err
+		}
+
+		recoveryCodes, err := service.ConfirmTwoFactor(context.Background(), code)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("Two-factor authentication enabled")
+		displayRecoveryCodes(recoveryCodes)
+
+		return nil
+	}
+}
+
+func createTwoFactorDisableCommand() func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+
+		code, err := readFlagOrPrompt(cmd, "code", "Code from the app or recovery code: ")
+		if err != nil {
+			return err
+		}
+
+		service := getServiceFromCommand(cmd)
+		if err = service.DisableTwoFactor(context.Background(), code); err != nil {
+			return err
+		}
+
+		fmt.Println("Two-factor authentication disabled")
+
+		return nil
+	}
+}
+
+func createTwoFactorStatusCommand() func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+
+		service := getServiceFromCommand(cmd)
+		twoFactorStatus, err := service.GetTwoFactorStatus(context.Background())
+		if err != nil {
+			return err
+		}
+
+		displayTwoFactorStatus(twoFactorStatus)
+
+		return nil
+	}
+}
+
+// readFlagOrPrompt значение флага, а если он не указан - строка из стандартного ввода
+func readFlagOrPrompt(cmd *cobra.Command, flag, prompt string) (string, error) {
+
+	if value := getStringFlag(cmd, flag); value != "" {
+		return value, nil
+	}
+
+	fmt.Print(prompt)
+	answer, err := bufio.NewReader(cmd.InOrStdin()).ReadString('\n')
+	if err != nil && answer == "" {
+		return "", fmt.Errorf("failed to read %s: %w", flag, err)
+	}
+
+	return strings.TrimSpace(answer), nil
+}
+
+func createSecretUndeleteCommand() func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+
+		service := getServiceFromCommand(cmd)
+		secret, err := service.UndeleteSecret(context.Background(), name)
+		if err != nil {
+			return err
+		}
+
+		return displaySecret(secret, false)
+	}
+}
+
+func createPasswdHandler() func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+
+		service := getServiceFromCommand(cmd)
+		err := service.ChangeMasterPassword(context.Background(), getStringFlag(cmd, "new-password"))
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("Master password changed, update KEEPER_PASSWORD")
+
+		return nil
+	}
+}
+
+func createRotateKeyHandler() func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+
+		service := getServiceFromCommand(cmd)
+		rotated, err := service.RotateVaultKey(context.Background())
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Vault key rotated, %d records re-encrypted\n", rotated)
+
+		return nil
+	}
+}
+
+func createUpgradeKDFHandler() func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+
+		service := getServiceFromCommand(cmd)
+		upgraded, err := service.UpgradeKDF(context.Background())
+		if err != nil {
+			return err
+		}
+
+		if !upgraded {
+			fmt.Println("Key derivation parameters are up to date")
+			return nil
+		}
+		fmt.Println("Key derivation parameters upgraded")
+
+		return nil
+	}
+}
+
+// createConflictResolver для ask спрашивает пользователя, для остальных режимов всегда возвращает выбранный
+func createConflictResolver(cmd *cobra.Command, resolution models.Resolution) models.ConflictResolver {
+	if resolution != models.ResolutionAsk {
+		return func(local, remote *models.LocalSecret) (models.Resolution, error) {
+			return resolution, nil
+		}
+	}
+
+	reader := bufio.NewReader(cmd.InOrStdin())
+	return func(local, remote *models.LocalSecret) (models.Resolution, error) {
+		displayConflict(local, remote)
+
+		for {
+			fmt.Print("Keep [l]ocal, [r]emote or [b]oth versions? ")
+			answer, err := reader.ReadString('\n')
+			if err != nil && answer == "" {
+				return "", fmt.Errorf("failed to read answer: %w", err)
+			}
+
+			switch strings.ToLower(strings.TrimSpace(answer)) {
+			case "l", "local":
+				return models.ResolutionLocal, nil
+			case "r", "remote":
+				return models.ResolutionRemote, nil
+			case "b", "both", "keep-both":
+				return models.ResolutionKeepBoth, nil
+			}
+		}
+	}
+}
@@ -2,8 +2,11 @@ package cmds
 
 import (
 	"fmt"
+	"github.com/s-turchinskiy/keeper/internal/client/models"
 	"github.com/s-turchinskiy/keeper/internal/client/service"
+	"github.com/s-turchinskiy/keeper/internal/utils/filecheckerutils"
 	"log"
+	"os"
 
 	"github.com/spf13/cobra"
 )
@@ -34,13 +37,120 @@ func setFlags() {
 	addCardCmd.Flags().String("metadata", "", "Metadata (optional)")
 	markFlagsRequired(addCardCmd, "name", "number", "holder", "expiry", "cvv")
 
+	addOTPCmd.Flags().String("name", "", "Secret name (required)")
+	addOTPCmd.Flags().String("metadata", "", "Metadata (optional)")
+	setOTPFlags(addOTPCmd)
+	markFlagsRequired(addOTPCmd, "name")
+	addOTPCmd.MarkFlagsOneRequired("uri", "secret")
+
+	addSSHKeyCmd.Flags().String("name", "", "Secret name (required)")
+	addSSHKeyCmd.Flags().String("metadata", "", "Metadata (optional)")
+	setSSHKeyFlags(addSSHKeyCmd)
+	markFlagsRequired(addSSHKeyCmd, "name", "private-key-file")
+
+	addAPITokenCmd.Flags().String("name", "", "Secret name (required)")
+	addAPITokenCmd.Flags().String("metadata", "", "Metadata (optional)")
+	setAPITokenFlags(addAPITokenCmd)
+	markFlagsRequired(addAPITokenCmd, "name", "token")
+
+	addIdentityCmd.Flags().String("name", "", "Secret name (required)")
+	addIdentityCmd.Flags().String("metadata", "", "Metadata (optional)")
+	setIdentityFlags(addIdentityCmd)
+	markFlagsRequired(addIdentityCmd, "name", "full-name")
+
 	getCmd.Flags().Bool("full", false, "Show all data including passwords/CVV")
 	getCmd.Flags().String("export", "", "Export to file path")
 
+	restoreCmd.Flags().Int64("version", 0, "Version number from history (required)")
+	markFlagsRequired(restoreCmd, "version")
+
+	logoutCmd.Flags().Bool("all", false, "End sessions of all devices, e.g. after a device is lost")
+
+	passwdCmd.Flags().String("new-password", "", "New master password (required)")
+	markFlagsRequired(passwdCmd, "new-password")
+
+	syncCmd.Flags().String("resolve", string(models.ResolutionAsk), "Conflict resolution: ask, local, remote or keep-both")
+
 	addCmd.AddCommand(addPasswordCmd)
 	addCmd.AddCommand(addTextCmd)
 	addCmd.AddCommand(addBinaryCmd)
 	addCmd.AddCommand(addCardCmd)
+	addCmd.AddCommand(addOTPCmd)
+	addCmd.AddCommand(addSSHKeyCmd)
+	addCmd.AddCommand(addAPITokenCmd)
+	addCmd.AddCommand(addIdentityCmd)
+
+	editPasswordCmd.Flags().String("username", "", "Username")
+	editPasswordCmd.Flags().String("password", "", "Password")
+	editPasswordCmd.Flags().String("url", "", "URL")
+
+	editTextCmd.Flags().String("content", "", "Text content")
+
+	editBinaryCmd.Flags().String("file", "", "File path")
+
+	editCardCmd.Flags().String("number", "", "Card number")
+	editCardCmd.Flags().String("holder", "", "Card holder name")
+	editCardCmd.Flags().String("expiry", "", "Expiry date")
+	editCardCmd.Flags().String("cvv", "", "CVV code")
+
+	setOTPFlags(editOTPCmd)
+	setSSHKeyFlags(editSSHKeyCmd)
+	setAPITokenFlags(editAPITokenCmd)
+	setIdentityFlags(editIdentityCmd)
+
+	for _, cmd := range []*cobra.Command{editPasswordCmd, editTextCmd, editBinaryCmd, editCardCmd, editOTPCmd,
+		editSSHKeyCmd, editAPITokenCmd, editIdentityCmd} {
+		cmd.Flags().String("metadata", "", "New metadata")
+		cmd.Flags().Bool("clear-metadata", false, "Remove metadata")
+		cmd.MarkFlagsMutuallyExclusive("metadata", "clear-metadata")
+		editCmd.AddCommand(cmd)
+	}
+
+	trashCmd.AddCommand(trashListCmd)
+	trashCmd.AddCommand(trashPurgeCmd)
+
+	devicesCmd.AddCommand(devicesListCmd)
+	devicesCmd.AddCommand(devicesRevokeCmd)
+
+	twoFactorEnableCmd.Flags().String("code", "", "Code from the authenticator app, asked interactively if not set")
+	twoFactorDisableCmd.Flags().String("code", "", "Code from the authenticator app or a recovery code, asked interactively if not set")
+
+	twoFactorCmd.AddCommand(twoFactorEnableCmd)
+	twoFactorCmd.AddCommand(twoFactorDisableCmd)
+	twoFactorCmd.AddCommand(twoFactorStatusCmd)
+}
+
+// setOTPFlags ключ задается otpauth:// URI или отдельными полями, поля уточняют URI
+func setOTPFlags(cmd *cobra.Command) {
+	cmd.Flags().String("uri", "", "Key as otpauth:// URI, e.g. from a QR code")
+	cmd.Flags().String("type", "", "totp or hotp (default totp)")
+	cmd.Flags().String("issuer", "", "Issuer, e.g. service name")
+	cmd.Flags().String("account", "", "Account name")
+	cmd.Flags().String("secret", "", "Secret key in base32")
+	cmd.Flags().String("algorithm", "", "SHA1, SHA256 or SHA512 (default SHA1)")
+	cmd.Flags().Int("digits", 0, "Code length, 6 to 8 (default 6)")
+	cmd.Flags().Int("period", 0, "TOTP code lifetime in seconds (default 30)")
+	cmd.Flags().Uint64("counter", 0, "HOTP counter of the next code")
+}
+
+// setSSHKeyFlags ключи читаются из файлов, открытый ключ по умолчанию выводится из закрытого
+func setSSHKeyFlags(cmd *cobra.Command) {
+	cmd.Flags().String("private-key-file", "", "Private key file, e.g. ~/.ssh/id_ed25519")
+	cmd.Flags().String("public-key-file", "", "Public key file, derived from the private key if not set")
+	cmd.Flags().String("passphrase", "", "Passphrase of an encrypted private key")
+}
+
+func setAPITokenFlags(cmd *cobra.Command) {
+	cmd.Flags().String("token", "", "API token")
+	cmd.Flags().StringSlice("scope", nil, "Token scopes, repeat the flag or separate with commas")
+	cmd.Flags().String("expires", "", "Expiry as YYYY-MM-DD or RFC 3339, empty - no expiry")
+}
+
+// setIdentityFlags документы задаются парами type=number, в edit заменяют все документы
+func setIdentityFlags(cmd *cobra.Command) {
+	cmd.Flags().String("full-name", "", "Full name")
+	cmd.Flags().String("address", "", "Address")
+	cmd.Flags().StringArray("document", nil, "Document as type=number, e.g. passport=4509 123456, repeat for several")
 }
 
 func markFlagsRequired(cmd *cobra.Command, flags ...string) {
@@ -55,11 +165,24 @@ func addCommands(rootCmd *cobra.Command) {
 	rootCmd.AddCommand(versionCmd)
 	rootCmd.AddCommand(registerCmd)
 	rootCmd.AddCommand(loginCmd)
+	rootCmd.AddCommand(logoutCmd)
 	rootCmd.AddCommand(addCmd)
 	rootCmd.AddCommand(getCmd)
+	rootCmd.AddCommand(otpCmd)
+	rootCmd.AddCommand(editCmd)
 	rootCmd.AddCommand(deleteCmd)
+	rootCmd.AddCommand(renameCmd)
 	rootCmd.AddCommand(listCmd)
 	rootCmd.AddCommand(syncCmd)
+	rootCmd.AddCommand(historyCmd)
+	rootCmd.AddCommand(restoreCmd)
+	rootCmd.AddCommand(trashCmd)
+	rootCmd.AddCommand(devicesCmd)
+	rootCmd.AddCommand(twoFactorCmd)
+	rootCmd.AddCommand(undeleteCmd)
+	rootCmd.AddCommand(passwdCmd)
+	rootCmd.AddCommand(rotateKeyCmd)
+	rootCmd.AddCommand(upgradeKDFCmd)
 }
 
 func getServiceFromCommand(cmd *cobra.Command) service.Servicer {
@@ -76,6 +199,29 @@ func getStringFlag(cmd *cobra.Command, name string) string {
 	return value
 }
 
+// readKeyFile содержимое файла ключа SSH не больше models.MaxSSHKeySize
+func readKeyFile(path string) (string, error) {
+	checker := filecheckerutils.NewFileChecker()
+	if err := checker.CheckFileSize(path, models.MaxSSHKeySize); err != nil {
+		return "", err
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read key file: %w", err)
+	}
+
+	return string(content), nil
+}
+
+// getChangedStringFlag значение флага, если он указан, иначе current
+func getChangedStringFlag(cmd *cobra.Command, name, current string) string {
+	if !cmd.Flags().Changed(name) {
+		return current
+	}
+	return getStringFlag(cmd, name)
+}
+
 func withErrorHandling(fn func(cmd *cobra.Command, args []string) error) func(cmd *cobra.Command, args []string) {
 	return func(cmd *cobra.Command, args []string) {
 		err := fn(cmd, args)
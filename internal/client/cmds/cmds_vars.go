@@ -23,6 +23,12 @@ var loginCmd = &cobra.Command{
 	Run:   withErrorHandling(createLoginHandler()),
 }
 
+var logoutCmd = &cobra.Command{
+	Use:   "logout",
+	Short: "End the session on the server",
+	Run:   withErrorHandling(createLogoutHandler()),
+}
+
 var syncCmd = &cobra.Command{
 	Use:   "sync",
 	Short: "Sync with remote repository",
@@ -38,23 +44,152 @@ var addPasswordCmd = createSecretAddCommand(models.SecretTypePassword)
 var addTextCmd = createSecretAddCommand(models.SecretTypeText)
 var addBinaryCmd = createSecretAddCommand(models.SecretTypeBinary)
 var addCardCmd = createSecretAddCommand(models.SecretTypeCard)
+var addOTPCmd = createSecretAddCommand(models.SecretTypeOTP)
+var addSSHKeyCmd = createSecretAddCommand(models.SecretTypeSSHKey)
+var addAPITokenCmd = createSecretAddCommand(models.SecretTypeAPIToken)
+var addIdentityCmd = createSecretAddCommand(models.SecretTypeIdentity)
+
+var editCmd = &cobra.Command{
+	Use:   "edit",
+	Short: "Edit an existing secret",
+}
+
+var editPasswordCmd = createSecretEditCommand(models.SecretTypePassword)
+var editTextCmd = createSecretEditCommand(models.SecretTypeText)
+var editBinaryCmd = createSecretEditCommand(models.SecretTypeBinary)
+var editCardCmd = createSecretEditCommand(models.SecretTypeCard)
+var editOTPCmd = createSecretEditCommand(models.SecretTypeOTP)
+var editSSHKeyCmd = createSecretEditCommand(models.SecretTypeSSHKey)
+var editAPITokenCmd = createSecretEditCommand(models.SecretTypeAPIToken)
+var editIdentityCmd = createSecretEditCommand(models.SecretTypeIdentity)
 
 var getCmd = &cobra.Command{
-	Use:   "get [uuid]",
-	Short: "Get secret by UUID",
+	Use:   "get [name]",
+	Short: "Get secret by name",
 	Args:  cobra.ExactArgs(1),
 	Run:   withErrorHandling(createSecretGetCommand()),
 }
 
 var deleteCmd = &cobra.Command{
-	Use:   "delete [uuid]",
-	Short: "Delete secret by UUID",
+	Use:   "delete [name]",
+	Short: "Delete secret by name",
 	Args:  cobra.ExactArgs(1),
 	Run:   withErrorHandling(createSecretDeleteCommand()),
 }
 
+var renameCmd = &cobra.Command{
+	Use:   "rename [old name] [new name]",
+	Short: "Rename secret",
+	Args:  cobra.ExactArgs(2),
+	Run:   withErrorHandling(createSecretRenameCommand()),
+}
+
 var listCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List all secrets",
 	Run:   withErrorHandling(createSecretsListCommand()),
 }
+
+var historyCmd = &cobra.Command{
+	Use:   "history [name]",
+	Short: "List previous versions of secret",
+	Args:  cobra.ExactArgs(1),
+	Run:   withErrorHandling(createSecretHistoryCommand()),
+}
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore [name]",
+	Short: "Restore previous version of secret",
+	Args:  cobra.ExactArgs(1),
+	Run:   withErrorHandling(createSecretRestoreCommand()),
+}
+
+var trashCmd = &cobra.Command{
+	Use:   "trash",
+	Short: "Manage deleted secrets",
+}
+
+var trashListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List deleted secrets",
+	Run:   withErrorHandling(createTrashListCommand()),
+}
+
+var trashPurgeCmd = &cobra.Command{
+	Use:   "purge",
+	Short: "Permanently delete all secrets from trash",
+	Run:   withErrorHandling(createTrashPurgeCommand()),
+}
+
+var undeleteCmd = &cobra.Command{
+	Use:   "undelete [name]",
+	Short: "Restore secret from trash",
+	Args:  cobra.ExactArgs(1),
+	Run:   withErrorHandling(createSecretUndeleteCommand()),
+}
+
+var devicesCmd = &cobra.Command{
+	Use:   "devices",
+	Short: "Manage devices with access to the vault",
+}
+
+var devicesListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List devices with last seen time",
+	Run:   withErrorHandling(createDevicesListCommand()),
+}
+
+var devicesRevokeCmd = &cobra.Command{
+	Use:   "revoke [id]",
+	Short: "Revoke device and end its sessions",
+	Args:  cobra.ExactArgs(1),
+	Run:   withErrorHandling(createDeviceRevokeCommand()),
+}
+
+var otpCmd = &cobra.Command{
+	Use:   "otp [name]",
+	Short: "Show one-time password code",
+	Args:  cobra.ExactArgs(1),
+	Run:   withErrorHandling(createOTPCommand()),
+}
+
+var twoFactorCmd = &cobra.Command{
+	Use:   "2fa",
+	Short: "Manage two-factor authentication",
+}
+
+var twoFactorEnableCmd = &cobra.Command{
+	Use:   "enable",
+	Short: "Enable two-factor authentication",
+	Run:   withErrorHandling(createTwoFactorEnableCommand()),
+}
+
+var twoFactorDisableCmd = &cobra.Command{
+	Use:   "disable",
+	Short: "Disable two-factor authentication",
+	Run:   withErrorHandling(createTwoFactorDisableCommand()),
+}
+
+var twoFactorStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show two-factor authentication status",
+	Run:   withErrorHandling(createTwoFactorStatusCommand()),
+}
+
+var passwdCmd = &cobra.Command{
+	Use:   "passwd",
+	Short: "Change master password",
+	Run:   withErrorHandling(createPasswdHandler()),
+}
+
+var rotateKeyCmd = &cobra.Command{
+	Use:   "rotate-key",
+	Short: "Re-encrypt all secrets with a new vault key",
+	Run:   withErrorHandling(createRotateKeyHandler()),
+}
+
+var upgradeKDFCmd = &cobra.Command{
+	Use:   "upgrade-kdf",
+	Short: "Re-derive account keys with the configured Argon2id parameters",
+	Run:   withErrorHandling(createUpgradeKDFHandler()),
+}
@@ -3,6 +3,7 @@ package cmds
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/s-turchinskiy/keeper/internal/client/models"
 )
@@ -18,10 +19,104 @@ func displaySecrets(responses []*models.LocalSecret) {
 	fmt.Printf("%-12s %-12s %s\n", "Name", "Type", "Last Modified")
 	fmt.Println(strings.Repeat("-", 82))
 	for _, resp := range responses {
-		fmt.Printf("%-12s %-12s %s\n",
+		var conflict string
+		if resp.Conflicted {
+			conflict = "  conflict, run sync"
+		}
+		fmt.Printf("%-12s %-12s %s%s\n",
 			resp.Name,
 			resp.Type,
-			resp.LastModified.Local().Format(timeFormat))
+			resp.LastModified.Local().Format(timeFormat),
+			conflict)
+	}
+}
+
+func displaySecretVersions(versions []*models.SecretVersion) {
+	if len(versions) == 0 {
+		fmt.Println("No previous versions found")
+		return
+	}
+
+	fmt.Printf("%-8s %-20s %s\n", "Version", "Last Modified", "Hash")
+	fmt.Println(strings.Repeat("-", 82))
+	for _, version := range versions {
+		fmt.Printf("%-8d %-20s %s\n",
+			version.Version,
+			version.LastModified.Local().Format(timeFormat),
+			version.Hash)
+	}
+}
+
+func displayDeletedSecrets(secrets []*models.LocalSecret) {
+	if len(secrets) == 0 {
+		fmt.Println("Trash is empty")
+		return
+	}
+
+	fmt.Printf("%-24s %s\n", "Name", "Deleted")
+	fmt.Println(strings.Repeat("-", 82))
+	for _, secret := range secrets {
+		fmt.Printf("%-24s %s\n",
+			secret.Name,
+			secret.LastModified.Local().Format(timeFormat))
+	}
+}
+
+// displayDevices текущее устройство помечено звездочкой
+func displayDevices(devices []*models.Device) {
+	if len(devices) == 0 {
+		fmt.Println("No devices found")
+		return
+	}
+
+	fmt.Printf("  %-36s %-20s %-14s %-10s %-20s %s\n", "ID", "Name", "OS", "Version", "Last Seen", "Status")
+	fmt.Println(strings.Repeat("-", 120))
+	for _, device := range devices {
+		marker := " "
+		if device.Current {
+			marker = "*"
+		}
+
+		deviceStatus := "active"
+		if device.RevokedAt != nil {
+			deviceStatus = "revoked " + device.RevokedAt.Local().Format(timeFormat)
+		}
+
+		fmt.Printf("%s %-36s %-20s %-14s %-10s %-20s %s\n",
+			marker,
+			device.ID,
+			device.Name,
+			device.OS,
+			device.ClientVersion,
+			device.LastSeenAt.Local().Format(timeFormat),
+			deviceStatus)
+	}
+}
+
+// displayRecoveryCodes коды показываются один раз, сервер хранит только их хеши
+func displayRecoveryCodes(codes []string) {
+	fmt.Println("Recovery codes, each works once instead of a code from the app. Store them in a safe place:")
+	for _, code := range codes {
+		fmt.Printf("  %s\n", code)
+	}
+}
+
+func displayOTPCode(code *models.OTPCode) {
+	if code.Remaining > 0 {
+		fmt.Printf("%s (valid for %d seconds)\n", code.Code, int(code.Remaining/time.Second))
+		return
+	}
+	fmt.Printf("%s (counter %d)\n", code.Code, code.Counter)
+}
+
+func displayTwoFactorStatus(twoFactorStatus *models.TwoFactorStatus) {
+	switch {
+	case twoFactorStatus.Enabled:
+		fmt.Printf("Two-factor authentication: enabled, %d recovery codes left\n", twoFactorStatus.RecoveryCodesLeft)
+	case twoFactorStatus.Pending:
+		fmt.Println("Two-factor authentication: not confirmed, run 2fa enable again")
+	default:
+		fmt.Println("Two-factor authentication: disabled")
 	}
 }
 
@@ -69,9 +164,97 @@ func displaySecret(secret *models.LocalSecret, full bool) error {
 			fmt.Printf("CVV: ***\n")
 		}
 
+	case models.OTPData:
+		fmt.Printf("OTP Type: %s\n", data.Type)
+		if data.Issuer != "" {
+			fmt.Printf("Issuer: %s\n", data.Issuer)
+		}
+		fmt.Printf("Account: %s\n", data.Account)
+		fmt.Printf("Algorithm: %s, %d digits\n", data.Algorithm, data.Digits)
+		if data.IsHOTP() {
+			fmt.Printf("Counter: %d\n", data.Counter)
+		} else {
+			fmt.Printf("Period: %d seconds\n", data.Period)
+		}
+		if full {
+			fmt.Printf("Secret: %s\n", data.Secret)
+		} else {
+			fmt.Printf("Secret: ********\n")
+		}
+
+	case models.SSHKeyData:
+		if keyType := data.KeyType(); keyType != "" {
+			fmt.Printf("Key Type: %s\n", keyType)
+		}
+		fmt.Printf("Fingerprint: %s\n", data.Fingerprint)
+		fmt.Printf("Public Key: %s\n", data.PublicKey)
+		if full {
+			fmt.Printf("Private Key:\n%s\n", strings.TrimRight(data.PrivateKey, "\n"))
+			if data.Passphrase != "" {
+				fmt.Printf("Passphrase: %s\n", data.Passphrase)
+			}
+		} else {
+			fmt.Printf("Private Key: ********\n")
+			if data.Passphrase != "" {
+				fmt.Printf("Passphrase: ********\n")
+			}
+		}
+
+	case models.APITokenData:
+		if full {
+			fmt.Printf("Token: %s\n", data.Token)
+		} else {
+			fmt.Printf("Token: ********\n")
+		}
+		if len(data.Scopes) > 0 {
+			fmt.Printf("Scopes: %s\n", strings.Join(data.Scopes, ", "))
+		}
+		switch {
+		case data.ExpiresAt == nil:
+			fmt.Printf("Expires: never\n")
+		case data.Expired(time.Now()):
+			fmt.Printf("Expires: %s (expired)\n", data.ExpiresAt.Local().Format(timeFormat))
+		default:
+			fmt.Printf("Expires: %s\n", data.ExpiresAt.Local().Format(timeFormat))
+		}
+
+	case models.IdentityData:
+		fmt.Printf("Full Name: %s\n", data.FullName)
+		if data.Address != "" {
+			fmt.Printf("Address: %s\n", data.Address)
+		}
+		for _, document := range data.Documents {
+			if full {
+				fmt.Printf("Document %s: %s\n", document.Type, document.Number)
+			} else {
+				fmt.Printf("Document %s: %s\n", document.Type, document.MaskedNumber())
+			}
+		}
+
 	default:
 		return fmt.Errorf("unknown data type: %T", data)
 	}
 
 	return nil
 }
+
+func displayConflict(local, remote *models.LocalSecret) {
+	fmt.Printf("Conflict in secret '%s'\n", local.Name)
+	fmt.Println(strings.Repeat("-", 82))
+	fmt.Println("Local version:")
+	displayConflictVersion(local)
+	fmt.Println(strings.Repeat("-", 82))
+	fmt.Println("Remote version:")
+	if remote == nil {
+		fmt.Println("deleted on the server")
+	} else {
+		displayConflictVersion(remote)
+	}
+	fmt.Println(strings.Repeat("-", 82))
+}
+
+func displayConflictVersion(secret *models.LocalSecret) {
+	if err := displaySecret(secret, false); err != nil {
+		fmt.Printf("failed to display secret: %v\n", err)
+	}
+}
@@ -2,9 +2,29 @@ package config
 
 import (
 	"fmt"
+	"github.com/s-turchinskiy/keeper/internal/client/crypto"
 	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 )
 
+const (
+	SchemeMongoDB    = "mongodb://"
+	SchemeMongoDBSRV = "mongodb+srv://"
+	SchemeFile       = "file://"
+	SchemeMemory     = "mem://"
+)
+
+// EphemeralFlag флаг командной строки, с которым секреты хранятся только в памяти процесса
+const EphemeralFlag = "--ephemeral"
+
+var dbSchemes = []string{SchemeMongoDB, SchemeMongoDBSRV, SchemeFile, SchemeMemory}
+
+// minKDFMemoryKiB меньше памяти для Argon2id не принимает сервер
+const minKDFMemoryKiB = 16 * 1024
+
 type OptionConfig func(*Config) error
 
 type Config struct {
@@ -12,6 +32,14 @@ type Config struct {
 	Login         string
 	Password      string
 	ServerAddress string
+	KDF           crypto.KDFParams
+	TwoFactorCode string // код второго фактора для входа без вопроса в терминале, KEEPER_2FA_CODE
+
+	TLS           bool   // подключаться к серверу по TLS
+	TLSCAFile     string // CA сервера в PEM, вместо системных корневых сертификатов
+	TLSServerName string // имя в сертификате сервера, если оно не совпадает с адресом подключения
+	TLSCertFile   string // сертификат клиента для mTLS
+	TLSKeyFile    string // закрытый ключ сертификата клиента
 }
 
 func LoadCfg(opts ...OptionConfig) (*Config, error) {
@@ -35,6 +63,7 @@ func LoadCfg(opts ...OptionConfig) (*Config, error) {
 		Login:         login,
 		Password:      password,
 		ServerAddress: serverAddress,
+		TwoFactorCode: os.Getenv("KEEPER_2FA_CODE"),
 	}
 
 	for _, opt := range opts {
@@ -47,13 +76,24 @@ func LoadCfg(opts ...OptionConfig) (*Config, error) {
 	return cfg, nil
 }
 
+// WithDB адрес локального хранилища, вид хранилища выбирается по схеме:
+// mongodb:// и mongodb+srv:// - MongoDB, file:// - встроенное файловое хранилище, mem:// - память процесса.
+// По умолчанию используется файл в каталоге настроек пользователя
 func WithDB() OptionConfig {
 
 	return func(c *Config) error {
 
 		dbURL := os.Getenv("KEEPER_CLIENT_DB_URL")
 		if dbURL == "" {
-			return fmt.Errorf("KEEPER_CLIENT_DB_URL environment variable is required")
+			configDir, err := os.UserConfigDir()
+			if err != nil {
+				return fmt.Errorf("KEEPER_CLIENT_DB_URL is not set and user config directory is unknown: %w", err)
+			}
+			dbURL = SchemeFile + filepath.Join(configDir, "keeper", "secrets.db")
+		}
+
+		if !slices.ContainsFunc(dbSchemes, func(scheme string) bool { return strings.HasPrefix(dbURL, scheme) }) {
+			return fmt.Errorf("KEEPER_CLIENT_DB_URL has unsupported scheme, expected one of %s", strings.Join(dbSchemes, ", "))
 		}
 
 		c.DBURL = dbURL
@@ -62,3 +102,86 @@ func WithDB() OptionConfig {
 
 	}
 }
+
+// WithEphemeral при флаге --ephemeral в аргументах заменяет локальное хранилище на хранилище в памяти,
+// указывается после WithDB
+func WithEphemeral(args []string) OptionConfig {
+
+	return func(c *Config) error {
+
+		if slices.Contains(args, EphemeralFlag) || slices.Contains(args, EphemeralFlag+"=true") {
+			c.DBURL = SchemeMemory
+		}
+
+		return nil
+	}
+}
+
+// WithKDF параметры Argon2id для новых учетных записей и повышения параметров существующих,
+// по умолчанию crypto.DefaultKDFParams
+func WithKDF() OptionConfig {
+
+	return func(c *Config) error {
+
+		c.KDF = crypto.DefaultKDFParams()
+
+		if value := os.Getenv("KEEPER_KDF_TIME"); value != "" {
+			valTyped, err := strconv.ParseUint(value, 10, 32)
+			if err != nil || valTyped == 0 {
+				return fmt.Errorf("KEEPER_KDF_TIME must be a positive number, got %q", value)
+			}
+			c.KDF.Time = uint32(valTyped)
+		}
+
+		if value := os.Getenv("KEEPER_KDF_MEMORY_KIB"); value != "" {
+			valTyped, err := strconv.ParseUint(value, 10, 32)
+			if err != nil || valTyped < minKDFMemoryKiB {
+				return fmt.Errorf("KEEPER_KDF_MEMORY_KIB must be at least %d, got %q", minKDFMemoryKiB, value)
+			}
+			c.KDF.MemoryKiB = uint32(valTyped)
+		}
+
+		if value := os.Getenv("KEEPER_KDF_THREADS"); value != "" {
+			valTyped, err := strconv.ParseUint(value, 10, 8)
+			if err != nil || valTyped == 0 {
+				return fmt.Errorf("KEEPER_KDF_THREADS must be a number from 1 to 255, got %q", value)
+			}
+			c.KDF.Threads = uint8(valTyped)
+		}
+
+		return nil
+	}
+}
+
+// WithTLS TLS подключения к серверу. Включается KEEPER_TLS=true или любым из файлов сертификатов,
+// без них соединение без шифрования. Файлы сертификатов вместе с KEEPER_TLS=false - ошибка настройки
+func WithTLS() OptionConfig {
+
+	return func(c *Config) error {
+
+		c.TLSCAFile = os.Getenv("KEEPER_TLS_CA_FILE")
+		c.TLSServerName = os.Getenv("KEEPER_TLS_SERVER_NAME")
+		c.TLSCertFile = os.Getenv("KEEPER_TLS_CERT_FILE")
+		c.TLSKeyFile = os.Getenv("KEEPER_TLS_KEY_FILE")
+
+		if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+			return fmt.Errorf("KEEPER_TLS_CERT_FILE and KEEPER_TLS_KEY_FILE must be set together")
+		}
+
+		tlsFiles := c.TLSCAFile != "" || c.TLSServerName != "" || c.TLSCertFile != ""
+		c.TLS = tlsFiles
+
+		if value := os.Getenv("KEEPER_TLS"); value != "" {
+			enabled, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("KEEPER_TLS must be true or false, got %q", value)
+			}
+			if !enabled && tlsFiles {
+				return fmt.Errorf("KEEPER_TLS=false, but KEEPER_TLS_CA_FILE, KEEPER_TLS_SERVER_NAME or KEEPER_TLS_CERT_FILE is set")
+			}
+			c.TLS = enabled
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,51 @@
+package config_test
+
+import (
+	"testing"
+
+	"github.com/s-turchinskiy/keeper/internal/client/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithTLS(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantTLS bool
+		wantErr bool
+	}{
+		{name: "plaintext by default"},
+		{name: "enabled", env: map[string]string{"KEEPER_TLS": "true"}, wantTLS: true},
+		{name: "enabled by CA file", env: map[string]string{"KEEPER_TLS_CA_FILE": "ca.pem"}, wantTLS: true},
+		{name: "enabled by client certificate",
+			env: map[string]string{"KEEPER_TLS_CERT_FILE": "client.pem", "KEEPER_TLS_KEY_FILE": "client.key"}, wantTLS: true},
+		{name: "certificate without key", env: map[string]string{"KEEPER_TLS_CERT_FILE": "client.pem"}, wantErr: true},
+		{name: "disabled with CA file",
+			env: map[string]string{"KEEPER_TLS": "false", "KEEPER_TLS_CA_FILE": "ca.pem"}, wantErr: true},
+		{name: "disabled with server name",
+			env: map[string]string{"KEEPER_TLS": "false", "KEEPER_TLS_SERVER_NAME": "keeper"}, wantErr: true},
+		{name: "disabled with client certificate",
+			env: map[string]string{"KEEPER_TLS": "0", "KEEPER_TLS_CERT_FILE": "client.pem", "KEEPER_TLS_KEY_FILE": "client.key"}, wantErr: true},
+		{name: "invalid flag", env: map[string]string{"KEEPER_TLS": "maybe"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("KEEPER_LOGIN", "user")
+			t.Setenv("KEEPER_PASSWORD", "password")
+			t.Setenv("KEEPER_SERVER_GRPC_ADDR", "localhost:3200")
+			for _, key := range []string{"KEEPER_TLS", "KEEPER_TLS_CA_FILE", "KEEPER_TLS_SERVER_NAME", "KEEPER_TLS_CERT_FILE", "KEEPER_TLS_KEY_FILE"} {
+				t.Setenv(key, tt.env[key])
+			}
+
+			cfg, err := config.LoadCfg(config.WithTLS())
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.wantTLS, cfg.TLS)
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/base64"
 	"fmt"
 	"io"
+	"sync"
 
 	"github.com/zeebo/blake3"
 	"golang.org/x/crypto/argon2"
@@ -12,21 +13,47 @@ import (
 )
 
 const (
-	storageSaltSize = 16
-	keySize         = chacha20poly1305.KeySize
+	keySize           = chacha20poly1305.KeySize
+	hashKeyContext    = "keeper secret hash key"
+	storageKeyContext = "keeper local storage key"
 )
 
+type OptionCryptor func(*CryptorImpl)
+
 type CryptorImpl struct {
 	masterPassword string
 	login          string
 	cachedKeys     map[string][]byte
+
+	mu        sync.Mutex
+	kdf       *KDFParams
+	kdfTarget KDFParams
+	account   *accountKeys
+
+	keyringMu sync.RWMutex
+	keyring   *vaultKeyring
 }
 
-func NewCryptor(masterPassword, login string) Cryptor {
-	return &CryptorImpl{
+func NewCryptor(masterPassword, login string, opts ...OptionCryptor) Cryptor {
+	c := &CryptorImpl{
 		masterPassword: masterPassword,
 		login:          login,
 		cachedKeys:     make(map[string][]byte),
+		kdfTarget:      DefaultKDFParams(),
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// WithKDFTarget параметры Argon2id для новых учетных записей и для повышения параметров существующих
+func WithKDFTarget(params KDFParams) OptionCryptor {
+	return func(c *CryptorImpl) {
+		c.kdfTarget = params
+		c.kdfTarget.Salt = nil
 	}
 }
 
@@ -44,65 +71,159 @@ func (c *CryptorImpl) getDeriveKey(salt []byte) []byte {
 }
 
 func (c *CryptorImpl) genDeriveKey(salt []byte) []byte {
+	return deriveKey(c.masterPassword, salt)
+}
+
+// deriveKey ключ Argon2id с параметрами, которые использовались до появления параметров учетной записи
+func deriveKey(masterPassword string, salt []byte) []byte {
 	key := argon2.IDKey(
-		[]byte(c.masterPassword),
+		[]byte(masterPassword),
 		salt,
-		3, 64*1024, 4, keySize,
+		legacyKDFParams.Time, legacyKDFParams.MemoryKiB, legacyKDFParams.Threads, keySize,
 	)
 	return key
 }
 
+// getSecretsKey ключ от мастер-пароля, которым секреты шифровались до появления ключа хранилища
 func (c *CryptorImpl) getSecretsKey() []byte {
 	salt := []byte(c.login + "|secrets")
 	return c.getDeriveKey(salt)
 }
 
+func (c *CryptorImpl) getHashKey() []byte {
+	if keyring := c.getKeyring(); keyring != nil {
+		return keyring.HashKey
+	}
+
+	return c.getLegacyHashKey()
+}
+
+// getStorageKey ключ локального хранилища выводится из ключа хеша: он не меняется ни при смене
+// мастер-пароля, ни при ротации ключа хранилища, поэтому локальные записи не нужно перешифровывать
+func (c *CryptorImpl) getStorageKey() ([]byte, error) {
+	keyring := c.getKeyring()
+	if keyring == nil {
+		return nil, fmt.Errorf("vault is locked")
+	}
+
+	key := make([]byte, keySize)
+	blake3.DeriveKey(storageKeyContext, keyring.HashKey, key)
+	return key, nil
+}
+
+func (c *CryptorImpl) getLegacyHashKey() []byte {
+	key := make([]byte, keySize)
+	blake3.DeriveKey(hashKeyContext, c.getSecretsKey(), key)
+	return key
+}
+
 func (c *CryptorImpl) getServerKey() []byte {
-	salt := []byte(c.login + "|server")
-	return c.genDeriveKey(salt)
+	return c.getAccountKeys().server
 }
 
-func (c *CryptorImpl) EncryptStorageData(plainData []byte) ([]byte, error) {
-	salt := make([]byte, storageSaltSize)
+// EncryptStorageData шифрует запись recordID локального хранилища ключом хранилища
+func (c *CryptorImpl) EncryptStorageData(recordID string, plainData []byte) ([]byte, error) {
+	key, err := c.getStorageKey()
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted, err := c.sealWithKey(plainData, key, storageAdditionalData(recordID))
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte{storageEnvelopeVersion}, encrypted...), nil
+}
 
-	if _, err := rand.Read(salt); err != nil {
-		return nil, fmt.Errorf("generate salt: %w", err)
+func (c *CryptorImpl) DecryptStorageData(recordID string, encryptedData []byte) ([]byte, error) {
+	if len(encryptedData) == 0 || encryptedData[0] != storageEnvelopeVersion {
+		return nil, fmt.Errorf("unsupported storage data format")
 	}
 
-	key := c.genDeriveKey(salt)
-	encrypted, err := c.encryptWithKey(plainData, key)
+	key, err := c.getStorageKey()
 	if err != nil {
 		return nil, err
 	}
 
-	return append(salt, encrypted...), nil
+	return c.openWithKey(encryptedData[1:], key, storageAdditionalData(recordID))
 }
 
-func (c *CryptorImpl) DecryptStorageData(encryptedData []byte) ([]byte, error) {
-	if len(encryptedData) < storageSaltSize {
-		return nil, fmt.Errorf("invalid encrypted data")
+// StorageIndex ключевой хеш value для поиска в локальном хранилище без расшифровки записей
+func (c *CryptorImpl) StorageIndex(value string) (string, error) {
+	key, err := c.getStorageKey()
+	if err != nil {
+		return "", err
 	}
 
-	salt := encryptedData[:storageSaltSize]
-	ciphertext := encryptedData[storageSaltSize:]
+	hasher, err := blake3.NewKeyed(key)
+	if err != nil {
+		return "", err
+	}
 
-	key := c.genDeriveKey(salt)
-	return c.decryptWithKey(ciphertext, key)
+	_, _ = hasher.Write([]byte(storageIndexContext))
+	_, _ = hasher.Write([]byte{0})
+	_, _ = hasher.Write([]byte(value))
+	return base64.StdEncoding.EncodeToString(hasher.Sum(nil)), nil
 }
 
-func (c *CryptorImpl) EncryptSecretData(plainData []byte) ([]byte, error) {
-	key := c.getSecretsKey()
-	return c.encryptWithKey(plainData, key)
+// EncryptSecretData шифрует данные секрета secretID в конверт текущей версии,
+// ID секрета и логин владельца входят в дополнительные данные AEAD
+func (c *CryptorImpl) EncryptSecretData(secretID string, plainData []byte) ([]byte, error) {
+	key := c.getDataKeys()[0]
+
+	encrypted, err := c.sealWithKey(plainData, key, secretAdditionalData(c.login, secretID))
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte{secretEnvelopeVersion}, encrypted...), nil
 }
 
-func (c *CryptorImpl) DecryptSecretData(encryptedData []byte) ([]byte, error) {
-	key := c.getSecretsKey()
-	return c.decryptWithKey(encryptedData, key)
+// DecryptSecretData перебирает ключи хранилища от нового к старому: версии в истории и корзине
+// могут быть зашифрованы ключом до ротации. Данные без конверта принимаются только для ключей,
+// которыми шифровали до его появления, и только пока секреты не перешифрованы в конверт (BindVaultKeys)
+func (c *CryptorImpl) DecryptSecretData(secretID string, encryptedData []byte) ([]byte, error) {
+	if len(encryptedData) == 0 {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+
+	additionalData := secretAdditionalData(c.login, secretID)
+	keys, boundKeys := c.getDataKeys(), c.getBoundKeys()
+
+	err := fmt.Errorf("decryption failed")
+	for i, key := range keys {
+		if encryptedData[0] == secretEnvelopeVersion {
+			plainData, openErr := c.openWithKey(encryptedData[1:], key, additionalData)
+			if openErr == nil {
+				return plainData, nil
+			}
+			err = openErr
+		}
+
+		if i < boundKeys {
+			continue
+		}
+
+		plainData, openErr := c.decryptWithKey(encryptedData, key)
+		if openErr == nil {
+			return plainData, nil
+		}
+		err = openErr
+	}
+
+	return nil, err
 }
 
-func (c *CryptorImpl) CalculateDataHash(encryptedData []byte) string {
-	hash := blake3.Sum256(encryptedData)
-	return base64.StdEncoding.EncodeToString(hash[:])
+// CalculateDataHash хеш с ключом от мастер-пароля, чтобы сервер не мог подбирать содержимое секретов по хешу
+func (c *CryptorImpl) CalculateDataHash(data []byte) string {
+	hasher, err := blake3.NewKeyed(c.getHashKey())
+	if err != nil {
+		panic(err)
+	}
+
+	_, _ = hasher.Write(data)
+	return base64.StdEncoding.EncodeToString(hasher.Sum(nil))
 }
 
 func (c *CryptorImpl) GenerateServerPassword() string {
@@ -110,7 +231,32 @@ func (c *CryptorImpl) GenerateServerPassword() string {
 	return base64.StdEncoding.EncodeToString(key)
 }
 
+func (c *CryptorImpl) getDataKeys() [][]byte {
+	if keyring := c.getKeyring(); keyring != nil {
+		return keyring.Keys
+	}
+
+	return [][]byte{c.getSecretsKey()}
+}
+
+func (c *CryptorImpl) getBoundKeys() int {
+	if keyring := c.getKeyring(); keyring != nil {
+		return keyring.BoundKeys
+	}
+
+	return 0
+}
+
 func (c *CryptorImpl) encryptWithKey(plainData, key []byte) ([]byte, error) {
+	return c.sealWithKey(plainData, key, nil)
+}
+
+func (c *CryptorImpl) decryptWithKey(encryptedData, key []byte) ([]byte, error) {
+	return c.openWithKey(encryptedData, key, nil)
+}
+
+// sealWithKey шифрует plainData, additionalData не шифруется, но проверяется при расшифровке
+func (c *CryptorImpl) sealWithKey(plainData, key, additionalData []byte) ([]byte, error) {
 	aead, err := chacha20poly1305.NewX(key)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create AEAD: %w", err)
@@ -121,11 +267,11 @@ func (c *CryptorImpl) encryptWithKey(plainData, key []byte) ([]byte, error) {
 		return nil, fmt.Errorf("failed to generate nonce: %w", err)
 	}
 
-	encrypted := aead.Seal(nonce, nonce, plainData, nil)
+	encrypted := aead.Seal(nonce, nonce, plainData, additionalData)
 	return encrypted, nil
 }
 
-func (c *CryptorImpl) decryptWithKey(encryptedData, key []byte) ([]byte, error) {
+func (c *CryptorImpl) openWithKey(encryptedData, key, additionalData []byte) ([]byte, error) {
 	aead, err := chacha20poly1305.NewX(key)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create AEAD: %w", err)
@@ -137,7 +283,7 @@ func (c *CryptorImpl) decryptWithKey(encryptedData, key []byte) ([]byte, error)
 	}
 
 	nonce, ciphertext := encryptedData[:nonceSize], encryptedData[nonceSize:]
-	plainData, err := aead.Open(nil, nonce, ciphertext, nil)
+	plainData, err := aead.Open(nil, nonce, ciphertext, additionalData)
 	if err != nil {
 		return nil, fmt.Errorf("decryption failed: %w", err)
 	}
@@ -0,0 +1,38 @@
+package crypto
+
+// secretEnvelopeVersion первый байт зашифрованных данных секрета. Данные, записанные до появления конверта,
+// начинаются сразу с nonce
+const secretEnvelopeVersion byte = 1
+
+const secretAdditionalDataContext = "keeper secret"
+
+// secretAdditionalData привязывает шифротекст к секрету и его владельцу: данные одного секрета,
+// подставленные в другую запись на сервере, не расшифруются
+func secretAdditionalData(login, secretID string) []byte {
+	additionalData := make([]byte, 0, len(secretAdditionalDataContext)+len(login)+len(secretID)+3)
+	additionalData = append(additionalData, secretAdditionalDataContext...)
+	additionalData = append(additionalData, 0, secretEnvelopeVersion, 0)
+	additionalData = append(additionalData, login...)
+	additionalData = append(additionalData, 0)
+	additionalData = append(additionalData, secretID...)
+
+	return additionalData
+}
+
+// storageEnvelopeVersion первый байт зашифрованных записей локального хранилища
+const storageEnvelopeVersion byte = 1
+
+const (
+	storageAdditionalDataContext = "keeper local storage"
+	storageIndexContext          = "keeper local storage index"
+)
+
+// storageAdditionalData привязывает зашифрованную запись локального хранилища к ее ключу
+func storageAdditionalData(recordID string) []byte {
+	additionalData := make([]byte, 0, len(storageAdditionalDataContext)+len(recordID)+3)
+	additionalData = append(additionalData, storageAdditionalDataContext...)
+	additionalData = append(additionalData, 0, storageEnvelopeVersion, 0)
+	additionalData = append(additionalData, recordID...)
+
+	return additionalData
+}
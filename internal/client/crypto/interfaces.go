@@ -1,13 +1,29 @@
 package crypto
 
 type Cryptor interface {
-	EncryptStorageData(plainData []byte) ([]byte, error)
-	DecryptStorageData(encryptedData []byte) ([]byte, error)
+	EncryptStorageData(recordID string, plainData []byte) ([]byte, error)
+	DecryptStorageData(recordID string, encryptedData []byte) ([]byte, error)
+	StorageIndex(value string) (string, error)
 
-	EncryptSecretData(plainData []byte) ([]byte, error)
-	DecryptSecretData(encryptedData []byte) ([]byte, error)
+	EncryptSecretData(secretID string, plainData []byte) ([]byte, error)
+	DecryptSecretData(secretID string, encryptedData []byte) ([]byte, error)
 
 	CalculateDataHash(data []byte) string
 
 	GenerateServerPassword() string
+
+	SetKDFParams(params *KDFParams)
+	NewKDFParams() (*KDFParams, error)
+	KDFUpgradeNeeded() bool
+
+	CreateVault(legacy bool) ([]byte, error)
+	UnlockVault(wrappedKey []byte) error
+	RotateVaultKey() ([]byte, error)
+	HasRetiredKeys() bool
+	PruneVaultKeys() ([]byte, error)
+	HasUnboundKeys() bool
+	BindVaultKeys() ([]byte, error)
+	RewrapVault(newMasterPassword string, params *KDFParams) ([]byte, string, error)
+	SetMasterPassword(masterPassword string, params *KDFParams)
+	UpgradeVault(params *KDFParams) ([]byte, string, error)
 }
@@ -0,0 +1,197 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/zeebo/blake3"
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	kdfSaltSize = 16
+
+	// нижняя граница параметров, как у сервера: более слабые параметры с сервера не принимаются
+	minKDFSaltSize  = 16
+	minKDFMemoryKiB = 16 * 1024
+
+	serverKeyContext = "keeper server password"
+	kekContext       = "keeper vault key encryption key"
+)
+
+// KDFParams соль и параметры Argon2id учетной записи. У учетных записей, созданных до появления
+// параметров, соли нет: соли строятся из логина, параметры legacyKDFParams
+type KDFParams struct {
+	Salt      []byte
+	Time      uint32
+	MemoryKiB uint32
+	Threads   uint8
+}
+
+var legacyKDFParams = KDFParams{Time: 3, MemoryKiB: 64 * 1024, Threads: 4}
+
+var ErrWeakKDFParams = errors.New("key derivation parameters are weaker than allowed")
+
+// Validate проверяет параметры, полученные с сервера или из заголовка связки. Учетная запись без соли
+// выводит ключи с legacyKDFParams, ее параметры не проверяются
+func (p *KDFParams) Validate() error {
+	if p.legacy() {
+		return nil
+	}
+
+	if len(p.Salt) < minKDFSaltSize || p.Time == 0 || p.MemoryKiB < minKDFMemoryKiB || p.Threads == 0 {
+		return ErrWeakKDFParams
+	}
+	return nil
+}
+
+// DefaultKDFParams параметры Argon2id для новых учетных записей, если в настройках не заданы другие
+func DefaultKDFParams() KDFParams {
+	return legacyKDFParams
+}
+
+func (p *KDFParams) legacy() bool {
+	return p == nil || len(p.Salt) == 0
+}
+
+// weakerThan true, если хотя бы один из параметров дешевле target
+func (p *KDFParams) weakerThan(target KDFParams) bool {
+	return p.Time < target.Time || p.MemoryKiB < target.MemoryKiB || p.Threads < target.Threads
+}
+
+func (p *KDFParams) equal(other *KDFParams) bool {
+	if p.legacy() || other.legacy() {
+		return p.legacy() && other.legacy()
+	}
+
+	return bytes.Equal(p.Salt, other.Salt) && p.Time == other.Time &&
+		p.MemoryKiB == other.MemoryKiB && p.Threads == other.Threads
+}
+
+// accountKeys ключи учетной записи от мастер-пароля: пароль для сервера и ключ, которым шифруется связка ключей хранилища
+type accountKeys struct {
+	server []byte
+	kek    []byte
+}
+
+// deriveAccountKeys выводит один ключ Argon2id с солью учетной записи и получает из него ключи учетной записи.
+// Для учетных записей без соли каждый ключ выводится отдельно с солью из логина
+func (c *CryptorImpl) deriveAccountKeys(masterPassword string, params *KDFParams) *accountKeys {
+	if params.legacy() {
+		return &accountKeys{
+			server: deriveKey(masterPassword, []byte(c.login+"|server")),
+			kek:    deriveKey(masterPassword, []byte(c.login+"|kek")),
+		}
+	}
+
+	masterKey := argon2.IDKey([]byte(masterPassword), params.Salt, params.Time, params.MemoryKiB, params.Threads, keySize)
+
+	keys := &accountKeys{
+		server: make([]byte, keySize),
+		kek:    make([]byte, keySize),
+	}
+	blake3.DeriveKey(serverKeyContext, masterKey, keys.server)
+	blake3.DeriveKey(kekContext, masterKey, keys.kek)
+
+	return keys
+}
+
+func (c *CryptorImpl) getAccountKeys() *accountKeys {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.account == nil {
+		c.account = c.deriveAccountKeys(c.masterPassword, c.kdf)
+	}
+
+	return c.account
+}
+
+// SetKDFParams задает соль и параметры учетной записи, полученные с сервера, nil для учетных записей без соли
+func (c *CryptorImpl) SetKDFParams(params *KDFParams) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.kdf = params
+	c.account = nil
+}
+
+// NewKDFParams параметры из настроек клиента со случайной солью
+func (c *CryptorImpl) NewKDFParams() (*KDFParams, error) {
+	salt, err := randomBytes(kdfSaltSize)
+	if err != nil {
+		return nil, err
+	}
+
+	params := c.kdfTarget
+	params.Salt = salt
+	return &params, nil
+}
+
+// KDFUpgradeNeeded true, если учетная запись без соли или ее параметры слабее параметров из настроек клиента
+func (c *CryptorImpl) KDFUpgradeNeeded() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.kdf.legacy() || c.kdf.weakerThan(c.kdfTarget)
+}
+
+var vaultMagic = []byte("KVLT")
+
+const (
+	vaultFormatVersion = 1
+	vaultHeaderSize    = 4 + 1 + 4 + 4 + 1 + 1
+)
+
+// marshalVaultHeader заголовок связки ключей: magic, версия формата и параметры KDF, которыми выведен ключ шифрования связки.
+// Заголовок не шифруется, но защищен AEAD как дополнительные данные
+func marshalVaultHeader(params *KDFParams) []byte {
+	header := make([]byte, 0, vaultHeaderSize+kdfSaltSize)
+	header = append(header, vaultMagic...)
+	header = append(header, vaultFormatVersion)
+
+	if params.legacy() {
+		params = &legacyKDFParams
+	}
+	header = binary.BigEndian.AppendUint32(header, params.Time)
+	header = binary.BigEndian.AppendUint32(header, params.MemoryKiB)
+	header = append(header, params.Threads, byte(len(params.Salt)))
+	header = append(header, params.Salt...)
+
+	return header
+}
+
+// parseVaultHeader возвращает параметры из заголовка, сам заголовок и зашифрованную связку.
+// Связка без заголовка записана до появления параметров KDF
+func parseVaultHeader(data []byte) (*KDFParams, []byte, []byte, error) {
+	if !bytes.HasPrefix(data, vaultMagic) {
+		return nil, nil, data, nil
+	}
+
+	if len(data) < vaultHeaderSize {
+		return nil, nil, nil, fmt.Errorf("vault header too short")
+	}
+	if data[4] != vaultFormatVersion {
+		return nil, nil, nil, fmt.Errorf("unsupported vault format version %d", data[4])
+	}
+
+	saltSize := int(data[vaultHeaderSize-1])
+	headerSize := vaultHeaderSize + saltSize
+	if len(data) < headerSize {
+		return nil, nil, nil, fmt.Errorf("vault header too short")
+	}
+
+	params := &KDFParams{
+		Time:      binary.BigEndian.Uint32(data[5:9]),
+		MemoryKiB: binary.BigEndian.Uint32(data[9:13]),
+		Threads:   data[13],
+		Salt:      data[vaultHeaderSize:headerSize],
+	}
+	if params.legacy() {
+		params = nil
+	}
+
+	return params, data[:headerSize], data[headerSize:], nil
+}
@@ -0,0 +1,246 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+)
+
+// vaultKeyring связка ключей хранилища. Первый ключ шифрует новые данные, остальные выведены из работы
+// ротацией и остаются, только пока секреты, корзина и история версий не перешифрованы первым ключом,
+// после чего удаляются PruneVaultKeys. HashKey не меняется при ротации, чтобы хеши секретов
+// оставались прежними. Первые BoundKeys ключей созданы после появления конверта секретов
+// и никогда не расшифровывают данные без него
+type vaultKeyring struct {
+	HashKey   []byte   `json:"hash_key"`
+	Keys      [][]byte `json:"keys"`
+	BoundKeys int      `json:"bound_keys"`
+}
+
+// CreateVault создает связку ключей хранилища и возвращает ее, зашифрованную мастер-паролем.
+// С legacy ключом хранилища становится прежний ключ от мастер-пароля, чтобы уже сохраненные
+// на сервере секреты и их хеши остались действительными
+func (c *CryptorImpl) CreateVault(legacy bool) ([]byte, error) {
+	keyring := &vaultKeyring{}
+
+	if legacy {
+		keyring.HashKey = c.getLegacyHashKey()
+		keyring.Keys = [][]byte{c.getSecretsKey()}
+	} else {
+		hashKey, err := randomKey()
+		if err != nil {
+			return nil, err
+		}
+		dataKey, err := randomKey()
+		if err != nil {
+			return nil, err
+		}
+		keyring.HashKey = hashKey
+		keyring.Keys = [][]byte{dataKey}
+		keyring.BoundKeys = 1
+	}
+
+	wrapped, err := c.wrapKeyring(keyring, c.currentKDFParams(), c.getAccountKeys())
+	if err != nil {
+		return nil, err
+	}
+
+	c.setKeyring(keyring)
+	return wrapped, nil
+}
+
+// UnlockVault расшифровывает мастер-паролем связку ключей, полученную с сервера.
+// Ключ шифрования связки выводится с параметрами из ее заголовка, слабые параметры не принимаются
+func (c *CryptorImpl) UnlockVault(wrappedKey []byte) error {
+	params, header, encrypted, err := parseVaultHeader(wrappedKey)
+	if err != nil {
+		return err
+	}
+	if err = params.Validate(); err != nil {
+		return err
+	}
+
+	keys := c.getAccountKeys()
+	if !params.equal(c.currentKDFParams()) {
+		keys = c.deriveAccountKeys(c.masterPassword, params)
+	}
+
+	plainData, err := c.openWithKey(encrypted, keys.kek, header)
+	if err != nil {
+		return fmt.Errorf("failed to unlock vault, wrong master password? %w", err)
+	}
+
+	var keyring vaultKeyring
+	if err = json.Unmarshal(plainData, &keyring); err != nil {
+		return fmt.Errorf("failed to parse vault keyring: %w", err)
+	}
+
+	if len(keyring.HashKey) != keySize || len(keyring.Keys) == 0 || keyring.BoundKeys > len(keyring.Keys) {
+		return fmt.Errorf("invalid vault keyring")
+	}
+	for _, key := range keyring.Keys {
+		if len(key) != keySize {
+			return fmt.Errorf("invalid vault keyring")
+		}
+	}
+
+	c.setKeyring(&keyring)
+	return nil
+}
+
+// RotateVaultKey возвращает связку с новым ключом хранилища, зашифрованную мастер-паролем,
+// текущие ключи в ней выведены из работы. Текущая связка не меняется: новый ключ начинает
+// шифровать секреты после UnlockVault с этой связкой, когда ее принял сервер
+func (c *CryptorImpl) RotateVaultKey() ([]byte, error) {
+	current := c.getKeyring()
+	if current == nil {
+		return nil, fmt.Errorf("vault is locked")
+	}
+
+	dataKey, err := randomKey()
+	if err != nil {
+		return nil, err
+	}
+
+	keyring := &vaultKeyring{
+		HashKey:   current.HashKey,
+		Keys:      append([][]byte{dataKey}, current.Keys...),
+		BoundKeys: current.BoundKeys + 1,
+	}
+
+	return c.wrapKeyring(keyring, c.currentKDFParams(), c.getAccountKeys())
+}
+
+// HasRetiredKeys true, если в связке остались ключи, выведенные из работы ротацией
+func (c *CryptorImpl) HasRetiredKeys() bool {
+	keyring := c.getKeyring()
+	return keyring != nil && len(keyring.Keys) > 1
+}
+
+// PruneVaultKeys возвращает связку без ключей, выведенных из работы. Вызывается, когда все данные
+// на сервере перешифрованы текущим ключом: после этого старым ключом ничего не расшифровать.
+// Текущая связка меняется после UnlockVault, когда новую связку принял сервер
+func (c *CryptorImpl) PruneVaultKeys() ([]byte, error) {
+	current := c.getKeyring()
+	if current == nil {
+		return nil, fmt.Errorf("vault is locked")
+	}
+
+	keyring := &vaultKeyring{
+		HashKey:   current.HashKey,
+		Keys:      current.Keys[:1],
+		BoundKeys: min(current.BoundKeys, 1),
+	}
+
+	return c.wrapKeyring(keyring, c.currentKDFParams(), c.getAccountKeys())
+}
+
+// HasUnboundKeys true, если в связке есть ключи, которыми секреты шифровались без конверта
+func (c *CryptorImpl) HasUnboundKeys() bool {
+	keyring := c.getKeyring()
+	return keyring != nil && keyring.BoundKeys < len(keyring.Keys)
+}
+
+// BindVaultKeys возвращает связку, в которой все ключи расшифровывают только данные в конверте.
+// Вызывается, когда все секреты на сервере перешифрованы в конверт. Как и после RotateVaultKey,
+// текущая связка меняется после UnlockVault, когда новую связку принял сервер
+func (c *CryptorImpl) BindVaultKeys() ([]byte, error) {
+	current := c.getKeyring()
+	if current == nil {
+		return nil, fmt.Errorf("vault is locked")
+	}
+
+	keyring := &vaultKeyring{
+		HashKey:   current.HashKey,
+		Keys:      current.Keys,
+		BoundKeys: len(current.Keys),
+	}
+
+	return c.wrapKeyring(keyring, c.currentKDFParams(), c.getAccountKeys())
+}
+
+// RewrapVault шифрует связку ключей новым мастер-паролем с параметрами params и возвращает ее вместе
+// с паролем для сервера от нового мастер-пароля. Сами секреты при этом не перешифровываются,
+// криптор продолжает работать со старым мастер-паролем до SetMasterPassword
+func (c *CryptorImpl) RewrapVault(newMasterPassword string, params *KDFParams) ([]byte, string, error) {
+	keyring := c.getKeyring()
+	if keyring == nil {
+		return nil, "", fmt.Errorf("vault is locked")
+	}
+
+	keys := c.deriveAccountKeys(newMasterPassword, params)
+
+	wrapped, err := c.wrapKeyring(keyring, params, keys)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return wrapped, base64.StdEncoding.EncodeToString(keys.server), nil
+}
+
+// SetMasterPassword переводит криптор на новый мастер-пароль и параметры KDF после того, как сервер
+// принял связку из RewrapVault: следующие ротации и перешифровки связки выполняются уже с ними
+func (c *CryptorImpl) SetMasterPassword(masterPassword string, params *KDFParams) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.masterPassword = masterPassword
+	c.kdf = params
+	c.account = nil
+	c.cachedKeys = make(map[string][]byte)
+}
+
+// UpgradeVault как RewrapVault, но с текущим мастер-паролем: переводит учетную запись на новые параметры KDF
+func (c *CryptorImpl) UpgradeVault(params *KDFParams) ([]byte, string, error) {
+	return c.RewrapVault(c.masterPassword, params)
+}
+
+func (c *CryptorImpl) wrapKeyring(keyring *vaultKeyring, params *KDFParams, keys *accountKeys) ([]byte, error) {
+	plainData, err := json.Marshal(keyring)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal vault keyring: %w", err)
+	}
+
+	header := marshalVaultHeader(params)
+	encrypted, err := c.sealWithKey(plainData, keys.kek, header)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(header, encrypted...), nil
+}
+
+func (c *CryptorImpl) currentKDFParams() *KDFParams {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.kdf
+}
+
+func (c *CryptorImpl) getKeyring() *vaultKeyring {
+	c.keyringMu.RLock()
+	defer c.keyringMu.RUnlock()
+
+	return c.keyring
+}
+
+func (c *CryptorImpl) setKeyring(keyring *vaultKeyring) {
+	c.keyringMu.Lock()
+	defer c.keyringMu.Unlock()
+
+	c.keyring = keyring
+}
+
+func randomKey() ([]byte, error) {
+	return randomBytes(keySize)
+}
+
+func randomBytes(size int) ([]byte, error) {
+	data := make([]byte, size)
+	if _, err := rand.Read(data); err != nil {
+		return nil, fmt.Errorf("generate random bytes: %w", err)
+	}
+
+	return data, nil
+}
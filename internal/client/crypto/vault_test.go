@@ -0,0 +1,255 @@
+package crypto
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testLogin = "user"
+
+// testKDFParams дешевые параметры Argon2id, чтобы тесты не тратили время на вывод ключей
+var testKDFParams = KDFParams{Time: 1, MemoryKiB: 16 * 1024, Threads: 1}
+
+// newTestVault криптор с новой учетной записью и созданной связкой ключей
+func newTestVault(t *testing.T, masterPassword string) (*CryptorImpl, *KDFParams, []byte) {
+
+	c := NewCryptor(masterPassword, testLogin, WithKDFTarget(testKDFParams)).(*CryptorImpl)
+
+	params, err := c.NewKDFParams()
+	require.NoError(t, err)
+	c.SetKDFParams(params)
+
+	wrapped, err := c.CreateVault(false)
+	require.NoError(t, err)
+
+	return c, params, wrapped
+}
+
+// unlockAs криптор другого устройства: мастер-пароль и параметры KDF, с которыми оно войдет
+func unlockAs(t *testing.T, masterPassword string, params *KDFParams, wrapped []byte) (*CryptorImpl, error) {
+
+	c := NewCryptor(masterPassword, testLogin, WithKDFTarget(testKDFParams)).(*CryptorImpl)
+	c.SetKDFParams(params)
+
+	return c, c.UnlockVault(wrapped)
+}
+
+func TestChangeMasterPassword(t *testing.T) {
+
+	c, _, _ := newTestVault(t, "old password")
+
+	encrypted, err := c.EncryptSecretData("secret", []byte("data"))
+	require.NoError(t, err)
+
+	newParams, err := c.NewKDFParams()
+	require.NoError(t, err)
+
+	rewrapped, serverPassword, err := c.RewrapVault("new password", newParams)
+	require.NoError(t, err)
+
+	// до подтверждения сервером криптор работает со старым паролем
+	require.NotEqual(t, serverPassword, c.GenerateServerPassword())
+
+	c.SetMasterPassword("new password", newParams)
+	require.Equal(t, serverPassword, c.GenerateServerPassword())
+	require.NoError(t, c.UnlockVault(rewrapped))
+
+	_, err = unlockAs(t, "old password", newParams, rewrapped)
+	require.Error(t, err)
+
+	other, err := unlockAs(t, "new password", newParams, rewrapped)
+	require.NoError(t, err)
+
+	plainData, err := other.DecryptSecretData("secret", encrypted)
+	require.NoError(t, err)
+	require.Equal(t, []byte("data"), plainData)
+
+	// ротация после смены пароля шифрует связку уже новым паролем
+	rotated, err := c.RotateVaultKey()
+	require.NoError(t, err)
+	_, err = unlockAs(t, "new password", newParams, rotated)
+	require.NoError(t, err)
+}
+
+func TestRotateVaultKey(t *testing.T) {
+
+	c, params, _ := newTestVault(t, "password")
+
+	before, err := c.EncryptSecretData("secret", []byte("before"))
+	require.NoError(t, err)
+
+	rotated, err := c.RotateVaultKey()
+	require.NoError(t, err)
+
+	// связка не меняется, пока ее не принял сервер
+	require.Len(t, c.getDataKeys(), 1)
+
+	require.NoError(t, c.UnlockVault(rotated))
+	require.Len(t, c.getDataKeys(), 2)
+
+	after, err := c.EncryptSecretData("secret", []byte("after"))
+	require.NoError(t, err)
+
+	other, err := unlockAs(t, "password", params, rotated)
+	require.NoError(t, err)
+
+	for encrypted, expected := range map[string]string{string(before): "before", string(after): "after"} {
+		plainData, err := other.DecryptSecretData("secret", []byte(encrypted))
+		require.NoError(t, err)
+		require.Equal(t, expected, string(plainData))
+	}
+
+	// новые данные зашифрованы новым ключом, старой связкой они не расшифровываются
+	_, err = c.openWithKey(after[1:], other.getDataKeys()[1], secretAdditionalData(testLogin, "secret"))
+	require.Error(t, err)
+	require.Equal(t, c.getHashKey(), other.getHashKey())
+}
+
+// TestPruneVaultKeys после перешифровки и удаления выведенного ключа он не расшифровывает ничего из хранилища,
+// даже если попал к злоумышленнику вместе со старой связкой
+func TestPruneVaultKeys(t *testing.T) {
+
+	c, params, original := newTestVault(t, "password")
+
+	before, err := c.EncryptSecretData("secret", []byte("data"))
+	require.NoError(t, err)
+
+	rotated, err := c.RotateVaultKey()
+	require.NoError(t, err)
+	require.False(t, c.HasRetiredKeys())
+	require.NoError(t, c.UnlockVault(rotated))
+	require.True(t, c.HasRetiredKeys())
+
+	// перешифровка: старые данные еще читаются выведенным ключом
+	plainData, err := c.DecryptSecretData("secret", before)
+	require.NoError(t, err)
+	rekeyed, err := c.EncryptSecretData("secret", plainData)
+	require.NoError(t, err)
+
+	pruned, err := c.PruneVaultKeys()
+	require.NoError(t, err)
+
+	// связка не меняется, пока ее не принял сервер
+	require.True(t, c.HasRetiredKeys())
+	require.NoError(t, c.UnlockVault(pruned))
+	require.False(t, c.HasRetiredKeys())
+	require.False(t, c.HasUnboundKeys())
+	require.Len(t, c.getDataKeys(), 1)
+
+	plainData, err = c.DecryptSecretData("secret", rekeyed)
+	require.NoError(t, err)
+	require.Equal(t, []byte("data"), plainData)
+
+	_, err = c.DecryptSecretData("secret", before)
+	require.Error(t, err)
+
+	after, err := c.EncryptSecretData("secret", []byte("after"))
+	require.NoError(t, err)
+
+	retired, err := unlockAs(t, "password", params, original)
+	require.NoError(t, err)
+	for _, encrypted := range [][]byte{rekeyed, after} {
+		_, err = retired.DecryptSecretData("secret", encrypted)
+		require.Error(t, err)
+	}
+}
+
+func TestUnlockVaultWeakKDFParams(t *testing.T) {
+
+	c, _, _ := newTestVault(t, "password")
+
+	// сервер подменил связку на зашифрованную с дешевыми параметрами
+	weak := &KDFParams{Salt: make([]byte, kdfSaltSize), Time: 1, MemoryKiB: 1024, Threads: 1}
+	wrapped, err := c.wrapKeyring(c.getKeyring(), weak, c.deriveAccountKeys("password", weak))
+	require.NoError(t, err)
+
+	_, err = unlockAs(t, "password", weak, wrapped)
+	require.ErrorIs(t, err, ErrWeakKDFParams)
+}
+
+func TestKDFParamsValidate(t *testing.T) {
+
+	salt := make([]byte, kdfSaltSize)
+
+	tests := []struct {
+		name    string
+		params  *KDFParams
+		wantErr bool
+	}{
+		{name: "legacy", params: nil},
+		{name: "target", params: &KDFParams{Salt: salt, Time: 1, MemoryKiB: 16 * 1024, Threads: 1}},
+		{name: "short salt", params: &KDFParams{Salt: salt[:8], Time: 1, MemoryKiB: 16 * 1024, Threads: 1}, wantErr: true},
+		{name: "no time", params: &KDFParams{Salt: salt, Time: 0, MemoryKiB: 16 * 1024, Threads: 1}, wantErr: true},
+		{name: "low memory", params: &KDFParams{Salt: salt, Time: 1, MemoryKiB: 8 * 1024, Threads: 1}, wantErr: true},
+		{name: "no threads", params: &KDFParams{Salt: salt, Time: 1, MemoryKiB: 16 * 1024, Threads: 0}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.params.Validate()
+			if tt.wantErr {
+				require.ErrorIs(t, err, ErrWeakKDFParams)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestDecryptSecretDataBinding(t *testing.T) {
+
+	c, _, _ := newTestVault(t, "password")
+
+	encrypted, err := c.EncryptSecretData("secret", []byte("data"))
+	require.NoError(t, err)
+
+	// сервер выдает данные секрета за другой секрет или за секрет другого пользователя
+	_, err = c.DecryptSecretData("other secret", encrypted)
+	require.Error(t, err)
+
+	other := NewCryptor("password", "other user", WithKDFTarget(testKDFParams)).(*CryptorImpl)
+	other.setKeyring(c.getKeyring())
+	_, err = other.DecryptSecretData("secret", encrypted)
+	require.Error(t, err)
+
+	plainData, err := c.DecryptSecretData("secret", encrypted)
+	require.NoError(t, err)
+	require.Equal(t, []byte("data"), plainData)
+}
+
+func TestBindVaultKeys(t *testing.T) {
+
+	// секрет, записанный без конверта до появления ключа хранилища
+	c := NewCryptor("password", testLogin, WithKDFTarget(testKDFParams)).(*CryptorImpl)
+	legacyData, err := c.encryptWithKey([]byte("legacy"), c.getSecretsKey())
+	require.NoError(t, err)
+
+	wrapped, err := c.CreateVault(true)
+	require.NoError(t, err)
+	require.NoError(t, c.UnlockVault(wrapped))
+	require.True(t, c.HasUnboundKeys())
+
+	plainData, err := c.DecryptSecretData("secret", legacyData)
+	require.NoError(t, err)
+	require.Equal(t, []byte("legacy"), plainData)
+
+	encrypted, err := c.EncryptSecretData("secret", plainData)
+	require.NoError(t, err)
+
+	bound, err := c.BindVaultKeys()
+	require.NoError(t, err)
+
+	// связка не меняется, пока ее не принял сервер
+	require.True(t, c.HasUnboundKeys())
+
+	require.NoError(t, c.UnlockVault(bound))
+	require.False(t, c.HasUnboundKeys())
+
+	_, err = c.DecryptSecretData("secret", legacyData)
+	require.Error(t, err)
+
+	plainData, err = c.DecryptSecretData("secret", encrypted)
+	require.NoError(t, err)
+	require.Equal(t, []byte("legacy"), plainData)
+}
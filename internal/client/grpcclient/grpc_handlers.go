@@ -2,10 +2,21 @@ package grpcclient
 
 import (
 	"context"
+	"errors"
+	"github.com/s-turchinskiy/keeper/internal/client/crypto"
 	"github.com/s-turchinskiy/keeper/internal/client/models"
 	"github.com/s-turchinskiy/keeper/internal/utils/errorsutils"
 	"github.com/s-turchinskiy/keeper/models/proto"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	ErrVaultKeyExists = errors.New("vault key already exists")
+	ErrUserNotFound   = errors.New("user not found")
+	ErrDeviceRevoked  = errors.New("this device was revoked, use another device or reset local storage")
+	ErrDeviceNotFound = errors.New("device not found")
 )
 
 func (c *GRPCClient) Close() error {
@@ -28,20 +39,33 @@ func (c *GRPCClient) GetConnectionNumber(ctx context.Context) (uint64, error) {
 func (c *GRPCClient) Login(ctx context.Context, login, password string) error {
 
 	c.token = ""
+	c.refreshToken = ""
 	c.login = login
 	c.password = password
 
 	req := &proto.LoginRequest{
 		Login:    c.login,
 		Password: c.password,
+		Device:   models.ConvertDeviceToProtoDevice(c.device),
 	}
 
 	resp, err := c.authClient.Login(c.withConnNumber(ctx), req)
+	if status.Code(err) == codes.PermissionDenied {
+		return ErrDeviceRevoked
+	}
 	if err != nil {
 		return err
 	}
 
+	if resp.GetTwoFactorRequired() {
+		resp, err = c.loginTwoFactor(ctx, resp.GetChallenge())
+		if err != nil {
+			return err
+		}
+	}
+
 	c.token = resp.GetToken()
+	c.refreshToken = resp.GetRefreshToken()
 
 	err = c.setStream(ctx)
 	if err != nil {
@@ -51,15 +75,121 @@ func (c *GRPCClient) Login(ctx context.Context, login, password string) error {
 	return nil
 }
 
-func (c *GRPCClient) Register(ctx context.Context, login, password string) (string, error) {
+// SetCredentials логин и пароль для авторизации на сервере, токен получается заново при следующем запросе
+func (c *GRPCClient) SetCredentials(login, password string) {
+	c.token = ""
+	c.refreshToken = ""
+	c.login = login
+	c.password = password
+}
+
+// SetDevice устройство, которое регистрируется на сервере при каждом входе
+func (c *GRPCClient) SetDevice(device *models.Device) {
+	c.device = device
+}
+
+// ListDevices устройства пользователя, включая отозванные
+func (c *GRPCClient) ListDevices(ctx context.Context) ([]*models.Device, error) {
+
+	var resp *proto.ListDevicesResponse
+	err := c.withAuthRetry(c.withConnNumber(ctx), func(authCtx context.Context) error {
+		var err error
+		resp, err = c.authClient.ListDevices(authCtx, &proto.ListDevicesRequest{})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	devices := make([]*models.Device, len(resp.GetDevices()))
+	for i, device := range resp.GetDevices() {
+		devices[i] = models.ConvertProtoDeviceToDevice(device)
+	}
+
+	return devices, nil
+}
+
+// RevokeDevice отзывает устройство и завершает его сессии, возвращает число завершенных сессий
+func (c *GRPCClient) RevokeDevice(ctx context.Context, deviceID string) (int64, error) {
+
+	req := &proto.RevokeDeviceRequest{
+		DeviceId: deviceID,
+	}
+
+	var resp *proto.RevokeDeviceResponse
+	err := c.withAuthRetry(c.withConnNumber(ctx), func(authCtx context.Context) error {
+		var err error
+		resp, err = c.authClient.RevokeDevice(authCtx, req)
+		return err
+	})
+	if status.Code(err) == codes.NotFound {
+		return 0, ErrDeviceNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return resp.GetRevokedSessions(), nil
+}
+
+// Logout завершает сессию клиента на сервере, allSessions - все сессии пользователя на всех устройствах.
+// Без allSessions и без открытой сессии ничего не делает. Возвращает число завершенных сессий
+func (c *GRPCClient) Logout(ctx context.Context, allSessions bool) (int64, error) {
+
+	if !allSessions && c.token == "" && c.refreshToken == "" {
+		return 0, nil
+	}
+
+	req := &proto.LogoutRequest{
+		AllSessions: allSessions,
+	}
+
+	var resp *proto.LogoutResponse
+	err := c.withAuthRetry(c.withConnNumber(ctx), func(authCtx context.Context) error {
+		var err error
+		resp, err = c.authClient.Logout(authCtx, req)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	c.token = ""
+	c.refreshToken = ""
+
+	return resp.GetRevokedSessions(), nil
+}
+
+// GetKDFParams соль и параметры Argon2id пользователя, nil для пользователей без соли.
+// Если пользователь не зарегистрирован, возвращает ErrUserNotFound
+func (c *GRPCClient) GetKDFParams(ctx context.Context, login string) (*crypto.KDFParams, error) {
+
+	req := &proto.GetKDFParamsRequest{
+		Login: login,
+	}
+
+	resp, err := c.authClient.GetKDFParams(c.withConnNumber(ctx), req)
+	if status.Code(err) == codes.NotFound {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return models.ConvertProtoKDFParamsToKDFParams(resp.GetKdf()), nil
+}
+
+func (c *GRPCClient) Register(ctx context.Context, login, password string, kdf *crypto.KDFParams) (string, error) {
 
 	c.token = ""
+	c.refreshToken = ""
 	c.login = login
 	c.password = password
 
 	req := &proto.RegisterRequest{
 		Login:    c.login,
 		Password: c.password,
+		Kdf:      models.ConvertKDFParamsToProtoKDFParams(kdf),
 	}
 
 	resp, err := c.authClient.Register(c.withConnNumber(ctx), req)
@@ -69,15 +199,84 @@ func (c *GRPCClient) Register(ctx context.Context, login, password string) (stri
 	return resp.GetUserId(), nil
 }
 
-func (c *GRPCClient) SetSecret(ctx context.Context, secret *models.RemoteSecret) error {
+// ChangePassword меняет пароль авторизации и параметры KDF на сервере и сохраняет ключ хранилища,
+// зашифрованный новым мастер-паролем
+func (c *GRPCClient) ChangePassword(ctx context.Context, newPassword string, vaultKey []byte, kdf *crypto.KDFParams) error {
+
+	req := &proto.ChangePasswordRequest{
+		OldPassword: c.password,
+		NewPassword: newPassword,
+		VaultKey:    vaultKey,
+		Kdf:         models.ConvertKDFParamsToProtoKDFParams(kdf),
+	}
+
+	err := c.withAuthRetry(c.withConnNumber(ctx), func(authCtx context.Context) error {
+		_, err := c.authClient.ChangePassword(authCtx, req)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	c.password = newPassword
+	return nil
+}
+
+func (c *GRPCClient) GetVaultKey(ctx context.Context) ([]byte, error) {
+	var resp *proto.GetVaultKeyResponse
+	err := c.withAuthRetry(c.withConnNumber(ctx), func(authCtx context.Context) error {
+		var err error
+		resp, err = c.authClient.GetVaultKey(authCtx, &proto.GetVaultKeyRequest{})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.GetVaultKey(), nil
+}
+
+// SetVaultKey сохраняет ключ хранилища на сервере. Без replace возвращает ErrVaultKeyExists,
+// если ключ уже создан другим устройством
+func (c *GRPCClient) SetVaultKey(ctx context.Context, vaultKey []byte, replace bool) error {
+
+	req := &proto.SetVaultKeyRequest{
+		VaultKey: vaultKey,
+		Replace:  replace,
+	}
+
+	err := c.withAuthRetry(c.withConnNumber(ctx), func(authCtx context.Context) error {
+		_, err := c.authClient.SetVaultKey(authCtx, req)
+		return err
+	})
+	if status.Code(err) == codes.AlreadyExists {
+		return ErrVaultKeyExists
+	}
+
+	return err
+}
+
+func (c *GRPCClient) SetSecret(ctx context.Context, secret *models.RemoteSecret, expected *models.ExpectedVersion) (int64, error) {
+	var resp *proto.SetSecretResponse
+
 	req := &proto.SetSecretRequest{
 		Secret: models.ConvertRemoteSecretToProtoSecret(secret),
 	}
+	if expected != nil {
+		req.ExpectedHash = expected.Hash
+		req.ExpectedRevision = expected.Revision
+	}
 
-	return c.withAuthRetry(c.withConnNumber(ctx), func(authCtx context.Context) error {
-		_, err := c.secretClient.SetSecret(authCtx, req)
+	err := c.withAuthRetry(c.withConnNumber(ctx), func(authCtx context.Context) error {
+		var err error
+		resp, err = c.secretClient.SetSecret(authCtx, req)
 		return err
 	})
+	if err != nil {
+		return 0, convertConflictError(secret.ID, err)
+	}
+
+	return resp.GetRevision(), nil
 }
 
 func (c *GRPCClient) GetSecret(ctx context.Context, secretID string) (*models.RemoteSecret, error) {
@@ -113,15 +312,79 @@ func (c *GRPCClient) DeleteSecret(ctx context.Context, secretID string) error {
 	})
 }
 
-func (c *GRPCClient) UpdateSecret(ctx context.Context, secret *models.RemoteSecret) error {
+func (c *GRPCClient) UndeleteSecret(ctx context.Context, secretID string) (*models.RemoteSecret, error) {
+	var resp *proto.UndeleteSecretResponse
+
+	req := &proto.UndeleteSecretRequest{
+		SecretId: secretID,
+	}
+
+	err := c.withAuthRetry(c.withConnNumber(ctx), func(authCtx context.Context) error {
+		var err error
+		resp, err = c.secretClient.UndeleteSecret(authCtx, req)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return models.ConvertProtoSecretToRemoteSecret(resp.GetSecret()), nil
+}
+
+func (c *GRPCClient) ListDeletedSecrets(ctx context.Context) ([]*models.RemoteSecret, error) {
+	var resp *proto.ListDeletedSecretsResponse
+	err := c.withAuthRetry(c.withConnNumber(ctx), func(authCtx context.Context) error {
+		var err error
+		resp, err = c.secretClient.ListDeletedSecrets(authCtx, &proto.ListDeletedSecretsRequest{})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	secrets := make([]*models.RemoteSecret, len(resp.GetSecrets()))
+	for i, secretResp := range resp.GetSecrets() {
+		secrets[i] = models.ConvertProtoSecretToRemoteSecret(secretResp)
+	}
+
+	return secrets, nil
+}
+
+func (c *GRPCClient) PurgeDeletedSecrets(ctx context.Context) (int64, error) {
+	var resp *proto.PurgeDeletedSecretsResponse
+	err := c.withAuthRetry(c.withConnNumber(ctx), func(authCtx context.Context) error {
+		var err error
+		resp, err = c.secretClient.PurgeDeletedSecrets(authCtx, &proto.PurgeDeletedSecretsRequest{})
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return resp.GetPurged(), nil
+}
+
+func (c *GRPCClient) UpdateSecret(ctx context.Context, secret *models.RemoteSecret, expected *models.ExpectedVersion) (int64, error) {
+	var resp *proto.UpdateSecretResponse
+
 	req := &proto.UpdateSecretRequest{
 		Secret: models.ConvertRemoteSecretToProtoSecret(secret),
 	}
+	if expected != nil {
+		req.ExpectedHash = expected.Hash
+		req.ExpectedRevision = expected.Revision
+	}
 
-	return c.withAuthRetry(c.withConnNumber(ctx), func(authCtx context.Context) error {
-		_, err := c.secretClient.UpdateSecret(authCtx, req)
+	err := c.withAuthRetry(c.withConnNumber(ctx), func(authCtx context.Context) error {
+		var err error
+		resp, err = c.secretClient.UpdateSecret(authCtx, req)
 		return err
 	})
+	if err != nil {
+		return 0, convertConflictError(secret.ID, err)
+	}
+
+	return resp.GetRevision(), nil
 }
 
 func (c *GRPCClient) ListSecrets(ctx context.Context) ([]*models.RemoteSecret, error) {
@@ -139,18 +402,92 @@ func (c *GRPCClient) ListSecrets(ctx context.Context) ([]*models.RemoteSecret, e
 	secrets := make([]*models.RemoteSecret, len(secretsResp))
 	for i, secretResp := range secretsResp {
 		secrets[i] = &models.RemoteSecret{
-			Name:         secretResp.GetId(),
+			ID:           secretResp.GetId(),
 			LastModified: secretResp.GetLastModified().AsTime(),
 			Hash:         secretResp.GetHash(),
+			Revision:     secretResp.GetRevision(),
 		}
 	}
 
 	return secrets, nil
 }
 
-func (c *GRPCClient) SyncSecretsFromClient(ctx context.Context, secrets []*models.RemoteSecret) error {
+func (c *GRPCClient) ListSecretVersions(ctx context.Context, secretID string) ([]*models.SecretVersion, error) {
+	var resp *proto.ListSecretVersionsResponse
+
+	req := &proto.ListSecretVersionsRequest{
+		SecretId: secretID,
+	}
+
+	err := c.withAuthRetry(c.withConnNumber(ctx), func(authCtx context.Context) error {
+		var err error
+		resp, err = c.secretClient.ListSecretVersions(authCtx, req)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]*models.SecretVersion, len(resp.GetVersions()))
+	for i, versionResp := range resp.GetVersions() {
+		versions[i] = models.ConvertProtoSecretVersionToSecretVersion(versionResp)
+	}
+
+	return versions, nil
+}
 
-	protoSecrets := make([]*proto.Secret, len(secrets))
+func (c *GRPCClient) GetSecretVersion(ctx context.Context, secretID string, version int64) (*models.SecretVersion, error) {
+	var resp *proto.GetSecretVersionResponse
+
+	req := &proto.GetSecretVersionRequest{
+		SecretId: secretID,
+		Version:  version,
+	}
+
+	err := c.withAuthRetry(c.withConnNumber(ctx), func(authCtx context.Context) error {
+		var err error
+		resp, err = c.secretClient.GetSecretVersion(authCtx, req)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return models.ConvertProtoSecretVersionToSecretVersion(resp.GetVersion()), nil
+}
+
+// RekeySecrets отправляет данные секретов в корзине (Version 0) и версий из истории, перешифрованные
+// новым ключом хранилища, возвращает число записей, замененных на сервере
+func (c *GRPCClient) RekeySecrets(ctx context.Context, versions []*models.SecretVersion) (int64, error) {
+	var resp *proto.RekeySecretsResponse
+
+	req := &proto.RekeySecretsRequest{
+		Versions: make([]*proto.SecretVersion, len(versions)),
+	}
+	for i, version := range versions {
+		req.Versions[i] = &proto.SecretVersion{
+			Version: version.Version,
+			Secret:  models.ConvertRemoteSecretToProtoSecret(&version.RemoteSecret),
+		}
+	}
+
+	err := c.withAuthRetry(c.withConnNumber(ctx), func(authCtx context.Context) error {
+		var err error
+		resp, err = c.secretClient.RekeySecrets(authCtx, req)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return resp.GetRekeyed(), nil
+}
+
+// SyncSecretsFromClient отправляет секреты клиента на сервер, Revision секрета - ревизия, от которой сделано изменение.
+// Возвращает текущие версии секретов, измененных на сервере после нее: их изменения не записаны
+func (c *GRPCClient) SyncSecretsFromClient(ctx context.Context, secrets []*models.RemoteSecret) ([]*models.RemoteSecret, error) {
+
+	protoSecrets := make([]*proto.Secret, 0, len(secrets))
 	for _, remoteSecret := range secrets {
 		protoSecrets = append(protoSecrets, models.ConvertRemoteSecretToProtoSecret(remoteSecret))
 	}
@@ -159,10 +496,52 @@ func (c *GRPCClient) SyncSecretsFromClient(ctx context.Context, secrets []*model
 		Secrets: protoSecrets,
 	}
 
-	return c.withAuthRetry(c.withConnNumber(ctx), func(authCtx context.Context) error {
-		_, err := c.secretClient.SyncSecretsFromClient(authCtx, req)
+	var resp *proto.SyncSecretsFromClientResponse
+	err := c.withAuthRetry(c.withConnNumber(ctx), func(authCtx context.Context) error {
+		var err error
+		resp, err = c.secretClient.SyncSecretsFromClient(authCtx, req)
 		return err
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	conflicts := make([]*models.RemoteSecret, 0, len(resp.GetConflicts()))
+	for _, secret := range resp.GetConflicts() {
+		conflicts = append(conflicts, models.ConvertProtoSecretToRemoteSecret(secret))
+	}
+
+	return conflicts, nil
+}
+
+// GetChangesSince возвращает изменения после ревизии revision и новую ревизию для следующего запроса
+func (c *GRPCClient) GetChangesSince(ctx context.Context, revision int64) ([]*models.RemoteSecret, int64, error) {
+	var resp *proto.GetChangesSinceResponse
+
+	req := &proto.GetChangesSinceRequest{
+		Revision: revision,
+	}
+
+	err := c.withAuthRetry(c.withConnNumber(ctx), func(authCtx context.Context) error {
+		var err error
+		resp, err = c.secretClient.GetChangesSince(authCtx, req)
+		return err
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	secrets := make([]*models.RemoteSecret, len(resp.GetSecrets()))
+	for i, secretResp := range resp.GetSecrets() {
+		secrets[i] = models.ConvertProtoSecretToRemoteSecret(secretResp)
+	}
+
+	return secrets, resp.GetRevision(), nil
+}
+
+// SetSinceRevision ревизия, начиная с которой стрим GetUpdatedSecrets досылает пропущенные изменения
+func (c *GRPCClient) SetSinceRevision(revision int64) {
+	c.sinceRevision = revision
 }
 
 func (c *GRPCClient) GetStream() grpc.ServerStreamingClient[proto.GetUpdatedSecretsResponse] {
@@ -2,9 +2,12 @@ package grpcclient
 
 import (
 	"context"
+	"github.com/s-turchinskiy/keeper/internal/client/models"
 	"github.com/s-turchinskiy/keeper/internal/utils/errorsutils"
 	"github.com/s-turchinskiy/keeper/models/proto"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 	"strconv"
 )
 
@@ -48,16 +51,63 @@ func (c *GRPCClient) createAuthContext(ctx context.Context) context.Context {
 	return metadata.NewOutgoingContext(ctx, md)
 }
 
+// ensureAuth получает токен доступа: сначала по токену обновления, если сессия завершена - входом по паролю
 func (c *GRPCClient) ensureAuth(ctx context.Context) error {
 	if c.token != "" {
 		return nil
 	}
 
+	if c.refreshToken != "" {
+		err := c.refresh(ctx)
+		if err == nil {
+			return nil
+		}
+		if !isUnauthorizedError(err) {
+			return err
+		}
+	}
+
 	return c.Login(ctx, c.login, c.password)
 }
 
+// refresh меняет токен обновления на новую пару токенов, использованный токен обновления больше не действует
+func (c *GRPCClient) refresh(ctx context.Context) error {
+
+	req := &proto.RefreshTokenRequest{
+		RefreshToken: c.refreshToken,
+	}
+
+	resp, err := c.authClient.RefreshToken(c.withConnNumber(ctx), req)
+	if err != nil {
+		c.refreshToken = ""
+		return err
+	}
+
+	c.token = resp.GetToken()
+	c.refreshToken = resp.GetRefreshToken()
+
+	return nil
+}
+
 func isUnauthorizedError(err error) bool {
-	return err != nil && err.Error() == "rpc error: code = Unauthenticated desc = invalid token"
+	return status.Code(err) == codes.Unauthenticated
+}
+
+// convertConflictError превращает ответ Aborted в models.ConflictError с версией секрета на сервере
+func convertConflictError(secretID string, err error) error {
+	st, ok := status.FromError(err)
+	if !ok || st.Code() != codes.Aborted {
+		return err
+	}
+
+	conflictErr := &models.ConflictError{SecretID: secretID}
+	for _, detail := range st.Details() {
+		if current, ok := detail.(*proto.Secret); ok {
+			conflictErr.Current = models.ConvertProtoSecretToRemoteSecret(current)
+		}
+	}
+
+	return conflictErr
 }
 
 func (c *GRPCClient) withConnNumber(ctx context.Context) context.Context {
@@ -70,7 +120,11 @@ func (c *GRPCClient) withConnNumber(ctx context.Context) context.Context {
 func (c *GRPCClient) setStream(ctx context.Context) error {
 	return c.withAuthRetry(c.withConnNumber(ctx), func(authCtx context.Context) error {
 		var err error
-		c.stream, err = c.secretClient.GetUpdatedSecrets(authCtx, &proto.GetUpdatedSecretsRequest{})
+		req := &proto.GetUpdatedSecretsRequest{}
+		if c.sinceRevision > 0 {
+			req.SinceRevision = &c.sinceRevision
+		}
+		c.stream, err = c.secretClient.GetUpdatedSecrets(authCtx, req)
 		return errorsutils.WrapError(err)
 	})
 }
@@ -2,6 +2,7 @@ package grpcclient
 
 import (
 	"context"
+	"github.com/s-turchinskiy/keeper/internal/client/models"
 	"github.com/s-turchinskiy/keeper/internal/utils/errorsutils"
 	"github.com/s-turchinskiy/keeper/models/proto"
 	"google.golang.org/grpc"
@@ -21,8 +22,13 @@ type GRPCClient struct {
 	login            string
 	password         string
 	token            string
+	refreshToken     string
+	device           *models.Device
+	twoFactorPrompt  TwoFactorPrompt
+	sinceRevision    int64
 }
 
+// NewGRPCClient по умолчанию соединение без шифрования, grpc.WithTransportCredentials в extraOpts его заменяет
 func NewGRPCClient(ctx context.Context, serverAddress string, login string, password string, extraOpts ...grpc.DialOption) (*GRPCClient, error) {
 
 	grpcClient := &GRPCClient{
@@ -5,6 +5,7 @@ import (
 	"github.com/s-turchinskiy/keeper/models/proto"
 	"google.golang.org/grpc"
 
+	"github.com/s-turchinskiy/keeper/internal/client/crypto"
 	"github.com/s-turchinskiy/keeper/internal/client/models"
 )
 
@@ -14,14 +15,36 @@ type SenderReceiver interface {
 	GetConnectionNumber(ctx context.Context) (uint64, error)
 	ConnectionNumber() uint64
 	Login(ctx context.Context, login, password string) error
-	Register(ctx context.Context, login, password string) (string, error)
+	SetCredentials(login, password string)
+	Logout(ctx context.Context, allSessions bool) (int64, error)
+	SetDevice(device *models.Device)
+	ListDevices(ctx context.Context) ([]*models.Device, error)
+	RevokeDevice(ctx context.Context, deviceID string) (int64, error)
+	SetTwoFactorPrompt(prompt TwoFactorPrompt)
+	EnableTwoFactor(ctx context.Context) (string, string, error)
+	ConfirmTwoFactor(ctx context.Context, code string) ([]string, error)
+	DisableTwoFactor(ctx context.Context, code string) error
+	GetTwoFactorStatus(ctx context.Context) (*models.TwoFactorStatus, error)
+	Register(ctx context.Context, login, password string, kdf *crypto.KDFParams) (string, error)
+	GetKDFParams(ctx context.Context, login string) (*crypto.KDFParams, error)
+	ChangePassword(ctx context.Context, newPassword string, vaultKey []byte, kdf *crypto.KDFParams) error
+	GetVaultKey(ctx context.Context) ([]byte, error)
+	SetVaultKey(ctx context.Context, vaultKey []byte, replace bool) error
 
-	SetSecret(ctx context.Context, secret *models.RemoteSecret) error
+	SetSecret(ctx context.Context, secret *models.RemoteSecret, expected *models.ExpectedVersion) (int64, error)
 	GetSecret(ctx context.Context, secretID string) (*models.RemoteSecret, error)
-	UpdateSecret(ctx context.Context, secret *models.RemoteSecret) error
+	UpdateSecret(ctx context.Context, secret *models.RemoteSecret, expected *models.ExpectedVersion) (int64, error)
 	DeleteSecret(ctx context.Context, secretID string) error
+	UndeleteSecret(ctx context.Context, secretID string) (*models.RemoteSecret, error)
+	ListDeletedSecrets(ctx context.Context) ([]*models.RemoteSecret, error)
+	PurgeDeletedSecrets(ctx context.Context) (int64, error)
 	ListSecrets(ctx context.Context) ([]*models.RemoteSecret, error)
+	ListSecretVersions(ctx context.Context, secretID string) ([]*models.SecretVersion, error)
+	GetSecretVersion(ctx context.Context, secretID string, version int64) (*models.SecretVersion, error)
+	RekeySecrets(ctx context.Context, versions []*models.SecretVersion) (int64, error)
 
-	SyncSecretsFromClient(ctx context.Context, secrets []*models.RemoteSecret) error
+	SyncSecretsFromClient(ctx context.Context, secrets []*models.RemoteSecret) ([]*models.RemoteSecret, error)
+	GetChangesSince(ctx context.Context, revision int64) ([]*models.RemoteSecret, int64, error)
+	SetSinceRevision(revision int64)
 	GetStream() grpc.ServerStreamingClient[proto.GetUpdatedSecretsResponse]
 }
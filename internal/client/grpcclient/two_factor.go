@@ -0,0 +1,143 @@
+package grpcclient
+
+import (
+	"context"
+	"errors"
+
+	"github.com/s-turchinskiy/keeper/internal/client/models"
+	"github.com/s-turchinskiy/keeper/models/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	ErrTwoFactorRequired        = errors.New("two-factor code required")
+	ErrInvalidTwoFactorCode     = errors.New("invalid two-factor code")
+	ErrTooManyTwoFactorAttempts = errors.New("too many two-factor attempts, try later")
+)
+
+// TwoFactorPrompt запрашивает код второго фактора, когда сервер требует его при входе
+type TwoFactorPrompt func(ctx context.Context) (string, error)
+
+// SetTwoFactorPrompt без prompt вход пользователя со вторым фактором завершается ErrTwoFactorRequired
+func (c *GRPCClient) SetTwoFactorPrompt(prompt TwoFactorPrompt) {
+	c.twoFactorPrompt = prompt
+}
+
+// loginTwoFactor второй шаг входа: код TOTP или код восстановления в ответ на challenge
+func (c *GRPCClient) loginTwoFactor(ctx context.Context, challenge string) (*proto.LoginResponse, error) {
+
+	if c.twoFactorPrompt == nil {
+		return nil, ErrTwoFactorRequired
+	}
+
+	code, err := c.twoFactorPrompt(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &proto.LoginRequest{
+		Challenge:     challenge,
+		TwoFactorCode: code,
+		Device:        models.ConvertDeviceToProtoDevice(c.device),
+	}
+
+	resp, err := c.authClient.Login(c.withConnNumber(ctx), req)
+	if status.Code(err) == codes.PermissionDenied {
+		return nil, ErrDeviceRevoked
+	}
+	if err != nil {
+		return nil, twoFactorError(err)
+	}
+
+	return resp, nil
+}
+
+// EnableTwoFactor начинает подключение TOTP, возвращает секрет в base32 и otpauth URI.
+// Второй фактор включается после ConfirmTwoFactor
+func (c *GRPCClient) EnableTwoFactor(ctx context.Context) (string, string, error) {
+
+	var resp *proto.EnableTwoFactorResponse
+	err := c.withAuthRetry(c.withConnNumber(ctx), func(authCtx context.Context) error {
+		var err error
+		resp, err = c.authClient.EnableTwoFactor(authCtx, &proto.EnableTwoFactorRequest{})
+		return err
+	})
+	if err != nil {
+		return "", "", twoFactorError(err)
+	}
+
+	return resp.GetSecret(), resp.GetOtpauthUri(), nil
+}
+
+// ConfirmTwoFactor включает второй фактор первым кодом из приложения-аутентификатора, возвращает коды восстановления
+func (c *GRPCClient) ConfirmTwoFactor(ctx context.Context, code string) ([]string, error) {
+
+	req := &proto.ConfirmTwoFactorRequest{
+		Code: code,
+	}
+
+	var resp *proto.ConfirmTwoFactorResponse
+	err := c.withAuthRetry(c.withConnNumber(ctx), func(authCtx context.Context) error {
+		var err error
+		resp, err = c.authClient.ConfirmTwoFactor(authCtx, req)
+		return err
+	})
+	if err != nil {
+		return nil, twoFactorError(err)
+	}
+
+	return resp.GetRecoveryCodes(), nil
+}
+
+// DisableTwoFactor отключает второй фактор, code - действующий код TOTP или код восстановления
+func (c *GRPCClient) DisableTwoFactor(ctx context.Context, code string) error {
+
+	req := &proto.DisableTwoFactorRequest{
+		Code: code,
+	}
+
+	err := c.withAuthRetry(c.withConnNumber(ctx), func(authCtx context.Context) error {
+		_, err := c.authClient.DisableTwoFactor(authCtx, req)
+		return err
+	})
+	if err != nil {
+		return twoFactorError(err)
+	}
+
+	return nil
+}
+
+func (c *GRPCClient) GetTwoFactorStatus(ctx context.Context) (*models.TwoFactorStatus, error) {
+
+	var resp *proto.GetTwoFactorStatusResponse
+	err := c.withAuthRetry(c.withConnNumber(ctx), func(authCtx context.Context) error {
+		var err error
+		resp, err = c.authClient.GetTwoFactorStatus(authCtx, &proto.GetTwoFactorStatusRequest{})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	twoFactorStatus := &models.TwoFactorStatus{
+		Enabled:           resp.GetEnabled(),
+		Pending:           resp.GetPending(),
+		RecoveryCodesLeft: int(resp.GetRecoveryCodesLeft()),
+	}
+
+	return twoFactorStatus, nil
+}
+
+func twoFactorError(err error) error {
+	switch status.Code(err) {
+	case codes.InvalidArgument:
+		return ErrInvalidTwoFactorCode
+	case codes.ResourceExhausted:
+		return ErrTooManyTwoFactorAttempts
+	case codes.FailedPrecondition:
+		return errors.New(status.Convert(err).Message())
+	default:
+		return err
+	}
+}
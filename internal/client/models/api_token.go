@@ -0,0 +1,78 @@
+package models
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+const expiryDateFormat = "2006-01-02"
+
+// APITokenData токен доступа к API. ExpiresAt nil - бессрочный токен
+type APITokenData struct {
+	Token     string     `json:"token"`
+	Scopes    []string   `json:"scopes,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// ParseTokenExpiry срок действия токена: дата YYYY-MM-DD (начало дня по местному времени) или RFC 3339,
+// пустая строка - бессрочный
+func ParseTokenExpiry(value string) (*time.Time, error) {
+
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+
+	if expiresAt, err := time.ParseInLocation(expiryDateFormat, value, time.Local); err == nil {
+		return &expiresAt, nil
+	}
+
+	expiresAt, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expiry format, use YYYY-MM-DD or RFC 3339")
+	}
+
+	return &expiresAt, nil
+}
+
+func (d APITokenData) Validate() error {
+
+	token := strings.TrimSpace(d.Token)
+	if token == "" {
+		return fmt.Errorf("token is required")
+	}
+	if len(token) > MaxAPITokenLength {
+		return fmt.Errorf("token too long: %d characters (max: %d)", len(token), MaxAPITokenLength)
+	}
+	if strings.ContainsAny(token, "\r\n\t") {
+		return fmt.Errorf("token must be a single line")
+	}
+
+	if len(d.Scopes) > MaxAPITokenScopes {
+		return fmt.Errorf("too many scopes: %d (max: %d)", len(d.Scopes), MaxAPITokenScopes)
+	}
+	for i, scope := range d.Scopes {
+		if scope == "" || strings.ContainsAny(scope, " \r\n\t") {
+			return fmt.Errorf("invalid scope %q: must be non-empty without spaces", scope)
+		}
+		if len(scope) > MaxScopeLength {
+			return fmt.Errorf("scope too long: %d characters (max: %d)", len(scope), MaxScopeLength)
+		}
+		if slices.Contains(d.Scopes[:i], scope) {
+			return fmt.Errorf("duplicate scope %q", scope)
+		}
+	}
+
+	if d.ExpiresAt != nil && d.ExpiresAt.IsZero() {
+		return fmt.Errorf("invalid expiry")
+	}
+
+	return nil
+}
+
+// Expired срок действия токена истек к моменту now
+func (d APITokenData) Expired(now time.Time) bool {
+	return d.ExpiresAt != nil && !now.Before(*d.ExpiresAt)
+}
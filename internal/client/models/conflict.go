@@ -0,0 +1,68 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Resolution способ разрешения конфликта, когда секрет изменен и локально, и на сервере
+type Resolution string
+
+const (
+	ResolutionAsk      Resolution = "ask"
+	ResolutionLocal    Resolution = "local"
+	ResolutionRemote   Resolution = "remote"
+	ResolutionKeepBoth Resolution = "keep-both"
+)
+
+// ConflictResolver выбирает версию секрета, remote равен nil, если секрет удален на сервере
+type ConflictResolver func(local, remote *LocalSecret) (Resolution, error)
+
+func ParseResolution(value string) (Resolution, error) {
+	switch resolution := Resolution(value); resolution {
+	case ResolutionAsk, ResolutionLocal, ResolutionRemote, ResolutionKeepBoth:
+		return resolution, nil
+	default:
+		return "", fmt.Errorf("unknown resolution: %s, use ask, local, remote or keep-both", value)
+	}
+}
+
+// ConflictCopyName имя, под которым при keep-both сохраняется локальная версия
+func ConflictCopyName(name string, t time.Time) string {
+	return fmt.Sprintf("%s (conflict %s)", name, t.Local().Format("2006-01-02 15-04-05"))
+}
+
+// ExpectedVersion версия секрета на сервере, относительно которой сделано изменение
+type ExpectedVersion struct {
+	Hash     *string
+	Revision *int64
+}
+
+func ExpectRevision(revision int64) *ExpectedVersion {
+	return &ExpectedVersion{Revision: &revision}
+}
+
+func ExpectHash(hash string) *ExpectedVersion {
+	return &ExpectedVersion{Hash: &hash}
+}
+
+// ConflictError сервер отклонил запись, так как секрет на нем уже изменен с другого устройства
+type ConflictError struct {
+	SecretID string
+	Name     string // заполняется, если известно имя секрета
+	Current  *RemoteSecret
+}
+
+func (e *ConflictError) Error() string {
+	name := e.Name
+	if name == "" {
+		name = e.SecretID
+	}
+
+	if e.Current == nil || e.Current.Deleted {
+		return fmt.Sprintf("secret '%s' was changed on the server, run sync first", name)
+	}
+
+	return fmt.Sprintf("secret '%s' was changed on the server (revision %d, modified %s), run sync first",
+		name, e.Current.Revision, e.Current.LastModified.Local().Format("2006-01-02 15:04:05"))
+}
@@ -5,6 +5,10 @@ const (
 	SecretTypeText     = "text"
 	SecretTypeBinary   = "binary"
 	SecretTypeCard     = "card"
+	SecretTypeOTP      = "otp"
+	SecretTypeSSHKey   = "ssh_key"
+	SecretTypeAPIToken = "api_token"
+	SecretTypeIdentity = "identity"
 )
 
 const (
@@ -14,4 +18,13 @@ const (
 	MaxUsernameLength   = 255
 	MaxPasswordLength   = 1024
 	MaxURLLength        = 2048
+	MaxOTPPeriod        = 3600 // секунд
+	MaxSSHKeySize       = 16 * 1024
+	MaxAPITokenLength   = 8192
+	MaxAPITokenScopes   = 100
+	MaxScopeLength      = 255
+	MaxNameLength       = 255
+	MaxAddressLength    = 1024
+	MaxIdentityDocs     = 20
+	MaxDocumentLength   = 64
 )
@@ -2,9 +2,11 @@ package models
 
 import "encoding/json"
 
+// SecretDataContainer все, что сервер получает только в зашифрованном виде
 type SecretDataContainer struct {
 	Type       string     `json:"type"`
 	Name       string     `json:"name"`
+	Metadata   string     `json:"metadata,omitempty"`
 	SecretData SecretData `json:"-"`
 }
 
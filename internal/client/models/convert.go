@@ -17,6 +17,7 @@ func ConvertLocalSecretToRemoteSecret(cryptor crypto.Cryptor, localSecret *Local
 	secretDataContainer := &SecretDataContainer{
 		Type:       localSecret.Type,
 		Name:       localSecret.Name,
+		Metadata:   localSecret.Metadata,
 		SecretData: secretData,
 	}
 
@@ -25,23 +26,24 @@ func ConvertLocalSecretToRemoteSecret(cryptor crypto.Cryptor, localSecret *Local
 		return nil, err
 	}
 
-	encryptedRemoteData, err := cryptor.EncryptSecretData(remoteData)
+	encryptedRemoteData, err := cryptor.EncryptSecretData(localSecret.ID, remoteData)
 	if err != nil {
 		return nil, err
 	}
 
 	remoteSecret := &RemoteSecret{
-		Name:         localSecret.Name,
+		ID:           localSecret.ID,
 		LastModified: localSecret.LastModified,
 		Hash:         localSecret.Hash,
 		Data:         encryptedRemoteData,
+		Revision:     localSecret.Revision,
 	}
 
 	return remoteSecret, nil
 }
 
 func ConvertRemoteSecretToLocalSecret(cryptor crypto.Cryptor, remoteSecret *RemoteSecret) (*LocalSecret, error) {
-	remoteDecryptedData, err := cryptor.DecryptSecretData(remoteSecret.Data)
+	remoteDecryptedData, err := cryptor.DecryptSecretData(remoteSecret.ID, remoteSecret.Data)
 	if err != nil {
 		return nil, err
 	}
@@ -52,34 +54,106 @@ func ConvertRemoteSecretToLocalSecret(cryptor crypto.Cryptor, remoteSecret *Remo
 	}
 
 	localSecret := &LocalSecret{
-		Name:         remoteSecret.Name,
+		ID:           remoteSecret.ID,
+		Name:         secretDataContainer.Name,
+		Metadata:     secretDataContainer.Metadata,
 		Type:         secretDataContainer.Type,
 		LastModified: remoteSecret.LastModified,
-		Hash:         remoteSecret.Hash,
+		Revision:     remoteSecret.Revision,
 	}
 
+	// хеш пересчитывается по расшифрованным данным, а не берется с сервера,
+	// чтобы совпадать с хешем, который SetData дает локальной копии тех же данных
 	err = localSecret.SetData(cryptor, secretDataContainer.SecretData)
 	if err != nil {
 		return nil, err
 	}
+	localSecret.BaseHash = localSecret.Hash
 
 	return localSecret, nil
 }
 
 func ConvertProtoSecretToRemoteSecret(secretResp *proto.Secret) *RemoteSecret {
 	return &RemoteSecret{
-		Name:         secretResp.GetId(),
+		ID:           secretResp.GetId(),
 		LastModified: secretResp.GetLastModified().AsTime(),
 		Hash:         secretResp.GetHash(),
 		Data:         secretResp.GetData(),
+		Deleted:      secretResp.GetDeleted(),
+		Revision:     secretResp.GetRevision(),
+	}
+}
+
+func ConvertProtoSecretVersionToSecretVersion(versionResp *proto.SecretVersion) *SecretVersion {
+	return &SecretVersion{
+		RemoteSecret: *ConvertProtoSecretToRemoteSecret(versionResp.GetSecret()),
+		Version:      versionResp.GetVersion(),
 	}
 }
 
 func ConvertRemoteSecretToProtoSecret(secret *RemoteSecret) *proto.Secret {
 	return &proto.Secret{
-		Id:           secret.Name,
+		Id:           secret.ID,
 		LastModified: timestamppb.New(secret.LastModified),
 		Hash:         secret.Hash,
 		Data:         secret.Data,
+		Revision:     secret.Revision,
+	}
+}
+
+func ConvertKDFParamsToProtoKDFParams(params *crypto.KDFParams) *proto.KDFParams {
+	if params == nil {
+		return nil
+	}
+
+	return &proto.KDFParams{
+		Salt:      params.Salt,
+		Time:      params.Time,
+		MemoryKib: params.MemoryKiB,
+		Threads:   uint32(params.Threads),
+	}
+}
+
+func ConvertProtoKDFParamsToKDFParams(params *proto.KDFParams) *crypto.KDFParams {
+	if params == nil {
+		return nil
+	}
+
+	return &crypto.KDFParams{
+		Salt:      params.GetSalt(),
+		Time:      params.GetTime(),
+		MemoryKiB: params.GetMemoryKib(),
+		Threads:   uint8(params.GetThreads()),
+	}
+}
+
+func ConvertDeviceToProtoDevice(device *Device) *proto.Device {
+	if device == nil {
+		return nil
+	}
+
+	return &proto.Device{
+		Id:            device.ID,
+		Name:          device.Name,
+		Os:            device.OS,
+		ClientVersion: device.ClientVersion,
 	}
 }
+
+func ConvertProtoDeviceToDevice(device *proto.Device) *Device {
+	result := &Device{
+		ID:            device.GetId(),
+		Name:          device.GetName(),
+		OS:            device.GetOs(),
+		ClientVersion: device.GetClientVersion(),
+		CreatedAt:     device.GetCreatedAt().AsTime(),
+		LastSeenAt:    device.GetLastSeenAt().AsTime(),
+	}
+
+	if device.GetRevokedAt() != nil {
+		revokedAt := device.GetRevokedAt().AsTime()
+		result.RevokedAt = &revokedAt
+	}
+
+	return result
+}
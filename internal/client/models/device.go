@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+)
+
+// Device устройство пользователя на сервере. ID клиент генерирует один раз и хранит в локальном хранилище
+type Device struct {
+	ID            string
+	Name          string
+	OS            string
+	ClientVersion string
+	CreatedAt     time.Time
+	LastSeenAt    time.Time
+	RevokedAt     *time.Time
+	Current       bool // устройство, на котором запущен клиент
+}
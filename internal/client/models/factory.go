@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/google/uuid"
+
 	"github.com/s-turchinskiy/keeper/internal/client/crypto"
 )
 
@@ -14,6 +16,7 @@ func NewSecretModel(base BaseSecret, data SecretData, cryptor crypto.Cryptor) (*
 	}
 
 	secret := &LocalSecret{
+		ID:           uuid.NewString(),
 		Name:         base.Name,
 		Type:         base.Type,
 		LastModified: time.Now().Truncate(time.Microsecond),
@@ -0,0 +1,92 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	documentTypeRegex   = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+	documentNumberRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9 ./-]*$`)
+)
+
+// IdentityDocument документ, Type - вид документа, например passport или driver_license
+type IdentityDocument struct {
+	Type   string `json:"type"`
+	Number string `json:"number"`
+}
+
+// IdentityData личные данные: имя, адрес и номера документов
+type IdentityData struct {
+	FullName  string             `json:"full_name"`
+	Address   string             `json:"address,omitempty"`
+	Documents []IdentityDocument `json:"documents,omitempty"`
+}
+
+// ParseIdentityDocument документ из строки вида type=number, например passport=4509 123456
+func ParseIdentityDocument(value string) (IdentityDocument, error) {
+
+	documentType, number, found := strings.Cut(value, "=")
+	if !found {
+		return IdentityDocument{}, fmt.Errorf("invalid document %q, use type=number", value)
+	}
+
+	document := IdentityDocument{
+		Type:   strings.ToLower(strings.TrimSpace(documentType)),
+		Number: strings.TrimSpace(number),
+	}
+
+	return document, document.Validate()
+}
+
+func (d IdentityDocument) Validate() error {
+
+	if !documentTypeRegex.MatchString(d.Type) {
+		return fmt.Errorf("invalid document type %q: use lowercase letters, digits, '_' or '-'", d.Type)
+	}
+
+	if len(d.Number) > MaxDocumentLength {
+		return fmt.Errorf("%s number too long: %d characters (max: %d)", d.Type, len(d.Number), MaxDocumentLength)
+	}
+	if !documentNumberRegex.MatchString(d.Number) {
+		return fmt.Errorf("invalid %s number: use letters, digits, spaces, '.', '/' or '-'", d.Type)
+	}
+
+	return nil
+}
+
+// MaskedNumber номер документа, в котором видны только последние 4 символа
+func (d IdentityDocument) MaskedNumber() string {
+	const visible = 4
+	if len(d.Number) <= visible {
+		return strings.Repeat("*", len(d.Number))
+	}
+	return strings.Repeat("*", len(d.Number)-visible) + d.Number[len(d.Number)-visible:]
+}
+
+func (d IdentityData) Validate() error {
+
+	name := strings.TrimSpace(d.FullName)
+	if name == "" {
+		return fmt.Errorf("full name is required")
+	}
+	if len(name) > MaxNameLength {
+		return fmt.Errorf("full name too long: %d characters (max: %d)", len(name), MaxNameLength)
+	}
+
+	if len(d.Address) > MaxAddressLength {
+		return fmt.Errorf("address too long: %d characters (max: %d)", len(d.Address), MaxAddressLength)
+	}
+
+	if len(d.Documents) > MaxIdentityDocs {
+		return fmt.Errorf("too many documents: %d (max: %d)", len(d.Documents), MaxIdentityDocs)
+	}
+	for _, document := range d.Documents {
+		if err := document.Validate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
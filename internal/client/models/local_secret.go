@@ -15,12 +15,21 @@ type BaseSecret struct {
 }
 
 type LocalSecret struct {
-	Name         string
+	ID           string // постоянный идентификатор секрета, под ним секрет хранится на сервере
+	Name         string // имя секрета, передается на сервер только в зашифрованных данных
 	Type         string
 	LastModified time.Time
 	Hash         string
 	Data         []byte
 	Metadata     string
+	Revision     int64  // ревизия сервера, с которой секрет был синхронизирован последний раз, 0 - не синхронизирован
+	BaseHash     string // хеш последней версии, общей с сервером
+	Conflicted   bool   // сервер отклонил создание секрета: под этим ID уже есть другая версия, ее выбирает sync
+}
+
+// Modified есть ли локальные изменения, еще не отправленные на сервер
+func (s *LocalSecret) Modified() bool {
+	return s.Hash != s.BaseHash
 }
 
 func (s *LocalSecret) ParseData() (SecretData, error) {
@@ -33,10 +42,22 @@ func (s *LocalSecret) SetData(cryptor crypto.Cryptor, data SecretData) error {
 		return fmt.Errorf("failed to marshal data: %w", err)
 	}
 
-	hashData := fmt.Sprintf("%s%s", string(jsonData), s.Metadata)
+	// тип входит в хеш: одинаковые данные разных типов - разные версии секрета
+	hashData := fmt.Sprintf("%s\x00%s\x00%s\x00%s", s.Type, s.Name, string(jsonData), s.Metadata)
 	hash := cryptor.CalculateDataHash([]byte(hashData))
 
 	s.Data = jsonData
 	s.Hash = hash
 	return nil
 }
+
+// Rename меняет имя секрета, имя входит в хеш, поэтому хеш пересчитывается
+func (s *LocalSecret) Rename(cryptor crypto.Cryptor, name string) error {
+	data, err := s.ParseData()
+	if err != nil {
+		return err
+	}
+
+	s.Name = name
+	return s.SetData(cryptor, data)
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/s-turchinskiy/keeper/internal/client/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalSecretSetDataHash(t *testing.T) {
+
+	cryptor := crypto.NewCryptor("master-password", "user")
+	data := TextData{Content: "content"}
+
+	newSecret := func(secretType string) *LocalSecret {
+		secret := &LocalSecret{Name: "name", Type: secretType, Metadata: "metadata"}
+		require.NoError(t, secret.SetData(cryptor, data))
+		return secret
+	}
+
+	text := newSecret(SecretTypeText)
+	require.NotEmpty(t, text.Hash)
+	require.Equal(t, text.Hash, newSecret(SecretTypeText).Hash)
+	require.NotEqual(t, text.Hash, newSecret(SecretTypePassword).Hash)
+
+	renamed := newSecret(SecretTypeText)
+	require.NoError(t, renamed.Rename(cryptor, "other"))
+	require.NotEqual(t, text.Hash, renamed.Hash)
+}
@@ -0,0 +1,190 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/s-turchinskiy/keeper/internal/utils/otputils"
+)
+
+// OTPData ключ одноразовых паролей. Пустые Type, Algorithm, Digits и Period - значения по умолчанию:
+// TOTP, SHA1, 6 цифр, 30 секунд. Counter - счетчик следующего кода HOTP
+type OTPData struct {
+	Type      string `json:"type,omitempty"`
+	Issuer    string `json:"issuer,omitempty"`
+	Account   string `json:"account"`
+	Secret    string `json:"secret"`
+	Algorithm string `json:"algorithm,omitempty"`
+	Digits    int    `json:"digits,omitempty"`
+	Period    int    `json:"period,omitempty"`
+	Counter   uint64 `json:"counter,omitempty"`
+}
+
+// OTPCode код одноразового пароля. Remaining - сколько еще действует код TOTP,
+// Counter - значение счетчика, которым получен код HOTP
+type OTPCode struct {
+	Code      string
+	Type      string
+	Remaining time.Duration
+	Counter   uint64
+}
+
+// ParseOTPURI ключ из otpauth:// URI, например из QR кода
+func ParseOTPURI(uri string) (OTPData, error) {
+
+	key, err := otputils.ParseURI(uri)
+	if err != nil {
+		return OTPData{}, err
+	}
+
+	data := OTPData{
+		Type:      key.Type,
+		Issuer:    key.Issuer,
+		Account:   key.Account,
+		Secret:    otputils.EncodeSecret(key.Secret),
+		Algorithm: string(key.Params.Algorithm),
+		Digits:    key.Params.Digits,
+		Period:    int(key.Params.Period / time.Second),
+		Counter:   key.Counter,
+	}
+
+	return data, nil
+}
+
+// WithDefaults явные значения вместо пустых, секрет в base32 без пробелов в верхнем регистре
+func (d OTPData) WithDefaults() OTPData {
+
+	d.Type = strings.ToLower(strings.TrimSpace(d.Type))
+	if d.Type == "" {
+		d.Type = otputils.TypeTOTP
+	}
+
+	d.Algorithm = strings.ToUpper(strings.TrimSpace(d.Algorithm))
+	if d.Algorithm == "" {
+		d.Algorithm = string(otputils.AlgorithmSHA1)
+	}
+
+	if d.Digits == 0 {
+		d.Digits = otputils.DefaultDigits
+	}
+
+	if d.Period == 0 && d.Type == otputils.TypeTOTP {
+		d.Period = int(otputils.DefaultPeriod / time.Second)
+	}
+
+	d.Secret = strings.ToUpper(strings.Join(strings.Fields(d.Secret), ""))
+
+	return d
+}
+
+func (d OTPData) Validate() error {
+
+	if _, err := d.key(); err != nil {
+		return err
+	}
+
+	account := strings.TrimSpace(d.Account)
+	if account == "" {
+		return fmt.Errorf("account is required")
+	}
+	if len(account) > MaxUsernameLength {
+		return fmt.Errorf("account too long: %d characters (max: %d)",
+			len(account), MaxUsernameLength)
+	}
+
+	if len(d.Issuer) > MaxUsernameLength {
+		return fmt.Errorf("issuer too long: %d characters (max: %d)",
+			len(d.Issuer), MaxUsernameLength)
+	}
+	if strings.Contains(d.Issuer, ":") {
+		return fmt.Errorf("issuer must not contain ':'")
+	}
+
+	if d.Period > MaxOTPPeriod {
+		return fmt.Errorf("period too long: %d seconds (max: %d)", d.Period, MaxOTPPeriod)
+	}
+
+	return nil
+}
+
+// URI ключ в формате otpauth:// для переноса в приложение-аутентификатор
+func (d OTPData) URI() (string, error) {
+
+	key, err := d.key()
+	if err != nil {
+		return "", err
+	}
+
+	return key.URI(), nil
+}
+
+// Code код для момента now, для HOTP - код текущего значения счетчика, счетчик не меняется
+func (d OTPData) Code(now time.Time) (*OTPCode, error) {
+
+	key, err := d.key()
+	if err != nil {
+		return nil, err
+	}
+
+	if key.Type == otputils.TypeHOTP {
+		code, err := otputils.HOTP(key.Secret, key.Counter, key.Params)
+		if err != nil {
+			return nil, err
+		}
+		return &OTPCode{Code: code, Type: key.Type, Counter: key.Counter}, nil
+	}
+
+	code, err := otputils.TOTP(key.Secret, now, key.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	return &OTPCode{Code: code, Type: key.Type, Remaining: otputils.Remaining(now, key.Params.Period)}, nil
+}
+
+func (d OTPData) IsHOTP() bool {
+	return d.WithDefaults().Type == otputils.TypeHOTP
+}
+
+func (d OTPData) key() (*otputils.Key, error) {
+
+	d = d.WithDefaults()
+
+	if d.Type != otputils.TypeTOTP && d.Type != otputils.TypeHOTP {
+		return nil, fmt.Errorf("unknown otp type %q, use totp or hotp", d.Type)
+	}
+
+	secret, err := otputils.DecodeSecret(d.Secret)
+	if err != nil {
+		return nil, fmt.Errorf("secret must be base32: %w", err)
+	}
+
+	algorithm, err := otputils.ParseAlgorithm(d.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &otputils.Key{
+		Type:    d.Type,
+		Issuer:  d.Issuer,
+		Account: d.Account,
+		Secret:  secret,
+		Params: otputils.Params{
+			Algorithm: algorithm,
+			Digits:    d.Digits,
+			Period:    time.Duration(d.Period) * time.Second,
+		},
+		Counter: d.Counter,
+	}
+
+	if key.Type == otputils.TypeHOTP && key.Params.Period == 0 {
+		key.Params.Period = otputils.DefaultPeriod
+	}
+
+	if err = key.Params.Validate(); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
@@ -0,0 +1,82 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseOTPURI(t *testing.T) {
+
+	tests := []struct {
+		name string
+		uri  string
+		want OTPData
+	}{
+		{
+			name: "totp defaults",
+			uri:  "otpauth://totp/Example:alice@example.com?secret=JBSWY3DPEHPK3PXP&issuer=Example",
+			want: OTPData{Type: "totp", Issuer: "Example", Account: "alice@example.com", Secret: "JBSWY3DPEHPK3PXP",
+				Algorithm: "SHA1", Digits: 6, Period: 30},
+		},
+		{
+			name: "totp digits and period",
+			uri:  "otpauth://totp/alice?secret=JBSWY3DPEHPK3PXP&algorithm=SHA256&digits=8&period=60",
+			want: OTPData{Type: "totp", Account: "alice", Secret: "JBSWY3DPEHPK3PXP", Algorithm: "SHA256", Digits: 8, Period: 60},
+		},
+		{
+			name: "hotp counter",
+			uri:  "otpauth://hotp/Bank:bob?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&digits=7&counter=42",
+			want: OTPData{Type: "hotp", Issuer: "Bank", Account: "bob", Secret: "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ",
+				Algorithm: "SHA1", Digits: 7, Period: 30, Counter: 42},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := ParseOTPURI(tt.uri)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, data)
+			require.NoError(t, data.Validate())
+
+			// экспорт и повторный импорт ничего не теряют
+			uri, err := data.URI()
+			require.NoError(t, err)
+			again, err := ParseOTPURI(uri)
+			require.NoError(t, err)
+			require.Equal(t, data, again)
+		})
+	}
+
+	_, err := ParseOTPURI("otpauth://totp/alice?secret=JBSWY3DPEHPK3PXP&digits=10")
+	require.Error(t, err)
+}
+
+func TestOTPDataCode(t *testing.T) {
+
+	// секрет RFC 4226, Appendix D: код счетчика 9
+	hotp, err := ParseOTPURI("otpauth://hotp/bob?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&counter=9")
+	require.NoError(t, err)
+	require.True(t, hotp.IsHOTP())
+
+	code, err := hotp.Code(time.Now())
+	require.NoError(t, err)
+	require.Equal(t, &OTPCode{Code: "520489", Type: "hotp", Counter: 9}, code)
+
+	// период и число цифр из URI действуют на код TOTP: RFC 6238, Appendix B, момент 59 при периоде 30
+	totp, err := ParseOTPURI("otpauth://totp/alice?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&digits=8&period=30")
+	require.NoError(t, err)
+	require.False(t, totp.IsHOTP())
+
+	code, err = totp.Code(time.Unix(59, 0))
+	require.NoError(t, err)
+	require.Equal(t, &OTPCode{Code: "94287082", Type: "totp", Remaining: time.Second}, code)
+
+	// при периоде 60 шаг 1 начинается на 60-й секунде
+	totp.Period = 60
+	code, err = totp.Code(time.Unix(89, 0))
+	require.NoError(t, err)
+	require.Equal(t, "94287082", code.Code)
+	require.Equal(t, 31*time.Second, code.Remaining)
+}
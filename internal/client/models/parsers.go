@@ -5,25 +5,28 @@ import (
 	"fmt"
 )
 
+// secretDataDecoders данные секрета по его типу, новый тип секрета регистрируется здесь
+var secretDataDecoders = map[string]func([]byte) (SecretData, error){
+	SecretTypePassword: decodeSecretData[LoginData],
+	SecretTypeText:     decodeSecretData[TextData],
+	SecretTypeBinary:   decodeSecretData[FileData],
+	SecretTypeCard:     decodeSecretData[CardData],
+	SecretTypeOTP:      decodeSecretData[OTPData],
+	SecretTypeSSHKey:   decodeSecretData[SSHKeyData],
+	SecretTypeAPIToken: decodeSecretData[APITokenData],
+	SecretTypeIdentity: decodeSecretData[IdentityData],
+}
+
 func parseSecretData(secretType string, inData []byte) (SecretData, error) {
-	switch secretType {
-	case SecretTypePassword:
-		var outData LoginData
-		err := json.Unmarshal(inData, &outData)
-		return outData, err
-	case SecretTypeText:
-		var outData TextData
-		err := json.Unmarshal(inData, &outData)
-		return outData, err
-	case SecretTypeBinary:
-		var outData FileData
-		err := json.Unmarshal(inData, &outData)
-		return outData, err
-	case SecretTypeCard:
-		var outData CardData
-		err := json.Unmarshal(inData, &outData)
-		return outData, err
-	default:
+	decode, ok := secretDataDecoders[secretType]
+	if !ok {
 		return nil, fmt.Errorf("unknown secret type: %s", secretType)
 	}
+	return decode(inData)
+}
+
+func decodeSecretData[T SecretData](inData []byte) (SecretData, error) {
+	var outData T
+	err := json.Unmarshal(inData, &outData)
+	return outData, err
 }
@@ -5,8 +5,16 @@ import (
 )
 
 type RemoteSecret struct {
-	Name         string
+	ID           string
 	LastModified time.Time
 	Hash         string
 	Data         []byte
+	Deleted      bool
+	Revision     int64
+}
+
+// SecretVersion предыдущая версия секрета из истории на сервере
+type SecretVersion struct {
+	RemoteSecret
+	Version int64
 }
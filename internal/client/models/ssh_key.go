@@ -0,0 +1,101 @@
+package models
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// SSHKeyData закрытый ключ SSH. PublicKey в формате authorized_keys и Fingerprint (SHA256)
+// вычисляются из закрытого ключа, если не указаны, и проверяются на соответствие ему
+type SSHKeyData struct {
+	PrivateKey  string `json:"private_key"`
+	PublicKey   string `json:"public_key,omitempty"`
+	Passphrase  string `json:"passphrase,omitempty"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+// WithDerivedFields открытый ключ, если он не указан, и отпечаток из закрытого ключа
+func (d SSHKeyData) WithDerivedFields() (SSHKeyData, error) {
+
+	publicKey, err := d.derivePublicKey()
+	if err != nil {
+		return d, err
+	}
+
+	if strings.TrimSpace(d.PublicKey) == "" {
+		d.PublicKey = strings.TrimSpace(string(ssh.MarshalAuthorizedKey(publicKey)))
+	}
+	d.Fingerprint = ssh.FingerprintSHA256(publicKey)
+
+	return d, nil
+}
+
+func (d SSHKeyData) Validate() error {
+
+	publicKey, err := d.derivePublicKey()
+	if err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(d.PublicKey) != "" {
+		parsed, _, _, _, err := ssh.ParseAuthorizedKey([]byte(d.PublicKey))
+		if err != nil {
+			return fmt.Errorf("invalid public key: %w", err)
+		}
+		if !bytes.Equal(parsed.Marshal(), publicKey.Marshal()) {
+			return fmt.Errorf("public key does not match private key")
+		}
+	}
+
+	if d.Fingerprint == "" {
+		return fmt.Errorf("fingerprint is required")
+	}
+	if d.Fingerprint != ssh.FingerprintSHA256(publicKey) {
+		return fmt.Errorf("fingerprint does not match private key")
+	}
+
+	return nil
+}
+
+// KeyType алгоритм ключа, например ssh-ed25519, пусто для неразбираемого ключа
+func (d SSHKeyData) KeyType() string {
+	publicKey, err := d.derivePublicKey()
+	if err != nil {
+		return ""
+	}
+	return publicKey.Type()
+}
+
+func (d SSHKeyData) derivePublicKey() (ssh.PublicKey, error) {
+
+	if strings.TrimSpace(d.PrivateKey) == "" {
+		return nil, fmt.Errorf("private key is required")
+	}
+	if len(d.PrivateKey) > MaxSSHKeySize {
+		return nil, fmt.Errorf("private key too large: %d bytes (max: %d)", len(d.PrivateKey), MaxSSHKeySize)
+	}
+
+	var (
+		signer ssh.Signer
+		err    error
+	)
+	if d.Passphrase != "" {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase([]byte(d.PrivateKey), []byte(d.Passphrase))
+	} else {
+		signer, err = ssh.ParsePrivateKey([]byte(d.PrivateKey))
+	}
+
+	var passphraseMissing *ssh.PassphraseMissingError
+	if errors.As(err, &passphraseMissing) {
+		return nil, fmt.Errorf("private key is encrypted, passphrase is required")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key: %w", err)
+	}
+
+	return signer.PublicKey(), nil
+}
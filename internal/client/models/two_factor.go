@@ -0,0 +1,8 @@
+package models
+
+// TwoFactorStatus состояние второго фактора пользователя на сервере
+type TwoFactorStatus struct {
+	Enabled           bool
+	Pending           bool // подключение начато, но не подтверждено кодом
+	RecoveryCodesLeft int
+}
@@ -0,0 +1,411 @@
+// Package filestorage локальное хранилище секретов в одном файле, не требует сервера БД.
+// Каждая запись зашифрована ключом хранилища, файл перезаписывается атомарно,
+// а на время работы клиента захватывается блокировка от одновременного доступа другим процессом
+package filestorage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/s-turchinskiy/keeper/internal/client/crypto"
+	"github.com/s-turchinskiy/keeper/internal/client/models"
+	"github.com/s-turchinskiy/keeper/internal/client/repository"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	formatVersion = 1
+	lockSuffix    = ".lock"
+)
+
+var ErrLocked = errors.New("local storage is used by another keeper process")
+
+// renameFile заменяет файл хранилища записанным временным файлом, в тестах подменяется сбоем
+var renameFile = os.Rename
+
+type FileStorage struct {
+	path    string
+	lock    *os.File
+	cryptor crypto.Cryptor
+
+	mu   sync.Mutex
+	data fileData
+}
+
+// fileData содержимое файла хранилища
+type fileData struct {
+	Version  int             `json:"version"`
+	Revision int64           `json:"revision"`
+	DeviceID string          `json:"device_id,omitempty"`
+	Secrets  []*storedSecret `json:"secrets"`
+}
+
+// storedSecret запись секрета: секрет целиком зашифрован ключом хранилища,
+// для поиска по имени хранится ключевой хеш имени
+type storedSecret struct {
+	ID        string `json:"id"`
+	NameIndex string `json:"name_index"`
+	Payload   []byte `json:"payload"`
+}
+
+// NewFileStorage открывает файл хранилища, при отсутствии файл и каталог создаются
+func NewFileStorage(path string, cryptor crypto.Cryptor) (*FileStorage, error) {
+
+	if path == "" {
+		return nil, errors.New("local storage path is empty")
+	}
+
+	err := os.MkdirAll(filepath.Dir(path), 0o700)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create local storage directory: %w", err)
+	}
+
+	lock, err := os.OpenFile(path+lockSuffix, os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open local storage lock: %w", err)
+	}
+
+	if err = lockFile(lock); err != nil {
+		_ = lock.Close()
+		return nil, fmt.Errorf("%w: %s", ErrLocked, path)
+	}
+
+	f := &FileStorage{
+		path:    path,
+		lock:    lock,
+		cryptor: cryptor,
+		data:    fileData{Version: formatVersion},
+	}
+
+	if err = f.load(); err != nil {
+		_ = f.Close(context.Background())
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (f *FileStorage) load() error {
+
+	content, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read local storage: %w", err)
+	}
+
+	var data fileData
+	if err = json.Unmarshal(content, &data); err != nil {
+		return fmt.Errorf("local storage %s is corrupted: %w", f.path, err)
+	}
+
+	if data.Version != formatVersion {
+		return fmt.Errorf("unsupported local storage format version %d", data.Version)
+	}
+
+	f.data = data
+
+	return nil
+}
+
+// save атомарно заменяет файл хранилища: данные пишутся во временный файл рядом и переименовываются,
+// поэтому при сбое на диске остается либо старое, либо новое содержимое
+func (f *FileStorage) save() error {
+
+	content, err := json.Marshal(f.data)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(f.path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(f.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+
+	if _, err = tmp.Write(content); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write local storage: %w", err)
+	}
+
+	if err = tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write local storage: %w", err)
+	}
+
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write local storage: %w", err)
+	}
+
+	if err = renameFile(tmp.Name(), f.path); err != nil {
+		return fmt.Errorf("failed to replace local storage: %w", err)
+	}
+
+	return syncDir(dir)
+}
+
+func (f *FileStorage) Create(_ context.Context, secret *models.LocalSecret) (*models.LocalSecret, error) {
+
+	record, err := f.encrypt(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.find(secret.ID) >= 0 {
+		return nil, fmt.Errorf("%w: %s", repository.ErrSecretExists, secret.ID)
+	}
+
+	f.data.Secrets = append(f.data.Secrets, record)
+	if err = f.save(); err != nil {
+		f.data.Secrets = f.data.Secrets[:len(f.data.Secrets)-1]
+		return nil, err
+	}
+
+	return secret, nil
+}
+
+func (f *FileStorage) GetAll(_ context.Context) ([]*models.LocalSecret, error) {
+
+	f.mu.Lock()
+	records := append([]*storedSecret(nil), f.data.Secrets...)
+	f.mu.Unlock()
+
+	secrets := make([]*models.LocalSecret, 0, len(records))
+	for _, record := range records {
+		secret, err := f.decrypt(record)
+		if err != nil {
+			return nil, err
+		}
+		secrets = append(secrets, secret)
+	}
+
+	return secrets, nil
+}
+
+func (f *FileStorage) GetByKey(_ context.Context, id string) (*models.LocalSecret, error) {
+
+	f.mu.Lock()
+	i := f.find(id)
+	if i < 0 {
+		f.mu.Unlock()
+		return nil, fmt.Errorf("%w: %s", repository.ErrSecretNotFound, id)
+	}
+	record := f.data.Secrets[i]
+	f.mu.Unlock()
+
+	return f.decrypt(record)
+}
+
+func (f *FileStorage) GetByName(_ context.Context, name string) (*models.LocalSecret, error) {
+
+	nameIndex, err := f.cryptor.StorageIndex(name)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	var record *storedSecret
+	for _, stored := range f.data.Secrets {
+		if stored.NameIndex == nameIndex {
+			record = stored
+			break
+		}
+	}
+	f.mu.Unlock()
+
+	if record == nil {
+		return nil, fmt.Errorf("%w: %s", repository.ErrSecretNotFound, name)
+	}
+
+	return f.decrypt(record)
+}
+
+func (f *FileStorage) UpdateByKey(_ context.Context, id string, secret *models.LocalSecret) (*models.LocalSecret, error) {
+
+	record, err := f.encrypt(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	i := f.find(id)
+	if i < 0 {
+		return nil, fmt.Errorf("%w: %s", repository.ErrSecretNotFound, id)
+	}
+
+	previous := f.data.Secrets[i]
+	f.data.Secrets[i] = record
+	if err = f.save(); err != nil {
+		f.data.Secrets[i] = previous
+		return nil, err
+	}
+
+	return secret, nil
+}
+
+func (f *FileStorage) DeleteByKey(_ context.Context, id string) error {
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	i := f.find(id)
+	if i < 0 {
+		return fmt.Errorf("%w: %s", repository.ErrSecretNotFound, id)
+	}
+
+	previous := f.data.Secrets
+	f.data.Secrets = append(append([]*storedSecret(nil), previous[:i]...), previous[i+1:]...)
+	if err := f.save(); err != nil {
+		f.data.Secrets = previous
+		return err
+	}
+
+	return nil
+}
+
+func (f *FileStorage) DeleteAll(_ context.Context) error {
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	previous := f.data
+	f.data = fileData{Version: formatVersion}
+	if err := f.save(); err != nil {
+		f.data = previous
+		return err
+	}
+
+	return nil
+}
+
+func (f *FileStorage) Count(_ context.Context) (int64, error) {
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return int64(len(f.data.Secrets)), nil
+}
+
+// EncryptPlaintext файловое хранилище появилось после шифрования локального хранилища,
+// записей открытым текстом в нем не бывает
+func (f *FileStorage) EncryptPlaintext(_ context.Context) (int, error) {
+	return 0, nil
+}
+
+// GetRevision последняя ревизия сервера, до которой клиент синхронизирован
+func (f *FileStorage) GetRevision(_ context.Context) (int64, error) {
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.data.Revision, nil
+}
+
+func (f *FileStorage) SetRevision(_ context.Context, revision int64) error {
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	previous := f.data.Revision
+	f.data.Revision = revision
+	if err := f.save(); err != nil {
+		f.data.Revision = previous
+		return err
+	}
+
+	return nil
+}
+
+// GetDeviceID ID устройства, под которым клиент входит на сервер, "" если он еще не создан
+func (f *FileStorage) GetDeviceID(_ context.Context) (string, error) {
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.data.DeviceID, nil
+}
+
+func (f *FileStorage) SetDeviceID(_ context.Context, deviceID string) error {
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	previous := f.data.DeviceID
+	f.data.DeviceID = deviceID
+	if err := f.save(); err != nil {
+		f.data.DeviceID = previous
+		return err
+	}
+
+	return nil
+}
+
+// Close снимает блокировку файла хранилища, файл блокировки остается на диске
+func (f *FileStorage) Close(_ context.Context) error {
+
+	err := unlockFile(f.lock)
+
+	return errors.Join(err, f.lock.Close())
+}
+
+func (f *FileStorage) find(id string) int {
+
+	for i, stored := range f.data.Secrets {
+		if stored.ID == id {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (f *FileStorage) encrypt(secret *models.LocalSecret) (*storedSecret, error) {
+
+	nameIndex, err := f.cryptor.StorageIndex(secret.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	plainData, err := json.Marshal(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := f.cryptor.EncryptStorageData(secret.ID, plainData)
+	if err != nil {
+		return nil, err
+	}
+
+	return &storedSecret{
+		ID:        secret.ID,
+		NameIndex: nameIndex,
+		Payload:   payload,
+	}, nil
+}
+
+func (f *FileStorage) decrypt(record *storedSecret) (*models.LocalSecret, error) {
+
+	plainData, err := f.cryptor.DecryptStorageData(record.ID, record.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt secret '%s': %w", record.ID, err)
+	}
+
+	var secret models.LocalSecret
+	if err = json.Unmarshal(plainData, &secret); err != nil {
+		return nil, err
+	}
+
+	return &secret, nil
+}
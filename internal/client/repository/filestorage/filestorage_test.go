@@ -0,0 +1,172 @@
+package filestorage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/s-turchinskiy/keeper/internal/client/crypto"
+	"github.com/s-turchinskiy/keeper/internal/client/models"
+	"github.com/s-turchinskiy/keeper/internal/client/repository"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestCryptor криптор с открытым хранилищем: без ключа хранилища записи не шифруются
+func newTestCryptor(t *testing.T) crypto.Cryptor {
+
+	cryptor := crypto.NewCryptor("password", "user", crypto.WithKDFTarget(crypto.KDFParams{Time: 1, MemoryKiB: 16 * 1024, Threads: 1}))
+
+	params, err := cryptor.NewKDFParams()
+	require.NoError(t, err)
+	cryptor.SetKDFParams(params)
+
+	_, err = cryptor.CreateVault(false)
+	require.NoError(t, err)
+
+	return cryptor
+}
+
+func newTestSecret(id string) *models.LocalSecret {
+	return &models.LocalSecret{ID: id, Name: "bank card " + id, Type: "card", Data: []byte(`{"number":"4111111111111111"}`),
+		Hash: "hash", BaseHash: "hash", Revision: 7}
+}
+
+func TestFileStorageReload(t *testing.T) {
+
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "keeper", "secrets.json")
+	cryptor := newTestCryptor(t)
+
+	storage, err := NewFileStorage(path, cryptor)
+	require.NoError(t, err)
+
+	first, second := newTestSecret("1"), newTestSecret("2")
+	_, err = storage.Create(ctx, first)
+	require.NoError(t, err)
+	_, err = storage.Create(ctx, second)
+	require.NoError(t, err)
+	require.NoError(t, storage.DeleteByKey(ctx, first.ID))
+	require.NoError(t, storage.SetRevision(ctx, 42))
+	require.NoError(t, storage.SetDeviceID(ctx, "device"))
+	require.NoError(t, storage.Close(ctx))
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.False(t, bytes.Contains(content, []byte(second.Name)))
+	require.False(t, bytes.Contains(content, []byte("4111111111111111")))
+
+	storage, err = NewFileStorage(path, cryptor)
+	require.NoError(t, err)
+	defer storage.Close(ctx)
+
+	secrets, err := storage.GetAll(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []*models.LocalSecret{second}, secrets)
+
+	byName, err := storage.GetByName(ctx, second.Name)
+	require.NoError(t, err)
+	require.Equal(t, second, byName)
+
+	revision, err := storage.GetRevision(ctx)
+	require.NoError(t, err)
+	require.Equal(t, int64(42), revision)
+
+	deviceID, err := storage.GetDeviceID(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "device", deviceID)
+}
+
+func TestFileStorageLocked(t *testing.T) {
+
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "secrets.json")
+
+	storage, err := NewFileStorage(path, newTestCryptor(t))
+	require.NoError(t, err)
+
+	_, err = NewFileStorage(path, newTestCryptor(t))
+	require.ErrorIs(t, err, ErrLocked)
+
+	require.NoError(t, storage.Close(ctx))
+
+	storage, err = NewFileStorage(path, newTestCryptor(t))
+	require.NoError(t, err)
+	require.NoError(t, storage.Close(ctx))
+}
+
+func TestFileStorageFailedWrite(t *testing.T) {
+
+	ctx := context.Background()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "secrets.json")
+
+	storage, err := NewFileStorage(path, newTestCryptor(t))
+	require.NoError(t, err)
+	defer storage.Close(ctx)
+
+	secret := newTestSecret("1")
+	_, err = storage.Create(ctx, secret)
+	require.NoError(t, err)
+
+	before, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	renameFile = func(string, string) error { return errors.New("disk failure") }
+	defer func() { renameFile = os.Rename }()
+
+	changed := newTestSecret("1")
+	changed.Name = "renamed"
+	_, err = storage.UpdateByKey(ctx, secret.ID, changed)
+	require.Error(t, err)
+	_, err = storage.Create(ctx, newTestSecret("2"))
+	require.Error(t, err)
+	require.Error(t, storage.DeleteByKey(ctx, secret.ID))
+
+	// файл и состояние в памяти прежние, временные файлы удалены
+	after, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, before, after)
+
+	secrets, err := storage.GetAll(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []*models.LocalSecret{secret}, secrets)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	require.ElementsMatch(t, []string{"secrets.json", "secrets.json" + lockSuffix}, names)
+}
+
+func TestFileStorageNotFound(t *testing.T) {
+
+	ctx := context.Background()
+	storage, err := NewFileStorage(filepath.Join(t.TempDir(), "secrets.json"), newTestCryptor(t))
+	require.NoError(t, err)
+	defer storage.Close(ctx)
+
+	secret := newTestSecret("1")
+	_, err = storage.Create(ctx, secret)
+	require.NoError(t, err)
+
+	_, err = storage.Create(ctx, secret)
+	require.ErrorIs(t, err, repository.ErrSecretExists)
+
+	require.NoError(t, storage.DeleteByKey(ctx, secret.ID))
+
+	_, err = storage.GetByKey(ctx, secret.ID)
+	require.ErrorIs(t, err, repository.ErrSecretNotFound)
+
+	_, err = storage.GetByName(ctx, secret.Name)
+	require.ErrorIs(t, err, repository.ErrSecretNotFound)
+
+	_, err = storage.UpdateByKey(ctx, secret.ID, secret)
+	require.ErrorIs(t, err, repository.ErrSecretNotFound)
+
+	require.ErrorIs(t, storage.DeleteByKey(ctx, secret.ID), repository.ErrSecretNotFound)
+}
@@ -0,0 +1,31 @@
+//go:build !windows
+
+package filestorage
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile захватывает эксклюзивную блокировку без ожидания
+func lockFile(file *os.File) error {
+	return syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+}
+
+func unlockFile(file *os.File) error {
+	return syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+}
+
+// syncDir сбрасывает на диск запись каталога после переименования файла
+func syncDir(dir string) error {
+
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+
+	err = d.Sync()
+	_ = d.Close()
+
+	return err
+}
@@ -0,0 +1,25 @@
+//go:build windows
+
+package filestorage
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// lockFile захватывает эксклюзивную блокировку без ожидания
+func lockFile(file *os.File) error {
+	return windows.LockFileEx(windows.Handle(file.Fd()),
+		windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY,
+		0, 1, 0, new(windows.Overlapped))
+}
+
+func unlockFile(file *os.File) error {
+	return windows.UnlockFileEx(windows.Handle(file.Fd()), 0, 1, 0, new(windows.Overlapped))
+}
+
+// syncDir на Windows каталоги не синхронизируются, переименование фиксируется файловой системой
+func syncDir(string) error {
+	return nil
+}
@@ -0,0 +1,190 @@
+// Package memory локальное хранилище секретов в памяти процесса: для тестов и сеансов,
+// после которых на диске не должно остаться секретов
+package memory
+
+import (
+	"context"
+	"fmt"
+	"github.com/s-turchinskiy/keeper/internal/client/models"
+	"github.com/s-turchinskiy/keeper/internal/client/repository"
+	"sync"
+)
+
+type MemoryStorage struct {
+	mu       sync.RWMutex
+	secrets  map[string]*models.LocalSecret
+	order    []string // порядок создания, в нем секреты возвращает GetAll
+	revision int64
+	deviceID string
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		secrets: make(map[string]*models.LocalSecret),
+	}
+}
+
+func (m *MemoryStorage) Create(_ context.Context, secret *models.LocalSecret) (*models.LocalSecret, error) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.secrets[secret.ID]; ok {
+		return nil, fmt.Errorf("%w: %s", repository.ErrSecretExists, secret.ID)
+	}
+
+	m.secrets[secret.ID] = clone(secret)
+	m.order = append(m.order, secret.ID)
+
+	return secret, nil
+}
+
+func (m *MemoryStorage) GetAll(_ context.Context) ([]*models.LocalSecret, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	secrets := make([]*models.LocalSecret, 0, len(m.order))
+	for _, id := range m.order {
+		secrets = append(secrets, clone(m.secrets[id]))
+	}
+
+	return secrets, nil
+}
+
+func (m *MemoryStorage) GetByKey(_ context.Context, id string) (*models.LocalSecret, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	secret, ok := m.secrets[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", repository.ErrSecretNotFound, id)
+	}
+
+	return clone(secret), nil
+}
+
+func (m *MemoryStorage) GetByName(_ context.Context, name string) (*models.LocalSecret, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, id := range m.order {
+		if secret := m.secrets[id]; secret.Name == name {
+			return clone(secret), nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s", repository.ErrSecretNotFound, name)
+}
+
+func (m *MemoryStorage) UpdateByKey(_ context.Context, id string, secret *models.LocalSecret) (*models.LocalSecret, error) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.secrets[id]; !ok {
+		return nil, fmt.Errorf("%w: %s", repository.ErrSecretNotFound, id)
+	}
+
+	m.secrets[id] = clone(secret)
+
+	return secret, nil
+}
+
+func (m *MemoryStorage) DeleteByKey(_ context.Context, id string) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.secrets[id]; !ok {
+		return fmt.Errorf("%w: %s", repository.ErrSecretNotFound, id)
+	}
+
+	delete(m.secrets, id)
+	for i, key := range m.order {
+		if key == id {
+			m.order = append(m.order[:i:i], m.order[i+1:]...)
+			break
+		}
+	}
+
+	return nil
+}
+
+func (m *MemoryStorage) DeleteAll(_ context.Context) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.secrets = make(map[string]*models.LocalSecret)
+	m.order = nil
+	m.revision = 0
+
+	return nil
+}
+
+func (m *MemoryStorage) Count(_ context.Context) (int64, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return int64(len(m.secrets)), nil
+}
+
+// EncryptPlaintext хранилище в памяти не переживает процесс, переносить нечего
+func (m *MemoryStorage) EncryptPlaintext(_ context.Context) (int, error) {
+	return 0, nil
+}
+
+// GetRevision последняя ревизия сервера, до которой клиент синхронизирован
+func (m *MemoryStorage) GetRevision(_ context.Context) (int64, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.revision, nil
+}
+
+func (m *MemoryStorage) SetRevision(_ context.Context, revision int64) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.revision = revision
+
+	return nil
+}
+
+// GetDeviceID ID устройства живет до конца процесса, каждый запуск в памяти - новое устройство
+func (m *MemoryStorage) GetDeviceID(_ context.Context) (string, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.deviceID, nil
+}
+
+func (m *MemoryStorage) SetDeviceID(_ context.Context, deviceID string) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.deviceID = deviceID
+
+	return nil
+}
+
+func (m *MemoryStorage) Close(_ context.Context) error {
+	return nil
+}
+
+// clone копия секрета, чтобы вызывающий не мог изменить хранимую запись
+func clone(secret *models.LocalSecret) *models.LocalSecret {
+
+	copied := *secret
+	copied.Data = append([]byte(nil), secret.Data...)
+
+	return &copied
+}
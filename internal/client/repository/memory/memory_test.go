@@ -0,0 +1,109 @@
+package memory_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/s-turchinskiy/keeper/internal/client/models"
+	"github.com/s-turchinskiy/keeper/internal/client/repository"
+	"github.com/s-turchinskiy/keeper/internal/client/repository/memory"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestSecret(id string) *models.LocalSecret {
+	return &models.LocalSecret{ID: id, Name: "secret " + id, Type: "text", Data: []byte(`{"content":"data"}`), Hash: "hash"}
+}
+
+func TestMemoryStorage(t *testing.T) {
+
+	ctx := context.Background()
+	storage := memory.NewMemoryStorage()
+
+	for _, id := range []string{"3", "1", "2"} {
+		_, err := storage.Create(ctx, newTestSecret(id))
+		require.NoError(t, err)
+	}
+
+	_, err := storage.Create(ctx, newTestSecret("1"))
+	require.ErrorIs(t, err, repository.ErrSecretExists)
+
+	// секреты возвращаются в порядке создания
+	secrets, err := storage.GetAll(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []*models.LocalSecret{newTestSecret("3"), newTestSecret("1"), newTestSecret("2")}, secrets)
+
+	byName, err := storage.GetByName(ctx, "secret 2")
+	require.NoError(t, err)
+	require.Equal(t, newTestSecret("2"), byName)
+
+	changed := newTestSecret("1")
+	changed.Name = "renamed"
+	_, err = storage.UpdateByKey(ctx, "1", changed)
+	require.NoError(t, err)
+
+	byKey, err := storage.GetByKey(ctx, "1")
+	require.NoError(t, err)
+	require.Equal(t, "renamed", byKey.Name)
+
+	require.NoError(t, storage.DeleteByKey(ctx, "3"))
+	count, err := storage.Count(ctx)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), count)
+
+	require.NoError(t, storage.SetRevision(ctx, 42))
+	revision, err := storage.GetRevision(ctx)
+	require.NoError(t, err)
+	require.Equal(t, int64(42), revision)
+
+	require.NoError(t, storage.DeleteAll(ctx))
+	secrets, err = storage.GetAll(ctx)
+	require.NoError(t, err)
+	require.Empty(t, secrets)
+	revision, err = storage.GetRevision(ctx)
+	require.NoError(t, err)
+	require.Zero(t, revision)
+}
+
+func TestMemoryStorageNotFound(t *testing.T) {
+
+	ctx := context.Background()
+	storage := memory.NewMemoryStorage()
+
+	_, err := storage.Create(ctx, newTestSecret("1"))
+	require.NoError(t, err)
+	require.NoError(t, storage.DeleteByKey(ctx, "1"))
+
+	_, err = storage.GetByKey(ctx, "1")
+	require.ErrorIs(t, err, repository.ErrSecretNotFound)
+
+	_, err = storage.GetByName(ctx, "secret 1")
+	require.ErrorIs(t, err, repository.ErrSecretNotFound)
+
+	_, err = storage.UpdateByKey(ctx, "1", newTestSecret("1"))
+	require.ErrorIs(t, err, repository.ErrSecretNotFound)
+
+	require.ErrorIs(t, storage.DeleteByKey(ctx, "1"), repository.ErrSecretNotFound)
+}
+
+func TestMemoryStorageCopies(t *testing.T) {
+
+	ctx := context.Background()
+	storage := memory.NewMemoryStorage()
+
+	secret := newTestSecret("1")
+	_, err := storage.Create(ctx, secret)
+	require.NoError(t, err)
+
+	// изменения переданного и полученного секрета не попадают в хранилище
+	secret.Name = "changed"
+	secret.Data[0] = 'x'
+
+	stored, err := storage.GetByKey(ctx, "1")
+	require.NoError(t, err)
+	require.Equal(t, newTestSecret("1"), stored)
+
+	stored.Data[0] = 'x'
+	stored, err = storage.GetByKey(ctx, "1")
+	require.NoError(t, err)
+	require.Equal(t, newTestSecret("1"), stored)
+}
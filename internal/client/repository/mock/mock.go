@@ -49,6 +49,21 @@ func (mr *MockRepositorierMockRecorder) Close(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockRepositorier)(nil).Close), arg0)
 }
 
+// Count mocks base method.
+func (m *MockRepositorier) Count(arg0 context.Context) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Count", arg0)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Count indicates an expected call of Count.
+func (mr *MockRepositorierMockRecorder) Count(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Count", reflect.TypeOf((*MockRepositorier)(nil).Count), arg0)
+}
+
 // Create mocks base method.
 func (m *MockRepositorier) Create(arg0 context.Context, arg1 *models.LocalSecret) (*models.LocalSecret, error) {
 	m.ctrl.T.Helper()
@@ -64,6 +79,20 @@ func (mr *MockRepositorierMockRecorder) Create(arg0, arg1 interface{}) *gomock.C
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockRepositorier)(nil).Create), arg0, arg1)
 }
 
+// DeleteAll mocks base method.
+func (m *MockRepositorier) DeleteAll(arg0 context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteAll", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteAll indicates an expected call of DeleteAll.
+func (mr *MockRepositorierMockRecorder) DeleteAll(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteAll", reflect.TypeOf((*MockRepositorier)(nil).DeleteAll), arg0)
+}
+
 // DeleteByKey mocks base method.
 func (m *MockRepositorier) DeleteByKey(arg0 context.Context, arg1 string) error {
 	m.ctrl.T.Helper()
@@ -78,6 +107,21 @@ func (mr *MockRepositorierMockRecorder) DeleteByKey(arg0, arg1 interface{}) *gom
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteByKey", reflect.TypeOf((*MockRepositorier)(nil).DeleteByKey), arg0, arg1)
 }
 
+// EncryptPlaintext mocks base method.
+func (m *MockRepositorier) EncryptPlaintext(arg0 context.Context) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EncryptPlaintext", arg0)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// EncryptPlaintext indicates an expected call of EncryptPlaintext.
+func (mr *MockRepositorierMockRecorder) EncryptPlaintext(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EncryptPlaintext", reflect.TypeOf((*MockRepositorier)(nil).EncryptPlaintext), arg0)
+}
+
 // GetAll mocks base method.
 func (m *MockRepositorier) GetAll(arg0 context.Context) ([]*models.LocalSecret, error) {
 	m.ctrl.T.Helper()
@@ -108,6 +152,79 @@ func (mr *MockRepositorierMockRecorder) GetByKey(arg0, arg1 interface{}) *gomock
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByKey", reflect.TypeOf((*MockRepositorier)(nil).GetByKey), arg0, arg1)
 }
 
+// GetByName mocks base method.
+func (m *MockRepositorier) GetByName(arg0 context.Context, arg1 string) (*models.LocalSecret, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetByName", arg0, arg1)
+	ret0, _ := ret[0].(*models.LocalSecret)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetByName indicates an expected call of GetByName.
+func (mr *MockRepositorierMockRecorder) GetByName(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByName", reflect.TypeOf((*MockRepositorier)(nil).GetByName), arg0, arg1)
+}
+
+// GetDeviceID mocks base method.
+func (m *MockRepositorier) GetDeviceID(arg0 context.Context) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetDeviceID", arg0)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetDeviceID indicates an expected call of GetDeviceID.
+func (mr *MockRepositorierMockRecorder) GetDeviceID(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDeviceID", reflect.TypeOf((*MockRepositorier)(nil).GetDeviceID), arg0)
+}
+
+// GetRevision mocks base method.
+func (m *MockRepositorier) GetRevision(arg0 context.Context) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRevision", arg0)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRevision indicates an expected call of GetRevision.
+func (mr *MockRepositorierMockRecorder) GetRevision(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRevision", reflect.TypeOf((*MockRepositorier)(nil).GetRevision), arg0)
+}
+
+// SetDeviceID mocks base method.
+func (m *MockRepositorier) SetDeviceID(arg0 context.Context, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetDeviceID", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetDeviceID indicates an expected call of SetDeviceID.
+func (mr *MockRepositorierMockRecorder) SetDeviceID(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetDeviceID", reflect.TypeOf((*MockRepositorier)(nil).SetDeviceID), arg0, arg1)
+}
+
+// SetRevision mocks base method.
+func (m *MockRepositorier) SetRevision(arg0 context.Context, arg1 int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetRevision", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetRevision indicates an expected call of SetRevision.
+func (mr *MockRepositorierMockRecorder) SetRevision(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetRevision", reflect.TypeOf((*MockRepositorier)(nil).SetRevision), arg0, arg1)
+}
+
 // UpdateByKey mocks base method.
 func (m *MockRepositorier) UpdateByKey(arg0 context.Context, arg1 string, arg2 *models.LocalSecret) (*models.LocalSecret, error) {
 	m.ctrl.T.Helper()
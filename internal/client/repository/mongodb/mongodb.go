@@ -2,26 +2,64 @@ package mongodb
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"github.com/s-turchinskiy/keeper/internal/client/crypto"
 	"github.com/s-turchinskiy/keeper/internal/client/models"
+	"github.com/s-turchinskiy/keeper/internal/client/repository"
 	"github.com/s-turchinskiy/keeper/pkd/dbparse"
 	"github.com/s-turchinskiy/keeper/pkd/mongo_generic_repository"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 const (
-	collectionName = "secrets"
-	entityName     = "secret"
-	keyName        = "name"
+	collectionName      = "secrets"
+	stateCollectionName = "state"
+	entityName          = "secret"
+	keyName             = "id"
+	nameField           = "name"
+	nameIndexField      = "name_index"
+	payloadField        = "payload"
+	revisionKey         = "revision"
+	deviceIDKey         = "device_id"
 )
 
 type MongoDB struct {
-	mongo_generic_repository.Repository[models.LocalSecret]
-	client *mongo.Client
+	mongo_generic_repository.Repository[storedSecret]
+	client     *mongo.Client
+	collection *mongo.Collection
+	state      *mongo.Collection
+	cryptor    crypto.Cryptor
 }
 
-func NewMongoDBStorage(ctx context.Context, mongoDBURL string) (db *MongoDB, err error) {
+// storedSecret запись секрета в локальном хранилище: секрет целиком зашифрован ключом хранилища,
+// для поиска по имени хранится ключевой хеш имени
+type storedSecret struct {
+	ID        string `bson:"id"`
+	NameIndex string `bson:"name_index"`
+	Payload   []byte `bson:"payload"`
+}
+
+// plaintextSecret запись, сохраненная до появления шифрования локального хранилища
+type plaintextSecret struct {
+	ObjectID           primitive.ObjectID `bson:"_id"`
+	models.LocalSecret `bson:",inline"`
+}
+
+type stateValue struct {
+	Key   string `bson:"key"`
+	Value int64  `bson:"value"`
+}
+
+type stateString struct {
+	Key   string `bson:"key"`
+	Value string `bson:"value"`
+}
+
+func NewMongoDBStorage(ctx context.Context, mongoDBURL string, cryptor crypto.Cryptor) (db *MongoDB, err error) {
 
 	clientOptions := options.Client().ApplyURI(mongoDBURL)
 	parsedStr, err := dbparse.ParsedConnectionString(mongoDBURL)
@@ -44,16 +82,291 @@ func NewMongoDBStorage(ctx context.Context, mongoDBURL string) (db *MongoDB, err
 		return nil, fmt.Errorf("failed to ping mongoDB due to error: %v", err)
 	}
 
+	collection := client.Database(parsedStr.DBName).Collection(collectionName)
+	if err = migrateSecretIDs(ctx, collection); err != nil {
+		return nil, fmt.Errorf("failed to migrate secret ids due to error: %v", err)
+	}
+
+	if err = createIndexes(ctx, collection); err != nil {
+		return nil, fmt.Errorf("failed to create indexes due to error: %v", err)
+	}
+
 	return &MongoDB{
-		client: client,
-		Repository: *mongo_generic_repository.NewRepository[models.LocalSecret](
-			client.Database(parsedStr.DBName).Collection(collectionName),
+		client:     client,
+		collection: collection,
+		state:      client.Database(parsedStr.DBName).Collection(stateCollectionName),
+		cryptor:    cryptor,
+		Repository: *mongo_generic_repository.NewRepository[storedSecret](
+			collection,
 			entityName,
 			keyName,
 		),
 	}, nil
 }
 
+// migrateSecretIDs секреты, созданные до появления ID, хранятся на сервере под своим именем,
+// поэтому имя становится их ID
+func migrateSecretIDs(ctx context.Context, collection *mongo.Collection) error {
+
+	_, err := collection.UpdateMany(ctx,
+		bson.D{{Key: keyName, Value: bson.D{{Key: "$exists", Value: false}}}},
+		mongo.Pipeline{{{Key: "$set", Value: bson.D{{Key: keyName, Value: "$" + nameField}}}}},
+	)
+
+	return err
+}
+
+// createIndexes уникальный индекс по ID секрета: Create не должен добавить второй секрет с тем же ID
+func createIndexes(ctx context.Context, collection *mongo.Collection) error {
+
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: keyName, Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+
+	return err
+}
+
+func (m MongoDB) Create(ctx context.Context, secret *models.LocalSecret) (*models.LocalSecret, error) {
+
+	doc, err := m.encrypt(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = m.Repository.Create(ctx, doc)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, fmt.Errorf("%w: %s", repository.ErrSecretExists, secret.ID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return secret, nil
+}
+
+func (m MongoDB) GetAll(ctx context.Context) ([]*models.LocalSecret, error) {
+
+	docs, err := m.Repository.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	secrets := make([]*models.LocalSecret, 0, len(docs))
+	for _, doc := range docs {
+		secret, err := m.decrypt(doc)
+		if err != nil {
+			return nil, err
+		}
+		secrets = append(secrets, secret)
+	}
+
+	return secrets, nil
+}
+
+func (m MongoDB) GetByKey(ctx context.Context, id string) (*models.LocalSecret, error) {
+
+	doc, err := m.Repository.GetByKey(ctx, id)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, fmt.Errorf("%w: %s", repository.ErrSecretNotFound, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return m.decrypt(doc)
+}
+
+func (m MongoDB) GetByName(ctx context.Context, name string) (*models.LocalSecret, error) {
+
+	nameIndex, err := m.cryptor.StorageIndex(name)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := m.Repository.GetByField(ctx, nameIndexField, nameIndex)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, fmt.Errorf("%w: %s", repository.ErrSecretNotFound, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return m.decrypt(doc)
+}
+
+func (m MongoDB) UpdateByKey(ctx context.Context, id string, secret *models.LocalSecret) (*models.LocalSecret, error) {
+
+	doc, err := m.encrypt(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = m.Repository.UpdateByKey(ctx, id, doc)
+	if mongo_generic_repository.IsNotFound(err) {
+		return nil, fmt.Errorf("%w: %s", repository.ErrSecretNotFound, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return secret, nil
+}
+
+func (m MongoDB) DeleteByKey(ctx context.Context, id string) error {
+
+	err := m.Repository.DeleteByKey(ctx, id)
+	if mongo_generic_repository.IsNotFound(err) {
+		return fmt.Errorf("%w: %s", repository.ErrSecretNotFound, id)
+	}
+
+	return err
+}
+
+func (m MongoDB) Count(ctx context.Context) (int64, error) {
+	return m.collection.CountDocuments(ctx, bson.M{})
+}
+
+// EncryptPlaintext шифрует записи, сохраненные открытым текстом до появления шифрования локального хранилища.
+// Вызывается после разблокировки хранилища, когда доступен ключ
+func (m MongoDB) EncryptPlaintext(ctx context.Context) (int, error) {
+
+	cursor, err := m.collection.Find(ctx, bson.D{{Key: payloadField, Value: bson.D{{Key: "$exists", Value: false}}}})
+	if err != nil {
+		return 0, err
+	}
+	defer func(cursor *mongo.Cursor, ctx context.Context) {
+		_ = cursor.Close(ctx)
+	}(cursor, ctx)
+
+	var migrated int
+	for cursor.Next(ctx) {
+		var plaintext plaintextSecret
+		if err = cursor.Decode(&plaintext); err != nil {
+			return migrated, err
+		}
+
+		doc, err := m.encrypt(&plaintext.LocalSecret)
+		if err != nil {
+			return migrated, err
+		}
+
+		_, err = m.collection.ReplaceOne(ctx, bson.D{{Key: "_id", Value: plaintext.ObjectID}}, doc)
+		if err != nil {
+			return migrated, err
+		}
+		migrated++
+	}
+
+	return migrated, cursor.Err()
+}
+
+func (m MongoDB) encrypt(secret *models.LocalSecret) (*storedSecret, error) {
+
+	nameIndex, err := m.cryptor.StorageIndex(secret.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	plainData, err := bson.Marshal(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := m.cryptor.EncryptStorageData(secret.ID, plainData)
+	if err != nil {
+		return nil, err
+	}
+
+	return &storedSecret{
+		ID:        secret.ID,
+		NameIndex: nameIndex,
+		Payload:   payload,
+	}, nil
+}
+
+func (m MongoDB) decrypt(doc *storedSecret) (*models.LocalSecret, error) {
+
+	if len(doc.Payload) == 0 {
+		return nil, fmt.Errorf("secret '%s' is not encrypted yet", doc.ID)
+	}
+
+	plainData, err := m.cryptor.DecryptStorageData(doc.ID, doc.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt secret '%s': %w", doc.ID, err)
+	}
+
+	var secret models.LocalSecret
+	if err = bson.Unmarshal(plainData, &secret); err != nil {
+		return nil, err
+	}
+
+	return &secret, nil
+}
+
 func (m MongoDB) Close(ctx context.Context) error {
 	return m.client.Disconnect(ctx)
 }
+
+func (m MongoDB) DeleteAll(ctx context.Context) error {
+
+	err := m.Repository.DeleteAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = m.state.DeleteMany(ctx, bson.M{})
+	return err
+}
+
+// GetRevision последняя ревизия сервера, до которой клиент синхронизирован
+func (m MongoDB) GetRevision(ctx context.Context) (int64, error) {
+
+	var value stateValue
+	err := m.state.FindOne(ctx, bson.D{{Key: "key", Value: revisionKey}}).Decode(&value)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return value.Value, nil
+}
+
+func (m MongoDB) SetRevision(ctx context.Context, revision int64) error {
+
+	_, err := m.state.UpdateOne(ctx,
+		bson.D{{Key: "key", Value: revisionKey}},
+		bson.D{{Key: "$set", Value: bson.D{{Key: "value", Value: revision}}}},
+		options.Update().SetUpsert(true),
+	)
+
+	return err
+}
+
+// GetDeviceID ID устройства, под которым клиент входит на сервер, "" если он еще не создан
+func (m MongoDB) GetDeviceID(ctx context.Context) (string, error) {
+
+	var value stateString
+	err := m.state.FindOne(ctx, bson.D{{Key: "key", Value: deviceIDKey}}).Decode(&value)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return value.Value, nil
+}
+
+func (m MongoDB) SetDeviceID(ctx context.Context, deviceID string) error {
+
+	_, err := m.state.UpdateOne(ctx,
+		bson.D{{Key: "key", Value: deviceIDKey}},
+		bson.D{{Key: "$set", Value: bson.D{{Key: "value", Value: deviceID}}}},
+		options.Update().SetUpsert(true),
+	)
+
+	return err
+}
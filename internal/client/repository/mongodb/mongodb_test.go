@@ -0,0 +1,218 @@
+package mongodb
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/s-turchinskiy/keeper/internal/client/crypto"
+	"github.com/s-turchinskiy/keeper/internal/client/models"
+	"github.com/s-turchinskiy/keeper/internal/client/repository"
+	"github.com/s-turchinskiy/keeper/pkd/mongo_generic_repository"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// newTestCryptor криптор с открытым хранилищем: без ключа хранилища записи не шифруются
+func newTestCryptor(t *testing.T) crypto.Cryptor {
+
+	cryptor := crypto.NewCryptor("password", "user", crypto.WithKDFTarget(crypto.KDFParams{Time: 1, MemoryKiB: 16 * 1024, Threads: 1}))
+
+	params, err := cryptor.NewKDFParams()
+	require.NoError(t, err)
+	cryptor.SetKDFParams(params)
+
+	_, err = cryptor.CreateVault(false)
+	require.NoError(t, err)
+
+	return cryptor
+}
+
+func newTestSecret(id string) *models.LocalSecret {
+	return &models.LocalSecret{ID: id, Name: "bank card " + id, Type: "card", Data: []byte(`{"number":"4111111111111111"}`),
+		Metadata: "visa", Hash: "hash", BaseHash: "hash", Revision: 7}
+}
+
+func TestStoredSecret(t *testing.T) {
+
+	m := MongoDB{cryptor: newTestCryptor(t)}
+	secret := newTestSecret("1")
+
+	doc, err := m.encrypt(secret)
+	require.NoError(t, err)
+	require.Equal(t, secret.ID, doc.ID)
+
+	for _, plain := range []string{secret.Name, "4111111111111111", secret.Metadata} {
+		require.False(t, bytes.Contains(doc.Payload, []byte(plain)), "payload contains %q", plain)
+		require.NotContains(t, doc.NameIndex, plain)
+	}
+
+	// индекс имени не зависит от записи, но зависит от ключа хранилища
+	same, err := m.encrypt(newTestSecret("1"))
+	require.NoError(t, err)
+	require.Equal(t, doc.NameIndex, same.NameIndex)
+	require.NotEqual(t, doc.Payload, same.Payload)
+
+	other, err := MongoDB{cryptor: newTestCryptor(t)}.encrypt(secret)
+	require.NoError(t, err)
+	require.NotEqual(t, doc.NameIndex, other.NameIndex)
+
+	decrypted, err := m.decrypt(doc)
+	require.NoError(t, err)
+	require.Equal(t, secret, decrypted)
+
+	// запись привязана к ID секрета
+	_, err = m.decrypt(&storedSecret{ID: "2", NameIndex: doc.NameIndex, Payload: doc.Payload})
+	require.Error(t, err)
+
+	_, err = m.decrypt(&storedSecret{ID: secret.ID})
+	require.Error(t, err)
+}
+
+func TestEncryptPlaintext(t *testing.T) {
+
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("resumable", func(mt *mtest.T) {
+		ctx := context.Background()
+		m := MongoDB{collection: mt.Coll, cryptor: newTestCryptor(t)}
+		ns := mt.Coll.Database().Name() + "." + mt.Coll.Name()
+
+		plaintext := []*models.LocalSecret{newTestSecret("1"), newTestSecret("2")}
+		docs := make([]bson.D, len(plaintext))
+		for i, secret := range plaintext {
+			docs[i] = plaintextDocument(t, secret)
+		}
+
+		// запись второго секрета прерывается
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, docs...),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+			mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 6, Message: "host unreachable"}),
+		)
+		migrated, err := m.EncryptPlaintext(ctx)
+		require.Error(t, err)
+		require.Equal(t, 1, migrated)
+
+		// повторный запуск выбирает только записи без payload, то есть оставшиеся
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, docs[1]),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+		)
+		migrated, err = m.EncryptPlaintext(ctx)
+		require.NoError(t, err)
+		require.Equal(t, 1, migrated)
+
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, ns, mtest.FirstBatch))
+		migrated, err = m.EncryptPlaintext(ctx)
+		require.NoError(t, err)
+		require.Zero(t, migrated)
+
+		var replaced []*models.LocalSecret
+		for _, event := range mt.GetAllStartedEvents() {
+			switch event.CommandName {
+			case "find":
+				filter := event.Command.Lookup("filter").Document()
+				require.Equal(t, bson.TypeBoolean, filter.Lookup(payloadField, "$exists").Type)
+				require.False(t, filter.Lookup(payloadField, "$exists").Boolean())
+
+			case "update":
+				update := event.Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("u").Document()
+				require.Equal(t, bson.TypeString, update.Lookup(keyName).Type)
+				_, err = update.LookupErr(nameField)
+				require.Error(t, err, "plaintext name left in the record")
+
+				var doc storedSecret
+				require.NoError(t, bson.Unmarshal(update, &doc))
+				secret, err := m.decrypt(&doc)
+				require.NoError(t, err)
+				replaced = append(replaced, secret)
+			}
+		}
+
+		require.Equal(t, []*models.LocalSecret{plaintext[0], plaintext[1], plaintext[1]}, replaced)
+	})
+}
+
+func TestNotFound(t *testing.T) {
+
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("not found", func(mt *mtest.T) {
+		ctx := context.Background()
+		m := MongoDB{
+			collection: mt.Coll,
+			cryptor:    newTestCryptor(t),
+			Repository: *mongo_generic_repository.NewRepository[storedSecret](mt.Coll, entityName, keyName),
+		}
+		ns := mt.Coll.Database().Name() + "." + mt.Coll.Name()
+
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch),
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}, bson.E{Key: "nModified", Value: 0}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}),
+		)
+
+		_, err := m.GetByKey(ctx, "1")
+		require.ErrorIs(t, err, repository.ErrSecretNotFound)
+
+		_, err = m.GetByName(ctx, "secret")
+		require.ErrorIs(t, err, repository.ErrSecretNotFound)
+
+		_, err = m.UpdateByKey(ctx, "1", newTestSecret("1"))
+		require.ErrorIs(t, err, repository.ErrSecretNotFound)
+
+		require.ErrorIs(t, m.DeleteByKey(ctx, "1"), repository.ErrSecretNotFound)
+	})
+}
+
+func TestDuplicateID(t *testing.T) {
+
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("unique id", func(mt *mtest.T) {
+		ctx := context.Background()
+		m := MongoDB{
+			collection: mt.Coll,
+			cryptor:    newTestCryptor(t),
+			Repository: *mongo_generic_repository.NewRepository[storedSecret](mt.Coll, entityName, keyName),
+		}
+
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+		require.NoError(t, createIndexes(ctx, mt.Coll))
+
+		started := mt.GetStartedEvent()
+		require.Equal(t, "createIndexes", started.CommandName)
+		index := started.Command.Lookup("indexes").Array().Index(0).Value().Document()
+		require.Equal(t, int32(1), index.Lookup("key", keyName).Int32())
+		require.True(t, index.Lookup("unique").Boolean())
+
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+			mtest.CreateWriteErrorsResponse(mtest.WriteError{Index: 0, Code: 11000, Message: "E11000 duplicate key error"}),
+		)
+
+		_, err := m.Create(ctx, newTestSecret("1"))
+		require.NoError(t, err)
+
+		_, err = m.Create(ctx, newTestSecret("1"))
+		require.ErrorIs(t, err, repository.ErrSecretExists)
+	})
+}
+
+// plaintextDocument запись секрета в том виде, в каком она хранилась до шифрования локального хранилища
+func plaintextDocument(t *testing.T, secret *models.LocalSecret) bson.D {
+
+	data, err := bson.Marshal(plaintextSecret{ObjectID: primitive.NewObjectID(), LocalSecret: *secret})
+	require.NoError(t, err)
+
+	var doc bson.D
+	require.NoError(t, bson.Unmarshal(data, &doc))
+	return doc
+}
@@ -2,16 +2,33 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"github.com/s-turchinskiy/keeper/internal/client/models"
 )
 
+var (
+	// ErrSecretExists секрет с таким ID уже есть в локальном хранилище
+	ErrSecretExists = errors.New("secret already exists in local storage")
+	// ErrSecretNotFound секрета с таким ID или именем нет в локальном хранилище, одинаково для всех хранилищ
+	ErrSecretNotFound = errors.New("secret not found in local storage")
+)
+
 type Repositorier interface {
 	Create(ctx context.Context, secret *models.LocalSecret) (*models.LocalSecret, error)
 	GetAll(ctx context.Context) ([]*models.LocalSecret, error)
 	GetByKey(ctx context.Context, id string) (*models.LocalSecret, error)
+	GetByName(ctx context.Context, name string) (*models.LocalSecret, error)
 	UpdateByKey(ctx context.Context, id string, secret *models.LocalSecret) (*models.LocalSecret, error)
 	DeleteByKey(ctx context.Context, id string) error
 	DeleteAll(ctx context.Context) error
+	Count(ctx context.Context) (int64, error)
+	EncryptPlaintext(ctx context.Context) (int, error)
+
+	GetRevision(ctx context.Context) (int64, error)
+	SetRevision(ctx context.Context, revision int64) error
+
+	GetDeviceID(ctx context.Context) (string, error)
+	SetDeviceID(ctx context.Context, deviceID string) error
 
 	Close(ctx context.Context) error
 }
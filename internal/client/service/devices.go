@@ -0,0 +1,64 @@
+package service
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/s-turchinskiy/keeper/internal/client/models"
+	"github.com/s-turchinskiy/keeper/internal/utils/buildinfo"
+	"os"
+	"runtime"
+)
+
+const unknownHostname = "unknown"
+
+// InitDevice описывает устройство для входа на сервер. ID создается при первом запуске
+// и хранится в локальном хранилище: одно хранилище - одна копия секретов - одно устройство
+func (s *Service) InitDevice(ctx context.Context) error {
+
+	deviceID, err := s.storage.GetDeviceID(ctx)
+	if err != nil {
+		return err
+	}
+
+	if deviceID == "" {
+		deviceID = uuid.NewString()
+		if err = s.storage.SetDeviceID(ctx, deviceID); err != nil {
+			return err
+		}
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = unknownHostname
+	}
+
+	s.deviceID = deviceID
+	s.grpcClient.SetDevice(&models.Device{
+		ID:            deviceID,
+		Name:          hostname,
+		OS:            runtime.GOOS + "/" + runtime.GOARCH,
+		ClientVersion: buildinfo.BuildVersion,
+	})
+
+	return nil
+}
+
+// ListDevices устройства пользователя с сервера, текущее помечено Current
+func (s *Service) ListDevices(ctx context.Context) ([]*models.Device, error) {
+
+	devices, err := s.grpcClient.ListDevices(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, device := range devices {
+		device.Current = s.deviceID != "" && device.ID == s.deviceID
+	}
+
+	return devices, nil
+}
+
+// RevokeDevice отзывает устройство: его сессии завершаются, войти с него больше нельзя
+func (s *Service) RevokeDevice(ctx context.Context, deviceID string) (int64, error) {
+	return s.grpcClient.RevokeDevice(ctx, deviceID)
+}
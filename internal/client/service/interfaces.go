@@ -6,15 +6,34 @@ import (
 )
 
 type Servicer interface {
-	Register(ctx context.Context, login, password string) error
+	Register(ctx context.Context) error
 	Login(ctx context.Context, login, password string) error
+	Logout(ctx context.Context, allSessions bool) (int64, error)
+	InitDevice(ctx context.Context) error
+	ListDevices(ctx context.Context) ([]*models.Device, error)
+	RevokeDevice(ctx context.Context, deviceID string) (int64, error)
+	EnableTwoFactor(ctx context.Context) (string, string, error)
+	ConfirmTwoFactor(ctx context.Context, code string) ([]string, error)
+	DisableTwoFactor(ctx context.Context, code string) error
+	GetTwoFactorStatus(ctx context.Context) (*models.TwoFactorStatus, error)
 
-	SyncSecrets(ctx context.Context) error
+	SyncSecrets(ctx context.Context, resolver models.ConflictResolver) error
 	CreateSecret(ctx context.Context, base models.BaseSecret, data models.SecretData) (*models.LocalSecret, error)
-	ReadSecret(ctx context.Context, secretID string) (*models.LocalSecret, error)
+	ReadSecret(ctx context.Context, name string) (*models.LocalSecret, error)
 	UpdateSecret(ctx context.Context, secret *models.LocalSecret) error
-	DeleteSecret(ctx context.Context, secretID string) error
+	EditSecret(ctx context.Context, name, secretType string, metadata *string, edit func(models.SecretData) (models.SecretData, error)) (*models.LocalSecret, error)
+	RenameSecret(ctx context.Context, name, newName string) (*models.LocalSecret, error)
+	DeleteSecret(ctx context.Context, name string) error
+	UndeleteSecret(ctx context.Context, name string) (*models.LocalSecret, error)
+	ListDeletedSecrets(ctx context.Context) ([]*models.LocalSecret, error)
+	PurgeDeletedSecrets(ctx context.Context) (int64, error)
 	ListLocalSecrets(ctx context.Context) ([]*models.LocalSecret, error)
+	ListSecretVersions(ctx context.Context, name string) ([]*models.SecretVersion, error)
+	RestoreSecret(ctx context.Context, name string, version int64) (*models.LocalSecret, error)
+	ChangeMasterPassword(ctx context.Context, newMasterPassword string) error
+	RotateVaultKey(ctx context.Context) (int, error)
+	UpgradeKDF(ctx context.Context) (bool, error)
+	GenerateOTP(ctx context.Context, name string) (*models.OTPCode, error)
 
 	Close(ctx context.Context) error
 }
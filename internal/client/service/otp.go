@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/s-turchinskiy/keeper/internal/client/models"
+)
+
+// ErrOTPCounterNotSynced код HOTP выдан, но новое значение счетчика не отправлено на сервер:
+// оно сохранено локально и уйдет при следующей синхронизации
+var ErrOTPCounterNotSynced = errors.New("hotp counter is not synced with the server")
+
+// GenerateOTP код одноразового пароля из секрета name. Для HOTP счетчик увеличивается и отправляется
+// на сервер, чтобы другое устройство не выдало тот же код. Если счетчик на сервере уже изменен с другого
+// устройства, берется версия сервера и код выдается со следующего после большего из счетчиков
+func (s *Service) GenerateOTP(ctx context.Context, name string) (*models.OTPCode, error) {
+
+	if err := s.unlockVault(ctx); err != nil {
+		return nil, err
+	}
+
+	secret, err := s.storage.GetByName(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if secret.Type != models.SecretTypeOTP {
+		return nil, fmt.Errorf("secret '%s' has type %s, not %s", name, secret.Type, models.SecretTypeOTP)
+	}
+
+	data, err := secret.ParseData()
+	if err != nil {
+		return nil, err
+	}
+
+	otpData := data.(models.OTPData)
+	if err = otpData.Validate(); err != nil {
+		return nil, err
+	}
+
+	if !otpData.IsHOTP() {
+		return otpData.Code(time.Now())
+	}
+
+	code, err := s.nextHOTPCode(ctx, name, 0)
+
+	var conflictErr *models.ConflictError
+	if errors.As(err, &conflictErr) && conflictErr.Current != nil && !conflictErr.Current.Deleted {
+		if err = s.takeRemoteSecret(ctx, conflictErr.SecretID, conflictErr.Current); err != nil {
+			return nil, err
+		}
+		code, err = s.nextHOTPCode(ctx, name, otpData.Counter)
+	}
+
+	if code != nil && err != nil && !errors.As(err, &conflictErr) {
+		return code, fmt.Errorf("%w: %v", ErrOTPCounterNotSynced, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return code, nil
+}
+
+// nextHOTPCode код текущего значения счетчика, не меньшего minCounter, и увеличение счетчика.
+// Код возвращается и при ошибке отправки на сервер: счетчик уже сохранен локально
+func (s *Service) nextHOTPCode(ctx context.Context, name string, minCounter uint64) (*models.OTPCode, error) {
+
+	var code *models.OTPCode
+	_, err := s.EditSecret(ctx, name, models.SecretTypeOTP, nil, func(current models.SecretData) (models.SecretData, error) {
+		data := current.(models.OTPData)
+		data.Counter = max(data.Counter, minCounter)
+
+		var err error
+		if code, err = data.Code(time.Now()); err != nil {
+			return nil, err
+		}
+
+		data.Counter++
+		return data, nil
+	})
+
+	var conflictErr *models.ConflictError
+	if errors.As(err, &conflictErr) {
+		return nil, err
+	}
+
+	return code, err
+}
@@ -13,10 +13,15 @@ import (
 type OptionService func(*Service)
 
 type Service struct {
-	cryptor crypto.Cryptor
+	cryptor  crypto.Cryptor
+	login    string
+	deviceID string
 
 	mu sync.Mutex
 
+	vaultMu       sync.Mutex
+	vaultUnlocked bool
+
 	storage    repository.Repositorier
 	grpcClient grpcclient.SenderReceiver
 }
@@ -42,6 +47,15 @@ func WithCrypto(cryptor crypto.Cryptor) OptionService {
 	}
 }
 
+// WithLogin логин учетной записи из настроек клиента
+func WithLogin(login string) OptionService {
+
+	return func(s *Service) {
+
+		s.login = login
+	}
+}
+
 func (s *Service) Close(ctx context.Context) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -56,7 +70,12 @@ func (s *Service) Close(ctx context.Context) error {
 
 	if s.grpcClient != nil {
 
-		_ = s.grpcClient.GetStream().CloseSend()
+		if _, err := s.grpcClient.Logout(ctx, false); err != nil {
+			log.Printf("failed to end session: %v", err)
+		}
+		if stream := s.grpcClient.GetStream(); stream != nil {
+			_ = stream.CloseSend()
+		}
 		if err := s.grpcClient.Close(); err != nil {
 			log.Printf("failed to close client: %v", err)
 		} else {
@@ -9,13 +9,26 @@ import (
 	"io"
 	"log"
 	"strconv"
+	"strings"
+	"time"
 )
 
-var ErrSecretAlreadyExist = errors.New("secret already exist")
+var (
+	ErrSecretAlreadyExist = errors.New("secret already exist")
+	ErrSecretNotFound     = errors.New("secret not found")
+)
+
+// Register регистрирует учетную запись из настроек клиента со случайной солью и параметрами Argon2id.
+// Сервер получает только пароль, выведенный из мастер-пароля
+func (s *Service) Register(ctx context.Context) error {
 
-func (s *Service) Register(ctx context.Context, login, password string) error {
+	params, err := s.cryptor.NewKDFParams()
+	if err != nil {
+		return err
+	}
+	s.cryptor.SetKDFParams(params)
 
-	_, err := s.grpcClient.Register(ctx, login, password)
+	_, err = s.grpcClient.Register(ctx, s.login, s.cryptor.GenerateServerPassword(), params)
 	if err != nil {
 		return err
 	}
@@ -25,7 +38,18 @@ func (s *Service) Register(ctx context.Context, login, password string) error {
 
 func (s *Service) Login(ctx context.Context, login, password string) error {
 
-	err := s.grpcClient.Login(ctx, login, password)
+	revision, err := s.storage.GetRevision(ctx)
+	if err != nil {
+		return err
+	}
+	s.grpcClient.SetSinceRevision(revision)
+
+	err = s.grpcClient.Login(ctx, login, password)
+	if err != nil {
+		return err
+	}
+
+	err = s.unlockVault(ctx)
 	if err != nil {
 		return err
 	}
@@ -42,37 +66,66 @@ func (s *Service) Login(ctx context.Context, login, password string) error {
 	return nil
 }
 
-func (s *Service) SyncSecrets(ctx context.Context) error {
+// SyncSecrets забирает изменения, появившиеся на сервере после последней сохраненной ревизии,
+// и отправляет локальные изменения. Если секрет изменен с обеих сторон, версию выбирает resolver.
+func (s *Service) SyncSecrets(ctx context.Context, resolver models.ConflictResolver) error {
 
-	localSecrets, err := s.storage.GetAll(ctx)
+	if err := s.unlockVault(ctx); err != nil {
+		return err
+	}
+
+	revision, err := s.storage.GetRevision(ctx)
 	if err != nil {
 		return err
 	}
 
-	remoteSecrets := make([]*models.RemoteSecret, len(localSecrets))
-	for _, localSecret := range localSecrets {
-		remoteSecret, err := models.ConvertLocalSecretToRemoteSecret(s.cryptor, localSecret)
+	changes, newRevision, err := s.grpcClient.GetChangesSince(ctx, revision)
+	if err != nil {
+		return err
+	}
+
+	for _, remoteSecret := range changes {
+		err = s.applyRemoteSecret(ctx, remoteSecret, resolver)
 		if err != nil {
-			return nil
+			return err
 		}
-		remoteSecrets = append(remoteSecrets, remoteSecret)
 	}
-	err = s.grpcClient.SyncSecretsFromClient(ctx, remoteSecrets)
+
+	localSecrets, err := s.storage.GetAll(ctx)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	var pushed int
+	for _, localSecret := range localSecrets {
+		if !localSecret.Modified() {
+			continue
+		}
+
+		err = s.pushLocalSecret(ctx, localSecret, resolver)
+		if err != nil {
+			return err
+		}
+		pushed++
+	}
+
+	fmt.Printf("Synced: received %d changes, sent %d secrets, revision %d\n", len(changes), pushed, newRevision)
+
+	return s.advanceRevision(ctx, newRevision)
 }
 
 func (s *Service) CreateSecret(ctx context.Context, base models.BaseSecret, data models.SecretData) (*models.LocalSecret, error) {
 
+	if err := s.unlockVault(ctx); err != nil {
+		return nil, err
+	}
+
 	secret, err := models.NewSecretModel(base, data, s.cryptor)
 	if err != nil {
 		return nil, err
 	}
 
-	_, err = s.storage.GetByKey(ctx, secret.Name)
+	_, err = s.storage.GetByName(ctx, secret.Name)
 	if err == nil {
 		return nil, ErrSecretAlreadyExist
 	}
@@ -82,7 +135,7 @@ func (s *Service) CreateSecret(ctx context.Context, base models.BaseSecret, data
 		return nil, err
 	}
 
-	err = s.createRemoteSecret(ctx, secret.Name)
+	err = s.createRemoteSecret(ctx, secret.ID)
 	if err != nil {
 		return nil, err
 	}
@@ -90,31 +143,140 @@ func (s *Service) CreateSecret(ctx context.Context, base models.BaseSecret, data
 	return secret, nil
 }
 
+// UpdateSecret отправляет изменение на сервер относительно последней синхронизированной ревизии.
+// Если секрет на сервере уже изменен с другого устройства, возвращает models.ConflictError
+// и не меняет локальную копию.
 func (s *Service) UpdateSecret(ctx context.Context, secret *models.LocalSecret) error {
 
-	secret, err := s.storage.UpdateByKey(ctx, secret.Name, secret)
+	if err := s.unlockVault(ctx); err != nil {
+		return err
+	}
+
+	stored, err := s.storage.GetByKey(ctx, secret.ID)
 	if err != nil {
 		return err
 	}
 
-	err = s.replaceRemoteSecret(ctx, secret)
+	revision, err := s.replaceRemoteSecret(ctx, secret, models.ExpectRevision(stored.Revision))
+	var conflictErr *models.ConflictError
+	if errors.As(err, &conflictErr) {
+		conflictErr.Name = secret.Name
+		return err
+	}
+
+	if err != nil {
+		secret.Revision = stored.Revision
+		secret.BaseHash = stored.BaseHash
+	} else {
+		secret.Revision = revision
+		secret.BaseHash = secret.Hash
+	}
+
+	_, updateErr := s.storage.UpdateByKey(ctx, secret.ID, secret)
+	if updateErr != nil {
+		return updateErr
+	}
+
 	return err
 }
 
-func (s *Service) ReadSecret(ctx context.Context, secretID string) (*models.LocalSecret, error) {
+// EditSecret меняет данные локального секрета функцией edit и метаданные, если metadata не nil,
+// пересчитывает хеш и отправляет изменение на сервер
+func (s *Service) EditSecret(ctx context.Context, name, secretType string, metadata *string,
+	edit func(models.SecretData) (models.SecretData, error)) (*models.LocalSecret, error) {
+
+	if err := s.unlockVault(ctx); err != nil {
+		return nil, err
+	}
 
-	_, err := s.storage.GetByKey(ctx, secretID)
+	secret, err := s.storage.GetByName(ctx, name)
 	if err != nil {
 		return nil, err
 	}
 
-	secret, err := s.getSecretFromServer(ctx, secretID)
+	if secret.Type != secretType {
+		return nil, fmt.Errorf("secret '%s' has type %s, not %s", name, secret.Type, secretType)
+	}
+
+	data, err := secret.ParseData()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err = edit(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = data.Validate(); err != nil {
+		return nil, fmt.Errorf("data validation failed: %w", err)
+	}
+
+	if metadata != nil {
+		secret.Metadata = *metadata
+	}
+
+	err = secret.SetData(s.cryptor, data)
+	if err != nil {
+		return nil, err
+	}
+	secret.LastModified = time.Now().Truncate(time.Microsecond)
+
+	return secret, s.UpdateSecret(ctx, secret)
+}
+
+// RenameSecret меняет имя секрета, ID секрета и его история на сервере сохраняются
+func (s *Service) RenameSecret(ctx context.Context, name, newName string) (*models.LocalSecret, error) {
+
+	if err := s.unlockVault(ctx); err != nil {
+		return nil, err
+	}
+
+	if strings.TrimSpace(newName) == "" {
+		return nil, fmt.Errorf("new name is required")
+	}
+
+	_, err := s.storage.GetByName(ctx, newName)
+	if err == nil {
+		return nil, ErrSecretAlreadyExist
+	}
+
+	secret, err := s.storage.GetByName(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	err = secret.Rename(s.cryptor, newName)
+	if err != nil {
+		return nil, err
+	}
+	secret.LastModified = time.Now().Truncate(time.Microsecond)
+
+	return secret, s.UpdateSecret(ctx, secret)
+}
+
+func (s *Service) ReadSecret(ctx context.Context, name string) (*models.LocalSecret, error) {
+
+	if err := s.unlockVault(ctx); err != nil {
+		return nil, err
+	}
+
+	localSecret, err := s.storage.GetByName(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := s.getSecretFromServer(ctx, localSecret.ID)
 
 	return secret, err
 }
 
 func (s *Service) ListLocalSecrets(ctx context.Context) ([]*models.LocalSecret, error) {
 
+	if err := s.unlockVault(ctx); err != nil {
+		return nil, err
+	}
+
 	secrets, err := s.storage.GetAll(ctx)
 	if err != nil {
 		return nil, err
@@ -123,21 +285,237 @@ func (s *Service) ListLocalSecrets(ctx context.Context) ([]*models.LocalSecret,
 	return secrets, nil
 }
 
-func (s *Service) DeleteSecret(ctx context.Context, secretID string) error {
+func (s *Service) ListSecretVersions(ctx context.Context, name string) ([]*models.SecretVersion, error) {
+
+	if err := s.unlockVault(ctx); err != nil {
+		return nil, err
+	}
+
+	secretID, err := s.secretIDByName(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.grpcClient.ListSecretVersions(ctx, secretID)
+}
+
+// RestoreSecret записывает содержимое версии version как новое изменение секрета,
+// удаленный секрет создается заново
+func (s *Service) RestoreSecret(ctx context.Context, name string, version int64) (*models.LocalSecret, error) {
+
+	if err := s.unlockVault(ctx); err != nil {
+		return nil, err
+	}
+
+	secretID, err := s.secretIDByName(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	secretVersion, err := s.grpcClient.GetSecretVersion(ctx, secretID, version)
+	if err != nil {
+		return nil, err
+	}
+
+	restored, err := models.ConvertRemoteSecretToLocalSecret(s.cryptor, &secretVersion.RemoteSecret)
+	if err != nil {
+		return nil, err
+	}
+	restored.LastModified = time.Now()
+
+	_, err = s.storage.GetByKey(ctx, secretID)
+	if err != nil {
+		restored.Revision = 0
+		restored.BaseHash = ""
+
+		_, err = s.storage.Create(ctx, restored)
+		if err != nil {
+			return nil, err
+		}
+
+		return restored, s.createRemoteSecret(ctx, secretID)
+	}
+
+	return restored, s.UpdateSecret(ctx, restored)
+}
+
+func (s *Service) DeleteSecret(ctx context.Context, name string) error {
+
+	if err := s.unlockVault(ctx); err != nil {
+		return err
+	}
+
+	secret, err := s.storage.GetByName(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	err = s.deleteLocalSecret(ctx, secret.ID)
+	if err != nil {
+		return err
+	}
+
+	err = s.deleteRemoteSecret(ctx, secret.ID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// UndeleteSecret возвращает секрет из корзины на сервере и сохраняет его локально
+func (s *Service) UndeleteSecret(ctx context.Context, name string) (*models.LocalSecret, error) {
+
+	if err := s.unlockVault(ctx); err != nil {
+		return nil, err
+	}
+
+	deletedSecret, err := s.findDeletedSecret(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	remoteSecret, err := s.grpcClient.UndeleteSecret(ctx, deletedSecret.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.applyRemoteSecret(ctx, remoteSecret, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.storage.GetByKey(ctx, deletedSecret.ID)
+}
+
+// ListDeletedSecrets секреты в корзине на сервере, имена расшифровываются на клиенте.
+// Секреты, удаленные до появления ключа хранилища, после перешифровки (bindVaultKeys) не читаются и пропускаются
+func (s *Service) ListDeletedSecrets(ctx context.Context) ([]*models.LocalSecret, error) {
+
+	if err := s.unlockVault(ctx); err != nil {
+		return nil, err
+	}
+
+	remoteSecrets, err := s.grpcClient.ListDeletedSecrets(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	secrets := make([]*models.LocalSecret, 0, len(remoteSecrets))
+	for _, remoteSecret := range remoteSecrets {
+		secret, err := models.ConvertRemoteSecretToLocalSecret(s.cryptor, remoteSecret)
+		if err != nil {
+			fmt.Printf("Skipping unreadable deleted secret '%s': %v\n", remoteSecret.ID, err)
+			continue
+		}
+		secrets = append(secrets, secret)
+	}
+
+	return secrets, nil
+}
+
+// Logout завершает сессию клиента на сервере, allSessions - сессии пользователя на всех устройствах
+func (s *Service) Logout(ctx context.Context, allSessions bool) (int64, error) {
+	return s.grpcClient.Logout(ctx, allSessions)
+}
+
+func (s *Service) PurgeDeletedSecrets(ctx context.Context) (int64, error) {
+	return s.grpcClient.PurgeDeletedSecrets(ctx)
+}
+
+// ChangeMasterPassword шифрует ключ хранилища новым мастер-паролем и меняет пароль авторизации на сервере.
+// Секреты не перешифровываются, ключ хранилища остается прежним
+func (s *Service) ChangeMasterPassword(ctx context.Context, newMasterPassword string) error {
+
+	if newMasterPassword == "" {
+		return fmt.Errorf("new master password is required")
+	}
+
+	err := s.unlockVault(ctx)
+	if err != nil {
+		return err
+	}
+
+	params, err := s.cryptor.NewKDFParams()
+	if err != nil {
+		return err
+	}
 
-	err := s.deleteLocalSecret(ctx, secretID)
+	vaultKey, serverPassword, err := s.cryptor.RewrapVault(newMasterPassword, params)
 	if err != nil {
 		return err
 	}
 
-	err = s.deleteRemoteSecret(ctx, secretID)
+	err = s.changePassword(ctx, serverPassword, vaultKey, params)
 	if err != nil {
 		return err
 	}
 
+	s.cryptor.SetMasterPassword(newMasterPassword, params)
 	return nil
 }
 
+// UpgradeKDF переводит учетную запись на параметры Argon2id из настроек клиента с новой солью:
+// связка ключей перешифровывается, пароль для сервера выводится заново. Возвращает false,
+// если параметры учетной записи не слабее параметров из настроек
+func (s *Service) UpgradeKDF(ctx context.Context) (bool, error) {
+
+	err := s.unlockVault(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	if !s.cryptor.KDFUpgradeNeeded() {
+		return false, nil
+	}
+
+	params, err := s.cryptor.NewKDFParams()
+	if err != nil {
+		return false, err
+	}
+
+	vaultKey, serverPassword, err := s.cryptor.UpgradeVault(params)
+	if err != nil {
+		return false, err
+	}
+
+	err = s.changePassword(ctx, serverPassword, vaultKey, params)
+	if err != nil {
+		return false, err
+	}
+
+	s.cryptor.SetKDFParams(params)
+	return true, nil
+}
+
+// RotateVaultKey создает новый ключ хранилища и перешифровывает им все данные на сервере: секреты,
+// корзину и историю версий. Прежние ключи после этого удаляются из связки
+func (s *Service) RotateVaultKey(ctx context.Context) (int, error) {
+
+	err := s.unlockVault(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	vaultKey, err := s.cryptor.RotateVaultKey()
+	if err != nil {
+		return 0, err
+	}
+
+	err = s.grpcClient.SetVaultKey(ctx, vaultKey, true)
+	if err != nil {
+		return 0, err
+	}
+
+	// сервер принял новую связку, дальше данные шифруются новым ключом
+	err = s.cryptor.UnlockVault(vaultKey)
+	if err != nil {
+		return 0, err
+	}
+
+	return s.retireVaultKeys(ctx, "rotate-key")
+}
+
 func (s *Service) GetUpdatedSecrets(ctx context.Context) error {
 
 	connNumber := strconv.FormatUint(s.grpcClient.ConnectionNumber(), 10)
@@ -148,7 +526,7 @@ func (s *Service) GetUpdatedSecrets(ctx context.Context) error {
 
 		resp, err := s.grpcClient.GetStream().Recv()
 
-		fmt.Printf("conn %s. GetUpdatedSecrets start getting secrets %v\n", connNumber, resp.Secrets)
+		fmt.Printf("conn %s. GetUpdatedSecrets start getting secrets %v\n", connNumber, resp.GetSecrets())
 
 		if err == io.EOF {
 			fmt.Printf("conn %s. GetUpdatedSecrets stopped EOF\n", connNumber)
@@ -171,6 +549,15 @@ func (s *Service) GetUpdatedSecrets(ctx context.Context) error {
 			return err
 		}
 
+		var revision int64
+		for _, secret := range resp.Secrets {
+			revision = max(revision, secret.GetRevision())
+		}
+
+		if err = s.advanceRevision(ctx, revision); err != nil {
+			return err
+		}
+
 		fmt.Printf("conn %s. GetUpdatedSecrets end getting secrets\n", connNumber)
 
 	}
@@ -1,11 +1,18 @@
 package service
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"github.com/s-turchinskiy/keeper/internal/client/crypto"
+	"github.com/s-turchinskiy/keeper/internal/client/grpcclient"
 	"github.com/s-turchinskiy/keeper/internal/client/models"
 	"github.com/s-turchinskiy/keeper/internal/utils/errorsutils"
 	"github.com/s-turchinskiy/keeper/models/proto"
+	"time"
+
+	"github.com/google/uuid"
 )
 
 func (s *Service) deleteLocalSecret(ctx context.Context, secretID string) error {
@@ -32,20 +39,33 @@ func (s *Service) createRemoteSecret(ctx context.Context, secretID string) error
 		return err
 	}
 
-	err = s.grpcClient.SetSecret(ctx, remoteSecret)
+	revision, err := s.grpcClient.SetSecret(ctx, remoteSecret, models.ExpectRevision(0))
+	var conflictErr *models.ConflictError
+	if errors.As(err, &conflictErr) {
+		// локальная копия остается неотправленной, sync разрешит конфликт с версией сервера
+		conflictErr.Name = localSecret.Name
+		localSecret.Conflicted = true
+		if _, updateErr := s.storage.UpdateByKey(ctx, secretID, localSecret); updateErr != nil {
+			return updateErr
+		}
+		return err
+	}
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return s.markSynced(ctx, secretID, revision)
 }
 
 func (s *Service) createLocalSecret(ctx context.Context, remoteSecret *models.RemoteSecret) error {
-	fmt.Printf("Creating local secret '%s'\n", remoteSecret.Name)
+	fmt.Printf("Creating local secret '%s'\n", remoteSecret.ID)
 
-	remoteSecret, err := s.grpcClient.GetSecret(ctx, remoteSecret.Name)
-	if err != nil {
-		return err
+	if len(remoteSecret.Data) == 0 {
+		var err error
+		remoteSecret, err = s.grpcClient.GetSecret(ctx, remoteSecret.ID)
+		if err != nil {
+			return err
+		}
 	}
 
 	localSecret, err := models.ConvertRemoteSecretToLocalSecret(s.cryptor, remoteSecret)
@@ -89,9 +109,9 @@ func (s *Service) deleteRemoteSecret(ctx context.Context, secretID string) error
 }
 
 func (s *Service) replaceLocalSecret(ctx context.Context, remoteSecret *models.RemoteSecret) error {
-	fmt.Printf("Replacing remote secret '%s'\n", remoteSecret.Name)
+	fmt.Printf("Replacing local secret '%s'\n", remoteSecret.ID)
 
-	err := s.deleteLocalSecret(ctx, remoteSecret.Name)
+	err := s.deleteLocalSecret(ctx, remoteSecret.ID)
 	if err != nil {
 		return err
 	}
@@ -104,56 +124,563 @@ func (s *Service) replaceLocalSecret(ctx context.Context, remoteSecret *models.R
 	return nil
 }
 
-func (s *Service) replaceRemoteSecret(ctx context.Context, localSecret *models.LocalSecret) error {
+func (s *Service) replaceRemoteSecret(ctx context.Context, localSecret *models.LocalSecret, expected *models.ExpectedVersion) (int64, error) {
 	fmt.Printf("Replacing remote secret '%s'\n", localSecret.Name)
 
 	remoteSecret, err := models.ConvertLocalSecretToRemoteSecret(s.cryptor, localSecret)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	err = s.grpcClient.UpdateSecret(ctx, remoteSecret)
+	return s.grpcClient.UpdateSecret(ctx, remoteSecret, expected)
+}
+
+func (s *Service) syncLocalSecret(ctx context.Context, secret *proto.Secret, connNumber string) error {
+
+	fmt.Printf("conn %s. GetUpdatedSecrets start syncing secret \"%s\"\n", connNumber, secret.GetId())
+
+	err := s.applyRemoteSecret(ctx, models.ConvertProtoSecretToRemoteSecret(secret), nil)
 	if err != nil {
+		fmt.Printf("conn %s. GetUpdatedSecrets end syncing secret \"%s\", error: %v\n",
+			connNumber, secret.GetId(), errorsutils.WrapError(err))
 		return err
 	}
 
+	fmt.Printf("conn %s. GetUpdatedSecrets end syncing secret \"%s\", success\n", connNumber, secret.GetId())
 	return nil
+}
 
+// applyRemoteSecret применяет к локальному хранилищу изменение секрета, пришедшее с сервера.
+// Если локальная копия тоже изменена, конфликт разрешает resolver, без resolver изменение пропускается
+// до следующей синхронизации.
+func (s *Service) applyRemoteSecret(ctx context.Context, remoteSecret *models.RemoteSecret, resolver models.ConflictResolver) error {
+
+	localSecret, err := s.storage.GetByKey(ctx, remoteSecret.ID)
+	exists := err == nil
+
+	switch {
+	case exists && localSecret.Revision >= remoteSecret.Revision:
+		return nil
+
+	case exists && !remoteSecret.Deleted && localSecret.Hash == remoteSecret.Hash:
+		return s.markSynced(ctx, remoteSecret.ID, remoteSecret.Revision)
+
+	case exists && localSecret.Modified():
+		if resolver == nil {
+			fmt.Printf("Secret '%s' changed locally and on the server, run sync to resolve\n", remoteSecret.ID)
+			return nil
+		}
+		return s.resolveConflict(ctx, localSecret, remoteSecret, resolver)
+
+	case remoteSecret.Deleted:
+		if !exists {
+			return nil
+		}
+		return s.deleteLocalSecret(ctx, remoteSecret.ID)
+
+	case exists:
+		return s.replaceLocalSecret(ctx, remoteSecret)
+
+	default:
+		return s.createLocalSecret(ctx, remoteSecret)
+	}
 }
 
-func (s *Service) syncLocalSecret(ctx context.Context, secret *proto.Secret, connNumber string) error {
+// pushLocalSecret отправляет локальные изменения относительно последней синхронизированной ревизии
+func (s *Service) pushLocalSecret(ctx context.Context, localSecret *models.LocalSecret, resolver models.ConflictResolver) error {
+
+	revision, err := s.replaceRemoteSecret(ctx, localSecret, models.ExpectRevision(localSecret.Revision))
+	var conflictErr *models.ConflictError
+	if errors.As(err, &conflictErr) && conflictErr.Current != nil {
+		return s.resolveConflict(ctx, localSecret, conflictErr.Current, resolver)
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.markSynced(ctx, localSecret.ID, revision)
+}
+
+// resolveConflict расшифровывает серверную версию и применяет выбранный resolver вариант
+func (s *Service) resolveConflict(ctx context.Context, localSecret *models.LocalSecret, remoteSecret *models.RemoteSecret, resolver models.ConflictResolver) error {
+
+	var (
+		remoteLocalSecret *models.LocalSecret
+		remoteRevision    int64
+		err               error
+	)
+
+	if !remoteSecret.Deleted {
+		if len(remoteSecret.Data) == 0 {
+			remoteSecret, err = s.grpcClient.GetSecret(ctx, remoteSecret.ID)
+			if err != nil {
+				return err
+			}
+		}
+
+		remoteLocalSecret, err = models.ConvertRemoteSecretToLocalSecret(s.cryptor, remoteSecret)
+		if err != nil {
+			return err
+		}
+
+		if remoteLocalSecret.Hash == localSecret.Hash {
+			return s.markSynced(ctx, localSecret.ID, remoteSecret.Revision)
+		}
+
+		remoteRevision = remoteSecret.Revision
+	}
+
+	resolution, err := resolver(localSecret, remoteLocalSecret)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Conflict in secret '%s' resolved: %s\n", localSecret.Name, resolution)
+
+	switch resolution {
+	case models.ResolutionLocal:
+		revision, err := s.replaceRemoteSecret(ctx, localSecret, models.ExpectRevision(remoteRevision))
+		if err != nil {
+			return err
+		}
+		return s.markSynced(ctx, localSecret.ID, revision)
+
+	case models.ResolutionRemote:
+		return s.takeRemoteSecret(ctx, localSecret.ID, remoteSecret)
+
+	case models.ResolutionKeepBoth:
+		copySecret := *localSecret
+		copySecret.ID = uuid.NewString()
+		copySecret.Revision = 0
+		copySecret.BaseHash = ""
+		copySecret.Conflicted = false
+
+		err = copySecret.Rename(s.cryptor, models.ConflictCopyName(localSecret.Name, time.Now()))
+		if err != nil {
+			return err
+		}
+
+		_, err = s.storage.Create(ctx, &copySecret)
+		if err != nil {
+			return err
+		}
+
+		err = s.createRemoteSecret(ctx, copySecret.ID)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Local version of '%s' saved as '%s'\n", localSecret.Name, copySecret.Name)
+		return s.takeRemoteSecret(ctx, localSecret.ID, remoteSecret)
+
+	default:
+		return fmt.Errorf("unsupported conflict resolution: %s", resolution)
+	}
+}
+
+func (s *Service) takeRemoteSecret(ctx context.Context, secretID string, remoteSecret *models.RemoteSecret) error {
+	if remoteSecret.Deleted {
+		return s.deleteLocalSecret(ctx, secretID)
+	}
+
+	return s.replaceLocalSecret(ctx, remoteSecret)
+}
+
+// markSynced запоминает, что локальная копия совпадает с версией сервера revision
+func (s *Service) markSynced(ctx context.Context, secretID string, revision int64) error {
+
+	localSecret, err := s.storage.GetByKey(ctx, secretID)
+	if err != nil {
+		return err
+	}
+
+	if localSecret.Revision == revision && !localSecret.Modified() && !localSecret.Conflicted {
+		return nil
+	}
+
+	localSecret.Revision = revision
+	localSecret.BaseHash = localSecret.Hash
+	localSecret.Conflicted = false
+	_, err = s.storage.UpdateByKey(ctx, secretID, localSecret)
+	return err
+}
+
+// secretIDByName ищет ID секрета по имени среди локальных секретов, затем в корзине на сервере
+func (s *Service) secretIDByName(ctx context.Context, name string) (string, error) {
+
+	secret, err := s.storage.GetByName(ctx, name)
+	if err == nil {
+		return secret.ID, nil
+	}
+
+	secret, err = s.findDeletedSecret(ctx, name)
+	if err != nil {
+		return "", err
+	}
+
+	return secret.ID, nil
+}
+
+func (s *Service) findDeletedSecret(ctx context.Context, name string) (*models.LocalSecret, error) {
+
+	deletedSecrets, err := s.ListDeletedSecrets(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, secret := range deletedSecrets {
+		if secret.Name == name {
+			return secret, nil
+		}
+	}
 
-	if *secret.Deleted {
+	return nil, fmt.Errorf("%w: %s", ErrSecretNotFound, name)
+}
 
-		fmt.Printf("conn %s. GetUpdatedSecrets start deleting secret \"%s\"\n", connNumber, secret.Id)
-		err := s.deleteLocalSecret(ctx, secret.Id)
-		fmt.Printf("conn %s. GetUpdatedSecrets end deleting secret \"%s\"\n", connNumber, secret.Id)
+// advanceRevision сохраняет ревизию сервера, до которой клиент получил все изменения
+func (s *Service) advanceRevision(ctx context.Context, revision int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, err := s.storage.GetRevision(ctx)
+	if err != nil {
 		return err
+	}
+
+	if revision <= current {
+		return nil
+	}
+
+	err = s.storage.SetRevision(ctx, revision)
+	if err != nil {
+		return err
+	}
+
+	s.grpcClient.SetSinceRevision(revision)
+	return nil
+}
+
+// unlockVault получает с сервера ключ хранилища и расшифровывает его мастер-паролем,
+// при первом обращении пользователя ключ создается. Без ключа хранилища недоступно и локальное хранилище
+func (s *Service) unlockVault(ctx context.Context) error {
+	s.vaultMu.Lock()
+	defer s.vaultMu.Unlock()
 
+	if s.vaultUnlocked {
+		return nil
+	}
+
+	vaultKey, err := s.grpcClient.GetVaultKey(ctx)
+	if err != nil {
+		return err
 	}
 
-	fmt.Printf("conn %s. GetUpdatedSecrets start updating secret \"%s\"\n", connNumber, secret.Id)
+	if len(vaultKey) == 0 {
+		vaultKey, err = s.createVault(ctx)
+		if err != nil {
+			return err
+		}
+	}
 
-	localSecret, err := s.storage.GetByKey(ctx, secret.Id)
+	err = s.cryptor.UnlockVault(vaultKey)
 	if err != nil {
-		fmt.Printf("conn %s. GetUpdatedSecrets end updating secret \"%s\", error: %v\n",
-			connNumber, secret.Id, errorsutils.WrapError(err))
 		return err
 	}
 
-	remoteSecret := models.ConvertProtoSecretToRemoteSecret(secret)
-	if localSecret.LastModified.Before(remoteSecret.LastModified) {
-		err = s.replaceLocalSecret(ctx, remoteSecret)
+	migrated, err := s.storage.EncryptPlaintext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt local storage: %w", err)
+	}
+	if migrated > 0 {
+		fmt.Printf("Local storage encrypted: %d secrets\n", migrated)
+	}
+
+	bound, err := s.bindVaultKeys(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to re-encrypt secrets written before the vault key: %w", err)
+	}
+	if bound > 0 {
+		fmt.Printf("Secrets re-encrypted: %d\n", bound)
+	}
+
+	retired, err := s.retireVaultKeys(ctx, "sync")
+	if err != nil {
+		return fmt.Errorf("failed to finish vault key rotation: %w", err)
+	}
+	if retired > 0 {
+		fmt.Printf("Vault key rotation finished, records re-encrypted: %d\n", retired)
+	}
+
+	s.vaultUnlocked = true
+	if s.cryptor.KDFUpgradeNeeded() {
+		fmt.Println("Key derivation parameters are weaker than configured, run upgrade-kdf to upgrade them")
+	}
+	return nil
+}
+
+// bindVaultKeys перешифровывает в конверт секреты на сервере, записанные без него до появления ключа хранилища,
+// после чего связка перестает принимать данные без конверта: иначе сервер мог бы выдать данные одного
+// секрета за другой. Версии в истории и корзине, записанные без конверта, после этого не читаются
+func (s *Service) bindVaultKeys(ctx context.Context) (int, error) {
+	if !s.cryptor.HasUnboundKeys() {
+		return 0, nil
+	}
+
+	secrets, err := s.getRemoteSecrets(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	// до замены связки перешифрованные секреты читаются и старой связкой, поэтому прерванный перенос
+	// повторяется при следующем открытии хранилища
+	err = s.reencryptRemoteSecrets(ctx, secrets, "sync")
+	if err != nil {
+		return 0, err
+	}
+
+	vaultKey, err := s.cryptor.BindVaultKeys()
+	if err != nil {
+		return 0, err
+	}
+
+	err = s.grpcClient.SetVaultKey(ctx, vaultKey, true)
+	if err != nil {
+		return 0, err
+	}
+
+	err = s.cryptor.UnlockVault(vaultKey)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(secrets), nil
+}
+
+// retireVaultKeys перешифровывает текущим ключом хранилища секреты на сервере, корзину и историю версий,
+// после чего удаляет из связки ключи, выведенные из работы ротацией. До замены связки все данные читаются
+// и старой связкой, поэтому прерванная ротация завершается при следующем открытии хранилища
+func (s *Service) retireVaultKeys(ctx context.Context, command string) (int, error) {
+	if !s.cryptor.HasRetiredKeys() {
+		return 0, nil
+	}
+
+	secrets, err := s.getRemoteSecrets(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	err = s.reencryptRemoteSecrets(ctx, secrets, command)
+	if err != nil {
+		return 0, err
+	}
+
+	secretIDs := make([]string, 0, len(secrets))
+	for _, secret := range secrets {
+		secretIDs = append(secretIDs, secret.ID)
+	}
+
+	archived, err := s.rekeyArchivedSecrets(ctx, secretIDs, command)
+	if err != nil {
+		return 0, err
+	}
+
+	vaultKey, err := s.cryptor.PruneVaultKeys()
+	if err != nil {
+		return 0, err
+	}
+
+	err = s.grpcClient.SetVaultKey(ctx, vaultKey, true)
+	if err != nil {
+		return 0, err
+	}
+
+	err = s.cryptor.UnlockVault(vaultKey)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(secrets) + archived, nil
+}
+
+// rekeyArchivedSecrets перешифровывает текущим ключом хранилища секреты в корзине и версии из истории
+// секретов secretIDs и секретов в корзине. Записи, которые не расшифровываются, пропускаются
+func (s *Service) rekeyArchivedSecrets(ctx context.Context, secretIDs []string, command string) (int, error) {
+
+	deletedSecrets, err := s.grpcClient.ListDeletedSecrets(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var versions []*models.SecretVersion
+	for _, deletedSecret := range deletedSecrets {
+		secretIDs = append(secretIDs, deletedSecret.ID)
+
+		version, err := s.rekeySecretVersion(&models.SecretVersion{RemoteSecret: *deletedSecret})
+		if err != nil {
+			return 0, err
+		}
+		if version != nil {
+			versions = append(versions, version)
+		}
+	}
+
+	for _, secretID := range secretIDs {
+		history, err := s.grpcClient.ListSecretVersions(ctx, secretID)
+		if err != nil {
+			return 0, err
+		}
+
+		for _, item := range history {
+			secretVersion, err := s.grpcClient.GetSecretVersion(ctx, secretID, item.Version)
+			if err != nil {
+				return 0, err
+			}
+
+			version, err := s.rekeySecretVersion(secretVersion)
+			if err != nil {
+				return 0, err
+			}
+			if version != nil {
+				versions = append(versions, version)
+			}
+		}
+	}
+
+	if len(versions) == 0 {
+		return 0, nil
+	}
+
+	rekeyed, err := s.grpcClient.RekeySecrets(ctx, versions)
+	if err != nil {
+		return 0, err
+	}
+	if rekeyed < int64(len(versions)) {
+		return 0, fmt.Errorf("trash or history changed during re-encryption, run %s again", command)
+	}
+
+	return len(versions), nil
+}
+
+// rekeySecretVersion версия секрета, перешифрованная текущим ключом хранилища, или nil, если версия не читается
+func (s *Service) rekeySecretVersion(version *models.SecretVersion) (*models.SecretVersion, error) {
+
+	plainData, err := s.cryptor.DecryptSecretData(version.ID, version.Data)
+	if err != nil {
+		fmt.Printf("Skipping unreadable secret '%s' version %d: %v\n", version.ID, version.Version, err)
+		return nil, nil
+	}
+
+	data, err := s.cryptor.EncryptSecretData(version.ID, plainData)
+	if err != nil {
+		return nil, err
+	}
+
+	rekeyed := *version
+	rekeyed.Data = data
+	return &rekeyed, nil
+}
+
+// getRemoteSecrets все секреты пользователя на сервере, расшифрованные текущей связкой
+func (s *Service) getRemoteSecrets(ctx context.Context) ([]*models.LocalSecret, error) {
+
+	remoteSecrets, err := s.grpcClient.ListSecrets(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	secrets := make([]*models.LocalSecret, 0, len(remoteSecrets))
+	for _, remoteSecret := range remoteSecrets {
+		secret, err := s.getSecretFromServer(ctx, remoteSecret.ID)
+		if err != nil {
+			return nil, err
+		}
+		secrets = append(secrets, secret)
+	}
+
+	return secrets, nil
+}
+
+// reencryptRemoteSecrets записывает secrets на сервер, зашифровав их текущим ключом хранилища.
+// Секрет, измененный на сервере после чтения, не перезаписывается: перешифровку нужно повторить командой command
+func (s *Service) reencryptRemoteSecrets(ctx context.Context, secrets []*models.LocalSecret, command string) error {
+
+	for _, secret := range secrets {
+		revision, err := s.replaceRemoteSecret(ctx, secret, models.ExpectRevision(secret.Revision))
+		var conflictErr *models.ConflictError
+		if errors.As(err, &conflictErr) {
+			return fmt.Errorf("secret '%s' changed during re-encryption, run %s again: %w", secret.Name, command, err)
+		}
+		if err != nil {
+			return err
+		}
+
+		localSecret, err := s.storage.GetByKey(ctx, secret.ID)
+		if err != nil || localSecret.Modified() || localSecret.Hash != secret.Hash {
+			continue
+		}
+
+		err = s.markSynced(ctx, secret.ID, revision)
 		if err != nil {
-			fmt.Printf("conn %s. GetUpdatedSecrets end updating secret \"%s\", error: %v\n",
-				connNumber, secret.Id, errorsutils.WrapError(err))
 			return err
 		}
+	}
 
-		fmt.Printf("conn %s. GetUpdatedSecrets end updating secret \"%s\", success\n", connNumber, secret.Id)
+	return nil
+}
+
+// changePassword отправляет на сервер связку ключей и пароль для сервера, выведенные с параметрами params.
+// Если ответ потерян, но сервер уже принял новые параметры, старый пароль для сервера больше не действует:
+// изменение считается выполненным, клиент входит с новым паролем
+func (s *Service) changePassword(ctx context.Context, serverPassword string, vaultKey []byte, params *crypto.KDFParams) error {
+	err := s.grpcClient.ChangePassword(ctx, serverPassword, vaultKey, params)
+	if err == nil {
 		return nil
 	}
 
-	fmt.Printf("conn %s. GetUpdatedSecrets end updating secret \"%s\", LastModified equal\n", connNumber, secret.Id)
+	// соль случайна для каждого изменения, поэтому совпадение значит, что сервер его принял
+	current, getErr := s.grpcClient.GetKDFParams(ctx, s.login)
+	if getErr != nil || current == nil || !bytes.Equal(current.Salt, params.Salt) {
+		return err
+	}
+
+	s.grpcClient.SetCredentials(s.login, serverPassword)
 	return nil
 }
+
+// createVault создает ключ хранилища. Если у пользователя уже есть секреты, зашифрованные ключом
+// от мастер-пароля, этот ключ переносится в хранилище без перешифровки секретов
+func (s *Service) createVault(ctx context.Context) ([]byte, error) {
+
+	remoteSecrets, err := s.grpcClient.ListSecrets(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	deletedSecrets, err := s.grpcClient.ListDeletedSecrets(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	localSecrets, err := s.storage.Count(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	legacy := len(remoteSecrets)+len(deletedSecrets) > 0 || localSecrets > 0
+
+	vaultKey, err := s.cryptor.CreateVault(legacy)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.grpcClient.SetVaultKey(ctx, vaultKey, false)
+	if errors.Is(err, grpcclient.ErrVaultKeyExists) {
+		return s.grpcClient.GetVaultKey(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("Vault key created")
+	return vaultKey, nil
+}
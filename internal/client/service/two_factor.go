@@ -0,0 +1,25 @@
+package service
+
+import (
+	"context"
+	"github.com/s-turchinskiy/keeper/internal/client/models"
+)
+
+// EnableTwoFactor начинает подключение TOTP, возвращает секрет в base32 и otpauth URI для приложения-аутентификатора
+func (s *Service) EnableTwoFactor(ctx context.Context) (string, string, error) {
+	return s.grpcClient.EnableTwoFactor(ctx)
+}
+
+// ConfirmTwoFactor включает второй фактор первым кодом из приложения, возвращает коды восстановления
+func (s *Service) ConfirmTwoFactor(ctx context.Context, code string) ([]string, error) {
+	return s.grpcClient.ConfirmTwoFactor(ctx, code)
+}
+
+// DisableTwoFactor отключает второй фактор по коду TOTP или коду восстановления
+func (s *Service) DisableTwoFactor(ctx context.Context, code string) error {
+	return s.grpcClient.DisableTwoFactor(ctx, code)
+}
+
+func (s *Service) GetTwoFactorStatus(ctx context.Context) (*models.TwoFactorStatus, error) {
+	return s.grpcClient.GetTwoFactorStatus(ctx)
+}
@@ -2,13 +2,16 @@ package functional_tests
 
 import (
 	"context"
+	"github.com/s-turchinskiy/keeper/internal/client/crypto"
 	grpcserver "github.com/s-turchinskiy/keeper/internal/server/grpc"
 	"github.com/s-turchinskiy/keeper/internal/server/repository"
 	"github.com/s-turchinskiy/keeper/internal/server/service"
 	"github.com/s-turchinskiy/keeper/internal/server/token"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/test/bufconn"
 	"log"
 	"net"
+	"sync"
 	"time"
 )
 
@@ -24,13 +27,45 @@ const (
 
 const bufSize = 1024 * 1024
 
+var kdfParams = &crypto.KDFParams{
+	Salt:      []byte("0123456789abcdef"),
+	Time:      3,
+	MemoryKiB: 64 * 1024,
+	Threads:   4,
+}
+
 var lis *bufconn.Listener
 
+// clock часы сервера для проверки кодов TOTP: тест считает коды на тот же момент и сам переводит время
+var clock = &testClock{now: time.Date(2025, time.January, 1, 12, 0, 0, 0, time.UTC)}
+
+type testClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
 func bufDialer(context.Context, string) (net.Conn, error) {
 	return lis.Dial()
 }
 
-func runGRPCServer(usersRepository repository.UserRepositorier, secretRepository repository.SecretRepositorier) {
+func runGRPCServer(
+	usersRepository repository.UserRepositorier,
+	secretRepository repository.SecretRepositorier,
+	sessionRepository repository.SessionRepositorier,
+	deviceRepository repository.DeviceRepositorier,
+	opts ...grpc.ServerOption) {
 	lis = bufconn.Listen(bufSize)
 
 	jwtManager := token.NewJWTManager("secret", time.Minute)
@@ -38,8 +73,11 @@ func runGRPCServer(usersRepository repository.UserRepositorier, secretRepository
 		jwtManager,
 		usersRepository,
 		secretRepository,
+		sessionRepository,
+		deviceRepository,
+		service.WithClock(clock.Now),
 	)
-	grpcServer := grpcserver.NewGrpcServer(srvc)
+	grpcServer := grpcserver.NewGrpcServer(srvc, opts...)
 
 	go func() {
 		if err := grpcServer.Serve(lis); err != nil {
@@ -24,10 +24,12 @@ func FunctionalTestAll(
 	t *testing.T,
 	usersRepository repository.UserRepositorier,
 	secretRepository repository.SecretRepositorier,
-	mongoRepository clientrepository.Repositorier,
+	sessionRepository repository.SessionRepositorier,
+	deviceRepository repository.DeviceRepositorier,
+	newStorage func(cryptor crypto.Cryptor) (clientrepository.Repositorier, error),
 	debug bool) {
 
-	runGRPCServer(usersRepository, secretRepository)
+	runGRPCServer(usersRepository, secretRepository, sessionRepository, deviceRepository)
 
 	ctx := context.Background()
 	if !debug {
@@ -40,7 +42,17 @@ func FunctionalTestAll(
 	require.NoError(t, err)
 
 	cryptor := crypto.NewCryptor(password, loginExistingUser)
-	srvc := service.NewService(ctx, mongoRepository, grpcClient, service.WithCrypto(cryptor))
+	storage, err := newStorage(cryptor)
+	require.NoError(t, err)
+	srvc := service.NewService(ctx, storage, grpcClient, service.WithCrypto(cryptor), service.WithLogin(loginExistingUser))
+
+	newUserGRPCClient, err := grpcclient.NewGRPCClient(ctx, "passthrough://bufnet", loginNewUser, password, grpc.WithContextDialer(bufDialer))
+	require.NoError(t, err)
+
+	newUserCryptor := crypto.NewCryptor(password, loginNewUser)
+	newUserStorage, err := newStorage(newUserCryptor)
+	require.NoError(t, err)
+	newUserSrvc := service.NewService(ctx, newUserStorage, newUserGRPCClient, service.WithCrypto(newUserCryptor), service.WithLogin(loginNewUser))
 
 	clientSecrets := []secretsType{
 		{
@@ -76,23 +88,23 @@ func FunctionalTestAll(
 	}
 
 	if debug {
-		functionalTestAll(ctx, t, srvc, clientSecrets, debug)
+		functionalTestAll(ctx, t, srvc, newUserSrvc, clientSecrets, debug)
 	} else {
 		t.Run(fmt.Sprintf("test #%d: %s", 1, "Функциональный тест grpc на все методы"), func(t *testing.T) {
-			functionalTestAll(ctx, t, srvc, clientSecrets, debug)
+			functionalTestAll(ctx, t, srvc, newUserSrvc, clientSecrets, debug)
 		})
 	}
 
 }
 
-func functionalTestAll(ctx context.Context, t *testing.T, srvc *service.Service, clientSecrets []secretsType, debug bool) {
+func functionalTestAll(ctx context.Context, t *testing.T, srvc, newUserSrvc *service.Service, clientSecrets []secretsType, debug bool) {
 
-	err := srvc.Register(ctx, loginNewUser, password)
+	err := newUserSrvc.Register(ctx)
 	if !debug {
 		require.NoError(t, err)
 	}
 
-	err = srvc.Register(ctx, loginExistingUser, password)
+	err = srvc.Register(ctx)
 	require.Error(t, err)
 
 	err = srvc.Login(ctx, loginExistingUser, password)
@@ -0,0 +1,222 @@
+package functional_tests
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"github.com/s-turchinskiy/keeper/internal/client"
+	"github.com/s-turchinskiy/keeper/internal/client/config"
+	"github.com/s-turchinskiy/keeper/internal/client/grpcclient"
+	clientmodels "github.com/s-turchinskiy/keeper/internal/client/models"
+	"github.com/s-turchinskiy/keeper/internal/server/repository"
+	"github.com/s-turchinskiy/keeper/internal/utils/otputils"
+	"github.com/s-turchinskiy/keeper/internal/utils/tlsutils"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const appSecretName = "App secret"
+
+// FunctionalTestApp запускает клиент целиком, через команды CLI, против сервера на bufconn с mTLS.
+// Локальное хранилище клиента в памяти, на диске ничего не остается.
+// Подтесты выполняются по порядку на одном клиенте, отзыв устройства - последним
+func FunctionalTestApp(
+	t *testing.T,
+	usersRepository repository.UserRepositorier,
+	secretRepository repository.SecretRepositorier,
+	sessionRepository repository.SessionRepositorier,
+	deviceRepository repository.DeviceRepositorier) {
+
+	startAppServer(t, usersRepository, secretRepository, sessionRepository, deviceRepository)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var twoFactorCode string
+	app := newTestApp(t, client.WithTwoFactorPrompt(func(context.Context) (string, error) { return twoFactorCode, nil }))
+
+	t.Run("register and sync", func(t *testing.T) {
+		require.NoError(t, app.Execute("register"))
+		require.NoError(t, app.Execute("add", "text", "--name", appSecretName, "--content", "app data"))
+		require.NoError(t, app.Execute("list"))
+		require.NoError(t, app.Execute("get", appSecretName))
+
+		// после выхода сессия отозвана, клиент снова входит по паролю
+		require.NoError(t, app.Execute("logout"))
+		require.NoError(t, app.Execute("sync"))
+
+		secrets, err := app.Service.ListLocalSecrets(ctx)
+		require.NoError(t, err)
+		require.Len(t, secrets, 1)
+		require.Equal(t, appSecretName, secrets[0].Name)
+		require.False(t, secrets[0].Modified())
+
+		require.Equal(t, clientmodels.TextData{Content: "app data"}, readSecretData(ctx, t, app, appSecretName))
+	})
+
+	t.Run("ssh_key", func(t *testing.T) {
+		// ключ SSH из файла: открытый ключ и отпечаток вычисляются из закрытого
+		_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+		privateKeyPEM, err := ssh.MarshalPrivateKey(privateKey, "")
+		require.NoError(t, err)
+		privateKeyFile := filepath.Join(t.TempDir(), "id_ed25519")
+		require.NoError(t, os.WriteFile(privateKeyFile, pem.EncodeToMemory(privateKeyPEM), 0o600))
+
+		require.NoError(t, app.Execute("add", "ssh_key", "--name", "App ssh", "--private-key-file", privateKeyFile))
+		require.NoError(t, app.Execute("get", "App ssh"))
+
+		sshData := readSecretData(ctx, t, app, "App ssh").(clientmodels.SSHKeyData)
+		publicKey, err := ssh.NewPublicKey(privateKey.Public())
+		require.NoError(t, err)
+		require.Equal(t, ssh.FingerprintSHA256(publicKey), sshData.Fingerprint)
+		require.Contains(t, sshData.PublicKey, "ssh-ed25519 ")
+	})
+
+	t.Run("api_token", func(t *testing.T) {
+		require.NoError(t, app.Execute("add", "api_token", "--name", "App token", "--token", "tok_123",
+			"--scope", "repo,read:org", "--expires", "2030-01-02"))
+		require.NoError(t, app.Execute("edit", "api_token", "App token", "--scope", "repo"))
+
+		tokenData := readSecretData(ctx, t, app, "App token").(clientmodels.APITokenData)
+		require.Equal(t, "tok_123", tokenData.Token)
+		require.Equal(t, []string{"repo"}, tokenData.Scopes)
+		require.NotNil(t, tokenData.ExpiresAt)
+	})
+
+	t.Run("identity", func(t *testing.T) {
+		require.NoError(t, app.Execute("add", "identity", "--name", "App identity", "--full-name", "Alice Smith",
+			"--document", "passport=4509 123456", "--document", "driver_license=77 AB 123456"))
+		require.NoError(t, app.Execute("get", "App identity"))
+
+		identityData := readSecretData(ctx, t, app, "App identity").(clientmodels.IdentityData)
+		require.Equal(t, []clientmodels.IdentityDocument{
+			{Type: "passport", Number: "4509 123456"},
+			{Type: "driver_license", Number: "77 AB 123456"},
+		}, identityData.Documents)
+	})
+
+	t.Run("devices", func(t *testing.T) {
+		require.NoError(t, app.Execute("devices", "list"))
+
+		devices, err := app.Service.ListDevices(ctx)
+		require.NoError(t, err)
+		require.Len(t, devices, 1)
+		require.True(t, devices[0].Current)
+		require.Nil(t, devices[0].RevokedAt)
+	})
+
+	t.Run("two-factor", func(t *testing.T) {
+		// после подключения вход требует код, принятый код и код восстановления повторно не принимаются
+		totpSecretEncoded, uri, err := app.Service.EnableTwoFactor(ctx)
+		require.NoError(t, err)
+		require.Contains(t, uri, "otpauth://totp/")
+
+		totpSecret, err := otputils.DecodeSecret(totpSecretEncoded)
+		require.NoError(t, err)
+		currentCode := func() string {
+			code, err := otputils.TOTP(totpSecret, clock.Now(), otputils.DefaultParams())
+			require.NoError(t, err)
+			return code
+		}
+
+		_, err = app.Service.ConfirmTwoFactor(ctx, "12345")
+		require.ErrorIs(t, err, grpcclient.ErrInvalidTwoFactorCode)
+
+		twoFactorCode = currentCode()
+		recoveryCodes, err := app.Service.ConfirmTwoFactor(ctx, twoFactorCode)
+		require.NoError(t, err)
+		require.Len(t, recoveryCodes, 10)
+
+		require.NoError(t, app.Execute("2fa", "status"))
+		require.NoError(t, app.Execute("logout"))
+
+		_, err = app.Service.ListDevices(ctx)
+		require.ErrorIs(t, err, grpcclient.ErrInvalidTwoFactorCode)
+
+		clock.Advance(otputils.DefaultPeriod)
+		twoFactorCode = currentCode()
+		_, err = app.Service.ListDevices(ctx)
+		require.NoError(t, err)
+
+		require.NoError(t, app.Execute("logout"))
+		twoFactorCode = recoveryCodes[0]
+		twoFactorStatus, err := app.Service.GetTwoFactorStatus(ctx)
+		require.NoError(t, err)
+		require.True(t, twoFactorStatus.Enabled)
+		require.Equal(t, 9, twoFactorStatus.RecoveryCodesLeft)
+
+		require.ErrorIs(t, app.Service.DisableTwoFactor(ctx, recoveryCodes[0]), grpcclient.ErrInvalidTwoFactorCode)
+		require.NoError(t, app.Execute("2fa", "disable", "--code", recoveryCodes[1]))
+
+		twoFactorStatus, err = app.Service.GetTwoFactorStatus(ctx)
+		require.NoError(t, err)
+		require.False(t, twoFactorStatus.Enabled)
+	})
+
+	t.Run("revoke device", func(t *testing.T) {
+		// отозванное устройство теряет сессию и не может войти снова
+		devices, err := app.Service.ListDevices(ctx)
+		require.NoError(t, err)
+		require.Len(t, devices, 1)
+
+		require.NoError(t, app.Execute("devices", "revoke", devices[0].ID))
+		_, err = app.Service.ListDevices(ctx)
+		require.ErrorIs(t, err, grpcclient.ErrDeviceRevoked)
+	})
+}
+
+func readSecretData(ctx context.Context, t *testing.T, app *client.App, name string) clientmodels.SecretData {
+	secret, err := app.Service.ReadSecret(ctx, name)
+	require.NoError(t, err)
+
+	data, err := secret.ParseData()
+	require.NoError(t, err)
+
+	return data
+}
+
+// startAppServer запускает сервер на bufconn с mTLS и настраивает на него клиент переменными окружения
+func startAppServer(
+	t *testing.T,
+	usersRepository repository.UserRepositorier,
+	secretRepository repository.SecretRepositorier,
+	sessionRepository repository.SessionRepositorier,
+	deviceRepository repository.DeviceRepositorier) {
+
+	files := generateTLSFiles(t)
+	serverTLS, err := tlsutils.ServerConfig(files.ServerCertFile, files.ServerKeyFile, files.CAFile, tlsutils.DefaultMinVersion)
+	require.NoError(t, err)
+
+	runGRPCServer(usersRepository, secretRepository, sessionRepository, deviceRepository, grpc.Creds(credentials.NewTLS(serverTLS)))
+
+	t.Setenv("KEEPER_LOGIN", loginNewUser)
+	t.Setenv("KEEPER_PASSWORD", password)
+	t.Setenv("KEEPER_SERVER_GRPC_ADDR", "passthrough://bufnet")
+	t.Setenv("KEEPER_CLIENT_DB_URL", config.SchemeMemory)
+	t.Setenv("KEEPER_KDF_TIME", "1")
+	t.Setenv("KEEPER_KDF_MEMORY_KIB", "16384")
+	t.Setenv("KEEPER_KDF_THREADS", "1")
+	t.Setenv("KEEPER_TLS_CA_FILE", files.CAFile)
+	t.Setenv("KEEPER_TLS_SERVER_NAME", tlsServerName)
+	t.Setenv("KEEPER_TLS_CERT_FILE", files.ClientCertFile)
+	t.Setenv("KEEPER_TLS_KEY_FILE", files.ClientKeyFile)
+}
+
+// newTestApp клиент со своим локальным хранилищем в памяти, то есть отдельное устройство пользователя
+func newTestApp(t *testing.T, opts ...client.OptionApp) *client.App {
+
+	opts = append([]client.OptionApp{client.WithArgs(nil), client.WithDialOptions(grpc.WithContextDialer(bufDialer))}, opts...)
+	app, err := client.NewApp(opts...)
+	require.NoError(t, err)
+	t.Cleanup(app.Close)
+
+	return app
+}
@@ -0,0 +1,146 @@
+package functional_tests
+
+import (
+	"context"
+	"github.com/s-turchinskiy/keeper/internal/client"
+	clientmodels "github.com/s-turchinskiy/keeper/internal/client/models"
+	"github.com/s-turchinskiy/keeper/internal/server/repository"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// FunctionalTestConflicts два устройства одного пользователя меняют секрет, одно из них без связи с сервером.
+// Конфликт при sync разрешается каждой из стратегий local, remote и keep-both
+func FunctionalTestConflicts(
+	t *testing.T,
+	usersRepository repository.UserRepositorier,
+	secretRepository repository.SecretRepositorier,
+	sessionRepository repository.SessionRepositorier,
+	deviceRepository repository.DeviceRepositorier) {
+
+	startAppServer(t, usersRepository, secretRepository, sessionRepository, deviceRepository)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	first := newTestApp(t)
+	require.NoError(t, first.Service.Register(ctx))
+
+	// второе устройство теряет связь с сервером, пока offline установлен
+	var offline atomic.Bool
+	second := newTestApp(t, client.WithDialOptions(grpc.WithChainUnaryInterceptor(
+		func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			if offline.Load() {
+				return status.Error(codes.Unavailable, "offline")
+			}
+			return invoker(ctx, method, req, reply, cc, opts...)
+		})))
+
+	// makeConflict секрет name изменен на первом устройстве и, без связи, на втором
+	makeConflict := func(name string) {
+		_, err := first.Service.CreateSecret(ctx, clientmodels.BaseSecret{Type: clientmodels.SecretTypeText, Name: name},
+			clientmodels.TextData{Content: "base"})
+		require.NoError(t, err)
+		require.NoError(t, second.Service.SyncSecrets(ctx, nil))
+
+		editSecret(ctx, t, first, name, "first")
+
+		offline.Store(true)
+		_, err = second.Service.EditSecret(ctx, name, clientmodels.SecretTypeText, nil, setTextContent("second"))
+		offline.Store(false)
+		require.Error(t, err)
+		require.True(t, findLocalSecret(ctx, t, second, name).Modified())
+	}
+
+	resolveWith := func(resolution clientmodels.Resolution) clientmodels.ConflictResolver {
+		return func(local, remote *clientmodels.LocalSecret) (clientmodels.Resolution, error) {
+			require.NotNil(t, remote)
+			require.Equal(t, local.ID, remote.ID)
+			return resolution, nil
+		}
+	}
+
+	t.Run("local", func(t *testing.T) {
+		makeConflict("conflict local")
+		require.NoError(t, second.Service.SyncSecrets(ctx, resolveWith(clientmodels.ResolutionLocal)))
+		require.NoError(t, first.Service.SyncSecrets(ctx, nil))
+
+		require.Equal(t, "second", readTextContent(ctx, t, second, "conflict local"))
+		require.Equal(t, "second", readTextContent(ctx, t, first, "conflict local"))
+	})
+
+	t.Run("remote", func(t *testing.T) {
+		makeConflict("conflict remote")
+		require.NoError(t, second.Service.SyncSecrets(ctx, resolveWith(clientmodels.ResolutionRemote)))
+
+		require.Equal(t, "first", readTextContent(ctx, t, second, "conflict remote"))
+
+		require.False(t, findLocalSecret(ctx, t, second, "conflict remote").Modified())
+	})
+
+	t.Run("keep-both", func(t *testing.T) {
+		makeConflict("conflict both")
+		original := findLocalSecret(ctx, t, second, "conflict both")
+
+		require.NoError(t, second.Service.SyncSecrets(ctx, resolveWith(clientmodels.ResolutionKeepBoth)))
+		require.NoError(t, first.Service.SyncSecrets(ctx, nil))
+
+		require.Equal(t, "first", readTextContent(ctx, t, second, "conflict both"))
+
+		for _, app := range []*client.App{first, second} {
+			secrets, err := app.Service.ListLocalSecrets(ctx)
+			require.NoError(t, err)
+
+			var copies []*clientmodels.LocalSecret
+			for _, secret := range secrets {
+				if strings.HasPrefix(secret.Name, "conflict both (conflict ") {
+					copies = append(copies, secret)
+				}
+			}
+			require.Len(t, copies, 1)
+			require.NotEqual(t, original.ID, copies[0].ID)
+			require.Equal(t, "second", readTextContent(ctx, t, app, copies[0].Name))
+		}
+	})
+}
+
+func editSecret(ctx context.Context, t *testing.T, app *client.App, name, content string) {
+	_, err := app.Service.EditSecret(ctx, name, clientmodels.SecretTypeText, nil, setTextContent(content))
+	require.NoError(t, err)
+}
+
+func setTextContent(content string) func(clientmodels.SecretData) (clientmodels.SecretData, error) {
+	return func(clientmodels.SecretData) (clientmodels.SecretData, error) {
+		return clientmodels.TextData{Content: content}, nil
+	}
+}
+
+// readTextContent содержимое текстового секрета в локальном хранилище app
+func readTextContent(ctx context.Context, t *testing.T, app *client.App, name string) string {
+	data, err := findLocalSecret(ctx, t, app, name).ParseData()
+	require.NoError(t, err)
+
+	text, ok := data.(clientmodels.TextData)
+	require.True(t, ok)
+	return text.Content
+}
+
+func findLocalSecret(ctx context.Context, t *testing.T, app *client.App, name string) *clientmodels.LocalSecret {
+	secrets, err := app.Service.ListLocalSecrets(ctx)
+	require.NoError(t, err)
+
+	for _, secret := range secrets {
+		if secret.Name == name {
+			return secret
+		}
+	}
+
+	require.Failf(t, "secret not found", "local secret %q", name)
+	return nil
+}
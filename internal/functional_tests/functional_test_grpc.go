@@ -4,22 +4,33 @@ import (
 	"context"
 	"fmt"
 	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/s-turchinskiy/keeper/internal/client/crypto"
 	"github.com/s-turchinskiy/keeper/internal/client/grpcclient"
 	clientmodels "github.com/s-turchinskiy/keeper/internal/client/models"
 	servermodels "github.com/s-turchinskiy/keeper/internal/server/models"
 	"github.com/s-turchinskiy/keeper/internal/server/repository"
 	mockserverrepository "github.com/s-turchinskiy/keeper/internal/server/repository/mock"
+	"github.com/s-turchinskiy/keeper/internal/server/repository/postgres"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/crypto/bcrypt"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"log"
 	"testing"
 	"time"
 )
 
-func FunctionalTestGRPC(t *testing.T, usersRepository repository.UserRepositorier, secretRepository repository.SecretRepositorier, debug bool) {
+func FunctionalTestGRPC(
+	t *testing.T,
+	usersRepository repository.UserRepositorier,
+	secretRepository repository.SecretRepositorier,
+	sessionRepository repository.SessionRepositorier,
+	deviceRepository repository.DeviceRepositorier,
+	debug bool) {
 
-	runGRPCServer(usersRepository, secretRepository)
+	runGRPCServer(usersRepository, secretRepository, sessionRepository, deviceRepository)
 
 	ctx := context.Background()
 	if !debug {
@@ -30,19 +41,19 @@ func FunctionalTestGRPC(t *testing.T, usersRepository repository.UserRepositorie
 
 	clientSecrets := []*clientmodels.RemoteSecret{
 		{
-			Name:         secretOnlyCreating,
+			ID:           secretOnlyCreating,
 			LastModified: time.Now(),
 			Hash:         "hash",
 			Data:         []byte("data"),
 		},
 		{
-			Name:         secretForDeleting,
+			ID:           secretForDeleting,
 			LastModified: time.Now(),
 			Hash:         "hash",
 			Data:         []byte("data"),
 		},
 		{
-			Name:         secretForUpdating,
+			ID:           secretForUpdating,
 			LastModified: time.Now(),
 			Hash:         "hash",
 			Data:         []byte("data"),
@@ -64,22 +75,49 @@ func functionalTestGRPC(ctx context.Context, t *testing.T, clientSecrets []*clie
 	grpcClient, err := grpcclient.NewGRPCClient(ctx, "passthrough://bufnet", loginExistingUser, password, grpc.WithContextDialer(bufDialer))
 	require.NoError(t, err)
 
-	_, err = grpcClient.Register(ctx, loginNewUser, password)
+	_, err = grpcClient.Register(ctx, loginNewUser, password, kdfParams)
 	if !debug {
 		require.NoError(t, err)
 	}
 
-	_, err = grpcClient.Register(ctx, loginExistingUser, password)
+	_, err = grpcClient.Register(ctx, loginExistingUser, password, nil)
 	require.Error(t, err)
 
+	_, err = grpcClient.Register(ctx, loginNewUser, password, &crypto.KDFParams{Salt: []byte("salt"), Time: 1, MemoryKiB: 1024, Threads: 1})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	kdf, err := grpcClient.GetKDFParams(ctx, loginExistingUser)
+	require.NoError(t, err)
+	require.Equal(t, kdfParams, kdf)
+
+	_, err = grpcClient.GetKDFParams(ctx, "unknown")
+	require.ErrorIs(t, err, grpcclient.ErrUserNotFound)
+
 	err = grpcClient.Login(ctx, loginExistingUser, password)
 	require.NoError(t, err)
 
+	vaultKey, err := grpcClient.GetVaultKey(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []byte("vault key"), vaultKey)
+
+	err = grpcClient.SetVaultKey(ctx, []byte("other vault key"), false)
+	require.ErrorIs(t, err, grpcclient.ErrVaultKeyExists)
+
 	for _, secret := range clientSecrets {
-		err = grpcClient.SetSecret(ctx, secret)
+		_, err = grpcClient.SetSecret(ctx, secret, nil)
 		require.NoError(t, err)
+
+		resp, err := grpcClient.GetStream().Recv()
+		require.NoError(t, err)
+		require.Len(t, resp.GetSecrets(), 1)
+		require.Equal(t, secret.ID, resp.GetSecrets()[0].GetId())
 	}
 
+	_, err = grpcClient.UpdateSecret(ctx, clientSecrets[2], clientmodels.ExpectRevision(1))
+	var conflictErr *clientmodels.ConflictError
+	require.ErrorAs(t, err, &conflictErr)
+	require.Equal(t, int64(3), conflictErr.Current.Revision)
+
 	err = grpcClient.DeleteSecret(ctx, secretForDeleting)
 	require.NoError(t, err)
 
@@ -87,6 +125,52 @@ func functionalTestGRPC(ctx context.Context, t *testing.T, clientSecrets []*clie
 	require.NoError(t, err)
 	require.Len(t, remoteSecrets, 2)
 
+	changes, revision, err := grpcClient.GetChangesSince(ctx, 0)
+	require.NoError(t, err)
+	require.Len(t, changes, len(clientSecrets))
+	require.Equal(t, int64(len(clientSecrets)+1), revision)
+	require.True(t, changes[len(changes)-1].Deleted)
+
+	versions, err := grpcClient.ListSecretVersions(ctx, secretForUpdating)
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+	require.Equal(t, int64(2), versions[0].Version)
+
+	version, err := grpcClient.GetSecretVersion(ctx, secretForUpdating, 1)
+	require.NoError(t, err)
+	require.Equal(t, "old hash", version.Hash)
+	require.Equal(t, []byte("old data"), version.Data)
+
+	_, err = grpcClient.GetSecretVersion(ctx, secretForUpdating, 5)
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	deletedSecrets, err := grpcClient.ListDeletedSecrets(ctx)
+	require.NoError(t, err)
+	require.Len(t, deletedSecrets, 1)
+	require.True(t, deletedSecrets[0].Deleted)
+
+	undeleted, err := grpcClient.UndeleteSecret(ctx, secretForDeleting)
+	require.NoError(t, err)
+	require.Equal(t, int64(5), undeleted.Revision)
+
+	_, err = grpcClient.UndeleteSecret(ctx, secretOnlyCreating)
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	err = grpcClient.ChangePassword(ctx, "new password", []byte("new vault key"), kdfParams)
+	require.NoError(t, err)
+
+	devices, err := grpcClient.ListDevices(ctx)
+	require.NoError(t, err)
+	require.Len(t, devices, 1)
+	require.Equal(t, "laptop", devices[0].Name)
+
+	_, err = grpcClient.RevokeDevice(ctx, uuid.NewString())
+	require.ErrorIs(t, err, grpcclient.ErrDeviceNotFound)
+
+	revoked, err := grpcClient.Logout(ctx, false)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), revoked)
+
 	err = grpcClient.Close()
 	require.NoError(t, err)
 }
@@ -112,13 +196,25 @@ func UserMockRepository(ctrl *gomock.Controller) repository.UserRepositorier {
 		Login:        loginExistingUser,
 		PasswordHash: passwordHash,
 		CreatedAt:    time.Now(),
+		KDF: &servermodels.KDFParams{
+			Salt:      kdfParams.Salt,
+			Time:      kdfParams.Time,
+			MemoryKiB: kdfParams.MemoryKiB,
+			Threads:   kdfParams.Threads,
+		},
 	}
 
 	userMockRepository := mockserverrepository.NewMockUserRepositorier(ctrl)
 
 	userMockRepository.EXPECT().GetByLogin(gomock.Any(), loginNewUser).Return(nil, nil)
-	userMockRepository.EXPECT().Create(gomock.Any(), loginNewUser, gomock.Any()).Return(newUser, nil)
-	userMockRepository.EXPECT().GetByLogin(gomock.Any(), loginExistingUser).Return(existingUser, nil).MaxTimes(2)
+	userMockRepository.EXPECT().Create(gomock.Any(), loginNewUser, gomock.Any(), gomock.Any()).Return(newUser, nil)
+	userMockRepository.EXPECT().GetByLogin(gomock.Any(), loginExistingUser).Return(existingUser, nil).MaxTimes(3)
+	userMockRepository.EXPECT().GetByLogin(gomock.Any(), "unknown").Return(nil, postgres.ErrUserNotFound).MaxTimes(1)
+	userMockRepository.EXPECT().GetVaultKey(gomock.Any(), existingUser.ID).Return([]byte("vault key"), nil).MaxTimes(1)
+	userMockRepository.EXPECT().SetVaultKey(gomock.Any(), existingUser.ID, []byte("other vault key"), false).Return(postgres.ErrVaultKeySet).MaxTimes(1)
+	userMockRepository.EXPECT().GetByID(gomock.Any(), existingUser.ID).Return(existingUser, nil).MaxTimes(1)
+	userMockRepository.EXPECT().UpdateCredentials(gomock.Any(), existingUser.ID, gomock.Any(), []byte("new vault key"), gomock.Any()).Return(nil).MaxTimes(1)
+	userMockRepository.EXPECT().GetTwoFactor(gomock.Any(), existingUser.ID).Return(&servermodels.TwoFactor{}, nil).AnyTimes()
 
 	return userMockRepository
 }
@@ -131,6 +227,13 @@ func SecretMockRepository(ctrl *gomock.Controller) repository.SecretRepositorier
 	secretMockRepository.EXPECT().Delete(gomock.Any(), gomock.Any(), secretForDeleting).Return(nil)
 	secretMockRepository.EXPECT().GetByID(gomock.Any(), gomock.Any(), secretForDeleting).Return(nil, nil)
 
+	secretMockRepository.EXPECT().CreateUpdateIfMatch(gomock.Any(), gomock.Any(), gomock.Any()).Return(postgres.ErrSecretConflict)
+	secretMockRepository.EXPECT().GetByID(gomock.Any(), gomock.Any(), secretForUpdating).Return(&servermodels.Secret{
+		ID:       secretForUpdating,
+		Hash:     "hash",
+		Revision: 3,
+	}, nil)
+
 	resList := []*servermodels.Secret{
 		{
 			ID: secretOnlyCreating,
@@ -141,5 +244,76 @@ func SecretMockRepository(ctrl *gomock.Controller) repository.SecretRepositorier
 	}
 	secretMockRepository.EXPECT().GetAll(gomock.Any(), gomock.Any()).Return(resList, nil)
 
+	resChanges := []*servermodels.Secret{
+		{
+			ID:       secretOnlyCreating,
+			Revision: 1,
+		},
+		{
+			ID:       secretForUpdating,
+			Revision: 3,
+		},
+		{
+			ID:       secretForDeleting,
+			Revision: 4,
+			Deleted:  true,
+		},
+	}
+	secretMockRepository.EXPECT().GetChangesSince(gomock.Any(), gomock.Any(), int64(0)).Return(resChanges, nil).MaxTimes(1)
+
+	resVersions := []*servermodels.SecretVersion{
+		{
+			Secret:  servermodels.Secret{ID: secretForUpdating, Hash: "new hash"},
+			Version: 2,
+		},
+		{
+			Secret:  servermodels.Secret{ID: secretForUpdating, Hash: "old hash"},
+			Version: 1,
+		},
+	}
+	secretMockRepository.EXPECT().GetVersions(gomock.Any(), gomock.Any(), secretForUpdating).Return(resVersions, nil).MaxTimes(1)
+	secretMockRepository.EXPECT().GetVersion(gomock.Any(), gomock.Any(), secretForUpdating, int64(1)).Return(&servermodels.SecretVersion{
+		Secret:  servermodels.Secret{ID: secretForUpdating, Hash: "old hash", Data: []byte("old data")},
+		Version: 1,
+	}, nil).MaxTimes(1)
+	secretMockRepository.EXPECT().GetVersion(gomock.Any(), gomock.Any(), secretForUpdating, int64(5)).Return(nil, postgres.ErrSecretVersionNotFound).MaxTimes(1)
+
+	secretMockRepository.EXPECT().GetDeleted(gomock.Any(), gomock.Any()).Return([]*servermodels.Secret{
+		{ID: secretForDeleting, Deleted: true, Revision: 4},
+	}, nil).MaxTimes(1)
+	secretMockRepository.EXPECT().Undelete(gomock.Any(), gomock.Any(), secretForDeleting).Return(&servermodels.Secret{
+		ID:       secretForDeleting,
+		Revision: 5,
+	}, nil).MaxTimes(1)
+	secretMockRepository.EXPECT().Undelete(gomock.Any(), gomock.Any(), secretOnlyCreating).Return(nil, postgres.ErrSecretNotFound).MaxTimes(1)
+
 	return secretMockRepository
 }
+
+func SessionMockRepository(ctrl *gomock.Controller) repository.SessionRepositorier {
+
+	sessionMockRepository := mockserverrepository.NewMockSessionRepositorier(ctrl)
+
+	sessionMockRepository.EXPECT().Create(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	sessionMockRepository.EXPECT().IsTokenRevoked(gomock.Any(), gomock.Any()).Return(false, nil).AnyTimes()
+	sessionMockRepository.EXPECT().Revoke(gomock.Any(), "2", gomock.Any()).Return(nil).MaxTimes(1)
+
+	return sessionMockRepository
+}
+
+func DeviceMockRepository(ctrl *gomock.Controller) repository.DeviceRepositorier {
+
+	deviceMockRepository := mockserverrepository.NewMockDeviceRepositorier(ctrl)
+
+	deviceMockRepository.EXPECT().GetAll(gomock.Any(), "2").Return([]*servermodels.Device{{
+		ID:         uuid.NewString(),
+		UserID:     "2",
+		Name:       "laptop",
+		OS:         "linux/amd64",
+		CreatedAt:  time.Now(),
+		LastSeenAt: time.Now(),
+	}}, nil).MaxTimes(1)
+	deviceMockRepository.EXPECT().Revoke(gomock.Any(), "2", gomock.Any()).Return(repository.ErrDeviceNotFound).MaxTimes(1)
+
+	return deviceMockRepository
+}
@@ -0,0 +1,143 @@
+package functional_tests
+
+import (
+	"context"
+	"github.com/s-turchinskiy/keeper/internal/client"
+	clientmodels "github.com/s-turchinskiy/keeper/internal/client/models"
+	"github.com/s-turchinskiy/keeper/internal/client/service"
+	"github.com/s-turchinskiy/keeper/internal/server/repository"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// rfcHOTPCodes коды HOTP секрета RFC 4226 для счетчиков 0, 1, 2... (Appendix D)
+var rfcHOTPCodes = []string{"755224", "287082", "359152", "969429", "338314", "254676", "287922", "162583", "399871", "520489"}
+
+// FunctionalTestOTP ключи одноразовых паролей на двух устройствах одного пользователя: счетчик HOTP
+// растет с каждым кодом и уходит на сервер, поэтому устройства не выдают один и тот же код
+func FunctionalTestOTP(
+	t *testing.T,
+	usersRepository repository.UserRepositorier,
+	secretRepository repository.SecretRepositorier,
+	sessionRepository repository.SessionRepositorier,
+	deviceRepository repository.DeviceRepositorier) {
+
+	const name = "hotp"
+
+	startAppServer(t, usersRepository, secretRepository, sessionRepository, deviceRepository)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var offline atomic.Bool
+	first := newTestApp(t, client.WithDialOptions(grpc.WithChainUnaryInterceptor(
+		func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			if offline.Load() {
+				return status.Error(codes.Unavailable, "offline")
+			}
+			return invoker(ctx, method, req, reply, cc, opts...)
+		})))
+	require.NoError(t, first.Service.Register(ctx))
+
+	second := newTestApp(t)
+
+	_, err := first.Service.CreateSecret(ctx, clientmodels.BaseSecret{Type: clientmodels.SecretTypeOTP, Name: name},
+		clientmodels.OTPData{Type: "hotp", Account: "bob", Secret: "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"})
+	require.NoError(t, err)
+
+	// generate код и счетчик, которым он получен
+	generate := func(app *client.App, secretName string) (string, uint64) {
+		code, err := app.Service.GenerateOTP(ctx, secretName)
+		require.NoError(t, err)
+		return code.Code, code.Counter
+	}
+
+	t.Run("uri import", func(t *testing.T) {
+		require.NoError(t, first.Execute("add", "otp", "--name", "totp",
+			"--uri", "otpauth://totp/Example:alice@example.com?secret=JBSWY3DPEHPK3PXP&issuer=Example&digits=8&period=60"))
+		require.NoError(t, first.Execute("add", "otp", "--name", "imported hotp",
+			"--uri", "otpauth://hotp/Bank:bob?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&digits=6&counter=9"))
+		require.NoError(t, first.Execute("otp", "totp"))
+
+		totp, err := first.Service.GenerateOTP(ctx, "totp")
+		require.NoError(t, err)
+		require.Len(t, totp.Code, 8)
+		require.Positive(t, totp.Remaining)
+		require.LessOrEqual(t, totp.Remaining, time.Minute)
+
+		// параметры URI переживают синхронизацию на другое устройство
+		require.NoError(t, second.Service.SyncSecrets(ctx, nil))
+		data, err := findLocalSecret(ctx, t, second, "totp").ParseData()
+		require.NoError(t, err)
+		otpData := data.(clientmodels.OTPData)
+		require.Equal(t, 8, otpData.Digits)
+		require.Equal(t, 60, otpData.Period)
+		require.Equal(t, uint64(9), hotpCounter(ctx, t, second, "imported hotp"))
+
+		code, used := generate(first, "imported hotp")
+		require.Equal(t, rfcHOTPCodes[9], code)
+		require.Equal(t, uint64(9), used)
+		require.NoError(t, first.Execute("otp", "imported hotp"))
+		require.Equal(t, uint64(11), hotpCounter(ctx, t, first, "imported hotp"))
+	})
+
+	t.Run("counter increments and syncs", func(t *testing.T) {
+		for counter := range 2 {
+			code, used := generate(first, name)
+			require.Equal(t, rfcHOTPCodes[counter], code)
+			require.Equal(t, uint64(counter), used)
+		}
+		require.Equal(t, uint64(2), hotpCounter(ctx, t, first, name))
+		require.False(t, findLocalSecret(ctx, t, first, name).Modified())
+
+		require.NoError(t, second.Service.SyncSecrets(ctx, nil))
+		require.Equal(t, uint64(2), hotpCounter(ctx, t, second, name))
+
+		code, _ := generate(second, name)
+		require.Equal(t, rfcHOTPCodes[2], code)
+	})
+
+	t.Run("stale counter", func(t *testing.T) {
+		// первое устройство не знает о коде второго: берется счетчик сервера, код не повторяется
+		require.Equal(t, uint64(2), hotpCounter(ctx, t, first, name))
+
+		code, used := generate(first, name)
+		require.Equal(t, rfcHOTPCodes[3], code)
+		require.Equal(t, uint64(3), used)
+		require.Equal(t, uint64(4), hotpCounter(ctx, t, first, name))
+		require.False(t, findLocalSecret(ctx, t, first, name).Modified())
+	})
+
+	t.Run("offline", func(t *testing.T) {
+		// без связи код выдается, счетчик сохраняется локально и уходит на сервер при синхронизации
+		offline.Store(true)
+		code, err := first.Service.GenerateOTP(ctx, name)
+		offline.Store(false)
+		require.ErrorIs(t, err, service.ErrOTPCounterNotSynced)
+		require.NotNil(t, code)
+		require.Equal(t, rfcHOTPCodes[4], code.Code)
+		require.True(t, findLocalSecret(ctx, t, first, name).Modified())
+
+		require.NoError(t, first.Service.SyncSecrets(ctx, nil))
+		require.NoError(t, second.Service.SyncSecrets(ctx, nil))
+		require.Equal(t, uint64(5), hotpCounter(ctx, t, second, name))
+
+		next, _ := generate(second, name)
+		require.Equal(t, rfcHOTPCodes[5], next)
+	})
+}
+
+// hotpCounter счетчик следующего кода HOTP в локальном хранилище app
+func hotpCounter(ctx context.Context, t *testing.T, app *client.App, name string) uint64 {
+	data, err := findLocalSecret(ctx, t, app, name).ParseData()
+	require.NoError(t, err)
+
+	otpData, ok := data.(clientmodels.OTPData)
+	require.True(t, ok)
+	return otpData.Counter
+}
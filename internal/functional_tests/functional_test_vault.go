@@ -0,0 +1,247 @@
+package functional_tests
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/s-turchinskiy/keeper/internal/client"
+	"github.com/s-turchinskiy/keeper/internal/client/crypto"
+	clientmodels "github.com/s-turchinskiy/keeper/internal/client/models"
+	"github.com/s-turchinskiy/keeper/internal/server/models"
+	"github.com/s-turchinskiy/keeper/internal/server/repository"
+	"github.com/s-turchinskiy/keeper/models/proto"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// FunctionalTestVault смена мастер-пароля и ротация ключа хранилища в одном процессе клиента:
+// после них хранилище открывается новым паролем на другом устройстве, старым - нет.
+// Повышение параметров KDF, прерванное на любом шаге, не закрывает доступ к хранилищу,
+// а ослабленные сервером параметры клиент не принимает
+func FunctionalTestVault(
+	t *testing.T,
+	usersRepository repository.UserRepositorier,
+	secretRepository repository.SecretRepositorier,
+	sessionRepository repository.SessionRepositorier,
+	deviceRepository repository.DeviceRepositorier) {
+
+	const newPassword = "new password"
+
+	startAppServer(t, usersRepository, secretRepository, sessionRepository, deviceRepository)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	app := newTestApp(t)
+	require.NoError(t, app.Service.Register(ctx))
+
+	_, err := app.Service.CreateSecret(ctx, clientmodels.BaseSecret{Type: clientmodels.SecretTypeText, Name: "before passwd"},
+		clientmodels.TextData{Content: "old key"})
+	require.NoError(t, err)
+
+	require.NoError(t, app.Service.ChangeMasterPassword(ctx, newPassword))
+
+	// ротация в том же процессе шифрует связку уже новым мастер-паролем
+	rotated, err := app.Service.RotateVaultKey(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, rotated)
+
+	_, err = app.Service.CreateSecret(ctx, clientmodels.BaseSecret{Type: clientmodels.SecretTypeText, Name: "after rotation"},
+		clientmodels.TextData{Content: "new key"})
+	require.NoError(t, err)
+
+	t.Setenv("KEEPER_PASSWORD", newPassword)
+	other := newTestApp(t)
+	require.NoError(t, other.Service.SyncSecrets(ctx, nil))
+	require.Equal(t, "old key", readTextContent(ctx, t, other, "before passwd"))
+	require.Equal(t, "new key", readTextContent(ctx, t, other, "after rotation"))
+
+	t.Setenv("KEEPER_PASSWORD", password)
+	stale := newTestApp(t)
+	require.Error(t, stale.Service.SyncSecrets(ctx, nil))
+
+	t.Run("interrupted upgrade-kdf", func(t *testing.T) {
+		t.Setenv("KEEPER_PASSWORD", newPassword)
+		t.Setenv("KEEPER_KDF_TIME", "2")
+
+		const (
+			requestLost int32 = iota + 1
+			responseLost
+		)
+
+		var interrupt atomic.Int32
+		app := newTestApp(t, client.WithDialOptions(grpc.WithChainUnaryInterceptor(
+			func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+				if method != proto.AuthService_ChangePassword_FullMethodName {
+					return invoker(ctx, method, req, reply, cc, opts...)
+				}
+
+				switch interrupt.Load() {
+				case requestLost:
+					return status.Error(codes.Unavailable, "request lost")
+				case responseLost:
+					if err := invoker(ctx, method, req, reply, cc, opts...); err != nil {
+						return err
+					}
+					return status.Error(codes.Unavailable, "response lost")
+				}
+				return invoker(ctx, method, req, reply, cc, opts...)
+			})))
+
+		// сервер не получил новые параметры, клиент продолжает работать со старыми
+		interrupt.Store(requestLost)
+		_, err := app.Service.UpgradeKDF(ctx)
+		require.Error(t, err)
+		_, err = app.Service.Logout(ctx, false)
+		require.NoError(t, err)
+		require.NoError(t, app.Service.SyncSecrets(ctx, nil))
+
+		// сервер принял новые параметры, но ответ потерян: клиент входит уже с новым паролем для сервера
+		interrupt.Store(responseLost)
+		upgraded, err := app.Service.UpgradeKDF(ctx)
+		require.NoError(t, err)
+		require.True(t, upgraded)
+		require.NoError(t, app.Service.SyncSecrets(ctx, nil))
+
+		interrupt.Store(0)
+		upgraded, err = app.Service.UpgradeKDF(ctx)
+		require.NoError(t, err)
+		require.False(t, upgraded)
+
+		restarted := newTestApp(t)
+		require.NoError(t, restarted.Service.SyncSecrets(ctx, nil))
+		require.Equal(t, "old key", readTextContent(ctx, t, restarted, "before passwd"))
+		require.Equal(t, "new key", readTextContent(ctx, t, restarted, "after rotation"))
+	})
+
+	t.Run("legacy secrets", func(t *testing.T) {
+		const legacyLogin = "legacy user"
+		t.Setenv("KEEPER_LOGIN", legacyLogin)
+
+		app := newTestApp(t)
+		require.NoError(t, app.Service.Register(ctx))
+
+		// секрет записан клиентом до появления ключа хранилища: ключом от мастер-пароля
+		legacySecret := &clientmodels.LocalSecret{ID: uuid.NewString(), Name: "legacy", Type: clientmodels.SecretTypeText}
+		require.NoError(t, legacySecret.SetData(crypto.NewCryptor(password, legacyLogin), clientmodels.TextData{Content: "legacy data"}))
+		remoteSecret, err := clientmodels.ConvertLocalSecretToRemoteSecret(crypto.NewCryptor(password, legacyLogin), legacySecret)
+		require.NoError(t, err)
+
+		user, err := usersRepository.GetByLogin(ctx, legacyLogin)
+		require.NoError(t, err)
+		require.NoError(t, secretRepository.CreateUpdate(ctx, &models.Secret{ID: remoteSecret.ID, UserID: user.ID,
+			LastModified: remoteSecret.LastModified, Hash: remoteSecret.Hash, Data: remoteSecret.Data}))
+		before, err := secretRepository.GetByID(ctx, user.ID, remoteSecret.ID)
+		require.NoError(t, err)
+
+		// при открытии хранилища секрет перешифровывается ключом хранилища
+		require.NoError(t, app.Service.SyncSecrets(ctx, nil))
+		require.Equal(t, "legacy data", readTextContent(ctx, t, app, "legacy"))
+
+		after, err := secretRepository.GetByID(ctx, user.ID, remoteSecret.ID)
+		require.NoError(t, err)
+		require.Greater(t, after.Revision, before.Revision)
+		require.NotEqual(t, before.Data, after.Data)
+		require.Equal(t, before.Hash, after.Hash)
+
+		other := newTestApp(t)
+		require.NoError(t, other.Service.SyncSecrets(ctx, nil))
+		require.Equal(t, "legacy data", readTextContent(ctx, t, other, "legacy"))
+		require.False(t, findLocalSecret(ctx, t, other, "legacy").Modified())
+	})
+
+	t.Run("retired keys", func(t *testing.T) {
+		const rotationLogin = "rotation user"
+		t.Setenv("KEEPER_LOGIN", rotationLogin)
+
+		app := newTestApp(t)
+		require.NoError(t, app.Service.Register(ctx))
+
+		_, err := app.Service.CreateSecret(ctx, clientmodels.BaseSecret{Type: clientmodels.SecretTypeText, Name: "live"},
+			clientmodels.TextData{Content: "first"})
+		require.NoError(t, err)
+		editSecret(ctx, t, app, "live", "second")
+		_, err = app.Service.CreateSecret(ctx, clientmodels.BaseSecret{Type: clientmodels.SecretTypeText, Name: "trashed"},
+			clientmodels.TextData{Content: "deleted"})
+		require.NoError(t, err)
+		require.NoError(t, app.Service.DeleteSecret(ctx, "trashed"))
+
+		// связка до ротации, как если бы ее сохранил тот, кто узнал старый ключ
+		user, err := usersRepository.GetByLogin(ctx, rotationLogin)
+		require.NoError(t, err)
+		oldVaultKey, err := usersRepository.GetVaultKey(ctx, user.ID)
+		require.NoError(t, err)
+		retired := crypto.NewCryptor(password, rotationLogin)
+		retired.SetKDFParams(&crypto.KDFParams{Salt: user.KDF.Salt, Time: user.KDF.Time, MemoryKiB: user.KDF.MemoryKiB, Threads: user.KDF.Threads})
+		require.NoError(t, retired.UnlockVault(oldVaultKey))
+		live, err := secretRepository.GetAll(ctx, user.ID)
+		require.NoError(t, err)
+		require.Len(t, live, 1)
+		before, err := secretRepository.GetByID(ctx, user.ID, live[0].ID)
+		require.NoError(t, err)
+		_, err = retired.DecryptSecretData(before.ID, before.Data)
+		require.NoError(t, err)
+
+		rotated, err := app.Service.RotateVaultKey(ctx)
+		require.NoError(t, err)
+
+		// старый ключ удален из связки и не расшифровывает ни секреты, ни корзину, ни историю
+		after, err := secretRepository.GetByID(ctx, user.ID, before.ID)
+		require.NoError(t, err)
+		deleted, err := secretRepository.GetDeleted(ctx, user.ID)
+		require.NoError(t, err)
+		require.NotEmpty(t, deleted)
+
+		records := 0
+		for _, secret := range append(deleted, after) {
+			_, err = retired.DecryptSecretData(secret.ID, secret.Data)
+			require.Error(t, err)
+			records++
+
+			versions, err := secretRepository.GetVersions(ctx, user.ID, secret.ID)
+			require.NoError(t, err)
+			for _, item := range versions {
+				version, err := secretRepository.GetVersion(ctx, user.ID, secret.ID, item.Version)
+				require.NoError(t, err)
+				_, err = retired.DecryptSecretData(secret.ID, version.Data)
+				require.Error(t, err)
+				records++
+			}
+		}
+		require.Equal(t, records, rotated)
+
+		// новая связка читает все: секреты, корзину и историю
+		other := newTestApp(t)
+		require.NoError(t, other.Service.SyncSecrets(ctx, nil))
+		require.Equal(t, "second", readTextContent(ctx, t, other, "live"))
+
+		versions, err := other.Service.ListSecretVersions(ctx, "live")
+		require.NoError(t, err)
+		require.NotEmpty(t, versions)
+		_, err = other.Service.RestoreSecret(ctx, "live", versions[len(versions)-1].Version)
+		require.NoError(t, err)
+		require.Equal(t, "first", readTextContent(ctx, t, other, "live"))
+
+		_, err = other.Service.UndeleteSecret(ctx, "trashed")
+		require.NoError(t, err)
+		require.Equal(t, "deleted", readTextContent(ctx, t, other, "trashed"))
+	})
+
+	t.Run("downgraded kdf", func(t *testing.T) {
+		user, err := usersRepository.GetByLogin(ctx, loginNewUser)
+		require.NoError(t, err)
+		vaultKey, err := usersRepository.GetVaultKey(ctx, user.ID)
+		require.NoError(t, err)
+
+		weak := &models.KDFParams{Salt: make([]byte, 16), Time: 1, MemoryKiB: 1024, Threads: 1}
+		require.NoError(t, usersRepository.UpdateCredentials(ctx, user.ID, user.PasswordHash, vaultKey, weak))
+
+		t.Setenv("KEEPER_PASSWORD", newPassword)
+		_, err = client.NewApp(client.WithArgs(nil), client.WithDialOptions(grpc.WithContextDialer(bufDialer)))
+		require.ErrorIs(t, err, crypto.ErrWeakKDFParams)
+	})
+}
@@ -7,22 +7,35 @@ import (
 	grpc2 "github.com/s-turchinskiy/keeper/internal/server/grpc"
 	"github.com/s-turchinskiy/keeper/internal/server/repository"
 	"github.com/s-turchinskiy/keeper/internal/server/repository/postgres"
+	"github.com/s-turchinskiy/keeper/internal/server/repository/sqlite"
 	"github.com/s-turchinskiy/keeper/internal/server/service"
 	"github.com/s-turchinskiy/keeper/internal/server/token"
+	"github.com/s-turchinskiy/keeper/internal/utils/tlsutils"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"log"
 	"net"
+	"strings"
+	"time"
 )
 
+const sessionPurgeInterval = time.Hour
+
 type App struct {
 	grpcServer *grpc.Server
 	grpcAddr   string
+	transport  string
 	db         repository.DBer
+
+	srvc               *service.Service
+	trashRetention     time.Duration
+	trashPurgeInterval time.Duration
+	stopJobs           context.CancelFunc
 }
 
 func NewApp(ctx context.Context, cfg *config.Config) (*App, error) {
 
-	db, err := postgres.NewPostgresStorage(ctx, cfg.DBURL)
+	storage, err := NewStorage(ctx, cfg, true)
 	if err != nil {
 		return nil, err
 	}
@@ -30,31 +43,143 @@ func NewApp(ctx context.Context, cfg *config.Config) (*App, error) {
 	jwtManager := token.NewJWTManager(cfg.JWTSecret, cfg.JWTDuration)
 	srvc := service.NewService(
 		jwtManager,
-		postgres.NewUserRepository(db),
-		postgres.NewSecretRepository(db),
+		storage.Users,
+		storage.Secrets,
+		storage.Sessions,
+		storage.Devices,
+		service.WithSessionDuration(cfg.RefreshTokenDuration),
 		service.WithRedis(redisClient(cfg.RedisAddr, cfg.RedisPassword, cfg.RedisDB), cfg.RedisExpiration),
 	)
-	grpcServer := grpc2.NewGrpcServer(srvc)
+
+	serverOpts, err := transportOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+	grpcServer := grpc2.NewGrpcServer(srvc, serverOpts...)
 
 	return &App{
-		grpcServer: grpcServer,
-		db:         db,
-		grpcAddr:   cfg.GrpcAddr,
+		grpcServer:         grpcServer,
+		transport:          transportName(cfg),
+		db:                 storage.DB,
+		grpcAddr:           cfg.GrpcAddr,
+		srvc:               srvc,
+		trashRetention:     cfg.TrashRetention,
+		trashPurgeInterval: cfg.TrashPurgeInterval,
+	}, nil
+}
+
+// transportOptions TLS сервера, если в конфигурации задан сертификат
+func transportOptions(cfg *config.Config) ([]grpc.ServerOption, error) {
+
+	if !cfg.TLSEnabled() {
+		return nil, nil
+	}
+
+	tlsConfig, err := tlsutils.ServerConfig(cfg.TLSCertFile, cfg.TLSKeyFile, cfg.TLSClientCAFile, cfg.TLSMinVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	return []grpc.ServerOption{grpc.Creds(credentials.NewTLS(tlsConfig))}, nil
+}
+
+func transportName(cfg *config.Config) string {
+
+	switch {
+	case cfg.TLSClientCAFile != "":
+		return "mutual TLS"
+	case cfg.TLSEnabled():
+		return "TLS"
+	default:
+		return "plaintext"
+	}
+}
+
+// Storage соединение с базой и репозитории поверх него
+type Storage struct {
+	DB       repository.DBer
+	Users    repository.UserRepositorier
+	Secrets  repository.SecretRepositorier
+	Sessions repository.SessionRepositorier
+	Devices  repository.DeviceRepositorier
+}
+
+// NewStorage создает хранилище по схеме KEEPER_DB_URL: sqlite:// - файл SQLite, иначе PostgreSQL.
+// migrate - применить новые миграции схемы, остальные команды схему не меняют
+func NewStorage(ctx context.Context, cfg *config.Config, migrate bool) (*Storage, error) {
+
+	if path, ok := strings.CutPrefix(cfg.DBURL, config.SchemeSQLite); ok {
+		var opts []sqlite.OptionStorage
+		if migrate {
+			opts = append(opts, sqlite.WithMigrations())
+		}
+
+		db, err := sqlite.NewSQLiteStorage(ctx, path, opts...)
+		if err != nil {
+			return nil, err
+		}
+
+		return &Storage{
+			DB:       db,
+			Users:    sqlite.NewUserRepository(db),
+			Secrets:  sqlite.NewSecretRepository(db, sqlite.WithHistoryRetention(cfg.HistoryRetention)),
+			Sessions: sqlite.NewSessionRepository(db),
+			Devices:  sqlite.NewDeviceRepository(db),
+		}, nil
+	}
+
+	var opts []postgres.OptionStorage
+	if migrate {
+		opts = append(opts, postgres.WithMigrations())
+	}
+
+	db, err := postgres.NewPostgresStorage(ctx, cfg.DBURL, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Storage{
+		DB:       db,
+		Users:    postgres.NewUserRepository(db),
+		Secrets:  postgres.NewSecretRepository(db, postgres.WithHistoryRetention(cfg.HistoryRetention)),
+		Sessions: postgres.NewSessionRepository(db),
+		Devices:  postgres.NewDeviceRepository(db),
 	}, nil
 }
 
+// NewMigrator миграции хранилища по схеме KEEPER_DB_URL, как в NewStorage
+func NewMigrator(ctx context.Context, cfg *config.Config) (*repository.Migrator, error) {
+
+	if path, ok := strings.CutPrefix(cfg.DBURL, config.SchemeSQLite); ok {
+		return sqlite.NewMigrator(ctx, path)
+	}
+
+	return postgres.NewMigrator(ctx, cfg.DBURL)
+}
+
 func (a *App) Run() error {
 	lis, err := net.Listen("tcp", a.grpcAddr)
 	if err != nil {
 		return err
 	}
 
-	log.Printf("Server starting on %s", a.grpcAddr)
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	a.stopJobs = stopJobs
+	go a.srvc.RunTrashPurge(jobsCtx, a.trashRetention, a.trashPurgeInterval)
+	go a.srvc.RunSessionPurge(jobsCtx, sessionPurgeInterval)
+
+	if a.transport == "plaintext" {
+		log.Println("TLS is disabled, tokens and secrets are sent unencrypted; set KEEPER_TLS_CERT_FILE and KEEPER_TLS_KEY_FILE")
+	}
+	log.Printf("Server starting on %s (%s)", a.grpcAddr, a.transport)
 	return a.grpcServer.Serve(lis)
 }
 
 func (a *App) Stop(ctx context.Context) {
 
+	if a.stopJobs != nil {
+		a.stopJobs()
+	}
 	a.grpcServer.GracefulStop()
 	a.db.Close(ctx)
 }
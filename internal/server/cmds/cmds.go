@@ -0,0 +1,40 @@
+// Package cmds команды keepersrv: запуск сервера, миграции, управление пользователями и конфигурацией
+package cmds
+
+import (
+	"github.com/s-turchinskiy/keeper/internal/server/config"
+	"github.com/spf13/cobra"
+)
+
+type CobraCommand struct {
+	rootCmd *cobra.Command
+}
+
+func New() *CobraCommand {
+	rootCmd := &cobra.Command{
+		Use:   "keepersrv",
+		Short: "Zero-Knowledge secret manager server",
+		Long: `Zero-Knowledge secret manager server.
+
+Parameters are taken from flags, then environment variables, then the config file (--config or KEEPER_CONFIG),
+then defaults. Without a subcommand the server is started, as with "keepersrv serve".`,
+		Args:          cobra.NoArgs,
+		RunE:          createServeHandler(),
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+
+	config.RegisterFlags(rootCmd.PersistentFlags())
+
+	setFlags()
+	addCommands(rootCmd)
+	return &CobraCommand{
+		rootCmd: rootCmd,
+	}
+}
+
+// Execute выполняет команду с аргументами args, при nil берутся аргументы процесса
+func (c *CobraCommand) Execute(args []string) error {
+	c.rootCmd.SetArgs(args)
+	return c.rootCmd.Execute()
+}
@@ -0,0 +1,188 @@
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"github.com/s-turchinskiy/keeper/internal/server"
+	"github.com/s-turchinskiy/keeper/internal/server/repository"
+	"github.com/s-turchinskiy/keeper/internal/utils/buildinfo"
+	"github.com/spf13/cobra"
+	"os"
+	"strconv"
+)
+
+func createVersionHandler() func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		fmt.Printf("Build version: %s\n", buildinfo.BuildVersion)
+		fmt.Printf("Build date: %s\n", buildinfo.BuildDate)
+		fmt.Printf("Build commit: %s\n", buildinfo.BuildCommit)
+	}
+}
+
+func createServeHandler() func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadConfig(cmd, serveOptions()...)
+		if err != nil {
+			return err
+		}
+
+		ctx := cmd.Context()
+		app, err := server.NewApp(ctx, cfg)
+		if err != nil {
+			return err
+		}
+		defer app.Stop(ctx)
+
+		return app.Run()
+	}
+}
+
+func createMigrateUpHandler() func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		return withMigrator(cmd, func(migrator *repository.Migrator) error {
+			if err := migrator.Up(); err != nil {
+				return err
+			}
+			return printVersion(migrator.Version())
+		})
+	}
+}
+
+func createMigrateDownHandler() func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		steps := 1
+		if len(args) > 0 {
+			var err error
+			steps, err = strconv.Atoi(args[0])
+			if err != nil || steps <= 0 {
+				return fmt.Errorf("number of migrations to roll back must be positive, got %q", args[0])
+			}
+		}
+
+		return withMigrator(cmd, func(migrator *repository.Migrator) error {
+			if err := migrator.Down(steps); err != nil {
+				return err
+			}
+			return printVersion(migrator.Version())
+		})
+	}
+}
+
+func createMigrateStatusHandler() func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		return withMigrator(cmd, func(migrator *repository.Migrator) error {
+			statuses, err := migrator.Status()
+			if err != nil {
+				return err
+			}
+
+			for _, status := range statuses {
+				state := "pending"
+				if status.Applied {
+					state = "applied"
+				}
+				fmt.Printf("%06d %-30s %s\n", status.Version, status.Identifier, state)
+			}
+
+			return printVersion(migrator.Version())
+		})
+	}
+}
+
+func createMigrateVersionHandler() func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		return withMigrator(cmd, func(migrator *repository.Migrator) error {
+			return printVersion(migrator.Version())
+		})
+	}
+}
+
+func createUserListHandler() func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		return withUsers(cmd, func(ctx context.Context, users repository.UserRepositorier) error {
+			list, err := users.GetAll(ctx)
+			if err != nil {
+				return err
+			}
+
+			if len(list) == 0 {
+				fmt.Println("No users")
+				return nil
+			}
+
+			for _, user := range list {
+				fmt.Printf("%-36s  %-30s  %s\n", user.ID, user.Login, user.CreatedAt.Format("2006-01-02 15:04:05"))
+			}
+			return nil
+		})
+	}
+}
+
+func createUserShowHandler() func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		return withUsers(cmd, func(ctx context.Context, users repository.UserRepositorier) error {
+			user, err := users.GetByLogin(ctx, args[0])
+			if err != nil {
+				return err
+			}
+
+			vaultKey, err := users.GetVaultKey(ctx, user.ID)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("ID: %s\n", user.ID)
+			fmt.Printf("Login: %s\n", user.Login)
+			fmt.Printf("Created: %s\n", user.CreatedAt.Format("2006-01-02 15:04:05"))
+			fmt.Printf("Vault key: %s\n", yesNo(vaultKey != nil))
+			if user.KDF != nil {
+				fmt.Printf("KDF: Argon2id, time %d, memory %d KiB, threads %d\n", user.KDF.Time, user.KDF.MemoryKiB, user.KDF.Threads)
+			} else {
+				fmt.Println("KDF: legacy, derived from login")
+			}
+			return nil
+		})
+	}
+}
+
+func createUserDeleteHandler() func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		return withUsers(cmd, func(ctx context.Context, users repository.UserRepositorier) error {
+			user, err := users.GetByLogin(ctx, args[0])
+			if err != nil {
+				return err
+			}
+
+			if yes, _ := cmd.Flags().GetBool("yes"); !yes {
+				if err = confirmUserDeletion(cmd, user.Login); err != nil {
+					return err
+				}
+			}
+
+			if err = users.Delete(ctx, user.ID); err != nil {
+				return err
+			}
+
+			fmt.Printf("User %s deleted with all secrets\n", user.Login)
+			return nil
+		})
+	}
+}
+
+func createConfigPrintHandler() func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadConfig(cmd, serveOptions()...)
+		if err != nil {
+			return err
+		}
+
+		return cfg.Print(os.Stdout)
+	}
+}
+
+func yesNo(value bool) string {
+	if value {
+		return "yes"
+	}
+	return "no"
+}
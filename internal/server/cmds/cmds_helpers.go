@@ -0,0 +1,150 @@
+package cmds
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/s-turchinskiy/keeper/internal/server"
+	"github.com/s-turchinskiy/keeper/internal/server/config"
+	"github.com/s-turchinskiy/keeper/internal/server/repository"
+	"github.com/spf13/cobra"
+	"log"
+	"strings"
+)
+
+func setFlags() {
+	userDeleteCmd.Flags().Bool("yes", false, "Delete without interactive confirmation")
+
+	migrateCmd.AddCommand(migrateUpCmd)
+	migrateCmd.AddCommand(migrateDownCmd)
+	migrateCmd.AddCommand(migrateStatusCmd)
+	migrateCmd.AddCommand(migrateVersionCmd)
+
+	userCmd.AddCommand(userListCmd)
+	userCmd.AddCommand(userShowCmd)
+	userCmd.AddCommand(userDeleteCmd)
+
+	configCmd.AddCommand(configPrintCmd)
+}
+
+func addCommands(rootCmd *cobra.Command) {
+	rootCmd.AddCommand(versionCmd)
+	rootCmd.AddCommand(serveCmd)
+	rootCmd.AddCommand(migrateCmd)
+	rootCmd.AddCommand(userCmd)
+	rootCmd.AddCommand(configCmd)
+}
+
+// serveOptions параметры, без которых сервер не запускается
+func serveOptions() []config.OptionConfig {
+	return []config.OptionConfig{config.WithGRPC(), config.WithTLS(), config.WithRedis(), config.WithJWT(), config.WithTrash()}
+}
+
+// loadConfig параметры из флагов команды, переменных окружения и файла конфигурации
+func loadConfig(cmd *cobra.Command, opts ...config.OptionConfig) (*config.Config, error) {
+
+	source, err := config.NewSource(config.WithFlags(cmd.Flags()))
+	if err != nil {
+		return nil, err
+	}
+
+	return config.LoadCfg(source, opts...)
+}
+
+// withMigrator выполняет fn с мигратором базы из конфигурации и закрывает его
+func withMigrator(cmd *cobra.Command, fn func(migrator *repository.Migrator) error) error {
+
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	migrator, err := server.NewMigrator(cmd.Context(), cfg)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := migrator.Close(); err != nil {
+			log.Println(err)
+		}
+	}()
+
+	return fn(migrator)
+}
+
+// withUsers выполняет fn с хранилищем пользователей из конфигурации и закрывает его
+func withUsers(cmd *cobra.Command, fn func(ctx context.Context, users repository.UserRepositorier) error) error {
+
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	ctx := cmd.Context()
+	if err = checkSchema(ctx, cfg); err != nil {
+		return err
+	}
+
+	storage, err := server.NewStorage(ctx, cfg, false)
+	if err != nil {
+		return err
+	}
+	defer storage.DB.Close(ctx)
+
+	return fn(ctx, storage.Users)
+}
+
+// checkSchema ошибка, если схема базы старее бинарного файла: административные команды ее не обновляют
+func checkSchema(ctx context.Context, cfg *config.Config) error {
+
+	migrator, err := server.NewMigrator(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := migrator.Close(); err != nil {
+			log.Println(err)
+		}
+	}()
+
+	return migrator.CheckUpToDate()
+}
+
+// confirmUserDeletion просит ввести логин удаляемого пользователя, удаление подтверждает только точное совпадение
+func confirmUserDeletion(cmd *cobra.Command, login string) error {
+
+	fmt.Fprintf(cmd.OutOrStdout(), "User %s will be deleted with all secrets, sessions and devices. Type the login to confirm: ", login)
+
+	answer, err := bufio.NewReader(cmd.InOrStdin()).ReadString('\n')
+	if err != nil && answer == "" {
+		return fmt.Errorf("failed to read confirmation: %w", err)
+	}
+
+	if strings.TrimSpace(answer) != login {
+		return errors.New("deletion not confirmed")
+	}
+
+	return nil
+}
+
+func printVersion(version uint, dirty bool, err error) error {
+
+	if err != nil {
+		return err
+	}
+
+	if version == 0 {
+		fmt.Println("Schema version: none, no migrations applied")
+		return nil
+	}
+
+	if dirty {
+		fmt.Printf("Schema version: %d (dirty, the last migration failed and needs manual repair)\n", version)
+		return nil
+	}
+
+	fmt.Printf("Schema version: %d\n", version)
+
+	return nil
+}
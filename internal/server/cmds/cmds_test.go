@@ -0,0 +1,87 @@
+package cmds
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/s-turchinskiy/keeper/internal/server/config"
+	"github.com/s-turchinskiy/keeper/internal/server/repository"
+	"github.com/s-turchinskiy/keeper/internal/server/repository/sqlite"
+	"github.com/stretchr/testify/require"
+)
+
+// testCommands команды создаются один раз на процесс: флаги подкоманд глобальные
+var testCommands = sync.OnceValue(New)
+
+func TestUserDelete(t *testing.T) {
+
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "keeper.db")
+	t.Setenv("KEEPER_DB_URL", config.SchemeSQLite+path)
+
+	db, err := sqlite.NewSQLiteStorage(ctx, path, sqlite.WithMigrations())
+	require.NoError(t, err)
+	users := sqlite.NewUserRepository(db)
+	for _, login := range []string{"alice", "bob"} {
+		_, err = users.Create(ctx, login, "hash", nil)
+		require.NoError(t, err)
+	}
+	db.Close(ctx)
+
+	c := testCommands()
+	c.rootCmd.SetOut(io.Discard)
+
+	exists := func(login string) bool {
+		db, err := sqlite.NewSQLiteStorage(ctx, path)
+		require.NoError(t, err)
+		defer db.Close(ctx)
+
+		_, err = sqlite.NewUserRepository(db).GetByLogin(ctx, login)
+		return err == nil
+	}
+
+	deleteUser := func(input string, args ...string) error {
+		c.rootCmd.SetIn(strings.NewReader(input))
+		return c.Execute(append([]string{"user", "delete"}, args...))
+	}
+
+	require.Error(t, deleteUser("", "alice"))
+	require.Error(t, deleteUser("yes\n", "alice"))
+	require.Error(t, deleteUser("y\n", "alice", "--yes=false"))
+	require.True(t, exists("alice"))
+
+	require.NoError(t, deleteUser("alice\n", "alice"))
+	require.False(t, exists("alice"))
+
+	require.NoError(t, deleteUser("", "bob", "--yes"))
+	require.False(t, exists("bob"))
+}
+
+func TestUserCommandsOutdatedSchema(t *testing.T) {
+
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "keeper.db")
+	t.Setenv("KEEPER_DB_URL", config.SchemeSQLite+path)
+
+	c := testCommands()
+	c.rootCmd.SetOut(io.Discard)
+	c.rootCmd.SetIn(strings.NewReader(""))
+
+	// команды не обновляют схему сами
+	require.ErrorIs(t, c.Execute([]string{"user", "list"}), repository.ErrSchemaOutdated)
+	require.ErrorIs(t, c.Execute([]string{"user", "delete", "alice", "--yes"}), repository.ErrSchemaOutdated)
+
+	migrator, err := sqlite.NewMigrator(ctx, path)
+	require.NoError(t, err)
+	version, _, err := migrator.Version()
+	require.NoError(t, err)
+	require.Zero(t, version)
+
+	require.NoError(t, migrator.Up())
+	require.NoError(t, migrator.Close())
+	require.NoError(t, c.Execute([]string{"user", "list"}))
+}
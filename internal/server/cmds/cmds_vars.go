@@ -0,0 +1,90 @@
+package cmds
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Show version information",
+	Args:  cobra.NoArgs,
+	Run:   createVersionHandler(),
+}
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Start GRPC server",
+	Args:  cobra.NoArgs,
+	RunE:  createServeHandler(),
+}
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Manage database schema",
+}
+
+var migrateUpCmd = &cobra.Command{
+	Use:   "up",
+	Short: "Apply all pending migrations",
+	Args:  cobra.NoArgs,
+	RunE:  createMigrateUpHandler(),
+}
+
+var migrateDownCmd = &cobra.Command{
+	Use:   "down [N]",
+	Short: "Roll back the last N migrations, 1 by default",
+	Args:  cobra.MaximumNArgs(1),
+	RunE:  createMigrateDownHandler(),
+}
+
+var migrateStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "List migrations and whether they are applied",
+	Args:  cobra.NoArgs,
+	RunE:  createMigrateStatusHandler(),
+}
+
+var migrateVersionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Show current schema version",
+	Args:  cobra.NoArgs,
+	RunE:  createMigrateVersionHandler(),
+}
+
+var userCmd = &cobra.Command{
+	Use:   "user",
+	Short: "Manage user accounts",
+}
+
+var userListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List registered users",
+	Args:  cobra.NoArgs,
+	RunE:  createUserListHandler(),
+}
+
+var userShowCmd = &cobra.Command{
+	Use:   "show [login]",
+	Short: "Show user account details",
+	Args:  cobra.ExactArgs(1),
+	RunE:  createUserShowHandler(),
+}
+
+var userDeleteCmd = &cobra.Command{
+	Use:   "delete [login]",
+	Short: "Delete user with all secrets",
+	Args:  cobra.ExactArgs(1),
+	RunE:  createUserDeleteHandler(),
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect server configuration",
+}
+
+var configPrintCmd = &cobra.Command{
+	Use:   "print",
+	Short: "Print effective configuration with secrets redacted",
+	Args:  cobra.NoArgs,
+	RunE:  createConfigPrintHandler(),
+}
@@ -0,0 +1,159 @@
+package config
+
+import (
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const configFileEnv = "KEEPER_CONFIG"
+
+// param параметр сервера. Имя флага и ключ в файле выводятся из имени переменной окружения:
+// KEEPER_JWT_DURATION_SEC - флаг --jwt-duration-sec и ключ jwt_duration_sec
+type param struct {
+	env   string
+	usage string
+}
+
+var params = []param{
+	{env: "KEEPER_DB_URL", usage: "PostgreSQL connection string or sqlite:///path/to/keeper.db"},
+	{env: "KEEPER_GRPC_ADDR", usage: "GRPC listen address, e.g. :50051"},
+	{env: "KEEPER_TLS_CERT_FILE", usage: "Server TLS certificate in PEM, TLS is disabled without it"},
+	{env: "KEEPER_TLS_KEY_FILE", usage: "Server TLS private key in PEM"},
+	{env: "KEEPER_TLS_CLIENT_CA_FILE", usage: "CA bundle for client certificates, enables mutual TLS"},
+	{env: "KEEPER_TLS_MIN_VERSION", usage: "Minimum TLS version, 1.2 or 1.3 (default 1.2)"},
+	{env: "KEEPER_JWT_SECRET", usage: "Secret for signing JWT"},
+	{env: "KEEPER_JWT_DURATION_SEC", usage: "Access token lifetime in seconds (default 900)"},
+	{env: "KEEPER_REFRESH_TOKEN_DURATION_SEC", usage: "Refresh token lifetime in seconds (default 2592000, 30 days)"},
+	{env: "KEEPER_REDIS_ADDR", usage: "Redis address, e.g. localhost:6379"},
+	{env: "KEEPER_REDIS_PASSWORD", usage: "Redis password"},
+	{env: "KEEPER_REDIS_DB", usage: "Redis database number"},
+	{env: "KEEPER_REDIS_EXPIRATION_SEC", usage: "Redis cache lifetime in seconds, 0 - no expiration"},
+	{env: "KEEPER_HISTORY_RETENTION", usage: "Previous secret versions to keep, 0 - no history (default 10)"},
+	{env: "KEEPER_TRASH_RETENTION_SEC", usage: "How long deleted secrets stay in trash, 0 - forever (default 30 days)"},
+	{env: "KEEPER_TRASH_PURGE_INTERVAL_SEC", usage: "Trash purge period in seconds (default 3600)"},
+}
+
+func fileKey(env string) string {
+	return strings.ToLower(strings.TrimPrefix(env, "KEEPER_"))
+}
+
+func flagName(env string) string {
+	return strings.ReplaceAll(fileKey(env), "_", "-")
+}
+
+// Source откуда читаются параметры сервера. Приоритет: флаги командной строки, переменные окружения,
+// файл конфигурации, значения по умолчанию. nil - только переменные окружения
+type Source struct {
+	flags *pflag.FlagSet
+	file  map[string]string
+}
+
+type OptionSource func(*Source)
+
+// WithFlags флаги, объявленные через RegisterFlags
+func WithFlags(flags *pflag.FlagSet) OptionSource {
+	return func(s *Source) {
+		s.flags = flags
+	}
+}
+
+// NewSource читает файл конфигурации из флага --config или KEEPER_CONFIG, если он задан
+func NewSource(opts ...OptionSource) (*Source, error) {
+
+	s := &Source{}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	path := s.Get(configFileEnv)
+	if path == "" {
+		return s, nil
+	}
+
+	file, err := readConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s.file = file
+
+	return s, nil
+}
+
+// RegisterFlags объявляет флаг для каждого параметра и --config
+func RegisterFlags(flags *pflag.FlagSet) {
+
+	flags.String("config", "", "Config file, YAML or TOML (env "+configFileEnv+")")
+	for _, p := range params {
+		flags.String(flagName(p.env), "", p.usage+" (env "+p.env+")")
+	}
+}
+
+// Get значение параметра по имени переменной окружения, "" если он нигде не задан
+func (s *Source) Get(env string) string {
+
+	if s != nil && s.flags != nil {
+		if flag := s.flags.Lookup(flagName(env)); flag != nil && flag.Changed {
+			return flag.Value.String()
+		}
+	}
+
+	if value := os.Getenv(env); value != "" {
+		return value
+	}
+
+	if s != nil {
+		return s.file[fileKey(env)]
+	}
+
+	return ""
+}
+
+// readConfigFile плоский файл ключ: значение, формат по расширению. Неизвестный ключ - ошибка, чтобы опечатка не терялась
+func readConfigFile(path string) (map[string]string, error) {
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := make(map[string]any)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		err = toml.Unmarshal(data, &raw)
+	default:
+		return nil, fmt.Errorf("config file %s: unsupported format, use .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	known := make(map[string]bool, len(params))
+	for _, p := range params {
+		known[fileKey(p.env)] = true
+	}
+
+	file := make(map[string]string, len(raw))
+	for key, value := range raw {
+		if !known[key] {
+			return nil, fmt.Errorf("config file %s: unknown key %q", path, key)
+		}
+
+		switch value.(type) {
+		case map[string]any, []any:
+			return nil, fmt.Errorf("config file %s: key %q must be a single value", path, key)
+		case nil:
+			continue
+		}
+
+		file[key] = fmt.Sprint(value)
+	}
+
+	return file, nil
+}
@@ -1,6 +1,8 @@
 package grpc
 
 import (
+	"math"
+
 	"github.com/s-turchinskiy/keeper/internal/server/models"
 	"github.com/s-turchinskiy/keeper/models/proto"
 	"google.golang.org/protobuf/types/known/timestamppb"
@@ -13,6 +15,7 @@ func convertProtoSecretToServerSecret(grpcSecret *proto.Secret, userID string) *
 		Data:         grpcSecret.GetData(),
 		Hash:         grpcSecret.GetHash(),
 		LastModified: grpcSecret.GetLastModified().AsTime(),
+		Revision:     grpcSecret.GetRevision(),
 	}
 
 	if grpcSecret.Deleted != nil {
@@ -29,5 +32,102 @@ func convertServerSecretToProtoSecret(secret *models.Secret) *proto.Secret {
 		Hash:         secret.Hash,
 		LastModified: timestamppb.New(secret.LastModified),
 		Deleted:      &secret.Deleted,
+		Revision:     secret.Revision,
+	}
+}
+
+func convertServerSecretsToProtoSecrets(secrets []*models.Secret) []*proto.Secret {
+	protoSecrets := make([]*proto.Secret, len(secrets))
+	for i, secret := range secrets {
+		protoSecrets[i] = convertServerSecretToProtoSecret(secret)
+	}
+	return protoSecrets
+}
+
+func convertServerSecretVersionToProtoSecretVersion(version *models.SecretVersion) *proto.SecretVersion {
+	return &proto.SecretVersion{
+		Version: version.Version,
+		Secret:  convertServerSecretToProtoSecret(&version.Secret),
+	}
+}
+
+func convertProtoSecretVersionToServerSecretVersion(version *proto.SecretVersion, userID string) *models.SecretVersion {
+	return &models.SecretVersion{
+		Secret:  *convertProtoSecretToServerSecret(version.GetSecret(), userID),
+		Version: version.GetVersion(),
+	}
+}
+
+func convertProtoExpectedVersion(hash *string, revision *int64) *models.ExpectedVersion {
+	if hash == nil && revision == nil {
+		return nil
+	}
+
+	return &models.ExpectedVersion{
+		Hash:     hash,
+		Revision: revision,
+	}
+}
+
+func convertProtoKDFParamsToServerKDFParams(kdf *proto.KDFParams) *models.KDFParams {
+	if kdf == nil {
+		return nil
+	}
+
+	params := &models.KDFParams{
+		Salt:      kdf.GetSalt(),
+		Time:      kdf.GetTime(),
+		MemoryKiB: kdf.GetMemoryKib(),
+	}
+
+	// потоки вне диапазона uint8 оставляем нулем, такие параметры не пройдут Validate
+	if kdf.GetThreads() <= math.MaxUint8 {
+		params.Threads = uint8(kdf.GetThreads())
+	}
+
+	return params
+}
+
+func convertServerKDFParamsToProtoKDFParams(kdf *models.KDFParams) *proto.KDFParams {
+	if kdf == nil {
+		return nil
+	}
+
+	return &proto.KDFParams{
+		Salt:      kdf.Salt,
+		Time:      kdf.Time,
+		MemoryKib: kdf.MemoryKiB,
+		Threads:   uint32(kdf.Threads),
+	}
+}
+
+func convertProtoDeviceToServerDevice(device *proto.Device) *models.Device {
+	if device == nil {
+		return nil
+	}
+
+	return &models.Device{
+		ID:            device.GetId(),
+		Name:          device.GetName(),
+		OS:            device.GetOs(),
+		ClientVersion: device.GetClientVersion(),
+	}
+}
+
+func convertServerDevicesToProtoDevices(devices []*models.Device) []*proto.Device {
+	protoDevices := make([]*proto.Device, len(devices))
+	for i, device := range devices {
+		protoDevices[i] = &proto.Device{
+			Id:            device.ID,
+			Name:          device.Name,
+			Os:            device.OS,
+			ClientVersion: device.ClientVersion,
+			CreatedAt:     timestamppb.New(device.CreatedAt),
+			LastSeenAt:    timestamppb.New(device.LastSeenAt),
+		}
+		if device.RevokedAt != nil {
+			protoDevices[i].RevokedAt = timestamppb.New(*device.RevokedAt)
+		}
 	}
+	return protoDevices
 }
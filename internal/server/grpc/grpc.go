@@ -6,16 +6,22 @@ import (
 	"google.golang.org/grpc"
 )
 
-func NewGrpcServer(service *service.Service) *grpc.Server {
-	grpcServer := grpc.NewServer(
+// NewGrpcServer opts - дополнительные параметры сервера, например grpc.Creds для TLS
+func NewGrpcServer(service *service.Service, opts ...grpc.ServerOption) *grpc.Server {
+	grpcServer := grpc.NewServer(append([]grpc.ServerOption{
 		grpc.ChainUnaryInterceptor(
 			LoggingInterceptor(),
 			AuthInterceptor(service),
 		),
-	)
+		grpc.ChainStreamInterceptor(
+			StreamLoggingInterceptor(),
+			StreamAuthInterceptor(service),
+		),
+	}, opts...)...)
 
-	proto.RegisterAuthServiceServer(grpcServer, NewAuthHandler(service))
-	proto.RegisterSecretServiceServer(grpcServer, NewSecretHandler(service))
+	hub := NewSecretsHub()
+	proto.RegisterAuthServiceServer(grpcServer, NewAuthHandler(service, hub))
+	proto.RegisterSecretServiceServer(grpcServer, NewSecretHandler(service, hub))
 
 	return grpcServer
 
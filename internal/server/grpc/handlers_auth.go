@@ -3,16 +3,21 @@ package grpc
 import (
 	"context"
 	"errors"
+	"github.com/s-turchinskiy/keeper/internal/server/models"
+	"github.com/s-turchinskiy/keeper/internal/server/repository"
 	"github.com/s-turchinskiy/keeper/internal/server/service"
+	"github.com/s-turchinskiy/keeper/internal/utils/otputils"
 	"github.com/s-turchinskiy/keeper/models/proto"
 
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 type AuthHandler struct {
 	proto.UnimplementedAuthServiceServer
 	service service.Servicer
+	hub     *SecretsHub
 }
 
 func (h *AuthHandler) GetConnectionNumber(ctx context.Context, req *proto.GetConnectionNumberRequest) (*proto.GetConnectionNumberResponse, error) {
@@ -25,12 +30,15 @@ func (h *AuthHandler) GetConnectionNumber(ctx context.Context, req *proto.GetCon
 	return resp, nil
 }
 
-func NewAuthHandler(service service.Servicer) *AuthHandler {
-	return &AuthHandler{service: service}
+func NewAuthHandler(service service.Servicer, hub *SecretsHub) *AuthHandler {
+	return &AuthHandler{service: service, hub: hub}
 }
 
 func (h *AuthHandler) Register(ctx context.Context, req *proto.RegisterRequest) (*proto.RegisterResponse, error) {
-	user, err := h.service.Register(ctx, req.GetLogin(), req.GetPassword())
+	user, err := h.service.Register(ctx, req.GetLogin(), req.GetPassword(), convertProtoKDFParamsToServerKDFParams(req.GetKdf()))
+	if errors.Is(err, models.ErrInvalidKDFParams) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
 	if err != nil {
 		return nil, status.Error(codes.Internal, err.Error())
 	}
@@ -42,22 +50,337 @@ func (h *AuthHandler) Register(ctx context.Context, req *proto.RegisterRequest)
 	return resp, nil
 }
 
+// Login вход по логину и паролю. Если у пользователя включен второй фактор, ответ содержит только
+// two_factor_required и challenge, а токены выдаются на втором шаге по challenge и two_factor_code
 func (h *AuthHandler) Login(ctx context.Context, req *proto.LoginRequest) (*proto.LoginResponse, error) {
-	token, user, err := h.service.Login(ctx, req.GetLogin(), req.GetPassword())
+	device := convertProtoDeviceToServerDevice(req.GetDevice())
+
+	var (
+		tokens *models.Tokens
+		user   *models.User
+		err    error
+	)
+	if req.GetChallenge() != "" {
+		tokens, user, err = h.service.LoginTwoFactor(ctx, req.GetChallenge(), req.GetTwoFactorCode(), device)
+	} else {
+		tokens, user, err = h.service.Login(ctx, req.GetLogin(), req.GetPassword(), device)
+	}
+
+	var required *service.TwoFactorRequiredError
+	if errors.As(err, &required) {
+		resp := &proto.LoginResponse{
+			UserId:             user.ID,
+			TwoFactorRequired:  true,
+			Challenge:          required.Challenge,
+			ChallengeExpiresAt: timestamppb.New(required.ExpiresAt),
+		}
+		return resp, nil
+	}
+
 	if err != nil {
 		switch {
 		case errors.Is(err, service.ErrUserNotFound):
 			return nil, status.Error(codes.NotFound, "user not found")
 		case errors.Is(err, service.ErrInvalidCredentials):
 			return nil, status.Error(codes.Unauthenticated, "invalid password")
+		case errors.Is(err, service.ErrInvalidChallenge):
+			return nil, status.Error(codes.Unauthenticated, "invalid two-factor challenge")
+		case errors.Is(err, service.ErrInvalidDevice):
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		case errors.Is(err, service.ErrDeviceRevoked):
+			return nil, status.Error(codes.PermissionDenied, "device revoked")
 		default:
-			return nil, status.Error(codes.Internal, "internal error")
+			return nil, twoFactorError(err)
 		}
 	}
 	resp := &proto.LoginResponse{
-		Token:  token,
-		UserId: user.ID,
+		Token:                 tokens.AccessToken,
+		UserId:                user.ID,
+		RefreshToken:          tokens.RefreshToken,
+		TokenExpiresAt:        timestamppb.New(tokens.AccessExpiresAt),
+		RefreshTokenExpiresAt: timestamppb.New(tokens.RefreshExpiresAt),
+	}
+
+	return resp, nil
+}
+
+// RefreshToken выдает новую пару токенов, доступен без токена доступа: он мог уже истечь
+func (h *AuthHandler) RefreshToken(ctx context.Context, req *proto.RefreshTokenRequest) (*proto.RefreshTokenResponse, error) {
+	tokens, err := h.service.RefreshToken(ctx, req.GetRefreshToken())
+	if errors.Is(err, service.ErrInvalidRefreshToken) {
+		return nil, status.Error(codes.Unauthenticated, "invalid refresh token")
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	resp := &proto.RefreshTokenResponse{
+		Token:                 tokens.AccessToken,
+		RefreshToken:          tokens.RefreshToken,
+		TokenExpiresAt:        timestamppb.New(tokens.AccessExpiresAt),
+		RefreshTokenExpiresAt: timestamppb.New(tokens.RefreshExpiresAt),
+	}
+
+	return resp, nil
+}
+
+// Logout завершает текущую сессию или все сессии пользователя и закрывает их стримы изменений
+func (h *AuthHandler) Logout(ctx context.Context, req *proto.LogoutRequest) (*proto.LogoutResponse, error) {
+	userID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "authentication required")
+	}
+
+	sessionID, err := getSessionIDFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "authentication required")
+	}
+
+	revoked, err := h.service.Logout(ctx, userID, sessionID, req.GetAllSessions())
+	if err != nil {
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	if req.GetAllSessions() {
+		h.hub.Disconnect(userID, "")
+	} else {
+		h.hub.Disconnect(userID, sessionID)
+	}
+
+	resp := &proto.LogoutResponse{
+		RevokedSessions: revoked,
+	}
+
+	return resp, nil
+}
+
+// GetKDFParams соль и параметры Argon2id пользователя, доступны без авторизации: без них клиент не выведет пароль
+func (h *AuthHandler) GetKDFParams(ctx context.Context, req *proto.GetKDFParamsRequest) (*proto.GetKDFParamsResponse, error) {
+	kdf, err := h.service.GetKDFParams(ctx, req.GetLogin())
+	if errors.Is(err, service.ErrUserNotFound) {
+		return nil, status.Error(codes.NotFound, "user not found")
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	resp := &proto.GetKDFParamsResponse{
+		Kdf: convertServerKDFParamsToProtoKDFParams(kdf),
+	}
+
+	return resp, nil
+}
+
+// ChangePassword меняет пароль авторизации и ключ хранилища, зашифрованный новым мастер-паролем
+func (h *AuthHandler) ChangePassword(ctx context.Context, req *proto.ChangePasswordRequest) (*proto.ChangePasswordResponse, error) {
+	userID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "authentication required")
+	}
+
+	if req.GetNewPassword() == "" || len(req.GetVaultKey()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "new password and vault key are required")
+	}
+
+	err = h.service.ChangePassword(ctx, userID, req.GetOldPassword(), req.GetNewPassword(), req.GetVaultKey(),
+		convertProtoKDFParamsToServerKDFParams(req.GetKdf()))
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrInvalidKDFParams):
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		case errors.Is(err, service.ErrUserNotFound):
+			return nil, status.Error(codes.NotFound, "user not found")
+		case errors.Is(err, service.ErrInvalidCredentials):
+			return nil, status.Error(codes.PermissionDenied, "invalid password")
+		default:
+			return nil, status.Error(codes.Internal, "internal error")
+		}
+	}
+
+	return &proto.ChangePasswordResponse{}, nil
+}
+
+func (h *AuthHandler) GetVaultKey(ctx context.Context, req *proto.GetVaultKeyRequest) (*proto.GetVaultKeyResponse, error) {
+	userID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "authentication required")
+	}
+
+	vaultKey, err := h.service.GetVaultKey(ctx, userID)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	resp := &proto.GetVaultKeyResponse{
+		VaultKey: vaultKey,
+	}
+
+	return resp, nil
+}
+
+// SetVaultKey сохраняет ключ хранилища. Без replace возвращает AlreadyExists, если ключ уже создан другим устройством
+func (h *AuthHandler) SetVaultKey(ctx context.Context, req *proto.SetVaultKeyRequest) (*proto.SetVaultKeyResponse, error) {
+	userID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "authentication required")
+	}
+
+	if len(req.GetVaultKey()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "vault key is required")
+	}
+
+	err = h.service.SetVaultKey(ctx, userID, req.GetVaultKey(), req.GetReplace())
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrVaultKeySet):
+			return nil, status.Error(codes.AlreadyExists, "vault key already set")
+		case errors.Is(err, repository.ErrUserNotFound):
+			return nil, status.Error(codes.NotFound, "user not found")
+		default:
+			return nil, status.Error(codes.Internal, "internal error")
+		}
+	}
+
+	return &proto.SetVaultKeyResponse{}, nil
+}
+
+// ListDevices устройства пользователя с временем последнего входа, включая отозванные
+func (h *AuthHandler) ListDevices(ctx context.Context, req *proto.ListDevicesRequest) (*proto.ListDevicesResponse, error) {
+	userID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "authentication required")
+	}
+
+	devices, err := h.service.ListDevices(ctx, userID)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	resp := &proto.ListDevicesResponse{
+		Devices: convertServerDevicesToProtoDevices(devices),
+	}
+
+	return resp, nil
+}
+
+// RevokeDevice отзывает устройство пользователя, завершает его сессии и закрывает их стримы изменений
+func (h *AuthHandler) RevokeDevice(ctx context.Context, req *proto.RevokeDeviceRequest) (*proto.RevokeDeviceResponse, error) {
+	userID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "authentication required")
+	}
+
+	sessionIDs, err := h.service.RevokeDevice(ctx, userID, req.GetDeviceId())
+	if errors.Is(err, service.ErrDeviceNotFound) {
+		return nil, status.Error(codes.NotFound, "device not found")
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	for _, sessionID := range sessionIDs {
+		h.hub.Disconnect(userID, sessionID)
+	}
+
+	resp := &proto.RevokeDeviceResponse{
+		RevokedSessions: int64(len(sessionIDs)),
+	}
+
+	return resp, nil
+}
+
+// EnableTwoFactor начинает подключение TOTP, второй фактор включается после ConfirmTwoFactor
+func (h *AuthHandler) EnableTwoFactor(ctx context.Context, req *proto.EnableTwoFactorRequest) (*proto.EnableTwoFactorResponse, error) {
+	userID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "authentication required")
+	}
+
+	secret, uri, err := h.service.EnableTwoFactor(ctx, userID)
+	if errors.Is(err, service.ErrUserNotFound) {
+		return nil, status.Error(codes.NotFound, "user not found")
+	}
+	if err != nil {
+		return nil, twoFactorError(err)
+	}
+
+	resp := &proto.EnableTwoFactorResponse{
+		Secret:     otputils.EncodeSecret(secret),
+		OtpauthUri: uri,
+	}
+
+	return resp, nil
+}
+
+// ConfirmTwoFactor включает второй фактор первым кодом из приложения-аутентификатора, возвращает коды восстановления
+func (h *AuthHandler) ConfirmTwoFactor(ctx context.Context, req *proto.ConfirmTwoFactorRequest) (*proto.ConfirmTwoFactorResponse, error) {
+	userID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "authentication required")
+	}
+
+	recoveryCodes, err := h.service.ConfirmTwoFactor(ctx, userID, req.GetCode())
+	if err != nil {
+		return nil, twoFactorError(err)
+	}
+
+	resp := &proto.ConfirmTwoFactorResponse{
+		RecoveryCodes: recoveryCodes,
 	}
 
 	return resp, nil
 }
+
+// DisableTwoFactor отключает второй фактор по действующему коду TOTP или коду восстановления
+func (h *AuthHandler) DisableTwoFactor(ctx context.Context, req *proto.DisableTwoFactorRequest) (*proto.DisableTwoFactorResponse, error) {
+	userID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "authentication required")
+	}
+
+	if err = h.service.DisableTwoFactor(ctx, userID, req.GetCode()); err != nil {
+		return nil, twoFactorError(err)
+	}
+
+	return &proto.DisableTwoFactorResponse{}, nil
+}
+
+func (h *AuthHandler) GetTwoFactorStatus(ctx context.Context, req *proto.GetTwoFactorStatusRequest) (*proto.GetTwoFactorStatusResponse, error) {
+	userID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "authentication required")
+	}
+
+	twoFactor, err := h.service.GetTwoFactorStatus(ctx, userID)
+	if errors.Is(err, service.ErrUserNotFound) {
+		return nil, status.Error(codes.NotFound, "user not found")
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	resp := &proto.GetTwoFactorStatusResponse{
+		Enabled:           twoFactor.Enabled(),
+		Pending:           len(twoFactor.PendingSecret) > 0,
+		RecoveryCodesLeft: int32(twoFactor.RecoveryCodesLeft),
+	}
+
+	return resp, nil
+}
+
+// twoFactorError ошибки проверки второго фактора. Неверный код - InvalidArgument, а не Unauthenticated:
+// на Unauthenticated клиент заново входит и повторяет запрос, тратя еще одну попытку
+func twoFactorError(err error) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidTwoFactorCode):
+		return status.Error(codes.InvalidArgument, "invalid two-factor code")
+	case errors.Is(err, service.ErrTooManyTwoFactorAttempts):
+		return status.Error(codes.ResourceExhausted, "too many two-factor attempts, try later")
+	case errors.Is(err, service.ErrTwoFactorAlreadyEnabled),
+		errors.Is(err, service.ErrTwoFactorNotEnabled),
+		errors.Is(err, service.ErrTwoFactorNotPending):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	default:
+		return status.Error(codes.Internal, "internal error")
+	}
+}
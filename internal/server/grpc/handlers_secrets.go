@@ -3,7 +3,7 @@ package grpc
 import (
 	"context"
 	"errors"
-	"github.com/s-turchinskiy/keeper/internal/server/repository/postgres"
+	"github.com/s-turchinskiy/keeper/internal/server/repository"
 	"github.com/s-turchinskiy/keeper/internal/server/service"
 	"github.com/s-turchinskiy/keeper/models/proto"
 	"google.golang.org/grpc"
@@ -17,14 +17,15 @@ import (
 
 type SecretHandler struct {
 	proto.UnimplementedSecretServiceServer
-	service             service.Servicer
-	secretsForClientsCh chan []*models.Secret
+	service service.Servicer
+	hub     *SecretsHub
 }
 
-func NewSecretHandler(service service.Servicer) *SecretHandler {
+// NewSecretHandler hub общий с AuthHandler, чтобы Logout закрывал стримы сессии
+func NewSecretHandler(service service.Servicer, hub *SecretsHub) *SecretHandler {
 	return &SecretHandler{
-		service:             service,
-		secretsForClientsCh: make(chan []*models.Secret),
+		service: service,
+		hub:     hub,
 	}
 }
 
@@ -36,17 +37,23 @@ func (h *SecretHandler) SetSecret(ctx context.Context, req *proto.SetSecretReque
 
 	secret := convertProtoSecretToServerSecret(req.GetSecret(), userID)
 
-	err = h.service.CreateSecret(ctx, secret)
+	expected := convertProtoExpectedVersion(req.ExpectedHash, req.ExpectedRevision)
+
+	err = h.service.CreateSecret(ctx, secret, expected)
+	if errors.Is(err, repository.ErrSecretConflict) {
+		return nil, h.conflictError(ctx, userID, secret.ID)
+	}
 	if err != nil {
 		log.Printf("Create failed: %v\n", err)
 		return nil, status.Error(codes.Internal, "failed to set secret, err: "+err.Error())
 	}
 
 	resp := &proto.SetSecretResponse{
-		Success: true,
+		Success:  true,
+		Revision: secret.Revision,
 	}
 
-	h.secretsForClientsCh <- []*models.Secret{secret}
+	h.hub.Publish(userID, []*models.Secret{secret})
 
 	return resp, nil
 }
@@ -63,11 +70,16 @@ func (h *SecretHandler) GetSecret(ctx context.Context, req *proto.GetSecretReque
 		return nil, status.Error(codes.Internal, "failed to get secret")
 	}
 
+	if secret.Deleted {
+		return nil, status.Error(codes.NotFound, "secret is in trash")
+	}
+
 	respSecret := &proto.Secret{
 		Id:           secret.ID,
 		Hash:         secret.Hash,
 		LastModified: timestamppb.New(secret.LastModified),
 		Data:         secret.Data,
+		Revision:     secret.Revision,
 	}
 
 	resp := &proto.GetSecretResponse{}
@@ -84,17 +96,23 @@ func (h *SecretHandler) UpdateSecret(ctx context.Context, req *proto.UpdateSecre
 
 	secret := convertProtoSecretToServerSecret(req.GetSecret(), userID)
 
-	err = h.service.CreateSecret(ctx, secret)
+	expected := convertProtoExpectedVersion(req.ExpectedHash, req.ExpectedRevision)
+
+	err = h.service.UpdateSecret(ctx, secret, expected)
+	if errors.Is(err, repository.ErrSecretConflict) {
+		return nil, h.conflictError(ctx, userID, secret.ID)
+	}
 	if err != nil {
 		log.Printf("Update failed: %v\n", err)
 		return nil, status.Error(codes.Internal, "failed to update secret, err: "+err.Error())
 	}
 
 	resp := &proto.UpdateSecretResponse{
-		Success: true,
+		Success:  true,
+		Revision: secret.Revision,
 	}
 
-	h.secretsForClientsCh <- []*models.Secret{secret}
+	h.hub.Publish(userID, []*models.Secret{secret})
 
 	return resp, nil
 }
@@ -106,7 +124,7 @@ func (h *SecretHandler) DeleteSecret(ctx context.Context, req *proto.DeleteSecre
 	}
 
 	err = h.service.DeleteSecret(ctx, userID, req.GetSecretId())
-	if err != nil && !errors.Is(err, postgres.ErrSecretNotFound) {
+	if err != nil && !errors.Is(err, repository.ErrSecretNotFound) {
 		log.Printf("Delete failed: %v", err)
 		return nil, status.Error(codes.Internal, "failed to delete secret")
 	}
@@ -115,9 +133,14 @@ func (h *SecretHandler) DeleteSecret(ctx context.Context, req *proto.DeleteSecre
 	resp.Success = true
 
 	secret, err := h.service.GetSecret(ctx, userID, req.GetSecretId())
-	//TODO: выше должен возвращаться секрет всегда, но со статусом - deleting, пока заглушка
 	if err == nil && secret != nil {
-		h.secretsForClientsCh <- []*models.Secret{secret}
+		h.hub.Publish(userID, []*models.Secret{{
+			ID:           secret.ID,
+			UserID:       secret.UserID,
+			LastModified: secret.LastModified,
+			Deleted:      secret.Deleted,
+			Revision:     secret.Revision,
+		}})
 	} else {
 		log.Printf("error send deleted secret in clients, user id: %s, name: %s, error : %v", userID, req.GetSecretId(), err)
 	}
@@ -157,12 +180,12 @@ func (h *SecretHandler) SyncSecretsFromClient(ctx context.Context, req *proto.Sy
 
 	reqSecrets := req.GetSecrets()
 
-	secrets := make([]*models.Secret, len(reqSecrets))
+	secrets := make([]*models.Secret, 0, len(reqSecrets))
 	for _, reqSecret := range reqSecrets {
 		secrets = append(secrets, convertProtoSecretToServerSecret(reqSecret, userID))
 	}
 
-	updateInClients, err := h.service.SyncFromClient(ctx, userID, secrets)
+	updateInClients, conflicts, err := h.service.SyncFromClient(ctx, userID, secrets)
 	if err != nil {
 		log.Printf("SyncSecretsFromClient failed: %v", err)
 		return nil, status.Error(codes.Internal, "failed to sync secrets from client, err: "+err.Error())
@@ -170,32 +193,254 @@ func (h *SecretHandler) SyncSecretsFromClient(ctx context.Context, req *proto.Sy
 
 	resp := &proto.SyncSecretsFromClientResponse{}
 	resp.Success = true
+	resp.Conflicts = convertServerSecretsToProtoSecrets(conflicts)
 
-	h.secretsForClientsCh <- updateInClients
+	h.hub.Publish(userID, updateInClients)
 	return resp, nil
 }
 
-// GetUpdatedSecrets Отправка измененных секретов всем подключенным клиентам
+// conflictError ошибка Aborted с текущей версией секрета на сервере в деталях статуса
+func (h *SecretHandler) conflictError(ctx context.Context, userID, secretID string) error {
+
+	st := status.New(codes.Aborted, "secret was changed on the server")
+
+	current, err := h.service.GetSecret(ctx, userID, secretID)
+	if err != nil {
+		current = &models.Secret{ID: secretID, UserID: userID, Deleted: true}
+	}
+
+	stWithDetails, err := st.WithDetails(convertServerSecretToProtoSecret(current))
+	if err != nil {
+		log.Printf("conflictError failed: %v", err)
+		return st.Err()
+	}
+
+	return stWithDetails.Err()
+}
+
+// GetUpdatedSecrets Отправка измененных секретов всем подключенным клиентам пользователя
 func (h *SecretHandler) GetUpdatedSecrets(req *proto.GetUpdatedSecretsRequest, g grpc.ServerStreamingServer[proto.GetUpdatedSecretsResponse]) error {
 
-	//надо бы прерывать, но контекста когда stream нет
-	//TODO: надо сделать проверку на userID, отправлять только на подключенные под именно этим юзером клиенты
-	//TODO: это все работает ненадежно, то клиент получает данные стрима, то нет и непонятно почему
-	for secretsForClients := range h.secretsForClientsCh {
+	ctx := g.Context()
+
+	userID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		return status.Error(codes.Unauthenticated, "authentication required")
+	}
+
+	sessionID, err := getSessionIDFromContext(ctx)
+	if err != nil {
+		return status.Error(codes.Unauthenticated, "authentication required")
+	}
+
+	connNumber, err := getConnectionNumber(ctx)
+	if err != nil {
+		return err
+	}
 
-		respSecrets := make([]*proto.Secret, len(secretsForClients))
-		for i, secret := range secretsForClients {
-			respSecrets[i] = convertServerSecretToProtoSecret(secret)
+	sub := h.hub.Subscribe(userID, sessionID, connNumber)
+	defer h.hub.Unsubscribe(sub)
+
+	if req.SinceRevision != nil {
+		changes, err := h.service.GetChangesSince(ctx, userID, req.GetSinceRevision())
+		if err != nil {
+			log.Printf("GetUpdatedSecrets failed: connection number: %s, error: %v", connNumber, err)
+			return status.Error(codes.Internal, "failed to get changes")
+		}
+
+		if len(changes) > 0 {
+			resp := &proto.GetUpdatedSecretsResponse{}
+			resp.Secrets = convertServerSecretsToProtoSecrets(changes)
+
+			if err := g.Send(resp); err != nil {
+				log.Printf("GetUpdatedSecrets failed: connection number: %s, error: %v", connNumber, err)
+				return err
+			}
+		}
+	}
+
+	for {
+		secretsForClients, err := sub.Next(ctx)
+		if errors.Is(err, ErrSubscriptionClosed) {
+			return status.Error(codes.Unauthenticated, "session closed")
+		}
+		if errors.Is(err, ErrSubscriptionOverflow) {
+			return status.Error(codes.ResourceExhausted, "too many pending changes, reconnect with since_revision")
+		}
+		if err != nil {
+			return nil
 		}
 
 		resp := &proto.GetUpdatedSecretsResponse{}
-		resp.Secrets = respSecrets
+		resp.Secrets = convertServerSecretsToProtoSecrets(secretsForClients)
 
 		if err := g.Send(resp); err != nil {
-			log.Printf("GetUpdatedSecrets failed: %v", err)
+			log.Printf("GetUpdatedSecrets failed: connection number: %s, error: %v", connNumber, err)
+			return err
 		}
 	}
+}
+
+// GetChangesSince Изменения секретов пользователя после указанной ревизии
+func (h *SecretHandler) GetChangesSince(ctx context.Context, req *proto.GetChangesSinceRequest) (*proto.GetChangesSinceResponse, error) {
 
-	return nil
+	userID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "authentication required")
+	}
+
+	changes, err := h.service.GetChangesSince(ctx, userID, req.GetRevision())
+	if err != nil {
+		log.Printf("GetChangesSince failed: %v", err)
+		return nil, status.Error(codes.Internal, "failed to get changes, err: "+err.Error())
+	}
+
+	revision := req.GetRevision()
+	for _, secret := range changes {
+		if secret.Revision > revision {
+			revision = secret.Revision
+		}
+	}
+
+	resp := &proto.GetChangesSinceResponse{}
+	resp.Secrets = convertServerSecretsToProtoSecrets(changes)
+	resp.Revision = revision
+
+	return resp, nil
+}
 
+// ListSecretVersions Предыдущие версии секрета без данных
+func (h *SecretHandler) ListSecretVersions(ctx context.Context, req *proto.ListSecretVersionsRequest) (*proto.ListSecretVersionsResponse, error) {
+
+	userID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "authentication required")
+	}
+
+	versions, err := h.service.ListSecretVersions(ctx, userID, req.GetSecretId())
+	if err != nil {
+		log.Printf("ListSecretVersions failed: %v", err)
+		return nil, status.Error(codes.Internal, "failed to list secret versions, err: "+err.Error())
+	}
+
+	resp := &proto.ListSecretVersionsResponse{}
+	resp.Versions = make([]*proto.SecretVersion, len(versions))
+	for i, version := range versions {
+		resp.Versions[i] = convertServerSecretVersionToProtoSecretVersion(version)
+	}
+
+	return resp, nil
+}
+
+// GetSecretVersion Предыдущая версия секрета с данными
+func (h *SecretHandler) GetSecretVersion(ctx context.Context, req *proto.GetSecretVersionRequest) (*proto.GetSecretVersionResponse, error) {
+
+	userID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "authentication required")
+	}
+
+	version, err := h.service.GetSecretVersion(ctx, userID, req.GetSecretId(), req.GetVersion())
+	if errors.Is(err, repository.ErrSecretVersionNotFound) {
+		return nil, status.Error(codes.NotFound, "secret version not found")
+	}
+	if err != nil {
+		log.Printf("GetSecretVersion failed: %v", err)
+		return nil, status.Error(codes.Internal, "failed to get secret version, err: "+err.Error())
+	}
+
+	resp := &proto.GetSecretVersionResponse{}
+	resp.Version = convertServerSecretVersionToProtoSecretVersion(version)
+
+	return resp, nil
+}
+
+// ListDeletedSecrets Секреты в корзине, данные нужны клиенту для расшифровки имен
+func (h *SecretHandler) ListDeletedSecrets(ctx context.Context, req *proto.ListDeletedSecretsRequest) (*proto.ListDeletedSecretsResponse, error) {
+
+	userID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "authentication required")
+	}
+
+	secrets, err := h.service.ListDeletedSecrets(ctx, userID)
+	if err != nil {
+		log.Printf("ListDeletedSecrets failed: %v", err)
+		return nil, status.Error(codes.Internal, "failed to list deleted secrets, err: "+err.Error())
+	}
+
+	resp := &proto.ListDeletedSecretsResponse{}
+	resp.Secrets = convertServerSecretsToProtoSecrets(secrets)
+
+	return resp, nil
+}
+
+// UndeleteSecret Возвращает секрет из корзины и рассылает его всем клиентам пользователя
+func (h *SecretHandler) UndeleteSecret(ctx context.Context, req *proto.UndeleteSecretRequest) (*proto.UndeleteSecretResponse, error) {
+
+	userID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "authentication required")
+	}
+
+	secret, err := h.service.UndeleteSecret(ctx, userID, req.GetSecretId())
+	if errors.Is(err, repository.ErrSecretNotFound) {
+		return nil, status.Error(codes.NotFound, "secret not found in trash")
+	}
+	if err != nil {
+		log.Printf("UndeleteSecret failed: %v", err)
+		return nil, status.Error(codes.Internal, "failed to undelete secret, err: "+err.Error())
+	}
+
+	h.hub.Publish(userID, []*models.Secret{secret})
+
+	resp := &proto.UndeleteSecretResponse{}
+	resp.Secret = convertServerSecretToProtoSecret(secret)
+
+	return resp, nil
+}
+
+// PurgeDeletedSecrets Окончательно удаляет все секреты пользователя из корзины
+func (h *SecretHandler) PurgeDeletedSecrets(ctx context.Context, req *proto.PurgeDeletedSecretsRequest) (*proto.PurgeDeletedSecretsResponse, error) {
+
+	userID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "authentication required")
+	}
+
+	purged, err := h.service.PurgeDeletedSecrets(ctx, userID)
+	if err != nil {
+		log.Printf("PurgeDeletedSecrets failed: %v", err)
+		return nil, status.Error(codes.Internal, "failed to purge deleted secrets, err: "+err.Error())
+	}
+
+	resp := &proto.PurgeDeletedSecretsResponse{}
+	resp.Purged = purged
+
+	return resp, nil
+}
+
+// RekeySecrets Заменяет данные секретов в корзине и версий из истории, перешифрованные новым ключом хранилища
+func (h *SecretHandler) RekeySecrets(ctx context.Context, req *proto.RekeySecretsRequest) (*proto.RekeySecretsResponse, error) {
+
+	userID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "authentication required")
+	}
+
+	versions := make([]*models.SecretVersion, len(req.GetVersions()))
+	for i, version := range req.GetVersions() {
+		versions[i] = convertProtoSecretVersionToServerSecretVersion(version, userID)
+	}
+
+	rekeyed, err := h.service.RekeySecrets(ctx, userID, versions)
+	if err != nil {
+		log.Printf("RekeySecrets failed: %v", err)
+		return nil, status.Error(codes.Internal, "failed to rekey secrets, err: "+err.Error())
+	}
+
+	resp := &proto.RekeySecretsResponse{}
+	resp.Rekeyed = rekeyed
+
+	return resp, nil
 }
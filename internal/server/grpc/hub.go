@@ -0,0 +1,189 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/s-turchinskiy/keeper/internal/server/models"
+)
+
+// maxSubscriptionQueue сколько пачек изменений ждет отправки в один стрим, прежде чем стрим закрывается
+const maxSubscriptionQueue = 256
+
+// SecretsHub рассылает измененные секреты во все стримы GetUpdatedSecrets владельца.
+// Стримы ключуются по userID и номеру соединения. Изменения, опубликованные без стримов, не хранятся:
+// новый стрим досылает пропущенное по ревизии SinceRevision.
+type SecretsHub struct {
+	mu      sync.Mutex
+	streams map[string]map[string]*Subscription
+}
+
+var (
+	// ErrSubscriptionClosed сессия стрима завершена через Logout
+	ErrSubscriptionClosed = errors.New("subscription closed")
+	// ErrSubscriptionOverflow стрим не успевал забирать изменения, клиент переподключается с SinceRevision
+	ErrSubscriptionOverflow = errors.New("subscription queue overflow")
+)
+
+// Subscription очередь изменений одного стрима, Publish в нее никогда не блокируется.
+// Очередь ограничена maxSubscriptionQueue, переполненный стрим закрывается
+type Subscription struct {
+	userID     string
+	sessionID  string
+	connNumber string
+
+	mu     sync.Mutex
+	queue  [][]*models.Secret
+	notify chan struct{}
+	closed chan struct{}
+	err    error
+}
+
+func NewSecretsHub() *SecretsHub {
+	return &SecretsHub{
+		streams: make(map[string]map[string]*Subscription),
+	}
+}
+
+// Subscribe sessionID - сессия, под которой открыт стрим, по ней стрим закрывается в Disconnect
+func (h *SecretsHub) Subscribe(userID, sessionID, connNumber string) *Subscription {
+	sub := &Subscription{
+		userID:     userID,
+		sessionID:  sessionID,
+		connNumber: connNumber,
+		notify:     make(chan struct{}, 1),
+		closed:     make(chan struct{}),
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	userStreams, ok := h.streams[userID]
+	if !ok {
+		userStreams = make(map[string]*Subscription)
+		h.streams[userID] = userStreams
+	}
+	userStreams[connNumber] = sub
+
+	return sub
+}
+
+func (h *SecretsHub) Unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	userStreams, ok := h.streams[sub.userID]
+	if !ok || userStreams[sub.connNumber] != sub {
+		return
+	}
+
+	delete(userStreams, sub.connNumber)
+	if len(userStreams) == 0 {
+		delete(h.streams, sub.userID)
+	}
+}
+
+// Disconnect закрывает стримы сессии sessionID пользователя, пустой sessionID - все его стримы
+func (h *SecretsHub) Disconnect(userID, sessionID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	userStreams := h.streams[userID]
+	for connNumber, sub := range userStreams {
+		if sessionID != "" && sub.sessionID != sessionID {
+			continue
+		}
+
+		delete(userStreams, connNumber)
+		sub.close(ErrSubscriptionClosed)
+	}
+
+	if len(userStreams) == 0 {
+		delete(h.streams, userID)
+	}
+}
+
+// Publish отправляет секреты во все стримы владельца userID, стримы с переполненной очередью закрываются
+func (h *SecretsHub) Publish(userID string, secrets []*models.Secret) {
+	secrets = compactSecrets(secrets)
+	if len(secrets) == 0 {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	userStreams := h.streams[userID]
+	for connNumber, sub := range userStreams {
+		if !sub.push(secrets) {
+			delete(userStreams, connNumber)
+			sub.close(ErrSubscriptionOverflow)
+		}
+	}
+
+	if len(userStreams) == 0 {
+		delete(h.streams, userID)
+	}
+}
+
+// Next ждет очередную пачку изменений, возвращает ошибку контекста при закрытии стрима,
+// ErrSubscriptionClosed после Disconnect и ErrSubscriptionOverflow при переполнении очереди
+func (s *Subscription) Next(ctx context.Context) ([]*models.Secret, error) {
+	for {
+		s.mu.Lock()
+		if len(s.queue) > 0 {
+			secrets := s.queue[0]
+			s.queue = s.queue[1:]
+			s.mu.Unlock()
+			return secrets, nil
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-s.closed:
+			return nil, s.err
+		case <-s.notify:
+		}
+	}
+}
+
+// push false, если очередь переполнена
+func (s *Subscription) push(secrets []*models.Secret) bool {
+	s.mu.Lock()
+	if len(s.queue) >= maxSubscriptionQueue {
+		s.mu.Unlock()
+		return false
+	}
+	s.queue = append(s.queue, secrets)
+	s.mu.Unlock()
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// close вызывается под блокировкой хаба после удаления стрима из него, поэтому ровно один раз.
+// Неотправленные изменения отбрасываются: клиент досылает их по ревизии при переподключении
+func (s *Subscription) close(err error) {
+	s.mu.Lock()
+	s.queue = nil
+	s.mu.Unlock()
+
+	s.err = err
+	close(s.closed)
+}
+
+func compactSecrets(secrets []*models.Secret) []*models.Secret {
+	result := make([]*models.Secret, 0, len(secrets))
+	for _, secret := range secrets {
+		if secret != nil {
+			result = append(result, secret)
+		}
+	}
+	return result
+}
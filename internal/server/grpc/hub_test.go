@@ -0,0 +1,85 @@
+package grpc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/s-turchinskiy/keeper/internal/server/models"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecretsHub(t *testing.T) {
+
+	hub := NewSecretsHub()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	first := hub.Subscribe("user", "session", "1")
+	second := hub.Subscribe("user", "session", "2")
+	other := hub.Subscribe("other user", "session", "3")
+
+	hub.Publish("user", []*models.Secret{{ID: "secret", UserID: "user"}})
+
+	for _, sub := range []*Subscription{first, second} {
+		secrets, err := sub.Next(ctx)
+		require.NoError(t, err)
+		require.Len(t, secrets, 1)
+		require.Equal(t, "secret", secrets[0].ID)
+	}
+
+	otherCtx, otherCancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer otherCancel()
+	_, err := other.Next(otherCtx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	hub.Unsubscribe(first)
+	hub.Unsubscribe(second)
+
+	// изменения без стримов не копятся: новый стрим досылает их по SinceRevision
+	hub.Publish("user", []*models.Secret{{ID: "secret", Hash: "missed"}, nil})
+
+	third := hub.Subscribe("user", "session", "4")
+	thirdCtx, thirdCancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer thirdCancel()
+	_, err = third.Next(thirdCtx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	hub.Publish("user", []*models.Secret{{ID: "secret", Hash: "new"}})
+	secrets, err := third.Next(ctx)
+	require.NoError(t, err)
+	require.Len(t, secrets, 1)
+	require.Equal(t, "new", secrets[0].Hash)
+}
+
+func TestSecretsHubSlowSubscriber(t *testing.T) {
+
+	hub := NewSecretsHub()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	slow := hub.Subscribe("user", "session", "1")
+	fast := hub.Subscribe("user", "session", "2")
+
+	for i := range maxSubscriptionQueue + 1 {
+		hub.Publish("user", []*models.Secret{{ID: "secret", Revision: int64(i)}})
+
+		secrets, err := fast.Next(ctx)
+		require.NoError(t, err)
+		require.Equal(t, int64(i), secrets[0].Revision)
+	}
+
+	// переполненный стрим закрыт и больше не получает изменений, остальные работают
+	_, err := slow.Next(ctx)
+	require.ErrorIs(t, err, ErrSubscriptionOverflow)
+
+	hub.Publish("user", []*models.Secret{{ID: "secret", Hash: "after"}})
+	secrets, err := fast.Next(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "after", secrets[0].Hash)
+
+	// Unsubscribe закрытого стрима ничего не ломает
+	hub.Unsubscribe(slow)
+}
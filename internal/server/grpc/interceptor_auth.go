@@ -12,36 +12,70 @@ import (
 
 type contextKey string
 
-const userIDKey contextKey = "userID"
+const (
+	userIDKey    contextKey = "userID"
+	sessionIDKey contextKey = "sessionID"
+)
 
 func AuthInterceptor(service *service.Service) grpc.UnaryServerInterceptor {
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
 		if info.FullMethod == "/keeper.AuthService/Login" ||
 			info.FullMethod == "/keeper.AuthService/Register" ||
+			info.FullMethod == "/keeper.AuthService/RefreshToken" ||
+			info.FullMethod == "/keeper.AuthService/GetKDFParams" ||
 			info.FullMethod == "/keeper.AuthService/GetConnectionNumber" {
 			return handler(ctx, req)
 		}
 
-		md, ok := metadata.FromIncomingContext(ctx)
-		if !ok {
-			return nil, status.Error(codes.Unauthenticated, "missing metadata")
-		}
-		tokens := md["authorization"]
-		if len(tokens) == 0 {
-			return nil, status.Error(codes.Unauthenticated, "missing authorization token")
+		ctx, err := authenticate(ctx, service)
+		if err != nil {
+			return nil, err
 		}
 
-		token := tokens[0]
-		userID, err := service.TokenManager.ValidateToken(token)
+		return handler(ctx, req)
+	}
+}
+
+func StreamAuthInterceptor(service *service.Service) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authenticate(ss.Context(), service)
 		if err != nil {
-			return nil, status.Error(codes.Unauthenticated, "invalid token")
+			return err
 		}
 
-		ctx = context.WithValue(ctx, userIDKey, userID)
-		return handler(ctx, req)
+		return handler(srv, &serverStreamWithContext{ServerStream: ss, ctx: ctx})
 	}
 }
 
+func authenticate(ctx context.Context, service *service.Service) (context.Context, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "missing metadata")
+	}
+	tokens := md["authorization"]
+	if len(tokens) == 0 {
+		return nil, status.Error(codes.Unauthenticated, "missing authorization token")
+	}
+
+	claims, err := service.Authenticate(ctx, tokens[0])
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "invalid token")
+	}
+
+	ctx = context.WithValue(ctx, userIDKey, claims.UserID)
+	return context.WithValue(ctx, sessionIDKey, claims.SessionID), nil
+}
+
+// serverStreamWithContext подменяет контекст стрима, чтобы передать userID и sessionID в обработчик
+type serverStreamWithContext struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStreamWithContext) Context() context.Context {
+	return s.ctx
+}
+
 func getUserIDFromContext(ctx context.Context) (string, error) {
 	userID, ok := ctx.Value(userIDKey).(string)
 	if !ok {
@@ -50,3 +84,12 @@ func getUserIDFromContext(ctx context.Context) (string, error) {
 
 	return userID, nil
 }
+
+func getSessionIDFromContext(ctx context.Context) (string, error) {
+	sessionID, ok := ctx.Value(sessionIDKey).(string)
+	if !ok {
+		return "", status.Error(codes.Unauthenticated, "session not found in context")
+	}
+
+	return sessionID, nil
+}
@@ -0,0 +1,61 @@
+package grpc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/s-turchinskiy/keeper/internal/server/repository/sqlite"
+	"github.com/s-turchinskiy/keeper/internal/server/service"
+	"github.com/s-turchinskiy/keeper/internal/server/token"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestAuthInterceptorRevokedToken(t *testing.T) {
+
+	ctx := context.Background()
+	db, err := sqlite.NewSQLiteStorage(ctx, ":memory:", sqlite.WithMigrations())
+	require.NoError(t, err)
+	defer db.Close(ctx)
+
+	s := service.NewService(token.NewJWTManager("secret", time.Hour),
+		sqlite.NewUserRepository(db),
+		sqlite.NewSecretRepository(db),
+		sqlite.NewSessionRepository(db),
+		sqlite.NewDeviceRepository(db))
+
+	user, err := s.Register(ctx, "user", "password", nil)
+	require.NoError(t, err)
+	tokens, _, err := s.Login(ctx, "user", "password", nil)
+	require.NoError(t, err)
+
+	interceptor := AuthInterceptor(s)
+	info := &grpc.UnaryServerInfo{FullMethod: "/keeper.SecretService/ListSecrets"}
+	call := func(accessToken string) (any, error) {
+		md := metadata.Pairs("authorization", accessToken)
+		return interceptor(metadata.NewIncomingContext(ctx, md), nil, info, func(ctx context.Context, _ any) (any, error) {
+			return getUserIDFromContext(ctx)
+		})
+	}
+
+	userID, err := call(tokens.AccessToken)
+	require.NoError(t, err)
+	require.Equal(t, user.ID, userID)
+
+	// после выхода jti токена доступа в списке отозванных
+	_, err = s.Logout(ctx, user.ID, tokens.SessionID, false)
+	require.NoError(t, err)
+
+	_, err = call(tokens.AccessToken)
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = call("not a token")
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = interceptor(ctx, nil, info, func(context.Context, any) (any, error) { return nil, nil })
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+}
@@ -45,6 +45,37 @@ func LoggingInterceptor() grpc.UnaryServerInterceptor {
 	}
 }
 
+func StreamLoggingInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+
+		connNumber, err := getConnectionNumber(ss.Context())
+		if err != nil {
+			log.Printf("gRPC stream failed: connection number: %s, method: %s, error: %v",
+				"N/A", info.FullMethod, err)
+			return err
+		}
+
+		log.Printf("gRPC stream opened: connection number: %s, method: %s", connNumber, info.FullMethod)
+
+		start := time.Now()
+
+		err = handler(srv, ss)
+
+		duration := time.Since(start)
+		statusCode := status.Code(err)
+
+		if err != nil {
+			log.Printf("gRPC stream failed: connection number: %s, method: %s, duration: %s, status: %s, error: %v",
+				connNumber, info.FullMethod, duration, statusCode, err)
+		} else {
+			log.Printf("gRPC stream closed: connection number: %s, method: %s,  duration: %s, status: %s",
+				connNumber, info.FullMethod, duration, statusCode)
+		}
+
+		return err
+	}
+}
+
 func getConnectionNumber(ctx context.Context) (string, error) {
 
 	md, ok := metadata.FromIncomingContext(ctx)
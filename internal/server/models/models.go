@@ -1,6 +1,9 @@
 package models
 
-import "time"
+import (
+	"errors"
+	"time"
+)
 
 type Secret struct {
 	ID           string
@@ -9,6 +12,33 @@ type Secret struct {
 	Hash         string
 	Data         []byte
 	Deleted      bool
+	Revision     int64
+}
+
+// SecretVersion предыдущая версия секрета из истории, Version растет с каждым изменением секрета
+type SecretVersion struct {
+	Secret
+	Version int64
+}
+
+// ExpectedVersion версия секрета, относительно которой клиент сделал изменение.
+// Отсутствующий или удаленный секрет имеет пустой хеш и ревизию 0.
+type ExpectedVersion struct {
+	Hash     *string
+	Revision *int64
+}
+
+func (v *ExpectedVersion) Match(hash string, revision int64) bool {
+	if v == nil {
+		return true
+	}
+	if v.Hash != nil && *v.Hash != hash {
+		return false
+	}
+	if v.Revision != nil && *v.Revision != revision {
+		return false
+	}
+	return true
 }
 
 type User struct {
@@ -16,4 +46,81 @@ type User struct {
 	Login        string
 	PasswordHash string
 	CreatedAt    time.Time
+	KDF          *KDFParams
+}
+
+// Session сессия входа с одного устройства. Токен обновления хранится только хешем,
+// AccessTokenID - jti последнего выданного токена доступа, он отзывается при ротации и завершении сессии
+type Session struct {
+	ID               string
+	UserID           string
+	DeviceID         string // "" - сессия клиента, который не сообщил устройство
+	RefreshTokenHash []byte
+	AccessTokenID    string
+	AccessExpiresAt  time.Time
+	CreatedAt        time.Time
+	LastUsedAt       time.Time
+	ExpiresAt        time.Time
+	RevokedAt        *time.Time
+}
+
+// Device устройство пользователя с локальной копией хранилища. ID генерирует клиент и хранит
+// в локальном хранилище, отозванное устройство больше не может войти
+type Device struct {
+	ID            string
+	UserID        string
+	Name          string
+	OS            string
+	ClientVersion string
+	CreatedAt     time.Time
+	LastSeenAt    time.Time
+	RevokedAt     *time.Time
+}
+
+// TwoFactor состояние двухфакторной аутентификации пользователя. PendingSecret - секрет,
+// выданный при подключении и еще не подтвержденный первым кодом; LastStep - последний принятый шаг TOTP,
+// коды этого и более ранних шагов повторно не принимаются
+type TwoFactor struct {
+	Secret            []byte
+	PendingSecret     []byte
+	LastStep          int64
+	RecoveryCodesLeft int
+}
+
+// Enabled вход требует второго фактора
+func (t *TwoFactor) Enabled() bool {
+	return t != nil && len(t.Secret) > 0
+}
+
+// Tokens токен доступа и токен обновления, выданные при входе или ротации
+type Tokens struct {
+	SessionID        string
+	AccessToken      string
+	AccessExpiresAt  time.Time
+	RefreshToken     string
+	RefreshExpiresAt time.Time
+}
+
+const (
+	minKDFSaltSize  = 16
+	minKDFMemoryKiB = 16 * 1024
+)
+
+var ErrInvalidKDFParams = errors.New("invalid kdf params")
+
+// KDFParams соль и параметры Argon2id, которыми клиент выводит ключи из мастер-пароля.
+// У пользователей, зарегистрированных до их появления, параметров нет (nil)
+type KDFParams struct {
+	Salt      []byte
+	Time      uint32
+	MemoryKiB uint32
+	Threads   uint8
+}
+
+// Validate отсекает параметры, с которыми перебор мастер-пароля становится дешевым
+func (p *KDFParams) Validate() error {
+	if p == nil || len(p.Salt) < minKDFSaltSize || p.Time == 0 || p.MemoryKiB < minKDFMemoryKiB || p.Threads == 0 {
+		return ErrInvalidKDFParams
+	}
+	return nil
 }
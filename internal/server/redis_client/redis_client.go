@@ -71,6 +71,21 @@ func (r *RedisClient) Get(ctx context.Context, userID, secretID string) (secret
 	return secret, nil
 }
 
+func (r *RedisClient) Del(ctx context.Context, userID, secretID string) error {
+
+	if r.rdb == nil {
+		return nil
+	}
+
+	err := r.rdb.Del(ctx, r.key(userID, secretID)).Err()
+	if err != nil {
+		fmt.Println(errorsutils.WrapError(err))
+		return err
+	}
+
+	return nil
+}
+
 func (r *RedisClient) key(userID, secretID string) string {
 	return fmt.Sprintf("secret_%s_%s", userID, secretID)
 }
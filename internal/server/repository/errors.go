@@ -0,0 +1,22 @@
+package repository
+
+import "errors"
+
+// Ошибки хранилищ сервера, одинаковые для всех реализаций
+var (
+	ErrUserNotFound = errors.New("user not found")
+	ErrUserExists   = errors.New("user already exists")
+	ErrVaultKeySet  = errors.New("vault key already set")
+
+	ErrTOTPNotPending = errors.New("two-factor enrollment not started")
+
+	ErrSecretNotFound = errors.New("secret not found")
+	ErrSecretConflict = errors.New("secret version conflict")
+
+	ErrSecretVersionNotFound = errors.New("secret version not found")
+
+	ErrSessionNotFound = errors.New("session not found")
+
+	ErrDeviceNotFound = errors.New("device not found")
+	ErrDeviceRevoked  = errors.New("device revoked")
+)
@@ -0,0 +1,146 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/source"
+	"io"
+	"io/fs"
+)
+
+// MigrationStatus миграция из бинарного файла и признак, что она применена к базе
+type MigrationStatus struct {
+	Version    uint
+	Identifier string
+	Applied    bool
+}
+
+// ErrSchemaOutdated в базе применены не все миграции из бинарного файла
+var ErrSchemaOutdated = errors.New("schema out of date, run `keepersrv migrate up`")
+
+// Migrator управляет схемой базы отдельно от запуска сервера
+type Migrator struct {
+	m       *migrate.Migrate
+	source  source.Driver
+	closers []io.Closer
+}
+
+// NewMigrator m - миграции, подключенные к базе, source - те же миграции для просмотра списка,
+// closers закрываются вместе с мигратором после m
+func NewMigrator(m *migrate.Migrate, source source.Driver, closers ...io.Closer) *Migrator {
+	return &Migrator{m: m, source: source, closers: closers}
+}
+
+// Up применяет все новые миграции, если их нет - не ошибка
+func (m *Migrator) Up() error {
+
+	if err := m.m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return err
+	}
+
+	return nil
+}
+
+// Down откатывает steps последних миграций
+func (m *Migrator) Down(steps int) error {
+
+	if steps <= 0 {
+		return fmt.Errorf("steps must be positive, got %d", steps)
+	}
+
+	if err := m.m.Steps(-steps); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return err
+	}
+
+	return nil
+}
+
+// Version текущая версия схемы, 0 если миграции еще не применялись.
+// dirty - последняя миграция упала на середине и схему надо чинить вручную
+func (m *Migrator) Version() (version uint, dirty bool, err error) {
+
+	version, dirty, err = m.m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return 0, false, nil
+	}
+
+	return version, dirty, err
+}
+
+// Status все миграции по возрастанию версии
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+
+	current, _, err := m.Version()
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []MigrationStatus
+
+	version, err := m.source.First()
+	for err == nil {
+		identifier, readErr := m.identifier(version)
+		if readErr != nil {
+			return nil, readErr
+		}
+
+		statuses = append(statuses, MigrationStatus{
+			Version:    version,
+			Identifier: identifier,
+			Applied:    version <= current,
+		})
+
+		version, err = m.source.Next(version)
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	return statuses, nil
+}
+
+// CheckUpToDate ErrSchemaOutdated, если в базе применены не все миграции из бинарного файла
+func (m *Migrator) CheckUpToDate() error {
+
+	version, dirty, err := m.Version()
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return fmt.Errorf("schema version %d is dirty, the last migration failed and needs manual repair", version)
+	}
+
+	statuses, err := m.Status()
+	if err != nil {
+		return err
+	}
+
+	if len(statuses) > 0 && statuses[len(statuses)-1].Version > version {
+		return fmt.Errorf("%w: schema version %d, required %d", ErrSchemaOutdated, version, statuses[len(statuses)-1].Version)
+	}
+
+	return nil
+}
+
+func (m *Migrator) identifier(version uint) (string, error) {
+
+	r, identifier, err := m.source.ReadUp(version)
+	if err != nil {
+		return "", err
+	}
+
+	return identifier, r.Close()
+}
+
+// Close закрывает соединение с базой
+func (m *Migrator) Close() error {
+
+	sourceErr, dbErr := m.m.Close()
+	errs := []error{sourceErr, dbErr, m.source.Close()}
+	for _, closer := range m.closers {
+		errs = append(errs, closer.Close())
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,51 @@
+package repository_test
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/s-turchinskiy/keeper/internal/server/repository/postgres"
+	"github.com/s-turchinskiy/keeper/internal/server/repository/sqlite"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMigrationsMatch у SQLite и PostgreSQL одинаковые версии и имена миграций, у каждой есть откат:
+// иначе migrate status и migrate down на разных базах означают разное
+func TestMigrationsMatch(t *testing.T) {
+
+	postgresSource, err := postgres.MigrationsSource()
+	require.NoError(t, err)
+	sqliteSource, err := sqlite.MigrationsSource()
+	require.NoError(t, err)
+
+	postgresMigrations := listMigrations(t, postgresSource)
+	require.NotEmpty(t, postgresMigrations)
+	require.Equal(t, postgresMigrations, listMigrations(t, sqliteSource))
+}
+
+// listMigrations имена миграций по версиям
+func listMigrations(t *testing.T, driver source.Driver) map[uint]string {
+
+	migrations := make(map[uint]string)
+
+	version, err := driver.First()
+	for err == nil {
+		up, identifier, readErr := driver.ReadUp(version)
+		require.NoError(t, readErr)
+		require.NoError(t, up.Close())
+
+		down, downIdentifier, readErr := driver.ReadDown(version)
+		require.NoError(t, readErr, "migration %d has no down file", version)
+		require.NoError(t, down.Close())
+		require.Equal(t, identifier, downIdentifier)
+
+		migrations[version] = identifier
+		version, err = driver.Next(version)
+	}
+	require.True(t, errors.Is(err, fs.ErrNotExist), "unexpected error: %v", err)
+	require.NoError(t, driver.Close())
+
+	return migrations
+}
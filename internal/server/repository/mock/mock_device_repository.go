@@ -0,0 +1,95 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: github.com/s-turchinskiy/keeper/internal/server/repository (interfaces: DeviceRepositorier)
+
+// Package mockserverrepository is a generated GoMock package.
+package mockserverrepository
+
+import (
+	context "context"
+	reflect "reflect"
+	time "time"
+
+	gomock "github.com/golang/mock/gomock"
+	models "github.com/s-turchinskiy/keeper/internal/server/models"
+)
+
+// MockDeviceRepositorier is a mock of DeviceRepositorier interface.
+type MockDeviceRepositorier struct {
+	ctrl     *gomock.Controller
+	recorder *MockDeviceRepositorierMockRecorder
+}
+
+// MockDeviceRepositorierMockRecorder is the mock recorder for MockDeviceRepositorier.
+type MockDeviceRepositorierMockRecorder struct {
+	mock *MockDeviceRepositorier
+}
+
+// NewMockDeviceRepositorier creates a new mock instance.
+func NewMockDeviceRepositorier(ctrl *gomock.Controller) *MockDeviceRepositorier {
+	mock := &MockDeviceRepositorier{ctrl: ctrl}
+	mock.recorder = &MockDeviceRepositorierMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockDeviceRepositorier) EXPECT() *MockDeviceRepositorierMockRecorder {
+	return m.recorder
+}
+
+// GetAll mocks base method.
+func (m *MockDeviceRepositorier) GetAll(arg0 context.Context, arg1 string) ([]*models.Device, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAll", arg0, arg1)
+	ret0, _ := ret[0].([]*models.Device)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAll indicates an expected call of GetAll.
+func (mr *MockDeviceRepositorierMockRecorder) GetAll(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAll", reflect.TypeOf((*MockDeviceRepositorier)(nil).GetAll), arg0, arg1)
+}
+
+// Register mocks base method.
+func (m *MockDeviceRepositorier) Register(arg0 context.Context, arg1 *models.Device) (*models.Device, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Register", arg0, arg1)
+	ret0, _ := ret[0].(*models.Device)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Register indicates an expected call of Register.
+func (mr *MockDeviceRepositorierMockRecorder) Register(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Register", reflect.TypeOf((*MockDeviceRepositorier)(nil).Register), arg0, arg1)
+}
+
+// Revoke mocks base method.
+func (m *MockDeviceRepositorier) Revoke(arg0 context.Context, arg1, arg2 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Revoke", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Revoke indicates an expected call of Revoke.
+func (mr *MockDeviceRepositorierMockRecorder) Revoke(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Revoke", reflect.TypeOf((*MockDeviceRepositorier)(nil).Revoke), arg0, arg1, arg2)
+}
+
+// Touch mocks base method.
+func (m *MockDeviceRepositorier) Touch(arg0 context.Context, arg1 string, arg2 time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Touch", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Touch indicates an expected call of Touch.
+func (mr *MockDeviceRepositorierMockRecorder) Touch(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Touch", reflect.TypeOf((*MockDeviceRepositorier)(nil).Touch), arg0, arg1, arg2)
+}
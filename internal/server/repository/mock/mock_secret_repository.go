@@ -7,6 +7,7 @@ package mockserverrepository
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 	models "github.com/s-turchinskiy/keeper/internal/server/models"
@@ -49,6 +50,20 @@ func (mr *MockSecretRepositorierMockRecorder) CreateUpdate(arg0, arg1 interface{
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUpdate", reflect.TypeOf((*MockSecretRepositorier)(nil).CreateUpdate), arg0, arg1)
 }
 
+// CreateUpdateIfMatch mocks base method.
+func (m *MockSecretRepositorier) CreateUpdateIfMatch(arg0 context.Context, arg1 *models.Secret, arg2 *models.ExpectedVersion) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateUpdateIfMatch", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateUpdateIfMatch indicates an expected call of CreateUpdateIfMatch.
+func (mr *MockSecretRepositorierMockRecorder) CreateUpdateIfMatch(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUpdateIfMatch", reflect.TypeOf((*MockSecretRepositorier)(nil).CreateUpdateIfMatch), arg0, arg1, arg2)
+}
+
 // Delete mocks base method.
 func (m *MockSecretRepositorier) Delete(arg0 context.Context, arg1, arg2 string) error {
 	m.ctrl.T.Helper()
@@ -108,6 +123,111 @@ func (mr *MockSecretRepositorierMockRecorder) GetByID(arg0, arg1, arg2 interface
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByID", reflect.TypeOf((*MockSecretRepositorier)(nil).GetByID), arg0, arg1, arg2)
 }
 
+// GetChangesSince mocks base method.
+func (m *MockSecretRepositorier) GetChangesSince(arg0 context.Context, arg1 string, arg2 int64) ([]*models.Secret, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetChangesSince", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]*models.Secret)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetChangesSince indicates an expected call of GetChangesSince.
+func (mr *MockSecretRepositorierMockRecorder) GetChangesSince(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetChangesSince", reflect.TypeOf((*MockSecretRepositorier)(nil).GetChangesSince), arg0, arg1, arg2)
+}
+
+// GetDeleted mocks base method.
+func (m *MockSecretRepositorier) GetDeleted(arg0 context.Context, arg1 string) ([]*models.Secret, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetDeleted", arg0, arg1)
+	ret0, _ := ret[0].([]*models.Secret)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetDeleted indicates an expected call of GetDeleted.
+func (mr *MockSecretRepositorierMockRecorder) GetDeleted(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDeleted", reflect.TypeOf((*MockSecretRepositorier)(nil).GetDeleted), arg0, arg1)
+}
+
+// GetVersion mocks base method.
+func (m *MockSecretRepositorier) GetVersion(arg0 context.Context, arg1, arg2 string, arg3 int64) (*models.SecretVersion, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetVersion", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(*models.SecretVersion)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetVersion indicates an expected call of GetVersion.
+func (mr *MockSecretRepositorierMockRecorder) GetVersion(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetVersion", reflect.TypeOf((*MockSecretRepositorier)(nil).GetVersion), arg0, arg1, arg2, arg3)
+}
+
+// GetVersions mocks base method.
+func (m *MockSecretRepositorier) GetVersions(arg0 context.Context, arg1, arg2 string) ([]*models.SecretVersion, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetVersions", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]*models.SecretVersion)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetVersions indicates an expected call of GetVersions.
+func (mr *MockSecretRepositorierMockRecorder) GetVersions(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetVersions", reflect.TypeOf((*MockSecretRepositorier)(nil).GetVersions), arg0, arg1, arg2)
+}
+
+// PurgeDeleted mocks base method.
+func (m *MockSecretRepositorier) PurgeDeleted(arg0 context.Context, arg1 string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PurgeDeleted", arg0, arg1)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PurgeDeleted indicates an expected call of PurgeDeleted.
+func (mr *MockSecretRepositorierMockRecorder) PurgeDeleted(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PurgeDeleted", reflect.TypeOf((*MockSecretRepositorier)(nil).PurgeDeleted), arg0, arg1)
+}
+
+// PurgeExpired mocks base method.
+func (m *MockSecretRepositorier) PurgeExpired(arg0 context.Context, arg1 time.Time) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PurgeExpired", arg0, arg1)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PurgeExpired indicates an expected call of PurgeExpired.
+func (mr *MockSecretRepositorierMockRecorder) PurgeExpired(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PurgeExpired", reflect.TypeOf((*MockSecretRepositorier)(nil).PurgeExpired), arg0, arg1)
+}
+
+// Rekey mocks base method.
+func (m *MockSecretRepositorier) Rekey(arg0 context.Context, arg1 string, arg2 []*models.SecretVersion) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Rekey", arg0, arg1, arg2)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Rekey indicates an expected call of Rekey.
+func (mr *MockSecretRepositorierMockRecorder) Rekey(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Rekey", reflect.TypeOf((*MockSecretRepositorier)(nil).Rekey), arg0, arg1, arg2)
+}
+
 // TruncateAllTabs mocks base method.
 func (m *MockSecretRepositorier) TruncateAllTabs(arg0 context.Context) error {
 	m.ctrl.T.Helper()
@@ -121,3 +241,18 @@ func (mr *MockSecretRepositorierMockRecorder) TruncateAllTabs(arg0 interface{})
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TruncateAllTabs", reflect.TypeOf((*MockSecretRepositorier)(nil).TruncateAllTabs), arg0)
 }
+
+// Undelete mocks base method.
+func (m *MockSecretRepositorier) Undelete(arg0 context.Context, arg1, arg2 string) (*models.Secret, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Undelete", arg0, arg1, arg2)
+	ret0, _ := ret[0].(*models.Secret)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Undelete indicates an expected call of Undelete.
+func (mr *MockSecretRepositorierMockRecorder) Undelete(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Undelete", reflect.TypeOf((*MockSecretRepositorier)(nil).Undelete), arg0, arg1, arg2)
+}
@@ -1,4 +1,4 @@
-DROP TABLE IF EXISTS keeper.secrets;
+DROP TABLE IF EXISTS keeper.secrets_statuses;
 DROP TABLE IF EXISTS keeper.secrets;
 DROP TABLE IF EXISTS keeper.users;
 DROP TYPE IF EXISTS keeper.secret_status;
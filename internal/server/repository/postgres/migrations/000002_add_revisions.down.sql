@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS keeper.idx_secrets_statuses_user_id_revision;
+ALTER TABLE keeper.secrets_statuses DROP COLUMN IF EXISTS revision;
+ALTER TABLE keeper.users DROP COLUMN IF EXISTS revision;
@@ -0,0 +1,16 @@
+ALTER TABLE keeper.users
+    ADD COLUMN IF NOT EXISTS revision BIGINT NOT NULL DEFAULT 0;
+
+ALTER TABLE keeper.secrets_statuses
+    ADD COLUMN IF NOT EXISTS revision BIGINT NOT NULL DEFAULT 0;
+
+UPDATE keeper.secrets_statuses st
+SET revision = r.revision
+FROM (SELECT id, ROW_NUMBER() OVER (PARTITION BY user_id ORDER BY last_modified, id) AS revision
+      FROM keeper.secrets_statuses) r
+WHERE st.id = r.id;
+
+UPDATE keeper.users u
+SET revision = COALESCE((SELECT MAX(st.revision) FROM keeper.secrets_statuses st WHERE st.user_id = u.id), 0);
+
+CREATE INDEX IF NOT EXISTS idx_secrets_statuses_user_id_revision ON keeper.secrets_statuses (user_id, revision);
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS keeper.secrets_history
+(
+    id            SERIAL PRIMARY KEY,
+    name          VARCHAR(255) NOT NULL,
+    user_id       UUID         NOT NULL REFERENCES keeper.users (id) ON DELETE CASCADE,
+    version       BIGINT       NOT NULL,
+    hash          VARCHAR(255) NOT NULL,
+    data          BYTEA        NOT NULL,
+    last_modified TIMESTAMP    NOT NULL,
+    revision      BIGINT       NOT NULL DEFAULT 0,
+    archived_at   TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE keeper.secrets_history
+    ADD CONSTRAINT secrets_history_name_user_id_version_key UNIQUE (name, user_id, version);
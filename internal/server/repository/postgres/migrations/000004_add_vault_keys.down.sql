@@ -0,0 +1,2 @@
+ALTER TABLE keeper.users
+    DROP COLUMN IF EXISTS vault_key;
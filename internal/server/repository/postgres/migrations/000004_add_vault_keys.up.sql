@@ -0,0 +1,2 @@
+ALTER TABLE keeper.users
+    ADD COLUMN IF NOT EXISTS vault_key BYTEA;
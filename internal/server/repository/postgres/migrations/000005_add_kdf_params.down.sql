@@ -0,0 +1,5 @@
+ALTER TABLE keeper.users
+    DROP COLUMN IF EXISTS kdf_salt,
+    DROP COLUMN IF EXISTS kdf_time,
+    DROP COLUMN IF EXISTS kdf_memory_kib,
+    DROP COLUMN IF EXISTS kdf_threads;
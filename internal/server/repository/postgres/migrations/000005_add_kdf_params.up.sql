@@ -0,0 +1,5 @@
+ALTER TABLE keeper.users
+    ADD COLUMN IF NOT EXISTS kdf_salt BYTEA,
+    ADD COLUMN IF NOT EXISTS kdf_time INTEGER,
+    ADD COLUMN IF NOT EXISTS kdf_memory_kib INTEGER,
+    ADD COLUMN IF NOT EXISTS kdf_threads SMALLINT;
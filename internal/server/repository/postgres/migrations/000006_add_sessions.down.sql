@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS keeper.revoked_tokens;
+DROP TABLE IF EXISTS keeper.sessions;
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS keeper.sessions
+(
+    id                 UUID PRIMARY KEY,
+    user_id            UUID      NOT NULL REFERENCES keeper.users (id) ON DELETE CASCADE,
+    refresh_token_hash BYTEA     NOT NULL,
+    access_token_id    UUID      NOT NULL,
+    access_expires_at  TIMESTAMP NOT NULL,
+    created_at         TIMESTAMP NOT NULL,
+    last_used_at       TIMESTAMP NOT NULL,
+    expires_at         TIMESTAMP NOT NULL,
+    revoked_at         TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON keeper.sessions (user_id);
+
+CREATE TABLE IF NOT EXISTS keeper.revoked_tokens
+(
+    token_id   UUID PRIMARY KEY,
+    expires_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,4 @@
+ALTER TABLE keeper.sessions
+    DROP COLUMN IF EXISTS device_id;
+
+DROP TABLE IF EXISTS keeper.devices;
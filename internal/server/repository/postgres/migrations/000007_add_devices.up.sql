@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS keeper.devices
+(
+    id             UUID PRIMARY KEY,
+    user_id        UUID      NOT NULL REFERENCES keeper.users (id) ON DELETE CASCADE,
+    name           TEXT      NOT NULL,
+    os             TEXT      NOT NULL,
+    client_version TEXT      NOT NULL,
+    created_at     TIMESTAMP NOT NULL,
+    last_seen_at   TIMESTAMP NOT NULL,
+    revoked_at     TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_devices_user_id ON keeper.devices (user_id);
+
+ALTER TABLE keeper.sessions
+    ADD COLUMN IF NOT EXISTS device_id UUID REFERENCES keeper.devices (id) ON DELETE CASCADE;
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS keeper.recovery_codes;
+
+ALTER TABLE keeper.users
+    DROP COLUMN IF EXISTS totp_last_step,
+    DROP COLUMN IF EXISTS totp_pending_secret,
+    DROP COLUMN IF EXISTS totp_secret;
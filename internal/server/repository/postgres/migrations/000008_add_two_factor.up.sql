@@ -0,0 +1,14 @@
+ALTER TABLE keeper.users
+    ADD COLUMN IF NOT EXISTS totp_secret BYTEA,
+    ADD COLUMN IF NOT EXISTS totp_pending_secret BYTEA,
+    ADD COLUMN IF NOT EXISTS totp_last_step BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS keeper.recovery_codes
+(
+    id        SERIAL PRIMARY KEY,
+    user_id   UUID  NOT NULL REFERENCES keeper.users (id) ON DELETE CASCADE,
+    code_hash BYTEA NOT NULL,
+    used_at   TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_recovery_codes_user_id ON keeper.recovery_codes (user_id);
@@ -2,14 +2,17 @@ package postgres
 
 import (
 	"context"
-	"errors"
+	"database/sql"
+	"embed"
 	"fmt"
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/postgres"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
 	"github.com/jackc/pgx/v5/pgxpool"
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/jmoiron/sqlx"
+	"github.com/s-turchinskiy/keeper/internal/server/repository"
 	"github.com/s-turchinskiy/keeper/internal/utils/errorsutils"
 	"log"
 	"time"
@@ -17,12 +20,19 @@ import (
 
 const schemaName = "keeper"
 
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+type OptionStorage func(*PostgreDB)
+
 type PostgreDB struct {
-	db   *sqlx.DB
-	pool *pgxpool.Pool
+	db      *sqlx.DB
+	pool    *pgxpool.Pool
+	migrate bool
 }
 
-func NewPostgresStorage(ctx context.Context, addr string) (*PostgreDB, error) {
+// NewPostgresStorage подключается к базе addr. Схема не меняется, если не задан WithMigrations
+func NewPostgresStorage(ctx context.Context, addr string, opts ...OptionStorage) (*PostgreDB, error) {
 
 	db, err := sqlx.Open("pgx", addr)
 	if err != nil {
@@ -44,26 +54,121 @@ func NewPostgresStorage(ctx context.Context, addr string) (*PostgreDB, error) {
 
 	p := &PostgreDB{db: db, pool: pool}
 
-	_, err = p.db.ExecContext(ctx, fmt.Sprintf(`CREATE SCHEMA IF NOT EXISTS %s`, schemaName))
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	if p.migrate {
+		if err = p.migrateUp(ctx); err != nil {
+			p.Close(ctx)
+			return nil, err
+		}
+	}
+
+	return p, nil
+
+}
+
+// WithMigrations применяет новые миграции при подключении, так базу открывает только serve
+func WithMigrations() OptionStorage {
+	return func(p *PostgreDB) {
+		p.migrate = true
+	}
+}
+
+// migrateUp применяет миграции в отдельном соединении из пула хранилища и возвращает его в пул
+func (p *PostgreDB) migrateUp(ctx context.Context) error {
+
+	conn, err := p.db.DB.Conn(ctx)
+	if err != nil {
+		return errorsutils.WrapError(err)
+	}
+
+	migrator, err := newMigrator(ctx, conn, nil)
 	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+	defer func() {
+		if err := migrator.Close(); err != nil {
+			log.Println(err)
+		}
+	}()
+
+	if err = migrator.Up(); err != nil {
+		return errorsutils.WrapError(err)
+	}
+
+	return nil
+}
+
+// NewMigrator миграции схемы без запуска сервера, соединение закрывается через Close мигратора
+func NewMigrator(ctx context.Context, addr string) (*repository.Migrator, error) {
+
+	db, err := sql.Open("pgx", addr)
+	if err != nil {
+		return nil, errorsutils.WrapError(err)
+	}
+	if err = db.PingContext(ctx); err != nil {
+		_ = db.Close()
 		return nil, errorsutils.WrapError(err)
 	}
 
-	driver, err := postgres.WithInstance(db.DB, &postgres.Config{SchemaName: schemaName})
+	conn, err := db.Conn(ctx)
 	if err != nil {
+		_ = db.Close()
 		return nil, errorsutils.WrapError(err)
 	}
 
-	m, err := migrate.NewWithDatabaseInstance("file://internal/server/repository/postgres/migrations", "postgres", driver)
+	migrator, err := newMigrator(ctx, conn, db)
 	if err != nil {
+		_ = conn.Close()
+		_ = db.Close()
 		return nil, err
 	}
-	if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+
+	return migrator, nil
+}
+
+// MigrationsSource миграции PostgreSQL из бинарного файла. Версии и имена миграций у всех диалектов общие
+func MigrationsSource() (source.Driver, error) {
+	return iofs.New(migrations, "migrations")
+}
+
+// newMigrator миграции из бинарного файла для схемы schemaName в соединении conn.
+// Close мигратора закрывает conn и db, если она задана
+func newMigrator(ctx context.Context, conn *sql.Conn, db *sql.DB) (*repository.Migrator, error) {
+
+	_, err := conn.ExecContext(ctx, fmt.Sprintf(`CREATE SCHEMA IF NOT EXISTS %s`, schemaName))
+	if err != nil {
 		return nil, errorsutils.WrapError(err)
 	}
 
-	return p, nil
+	driver, err := postgres.WithConnection(ctx, conn, &postgres.Config{SchemaName: schemaName})
+	if err != nil {
+		return nil, errorsutils.WrapError(err)
+	}
+
+	source, err := MigrationsSource()
+	if err != nil {
+		return nil, errorsutils.WrapError(err)
+	}
+
+	m, err := migrate.NewWithInstance("iofs", source, "postgres", driver)
+	if err != nil {
+		return nil, errorsutils.WrapError(err)
+	}
+
+	listing, err := MigrationsSource()
+	if err != nil {
+		return nil, errorsutils.WrapError(err)
+	}
+
+	if db == nil {
+		return repository.NewMigrator(m, listing), nil
+	}
 
+	return repository.NewMigrator(m, listing, db), nil
 }
 
 func (p *PostgreDB) Close(ctx context.Context) {
@@ -0,0 +1,279 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/s-turchinskiy/keeper/internal/server/models"
+	"github.com/s-turchinskiy/keeper/internal/server/repository"
+	"github.com/s-turchinskiy/keeper/internal/utils/errorsutils"
+	"time"
+)
+
+var ErrSessionNotFound = repository.ErrSessionNotFound
+
+type SessionRepository struct {
+	db *sqlx.DB
+}
+
+func NewSessionRepository(postgreDB *PostgreDB) *SessionRepository {
+	return &SessionRepository{
+		db: postgreDB.db,
+	}
+}
+
+const sessionColumns = `id, user_id, refresh_token_hash, access_token_id, access_expires_at, created_at, last_used_at, expires_at, revoked_at`
+
+// sessionDeviceColumn сессии, созданные до реестра устройств, без устройства
+const sessionDeviceColumn = `COALESCE(device_id::text, '')`
+
+func (r *SessionRepository) Create(ctx context.Context, session *models.Session) error {
+	query := `
+		INSERT INTO keeper.sessions (` + sessionColumns + `, device_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULL, NULLIF($9, '')::uuid)
+	`
+
+	_, err := r.db.ExecContext(ctx, query,
+		session.ID,
+		session.UserID,
+		session.RefreshTokenHash,
+		session.AccessTokenID,
+		session.AccessExpiresAt,
+		session.CreatedAt,
+		session.LastUsedAt,
+		session.ExpiresAt,
+		session.DeviceID,
+	)
+	if err != nil {
+		return errorsutils.WrapError(err)
+	}
+
+	return nil
+}
+
+func (r *SessionRepository) GetByID(ctx context.Context, sessionID string) (*models.Session, error) {
+	query := `
+		SELECT ` + sessionColumns + `, ` + sessionDeviceColumn + `
+		FROM keeper.sessions
+		WHERE id = $1
+	`
+
+	var session models.Session
+	err := r.db.QueryRowContext(ctx, query, sessionID).Scan(
+		&session.ID,
+		&session.UserID,
+		&session.RefreshTokenHash,
+		&session.AccessTokenID,
+		&session.AccessExpiresAt,
+		&session.CreatedAt,
+		&session.LastUsedAt,
+		&session.ExpiresAt,
+		&session.RevokedAt,
+		&session.DeviceID,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, errorsutils.WrapError(err)
+	}
+
+	return &session, nil
+}
+
+// Rotate заменяет токены сессии на next, только если сессия не отозвана и ее токен обновления
+// все еще previous.RefreshTokenHash. Токен доступа previous отзывается
+func (r *SessionRepository) Rotate(ctx context.Context, previous, next *models.Session) error {
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer rollback(tx)
+
+	query := `
+		UPDATE keeper.sessions
+		SET refresh_token_hash = $3, access_token_id = $4, access_expires_at = $5, last_used_at = $6, expires_at = $7
+		WHERE id = $1 AND refresh_token_hash = $2 AND revoked_at IS NULL
+	`
+
+	result, err := tx.ExecContext(ctx, query,
+		previous.ID,
+		previous.RefreshTokenHash,
+		next.RefreshTokenHash,
+		next.AccessTokenID,
+		next.AccessExpiresAt,
+		next.LastUsedAt,
+		next.ExpiresAt,
+	)
+	if err != nil {
+		return errorsutils.WrapError(err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return errorsutils.WrapError(err)
+	}
+	if affected == 0 {
+		return ErrSessionNotFound
+	}
+
+	err = revokeToken(ctx, tx, previous.AccessTokenID, previous.AccessExpiresAt)
+	if err != nil {
+		return errorsutils.WrapError(err)
+	}
+
+	return tx.Commit()
+}
+
+// Revoke завершает сессию пользователя и отзывает ее токен доступа
+func (r *SessionRepository) Revoke(ctx context.Context, userID, sessionID string) error {
+
+	revoked, err := r.revoke(ctx, `user_id = $2 AND id = $3`, userID, sessionID)
+	if err != nil {
+		return err
+	}
+
+	if len(revoked) == 0 {
+		return ErrSessionNotFound
+	}
+
+	return nil
+}
+
+// RevokeAll завершает все активные сессии пользователя
+func (r *SessionRepository) RevokeAll(ctx context.Context, userID string) (int64, error) {
+
+	revoked, err := r.revoke(ctx, `user_id = $2`, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(len(revoked)), nil
+}
+
+// RevokeDevice завершает активные сессии устройства, возвращает их ID
+func (r *SessionRepository) RevokeDevice(ctx context.Context, userID, deviceID string) ([]string, error) {
+	return r.revoke(ctx, `user_id = $2 AND device_id = $3`, userID, deviceID)
+}
+
+func (r *SessionRepository) IsTokenRevoked(ctx context.Context, tokenID string) (bool, error) {
+	query := `
+		SELECT EXISTS (SELECT 1 FROM keeper.revoked_tokens WHERE token_id = $1)
+	`
+
+	var revoked bool
+	err := r.db.QueryRowContext(ctx, query, tokenID).Scan(&revoked)
+	if err != nil {
+		return false, errorsutils.WrapError(err)
+	}
+
+	return revoked, nil
+}
+
+// PurgeExpired удаляет истекшие и отозванные до before сессии и отозванные токены, которые уже истекли сами
+func (r *SessionRepository) PurgeExpired(ctx context.Context, before time.Time) (int64, error) {
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer rollback(tx)
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM keeper.revoked_tokens WHERE expires_at < $1`, before)
+	if err != nil {
+		return 0, errorsutils.WrapError(err)
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM keeper.sessions WHERE expires_at < $1 OR revoked_at < $1`, before)
+	if err != nil {
+		return 0, errorsutils.WrapError(err)
+	}
+
+	purged, err := result.RowsAffected()
+	if err != nil {
+		return 0, errorsutils.WrapError(err)
+	}
+
+	return purged, tx.Commit()
+}
+
+// revoke отзывает активные сессии по condition и возвращает их ID, $1 занят временем отзыва
+func (r *SessionRepository) revoke(ctx context.Context, condition string, args ...any) ([]string, error) {
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer rollback(tx)
+
+	query := `
+		UPDATE keeper.sessions
+		SET revoked_at = $1
+		WHERE revoked_at IS NULL AND ` + condition + `
+		RETURNING id, access_token_id, access_expires_at
+	`
+
+	rows, err := tx.QueryContext(ctx, query, append([]any{time.Now().UTC()}, args...)...)
+	if err != nil {
+		return nil, errorsutils.WrapError(err)
+	}
+
+	type accessToken struct {
+		id        string
+		expiresAt time.Time
+	}
+
+	var (
+		sessionIDs []string
+		tokens     []accessToken
+	)
+	for rows.Next() {
+		var (
+			sessionID string
+			token     accessToken
+		)
+		if err = rows.Scan(&sessionID, &token.id, &token.expiresAt); err != nil {
+			_ = rows.Close()
+			return nil, errorsutils.WrapError(err)
+		}
+		sessionIDs = append(sessionIDs, sessionID)
+		tokens = append(tokens, token)
+	}
+	if err = rows.Close(); err != nil {
+		return nil, errorsutils.WrapError(err)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, errorsutils.WrapError(err)
+	}
+
+	for _, token := range tokens {
+		if err = revokeToken(ctx, tx, token.id, token.expiresAt); err != nil {
+			return nil, errorsutils.WrapError(err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return sessionIDs, nil
+}
+
+// revokeToken запоминает jti до истечения токена, после этого он отклоняется и без списка
+func revokeToken(ctx context.Context, tx *sql.Tx, tokenID string, expiresAt time.Time) error {
+	query := `
+		INSERT INTO keeper.revoked_tokens (token_id, expires_at)
+		VALUES ($1, $2)
+		ON CONFLICT (token_id) DO NOTHING
+	`
+
+	_, err := tx.ExecContext(ctx, query, tokenID, expiresAt)
+	if err != nil {
+		return fmt.Errorf("revoke token %s: %w", tokenID, err)
+	}
+
+	return nil
+}
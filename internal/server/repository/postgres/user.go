@@ -2,16 +2,19 @@ package postgres
 
 import (
 	"context"
-	"errors"
+	"database/sql"
+	"fmt"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/jmoiron/sqlx"
 
 	"github.com/s-turchinskiy/keeper/internal/server/models"
+	"github.com/s-turchinskiy/keeper/internal/server/repository"
 )
 
 var (
-	ErrUserNotFound = errors.New("user not found")
-	ErrUserExists   = errors.New("user already exists")
+	ErrUserNotFound = repository.ErrUserNotFound
+	ErrUserExists   = repository.ErrUserExists
+	ErrVaultKeySet  = repository.ErrVaultKeySet
 )
 
 type UserRepository struct {
@@ -26,68 +29,229 @@ func NewUserRepository(postgreDB *PostgreDB) *UserRepository {
 	}
 }
 
-func (r *UserRepository) Create(ctx context.Context, login, passwordHash string) (*models.User, error) {
-	query := `
-		INSERT INTO keeper.users (login, password_hash) 
-		VALUES ($1, $2) 
-		RETURNING id, login, password_hash, created_at
-	`
+const userColumns = `id, login, password_hash, created_at, kdf_salt, kdf_time, kdf_memory_kib, kdf_threads`
 
-	var user models.User
-	err := r.db.QueryRowContext(ctx, query, login, passwordHash).Scan(
-		&user.ID,
-		&user.Login,
-		&user.PasswordHash,
-		&user.CreatedAt,
-	)
+func (r *UserRepository) Create(ctx context.Context, login, passwordHash string, kdf *models.KDFParams) (*models.User, error) {
+	query := `
+		INSERT INTO keeper.users (login, password_hash, kdf_salt, kdf_time, kdf_memory_kib, kdf_threads) 
+		VALUES ($1, $2, $3, $4, $5, $6) 
+		RETURNING ` + userColumns
 
+	salt, iterations, memory, threads := kdfArgs(kdf)
+	user, err := scanUser(r.db.QueryRowContext(ctx, query, login, passwordHash, salt, iterations, memory, threads))
 	if err != nil {
 		return nil, err
 	}
 
-	return &user, nil
+	return user, nil
 }
 
 func (r *UserRepository) GetByLogin(ctx context.Context, login string) (*models.User, error) {
 	query := `
-		SELECT id, login, password_hash, created_at
+		SELECT ` + userColumns + `
 		FROM keeper.users
 		WHERE login = $1
 	`
 
-	var user models.User
-	err := r.db.QueryRowContext(ctx, query, login).Scan(
-		&user.ID,
-		&user.Login,
-		&user.PasswordHash,
-		&user.CreatedAt,
-	)
-
+	user, err := scanUser(r.db.QueryRowContext(ctx, query, login))
 	if err != nil {
 		return nil, ErrUserNotFound
 	}
 
-	return &user, nil
+	return user, nil
 }
 
 func (r *UserRepository) GetByID(ctx context.Context, userID string) (*models.User, error) {
 	query := `
-		SELECT id, login, password_hash, created_at
+		SELECT ` + userColumns + `
+		FROM keeper.users
+		WHERE id = $1
+	`
+
+	user, err := scanUser(r.db.QueryRowContext(ctx, query, userID))
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	return user, nil
+}
+
+// GetVaultKey зашифрованный ключ хранилища пользователя, nil если клиент еще не создал ключ
+func (r *UserRepository) GetVaultKey(ctx context.Context, userID string) ([]byte, error) {
+	query := `
+		SELECT vault_key
 		FROM keeper.users
 		WHERE id = $1
 	`
 
-	var user models.User
-	err := r.db.QueryRowContext(ctx, query, userID).Scan(
+	var vaultKey []byte
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(&vaultKey)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	return vaultKey, nil
+}
+
+// SetVaultKey сохраняет зашифрованный ключ хранилища. Без replace существующий ключ не перезаписывается,
+// чтобы два устройства не создали разные ключи одновременно
+func (r *UserRepository) SetVaultKey(ctx context.Context, userID string, vaultKey []byte, replace bool) error {
+	query := `
+		UPDATE keeper.users
+		SET vault_key = $2
+		WHERE id = $1 AND (vault_key IS NULL OR $3)
+	`
+
+	result, err := r.db.ExecContext(ctx, query, userID, vaultKey, replace)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		if _, err = r.GetByID(ctx, userID); err != nil {
+			return err
+		}
+		return ErrVaultKeySet
+	}
+
+	return nil
+}
+
+// UpdateCredentials меняет хеш пароля, параметры KDF и зашифрованный новым паролем ключ хранилища одной командой
+func (r *UserRepository) UpdateCredentials(ctx context.Context, userID, passwordHash string, vaultKey []byte, kdf *models.KDFParams) error {
+	query := `
+		UPDATE keeper.users
+		SET password_hash = $2, vault_key = $3,
+		    kdf_salt = $4, kdf_time = $5, kdf_memory_kib = $6, kdf_threads = $7
+		WHERE id = $1
+	`
+
+	salt, iterations, memory, threads := kdfArgs(kdf)
+	result, err := r.db.ExecContext(ctx, query, userID, passwordHash, vaultKey, salt, iterations, memory, threads)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// GetAll все пользователи в порядке регистрации
+func (r *UserRepository) GetAll(ctx context.Context) ([]*models.User, error) {
+	query := `
+		SELECT ` + userColumns + `
+		FROM keeper.users
+		ORDER BY created_at, login
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			fmt.Println(err)
+		}
+	}(rows)
+
+	var users []*models.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
+// Delete удаляет пользователя, его секреты и история удаляются каскадно
+func (r *UserRepository) Delete(ctx context.Context, userID string) error {
+	query := `
+		DELETE FROM keeper.users
+		WHERE id = $1
+	`
+
+	result, err := r.db.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// rowScanner одна строка результата, *sql.Row или *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanUser(row rowScanner) (*models.User, error) {
+	var (
+		user       models.User
+		salt       []byte
+		iterations sql.NullInt64
+		memory     sql.NullInt64
+		threads    sql.NullInt64
+	)
+
+	err := row.Scan(
 		&user.ID,
 		&user.Login,
 		&user.PasswordHash,
 		&user.CreatedAt,
+		&salt,
+		&iterations,
+		&memory,
+		&threads,
 	)
-
 	if err != nil {
-		return nil, ErrUserNotFound
+		return nil, err
+	}
+
+	if len(salt) > 0 {
+		user.KDF = &models.KDFParams{
+			Salt:      salt,
+			Time:      uint32(iterations.Int64),
+			MemoryKiB: uint32(memory.Int64),
+			Threads:   uint8(threads.Int64),
+		}
 	}
 
 	return &user, nil
 }
+
+// kdfArgs значения колонок kdf_*, для nil все колонки NULL
+func kdfArgs(kdf *models.KDFParams) (salt []byte, iterations, memory, threads sql.NullInt64) {
+	if kdf == nil {
+		return nil, iterations, memory, threads
+	}
+
+	return kdf.Salt,
+		sql.NullInt64{Int64: int64(kdf.Time), Valid: true},
+		sql.NullInt64{Int64: int64(kdf.MemoryKiB), Valid: true},
+		sql.NullInt64{Int64: int64(kdf.Threads), Valid: true}
+}
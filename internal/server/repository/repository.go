@@ -3,22 +3,67 @@ package repository
 import (
 	"context"
 	"github.com/s-turchinskiy/keeper/internal/server/models"
+	"time"
 )
 
+// DefaultHistoryRetention сколько предыдущих версий секрета хранится по умолчанию
+const DefaultHistoryRetention = 10
+
 type DBer interface {
 	Close(ctx context.Context)
 }
 type UserRepositorier interface {
-	Create(ctx context.Context, login, passwordHash string) (*models.User, error)
+	Create(ctx context.Context, login, passwordHash string, kdf *models.KDFParams) (*models.User, error)
 	GetByID(ctx context.Context, userID string) (*models.User, error)
 	GetByLogin(ctx context.Context, login string) (*models.User, error)
+	GetVaultKey(ctx context.Context, userID string) ([]byte, error)
+	SetVaultKey(ctx context.Context, userID string, vaultKey []byte, replace bool) error
+	UpdateCredentials(ctx context.Context, userID, passwordHash string, vaultKey []byte, kdf *models.KDFParams) error
+	GetAll(ctx context.Context) ([]*models.User, error)
+	Delete(ctx context.Context, userID string) error
+
+	GetTwoFactor(ctx context.Context, userID string) (*models.TwoFactor, error)
+	SetPendingTOTP(ctx context.Context, userID string, secret []byte) error
+	EnableTOTP(ctx context.Context, userID string, secret []byte, step int64, recoveryCodeHashes [][]byte) error
+	DisableTOTP(ctx context.Context, userID string) error
+	UseTOTPStep(ctx context.Context, userID string, step int64) (bool, error)
+	UseRecoveryCode(ctx context.Context, userID string, codeHash []byte) (bool, error)
 }
 
 type SecretRepositorier interface {
 	CreateUpdate(ctx context.Context, secret *models.Secret) error
+	CreateUpdateIfMatch(ctx context.Context, secret *models.Secret, expected *models.ExpectedVersion) error
 	GetByID(ctx context.Context, userID, secretID string) (*models.Secret, error)
 	Delete(ctx context.Context, userID, secretID string) error
+	Undelete(ctx context.Context, userID, secretID string) (*models.Secret, error)
+	GetDeleted(ctx context.Context, userID string) ([]*models.Secret, error)
+	PurgeDeleted(ctx context.Context, userID string) (int64, error)
+	PurgeExpired(ctx context.Context, before time.Time) (int64, error)
 	GetAll(ctx context.Context, userID string) ([]*models.Secret, error)
 	GetAllWithStatuses(ctx context.Context, userID string) ([]*models.Secret, error)
+	GetChangesSince(ctx context.Context, userID string, revision int64) ([]*models.Secret, error)
+	GetVersions(ctx context.Context, userID, secretID string) ([]*models.SecretVersion, error)
+	GetVersion(ctx context.Context, userID, secretID string, version int64) (*models.SecretVersion, error)
+	Rekey(ctx context.Context, userID string, versions []*models.SecretVersion) (int64, error)
 	TruncateAllTabs(ctx context.Context) error
 }
+
+// SessionRepositorier сессии входа и отозванные токены доступа
+type SessionRepositorier interface {
+	Create(ctx context.Context, session *models.Session) error
+	GetByID(ctx context.Context, sessionID string) (*models.Session, error)
+	Rotate(ctx context.Context, previous, next *models.Session) error
+	Revoke(ctx context.Context, userID, sessionID string) error
+	RevokeAll(ctx context.Context, userID string) (int64, error)
+	RevokeDevice(ctx context.Context, userID, deviceID string) ([]string, error)
+	IsTokenRevoked(ctx context.Context, tokenID string) (bool, error)
+	PurgeExpired(ctx context.Context, before time.Time) (int64, error)
+}
+
+// DeviceRepositorier устройства пользователей
+type DeviceRepositorier interface {
+	Register(ctx context.Context, device *models.Device) (*models.Device, error)
+	GetAll(ctx context.Context, userID string) ([]*models.Device, error)
+	Touch(ctx context.Context, deviceID string, seenAt time.Time) error
+	Revoke(ctx context.Context, userID, deviceID string) error
+}
@@ -0,0 +1,145 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"github.com/s-turchinskiy/keeper/internal/server/models"
+	"github.com/s-turchinskiy/keeper/internal/server/repository"
+	"github.com/s-turchinskiy/keeper/internal/utils/errorsutils"
+	"time"
+)
+
+type DeviceRepository struct {
+	db *sqlx.DB
+}
+
+func NewDeviceRepository(sqliteDB *SQLiteDB) *DeviceRepository {
+	return &DeviceRepository{
+		db: sqliteDB.db,
+	}
+}
+
+const deviceColumns = `id, user_id, name, os, client_version, created_at, last_seen_at, revoked_at`
+
+// Register добавляет устройство или обновляет его описание и время последнего входа.
+// ErrDeviceRevoked, если устройство отозвано или зарегистрировано другим пользователем
+func (r *DeviceRepository) Register(ctx context.Context, device *models.Device) (*models.Device, error) {
+	query := `
+		INSERT INTO devices AS d (` + deviceColumns + `)
+		VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, NULL)
+		ON CONFLICT (id) DO UPDATE
+		SET name = excluded.name, os = excluded.os, client_version = excluded.client_version, last_seen_at = excluded.last_seen_at
+		WHERE d.user_id = excluded.user_id AND d.revoked_at IS NULL
+		RETURNING ` + deviceColumns
+
+	registered, err := scanDevice(r.db.QueryRowContext(ctx, query,
+		device.ID,
+		device.UserID,
+		device.Name,
+		device.OS,
+		device.ClientVersion,
+		device.CreatedAt,
+		device.LastSeenAt,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, repository.ErrDeviceRevoked
+	}
+	if err != nil {
+		return nil, errorsutils.WrapError(err)
+	}
+
+	return registered, nil
+}
+
+// GetAll устройства пользователя, включая отозванные, недавно использованные первыми
+func (r *DeviceRepository) GetAll(ctx context.Context, userID string) ([]*models.Device, error) {
+	query := `
+		SELECT ` + deviceColumns + `
+		FROM devices
+		WHERE user_id = ?1
+		ORDER BY last_seen_at DESC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, errorsutils.WrapError(err)
+	}
+	defer closeRows(rows)
+
+	var devices []*models.Device
+	for rows.Next() {
+		device, err := scanDevice(rows)
+		if err != nil {
+			return nil, errorsutils.WrapError(err)
+		}
+		devices = append(devices, device)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errorsutils.WrapError(err)
+	}
+
+	return devices, nil
+}
+
+// Touch обновляет время последнего обращения устройства
+func (r *DeviceRepository) Touch(ctx context.Context, deviceID string, seenAt time.Time) error {
+	query := `
+		UPDATE devices
+		SET last_seen_at = ?2
+		WHERE id = ?1 AND last_seen_at < ?2
+	`
+
+	_, err := r.db.ExecContext(ctx, query, deviceID, seenAt)
+	if err != nil {
+		return errorsutils.WrapError(err)
+	}
+
+	return nil
+}
+
+// Revoke отзывает устройство пользователя, повторный отзыв не меняет время отзыва
+func (r *DeviceRepository) Revoke(ctx context.Context, userID, deviceID string) error {
+	query := `
+		UPDATE devices
+		SET revoked_at = COALESCE(revoked_at, ?3)
+		WHERE user_id = ?1 AND id = ?2
+	`
+
+	result, err := r.db.ExecContext(ctx, query, userID, deviceID, time.Now().UTC())
+	if err != nil {
+		return errorsutils.WrapError(err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return errorsutils.WrapError(err)
+	}
+	if affected == 0 {
+		return repository.ErrDeviceNotFound
+	}
+
+	return nil
+}
+
+func scanDevice(row rowScanner) (*models.Device, error) {
+
+	var device models.Device
+	err := row.Scan(
+		&device.ID,
+		&device.UserID,
+		&device.Name,
+		&device.OS,
+		&device.ClientVersion,
+		&device.CreatedAt,
+		&device.LastSeenAt,
+		&device.RevokedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &device, nil
+}
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS secrets_statuses;
+DROP TABLE IF EXISTS secrets;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,31 @@
+CREATE TABLE IF NOT EXISTS users
+(
+    id            TEXT PRIMARY KEY,
+    login         TEXT UNIQUE NOT NULL,
+    password_hash TEXT        NOT NULL,
+    created_at    DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS secrets
+(
+    id      INTEGER PRIMARY KEY AUTOINCREMENT,
+    name    TEXT NOT NULL,
+    user_id TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    hash    TEXT NOT NULL,
+    data    BLOB NOT NULL,
+    CONSTRAINT secrets_name_user_id_key UNIQUE (name, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_secrets_user_id ON secrets (user_id);
+
+CREATE TABLE IF NOT EXISTS secrets_statuses
+(
+    id            INTEGER PRIMARY KEY AUTOINCREMENT,
+    name          TEXT     NOT NULL,
+    user_id       TEXT     NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    last_modified DATETIME NOT NULL,
+    status        TEXT     NOT NULL CHECK (status IN ('ACTIVE', 'DELETED')),
+    CONSTRAINT secrets_statuses_name_user_id_key UNIQUE (name, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_secrets_statuses_user_id ON secrets_statuses (user_id);
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_secrets_statuses_user_id_revision;
+
+ALTER TABLE secrets_statuses
+    DROP COLUMN revision;
+
+ALTER TABLE users
+    DROP COLUMN revision;
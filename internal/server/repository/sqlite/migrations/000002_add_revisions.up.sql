@@ -0,0 +1,7 @@
+ALTER TABLE users
+    ADD COLUMN revision INTEGER NOT NULL DEFAULT 0;
+
+ALTER TABLE secrets_statuses
+    ADD COLUMN revision INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_secrets_statuses_user_id_revision ON secrets_statuses (user_id, revision);
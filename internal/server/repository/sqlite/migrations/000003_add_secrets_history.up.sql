@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS secrets_history
+(
+    id            INTEGER PRIMARY KEY AUTOINCREMENT,
+    name          TEXT     NOT NULL,
+    user_id       TEXT     NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    version       INTEGER  NOT NULL,
+    hash          TEXT     NOT NULL,
+    data          BLOB     NOT NULL,
+    last_modified DATETIME NOT NULL,
+    revision      INTEGER  NOT NULL DEFAULT 0,
+    archived_at   DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT secrets_history_name_user_id_version_key UNIQUE (name, user_id, version)
+);
@@ -0,0 +1,11 @@
+ALTER TABLE users
+    DROP COLUMN kdf_threads;
+
+ALTER TABLE users
+    DROP COLUMN kdf_memory_kib;
+
+ALTER TABLE users
+    DROP COLUMN kdf_time;
+
+ALTER TABLE users
+    DROP COLUMN kdf_salt;
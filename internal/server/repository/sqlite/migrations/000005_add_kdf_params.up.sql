@@ -0,0 +1,11 @@
+ALTER TABLE users
+    ADD COLUMN kdf_salt BLOB;
+
+ALTER TABLE users
+    ADD COLUMN kdf_time INTEGER;
+
+ALTER TABLE users
+    ADD COLUMN kdf_memory_kib INTEGER;
+
+ALTER TABLE users
+    ADD COLUMN kdf_threads INTEGER;
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS sessions
+(
+    id                 TEXT PRIMARY KEY,
+    user_id            TEXT     NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    refresh_token_hash BLOB     NOT NULL,
+    access_token_id    TEXT     NOT NULL,
+    access_expires_at  DATETIME NOT NULL,
+    created_at         DATETIME NOT NULL,
+    last_used_at       DATETIME NOT NULL,
+    expires_at         DATETIME NOT NULL,
+    revoked_at         DATETIME
+);
+
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions (user_id);
+
+CREATE TABLE IF NOT EXISTS revoked_tokens
+(
+    token_id   TEXT PRIMARY KEY,
+    expires_at DATETIME NOT NULL
+);
@@ -0,0 +1,4 @@
+ALTER TABLE sessions
+    DROP COLUMN device_id;
+
+DROP TABLE IF EXISTS devices;
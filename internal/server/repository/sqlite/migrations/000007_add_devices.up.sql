@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS devices
+(
+    id             TEXT PRIMARY KEY,
+    user_id        TEXT     NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name           TEXT     NOT NULL,
+    os             TEXT     NOT NULL,
+    client_version TEXT     NOT NULL,
+    created_at     DATETIME NOT NULL,
+    last_seen_at   DATETIME NOT NULL,
+    revoked_at     DATETIME
+);
+
+CREATE INDEX IF NOT EXISTS idx_devices_user_id ON devices (user_id);
+
+-- без REFERENCES: SQLite не удаляет столбцы с внешним ключом, а устройства удаляются только вместе с пользователем
+ALTER TABLE sessions
+    ADD COLUMN device_id TEXT;
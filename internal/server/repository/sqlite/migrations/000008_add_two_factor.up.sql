@@ -0,0 +1,18 @@
+ALTER TABLE users
+    ADD COLUMN totp_secret BLOB;
+
+ALTER TABLE users
+    ADD COLUMN totp_pending_secret BLOB;
+
+ALTER TABLE users
+    ADD COLUMN totp_last_step INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS recovery_codes
+(
+    id        INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id   TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    code_hash BLOB NOT NULL,
+    used_at   DATETIME
+);
+
+CREATE INDEX IF NOT EXISTS idx_recovery_codes_user_id ON recovery_codes (user_id);
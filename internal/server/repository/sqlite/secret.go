@@ -0,0 +1,612 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/s-turchinskiy/keeper/internal/server/models"
+	"github.com/s-turchinskiy/keeper/internal/server/repository"
+	"github.com/s-turchinskiy/keeper/internal/utils/errorsutils"
+	"time"
+)
+
+type OptionSecretRepository func(*SecretRepository)
+
+type SecretRepository struct {
+	db               *sqlx.DB
+	historyRetention int64
+}
+
+func NewSecretRepository(sqliteDB *SQLiteDB, opts ...OptionSecretRepository) *SecretRepository {
+	r := &SecretRepository{
+		db:               sqliteDB.db,
+		historyRetention: repository.DefaultHistoryRetention,
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
+}
+
+// WithHistoryRetention количество хранимых предыдущих версий секрета, 0 - история не ведется
+func WithHistoryRetention(retention int) OptionSecretRepository {
+	return func(r *SecretRepository) {
+		if retention >= 0 {
+			r.historyRetention = int64(retention)
+		}
+	}
+}
+
+func (r *SecretRepository) CreateUpdate(ctx context.Context, secret *models.Secret) error {
+	return r.CreateUpdateIfMatch(ctx, secret, nil)
+}
+
+// CreateUpdateIfMatch записывает секрет, только если его текущая версия на сервере совпадает с expected,
+// иначе возвращает repository.ErrSecretConflict
+func (r *SecretRepository) CreateUpdateIfMatch(ctx context.Context, secret *models.Secret, expected *models.ExpectedVersion) error {
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer rollback(tx)
+
+	revision, err := nextRevision(ctx, tx, secret.UserID)
+	if err != nil {
+		return errorsutils.WrapError(err)
+	}
+
+	if expected != nil {
+		currentHash, currentRevision, err := currentVersion(ctx, tx, secret.UserID, secret.ID)
+		if err != nil {
+			return errorsutils.WrapError(err)
+		}
+
+		if !expected.Match(currentHash, currentRevision) {
+			return repository.ErrSecretConflict
+		}
+	}
+
+	err = r.archive(ctx, tx, secret.UserID, secret.ID, secret.Hash)
+	if err != nil {
+		return errorsutils.WrapError(err)
+	}
+
+	query := `
+		INSERT INTO secrets (name, user_id, data, hash)
+		VALUES (?1, ?2, ?3, ?4)
+		ON CONFLICT (name, user_id) DO UPDATE SET
+			data = ?3,
+			hash = ?4
+	`
+
+	_, err = tx.ExecContext(ctx, query,
+		secret.ID,
+		secret.UserID,
+		secret.Data,
+		secret.Hash,
+	)
+
+	if err != nil {
+		return errorsutils.WrapError(err)
+	}
+
+	queryStatuses := `
+		INSERT INTO secrets_statuses (name, user_id, last_modified, status, revision)
+		VALUES (?1, ?2, ?3, 'ACTIVE', ?4)
+		ON CONFLICT (name, user_id) DO UPDATE SET
+			last_modified = ?3,
+			status = 'ACTIVE',
+			revision = ?4
+	`
+
+	_, err = tx.ExecContext(ctx, queryStatuses,
+		secret.ID,
+		secret.UserID,
+		secret.LastModified.UTC(),
+		revision,
+	)
+
+	if err != nil {
+		return errorsutils.WrapError(err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return errorsutils.WrapError(err)
+	}
+
+	secret.Revision = revision
+
+	return err
+}
+
+func (r *SecretRepository) GetByID(ctx context.Context, userID, secretID string) (*models.Secret, error) {
+	query := `
+		SELECT s.name, s.user_id, s.data, s.hash, st.last_modified, st.revision, st.status = 'DELETED'
+		FROM secrets s
+		INNER JOIN secrets_statuses st
+                   ON s.user_id = st.user_id AND s.name = st.name
+		WHERE s.user_id = ?1 AND s.name = ?2
+	`
+
+	var secret models.Secret
+	err := r.db.QueryRowContext(ctx, query, userID, secretID).Scan(
+		&secret.ID,
+		&secret.UserID,
+		&secret.Data,
+		&secret.Hash,
+		&secret.LastModified,
+		&secret.Revision,
+		&secret.Deleted,
+	)
+
+	if err != nil {
+		return nil, repository.ErrSecretNotFound
+	}
+
+	return &secret, nil
+}
+
+// Delete переносит секрет в корзину, зашифрованные данные хранятся до очистки корзины
+func (r *SecretRepository) Delete(ctx context.Context, userID, secretID string) error {
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer rollback(tx)
+
+	revision, err := nextRevision(ctx, tx, userID)
+	if err != nil {
+		return errorsutils.WrapError(err)
+	}
+
+	query := `
+		UPDATE secrets_statuses
+		SET last_modified = ?3,
+			status = 'DELETED',
+			revision = ?4
+		WHERE user_id = ?1 AND name = ?2 AND status = 'ACTIVE'
+	`
+
+	result, err := tx.ExecContext(ctx, query, userID, secretID, time.Now().UTC(), revision)
+	if err != nil {
+		return err
+	}
+
+	if count, _ := result.RowsAffected(); count == 0 {
+		return repository.ErrSecretNotFound
+	}
+
+	return tx.Commit()
+}
+
+// Undelete возвращает секрет из корзины новой ревизией
+func (r *SecretRepository) Undelete(ctx context.Context, userID, secretID string) (*models.Secret, error) {
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer rollback(tx)
+
+	revision, err := nextRevision(ctx, tx, userID)
+	if err != nil {
+		return nil, errorsutils.WrapError(err)
+	}
+
+	query := `
+		UPDATE secrets_statuses
+		SET last_modified = ?3,
+			status = 'ACTIVE',
+			revision = ?4
+		WHERE user_id = ?1 AND name = ?2 AND status = 'DELETED'
+			AND EXISTS (SELECT 1 FROM secrets s
+			            WHERE s.user_id = secrets_statuses.user_id AND s.name = secrets_statuses.name)
+	`
+
+	result, err := tx.ExecContext(ctx, query, userID, secretID, time.Now().UTC(), revision)
+	if err != nil {
+		return nil, err
+	}
+
+	if count, _ := result.RowsAffected(); count == 0 {
+		return nil, repository.ErrSecretNotFound
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, errorsutils.WrapError(err)
+	}
+
+	return r.GetByID(ctx, userID, secretID)
+}
+
+// GetDeleted секреты в корзине, LastModified - время удаления
+func (r *SecretRepository) GetDeleted(ctx context.Context, userID string) ([]*models.Secret, error) {
+
+	query := `
+		SELECT s.name, s.user_id, s.hash, s.data, st.last_modified, st.revision
+		FROM secrets s
+		INNER JOIN secrets_statuses st
+                   ON s.user_id = st.user_id AND s.name = st.name
+		WHERE s.user_id = ?1 AND st.status = 'DELETED'
+		ORDER BY st.last_modified DESC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer closeRows(rows)
+
+	var secrets []*models.Secret
+	for rows.Next() {
+		secret := models.Secret{Deleted: true}
+		err := rows.Scan(
+			&secret.ID,
+			&secret.UserID,
+			&secret.Hash,
+			&secret.Data,
+			&secret.LastModified,
+			&secret.Revision,
+		)
+		if err != nil {
+			return nil, err
+		}
+		secrets = append(secrets, &secret)
+	}
+	return secrets, rows.Err()
+}
+
+// PurgeDeleted окончательно удаляет данные и историю всех секретов пользователя из корзины
+func (r *SecretRepository) PurgeDeleted(ctx context.Context, userID string) (int64, error) {
+	return r.purge(ctx, `s.user_id = ?1`, userID)
+}
+
+// PurgeExpired окончательно удаляет данные и историю секретов, удаленных раньше before
+func (r *SecretRepository) PurgeExpired(ctx context.Context, before time.Time) (int64, error) {
+	return r.purge(ctx, `st.last_modified < ?1`, before.UTC())
+}
+
+func (r *SecretRepository) GetAll(ctx context.Context, userID string) ([]*models.Secret, error) {
+
+	query := `
+		SELECT s.name, s.user_id, s.hash, st.last_modified, st.revision
+		FROM secrets s
+		INNER JOIN secrets_statuses st
+                   ON s.user_id = st.user_id AND s.name = st.name
+		WHERE s.user_id = ?1 AND st.status = 'ACTIVE'
+		ORDER BY st.last_modified DESC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer closeRows(rows)
+
+	var secrets []*models.Secret
+	for rows.Next() {
+		var secret models.Secret
+		err := rows.Scan(
+			&secret.ID,
+			&secret.UserID,
+			&secret.Hash,
+			&secret.LastModified,
+			&secret.Revision,
+		)
+		if err != nil {
+			return nil, err
+		}
+		secrets = append(secrets, &secret)
+	}
+	return secrets, rows.Err()
+}
+
+func (r *SecretRepository) GetAllWithStatuses(ctx context.Context, userID string) ([]*models.Secret, error) {
+	return r.GetChangesSince(ctx, userID, 0)
+}
+
+// GetChangesSince возвращает все изменения пользователя (включая удаления) с ревизией больше revision
+func (r *SecretRepository) GetChangesSince(ctx context.Context, userID string, revision int64) ([]*models.Secret, error) {
+
+	query := `SELECT st.name, st.user_id, st.last_modified, st.status = 'DELETED', st.revision,
+			CASE WHEN st.status = 'ACTIVE' THEN COALESCE(s.hash, '') ELSE '' END,
+			CASE WHEN st.status = 'ACTIVE' THEN COALESCE(s.data, X'') ELSE X'' END
+		FROM secrets_statuses st
+		LEFT JOIN secrets s
+                   ON s.user_id = st.user_id AND s.name = st.name
+		WHERE st.user_id = ?1 AND st.revision > ?2
+		ORDER BY st.revision`
+
+	rows, err := r.db.QueryContext(ctx, query, userID, revision)
+	if err != nil {
+		return nil, err
+	}
+	defer closeRows(rows)
+
+	var secrets []*models.Secret
+	for rows.Next() {
+		var secret models.Secret
+		err := rows.Scan(
+			&secret.ID,
+			&secret.UserID,
+			&secret.LastModified,
+			&secret.Deleted,
+			&secret.Revision,
+			&secret.Hash,
+			&secret.Data,
+		)
+		if err != nil {
+			return nil, err
+		}
+		secrets = append(secrets, &secret)
+	}
+	return secrets, rows.Err()
+}
+
+// GetVersions предыдущие версии секрета без данных, от новых к старым
+func (r *SecretRepository) GetVersions(ctx context.Context, userID, secretID string) ([]*models.SecretVersion, error) {
+
+	query := `
+		SELECT name, user_id, version, hash, last_modified, revision
+		FROM secrets_history
+		WHERE user_id = ?1 AND name = ?2
+		ORDER BY version DESC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, userID, secretID)
+	if err != nil {
+		return nil, err
+	}
+	defer closeRows(rows)
+
+	var versions []*models.SecretVersion
+	for rows.Next() {
+		var version models.SecretVersion
+		err := rows.Scan(
+			&version.ID,
+			&version.UserID,
+			&version.Version,
+			&version.Hash,
+			&version.LastModified,
+			&version.Revision,
+		)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, &version)
+	}
+	return versions, rows.Err()
+}
+
+func (r *SecretRepository) GetVersion(ctx context.Context, userID, secretID string, version int64) (*models.SecretVersion, error) {
+
+	query := `
+		SELECT name, user_id, version, hash, data, last_modified, revision
+		FROM secrets_history
+		WHERE user_id = ?1 AND name = ?2 AND version = ?3
+	`
+
+	var secretVersion models.SecretVersion
+	err := r.db.QueryRowContext(ctx, query, userID, secretID, version).Scan(
+		&secretVersion.ID,
+		&secretVersion.UserID,
+		&secretVersion.Version,
+		&secretVersion.Hash,
+		&secretVersion.Data,
+		&secretVersion.LastModified,
+		&secretVersion.Revision,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, repository.ErrSecretVersionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &secretVersion, nil
+}
+
+// Rekey заменяет зашифрованные данные секретов в корзине (Version 0) и версий из истории, если их хеш
+// не изменился. Открытые данные те же, поэтому ревизии не меняются. Возвращает число замененных записей
+func (r *SecretRepository) Rekey(ctx context.Context, userID string, versions []*models.SecretVersion) (int64, error) {
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer rollback(tx)
+
+	queryDeleted := `
+		UPDATE secrets
+		SET data = ?4
+		WHERE user_id = ?1 AND name = ?2 AND hash = ?3
+			AND EXISTS (SELECT 1 FROM secrets_statuses st
+			            WHERE st.user_id = secrets.user_id AND st.name = secrets.name AND st.status = 'DELETED')
+	`
+
+	queryHistory := `
+		UPDATE secrets_history
+		SET data = ?5
+		WHERE user_id = ?1 AND name = ?2 AND version = ?3 AND hash = ?4
+	`
+
+	var rekeyed int64
+	for _, version := range versions {
+		var result sql.Result
+		if version.Version == 0 {
+			result, err = tx.ExecContext(ctx, queryDeleted, userID, version.ID, version.Hash, version.Data)
+		} else {
+			result, err = tx.ExecContext(ctx, queryHistory, userID, version.ID, version.Version, version.Hash, version.Data)
+		}
+		if err != nil {
+			return 0, errorsutils.WrapError(err)
+		}
+
+		count, err := result.RowsAffected()
+		if err != nil {
+			return 0, errorsutils.WrapError(err)
+		}
+		rekeyed += count
+	}
+
+	return rekeyed, tx.Commit()
+}
+
+func (r *SecretRepository) TruncateAllTabs(ctx context.Context) error {
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer rollback(tx)
+
+	for _, table := range []string{"secrets_statuses", "secrets_history", "secrets"} {
+		_, err = tx.ExecContext(ctx, `DELETE FROM `+table)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// nextRevision увеличивает счетчик ревизий пользователя, SQLite держит блокировку записи до конца транзакции
+func nextRevision(ctx context.Context, tx *sql.Tx, userID string) (int64, error) {
+
+	query := `
+		UPDATE users
+		SET revision = revision + 1
+		WHERE id = ?1
+		RETURNING revision
+	`
+
+	var revision int64
+	err := tx.QueryRowContext(ctx, query, userID).Scan(&revision)
+	if err != nil {
+		return 0, err
+	}
+
+	return revision, nil
+}
+
+// currentVersion хеш и ревизия активного секрета, для отсутствующего или удаленного - пустой хеш и 0
+func currentVersion(ctx context.Context, tx *sql.Tx, userID, secretID string) (string, int64, error) {
+
+	query := `
+		SELECT COALESCE(s.hash, ''), st.revision
+		FROM secrets_statuses st
+		LEFT JOIN secrets s
+                   ON s.user_id = st.user_id AND s.name = st.name
+		WHERE st.user_id = ?1 AND st.name = ?2 AND st.status = 'ACTIVE'
+	`
+
+	var (
+		hash     string
+		revision int64
+	)
+	err := tx.QueryRowContext(ctx, query, userID, secretID).Scan(&hash, &revision)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", 0, nil
+	}
+	if err != nil {
+		return "", 0, err
+	}
+
+	return hash, revision, nil
+}
+
+// purge удаляет из secrets и истории секреты в корзине, подходящие под condition.
+// SQLite не поддерживает DELETE внутри WITH, поэтому удаление идет двумя командами в одной транзакции
+func (r *SecretRepository) purge(ctx context.Context, condition string, args ...any) (int64, error) {
+
+	purged := `
+		SELECT s.user_id, s.name
+		FROM secrets s
+		INNER JOIN secrets_statuses st
+                   ON s.user_id = st.user_id AND s.name = st.name
+		WHERE st.status = 'DELETED' AND ` + condition
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer rollback(tx)
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM secrets_history WHERE (user_id, name) IN (`+purged+`)`, args...)
+	if err != nil {
+		return 0, errorsutils.WrapError(err)
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM secrets WHERE (user_id, name) IN (`+purged+`)`, args...)
+	if err != nil {
+		return 0, errorsutils.WrapError(err)
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return count, tx.Commit()
+}
+
+// archive переносит текущую версию секрета в историю, если новая версия с хешем newHash от нее отличается,
+// и удаляет версии сверх historyRetention
+func (r *SecretRepository) archive(ctx context.Context, tx *sql.Tx, userID, secretID, newHash string) error {
+
+	if r.historyRetention == 0 {
+		return nil
+	}
+
+	query := `
+		INSERT INTO secrets_history (name, user_id, version, hash, data, last_modified, revision)
+		SELECT s.name, s.user_id,
+		       COALESCE((SELECT MAX(h.version) FROM secrets_history h
+		                 WHERE h.user_id = s.user_id AND h.name = s.name), 0) + 1,
+		       s.hash, s.data, st.last_modified, st.revision
+		FROM secrets s
+		INNER JOIN secrets_statuses st
+                   ON s.user_id = st.user_id AND s.name = st.name
+		WHERE s.user_id = ?1 AND s.name = ?2 AND s.hash <> ?3
+		RETURNING version
+	`
+
+	var version int64
+	err := tx.QueryRowContext(ctx, query, userID, secretID, newHash).Scan(&version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	queryRetention := `
+		DELETE FROM secrets_history
+		WHERE user_id = ?1 AND name = ?2 AND version <= ?3
+	`
+
+	_, err = tx.ExecContext(ctx, queryRetention, userID, secretID, version-r.historyRetention)
+	return err
+}
+
+func rollback(tx *sql.Tx) {
+	err := tx.Rollback()
+	if err != nil && !errors.Is(err, sql.ErrTxDone) {
+		fmt.Println(err)
+	}
+}
+
+func closeRows(rows *sql.Rows) {
+	err := rows.Close()
+	if err != nil {
+		fmt.Println(err)
+	}
+}
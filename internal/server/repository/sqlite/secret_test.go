@@ -0,0 +1,121 @@
+package sqlite_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/s-turchinskiy/keeper/internal/server/models"
+	"github.com/s-turchinskiy/keeper/internal/server/repository"
+	"github.com/s-turchinskiy/keeper/internal/server/repository/sqlite"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestStorage база в памяти с примененными миграциями и пользователем, ID пользователя - второй результат
+func newTestStorage(t *testing.T) (*sqlite.SQLiteDB, string) {
+
+	ctx := context.Background()
+	db, err := sqlite.NewSQLiteStorage(ctx, ":memory:", sqlite.WithMigrations())
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close(ctx) })
+
+	user, err := sqlite.NewUserRepository(db).Create(ctx, "user", "hash", nil)
+	require.NoError(t, err)
+
+	return db, user.ID
+}
+
+func TestSecretRepositoryCreateUpdateIfMatch(t *testing.T) {
+
+	ctx := context.Background()
+	db, userID := newTestStorage(t)
+	secrets := sqlite.NewSecretRepository(db)
+
+	write := func(hash string, expected *models.ExpectedVersion) error {
+		return secrets.CreateUpdateIfMatch(ctx, &models.Secret{ID: "secret", UserID: userID, Hash: hash, Data: []byte(hash)}, expected)
+	}
+	revision := func(value int64) *models.ExpectedVersion {
+		return &models.ExpectedVersion{Revision: &value}
+	}
+	hash := func(value string) *models.ExpectedVersion {
+		return &models.ExpectedVersion{Hash: &value}
+	}
+
+	// отсутствующий секрет имеет пустой хеш и ревизию 0
+	require.ErrorIs(t, write("v1", revision(1)), repository.ErrSecretConflict)
+	require.ErrorIs(t, write("v1", hash("v0")), repository.ErrSecretConflict)
+	require.NoError(t, write("v1", revision(0)))
+
+	created, err := secrets.GetByID(ctx, userID, "secret")
+	require.NoError(t, err)
+	require.Equal(t, "v1", created.Hash)
+
+	// повторное создание с другого устройства
+	require.ErrorIs(t, write("other", revision(0)), repository.ErrSecretConflict)
+
+	require.NoError(t, write("v2", revision(created.Revision)))
+	require.ErrorIs(t, write("v3", revision(created.Revision)), repository.ErrSecretConflict)
+	require.ErrorIs(t, write("v3", hash("v1")), repository.ErrSecretConflict)
+	require.NoError(t, write("v3", hash("v2")))
+
+	current, err := secrets.GetByID(ctx, userID, "secret")
+	require.NoError(t, err)
+	require.Equal(t, "v3", current.Hash)
+	require.Greater(t, current.Revision, created.Revision)
+
+	// отклоненная запись не меняет секрет
+	require.ErrorIs(t, write("stale", &models.ExpectedVersion{Hash: &created.Hash, Revision: &current.Revision}),
+		repository.ErrSecretConflict)
+	unchanged, err := secrets.GetByID(ctx, userID, "secret")
+	require.NoError(t, err)
+	require.Equal(t, current, unchanged)
+
+	// удаленный секрет снова считается отсутствующим
+	require.NoError(t, secrets.Delete(ctx, userID, "secret"))
+	require.ErrorIs(t, write("v4", revision(current.Revision)), repository.ErrSecretConflict)
+	require.NoError(t, write("v4", revision(0)))
+}
+
+func TestSecretRepositoryRekey(t *testing.T) {
+
+	ctx := context.Background()
+	db, userID := newTestStorage(t)
+	secrets := sqlite.NewSecretRepository(db)
+
+	for _, hash := range []string{"v1", "v2"} {
+		require.NoError(t, secrets.CreateUpdate(ctx, &models.Secret{ID: "secret", UserID: userID, Hash: hash, Data: []byte(hash)}))
+	}
+	versions, err := secrets.GetVersions(ctx, userID, "secret")
+	require.NoError(t, err)
+	require.NotEmpty(t, versions)
+	old, err := secrets.GetVersion(ctx, userID, "secret", versions[len(versions)-1].Version)
+	require.NoError(t, err)
+
+	rekey := func(version int64, hash string) int64 {
+		rekeyed, err := secrets.Rekey(ctx, userID, []*models.SecretVersion{{
+			Secret:  models.Secret{ID: "secret", Hash: hash, Data: []byte("rekeyed")},
+			Version: version,
+		}})
+		require.NoError(t, err)
+		return rekeyed
+	}
+
+	// живой секрет перешифровывается обычной записью, а версия с другим хешем не заменяется
+	require.Zero(t, rekey(0, "v2"))
+	require.Zero(t, rekey(old.Version, "other"))
+	require.Equal(t, int64(1), rekey(old.Version, old.Hash))
+
+	rekeyed, err := secrets.GetVersion(ctx, userID, "secret", old.Version)
+	require.NoError(t, err)
+	require.Equal(t, []byte("rekeyed"), rekeyed.Data)
+	current, err := secrets.GetByID(ctx, userID, "secret")
+	require.NoError(t, err)
+	require.Equal(t, []byte("v2"), current.Data)
+
+	// секрет в корзине
+	require.NoError(t, secrets.Delete(ctx, userID, "secret"))
+	require.Equal(t, int64(1), rekey(0, "v2"))
+	deleted, err := secrets.GetDeleted(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, deleted, 1)
+	require.Equal(t, []byte("rekeyed"), deleted[0].Data)
+}
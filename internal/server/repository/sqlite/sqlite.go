@@ -0,0 +1,173 @@
+// Package sqlite хранилище сервера в одном файле SQLite, для небольших установок без отдельного сервера БД.
+// Схема повторяет postgres, миграции с теми же номерами версий встроены в бинарный файл
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/database/sqlite"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/jmoiron/sqlx"
+	"github.com/s-turchinskiy/keeper/internal/server/repository"
+	"github.com/s-turchinskiy/keeper/internal/utils/errorsutils"
+	"log"
+	_ "modernc.org/sqlite"
+)
+
+// dsnParams внешние ключи для ON DELETE CASCADE, ожидание блокировки вместо ошибки SQLITE_BUSY
+// и формат времени, который сравнивается как строка
+const dsnParams = "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_time_format=sqlite"
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+type OptionStorage func(*SQLiteDB)
+
+type SQLiteDB struct {
+	db      *sqlx.DB
+	migrate bool
+}
+
+// NewSQLiteStorage открывает файл базы path, ":memory:" - база в памяти процесса.
+// Схема не меняется, если не задан WithMigrations
+func NewSQLiteStorage(ctx context.Context, path string, opts ...OptionStorage) (*SQLiteDB, error) {
+
+	sqlDB, err := open(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	s := &SQLiteDB{db: sqlx.NewDb(sqlDB, "sqlite")}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if s.migrate {
+		if err = s.migrateUp(); err != nil {
+			_ = sqlDB.Close()
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// WithMigrations применяет новые миграции при открытии базы, так базу открывает только serve
+func WithMigrations() OptionStorage {
+	return func(s *SQLiteDB) {
+		s.migrate = true
+	}
+}
+
+// migrateUp применяет миграции в соединении хранилища: база в памяти существует только в нем
+func (s *SQLiteDB) migrateUp() error {
+
+	migrator, err := newMigrator(s.db.DB, false)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := migrator.Close(); err != nil {
+			log.Println(err)
+		}
+	}()
+
+	if err = migrator.Up(); err != nil {
+		return errorsutils.WrapError(err)
+	}
+
+	return nil
+}
+
+// NewMigrator миграции схемы без запуска сервера, соединение закрывается через Close мигратора
+func NewMigrator(ctx context.Context, path string) (*repository.Migrator, error) {
+
+	db, err := open(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	migrator, err := newMigrator(db, true)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return migrator, nil
+}
+
+func open(ctx context.Context, path string) (*sql.DB, error) {
+
+	db, err := sql.Open("sqlite", path+"?"+dsnParams)
+	if err != nil {
+		return nil, errorsutils.WrapError(err)
+	}
+
+	// SQLite допускает одного писателя, а база в памяти существует только в своем соединении
+	db.SetMaxOpenConns(1)
+
+	if err = db.PingContext(ctx); err != nil {
+		_ = db.Close()
+		return nil, errorsutils.WrapError(err)
+	}
+
+	return db, nil
+}
+
+// MigrationsSource миграции SQLite из бинарного файла. Версии и имена миграций у всех диалектов общие
+func MigrationsSource() (source.Driver, error) {
+	return iofs.New(migrations, "migrations")
+}
+
+// sharedDriver драйвер миграций в соединении хранилища: Close мигратора соединение не закрывает
+type sharedDriver struct {
+	database.Driver
+}
+
+func (sharedDriver) Close() error {
+	return nil
+}
+
+// newMigrator миграции из бинарного файла, closeDB - Close мигратора закрывает и db
+func newMigrator(db *sql.DB, closeDB bool) (*repository.Migrator, error) {
+
+	driver, err := sqlite.WithInstance(db, &sqlite.Config{})
+	if err != nil {
+		return nil, errorsutils.WrapError(err)
+	}
+	if !closeDB {
+		driver = sharedDriver{driver}
+	}
+
+	source, err := MigrationsSource()
+	if err != nil {
+		return nil, errorsutils.WrapError(err)
+	}
+
+	m, err := migrate.NewWithInstance("iofs", source, "sqlite", driver)
+	if err != nil {
+		return nil, errorsutils.WrapError(err)
+	}
+
+	listing, err := MigrationsSource()
+	if err != nil {
+		return nil, errorsutils.WrapError(err)
+	}
+
+	return repository.NewMigrator(m, listing), nil
+}
+
+func (s *SQLiteDB) Close(_ context.Context) {
+
+	err := s.db.Close()
+
+	if err != nil {
+		log.Printf("SQLite stopped with error %v", err)
+	} else {
+		log.Println("SQLite stopped")
+	}
+}
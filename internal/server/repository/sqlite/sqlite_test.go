@@ -0,0 +1,64 @@
+package sqlite_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/s-turchinskiy/keeper/internal/server/repository/sqlite"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMigrations все миграции применяются и откатываются до пустой схемы
+func TestMigrations(t *testing.T) {
+
+	migrator, err := sqlite.NewMigrator(context.Background(), ":memory:")
+	require.NoError(t, err)
+	defer migrator.Close()
+
+	require.NoError(t, migrator.Up())
+	statuses, err := migrator.Status()
+	require.NoError(t, err)
+
+	version, dirty, err := migrator.Version()
+	require.NoError(t, err)
+	require.False(t, dirty)
+	require.Equal(t, statuses[len(statuses)-1].Version, version)
+
+	require.NoError(t, migrator.Down(len(statuses)))
+	version, _, err = migrator.Version()
+	require.NoError(t, err)
+	require.Zero(t, version)
+
+	require.NoError(t, migrator.Up())
+}
+
+// TestStorageMigrations схему меняет только хранилище, открытое с WithMigrations, и мигратор не закрывает его соединение
+func TestStorageMigrations(t *testing.T) {
+
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "keeper.db")
+
+	version := func() uint {
+		migrator, err := sqlite.NewMigrator(ctx, path)
+		require.NoError(t, err)
+		defer migrator.Close()
+
+		version, _, err := migrator.Version()
+		require.NoError(t, err)
+		return version
+	}
+
+	db, err := sqlite.NewSQLiteStorage(ctx, path)
+	require.NoError(t, err)
+	db.Close(ctx)
+	require.Zero(t, version())
+
+	db, err = sqlite.NewSQLiteStorage(ctx, path, sqlite.WithMigrations())
+	require.NoError(t, err)
+	defer db.Close(ctx)
+	require.NotZero(t, version())
+
+	_, err = sqlite.NewUserRepository(db).Create(ctx, "user", "hash", nil)
+	require.NoError(t, err)
+}
@@ -0,0 +1,186 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/s-turchinskiy/keeper/internal/server/models"
+	"github.com/s-turchinskiy/keeper/internal/server/repository"
+	"github.com/s-turchinskiy/keeper/internal/utils/errorsutils"
+)
+
+// GetTwoFactor состояние TOTP и число неиспользованных кодов восстановления
+func (r *UserRepository) GetTwoFactor(ctx context.Context, userID string) (*models.TwoFactor, error) {
+	query := `
+		SELECT totp_secret, totp_pending_secret, totp_last_step,
+		       (SELECT COUNT(*) FROM recovery_codes c WHERE c.user_id = u.id AND c.used_at IS NULL)
+		FROM users u
+		WHERE u.id = ?1
+	`
+
+	var twoFactor models.TwoFactor
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(
+		&twoFactor.Secret,
+		&twoFactor.PendingSecret,
+		&twoFactor.LastStep,
+		&twoFactor.RecoveryCodesLeft,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, repository.ErrUserNotFound
+	}
+	if err != nil {
+		return nil, errorsutils.WrapError(err)
+	}
+
+	return &twoFactor, nil
+}
+
+// SetPendingTOTP сохраняет секрет, который станет действующим после подтверждения первым кодом
+func (r *UserRepository) SetPendingTOTP(ctx context.Context, userID string, secret []byte) error {
+	query := `
+		UPDATE users
+		SET totp_pending_secret = ?2
+		WHERE id = ?1
+	`
+
+	result, err := r.db.ExecContext(ctx, query, userID, secret)
+	if err != nil {
+		return errorsutils.WrapError(err)
+	}
+
+	return userAffected(result)
+}
+
+// EnableTOTP делает ожидающий секрет действующим, если он все еще равен secret,
+// и заменяет коды восстановления новыми. step - шаг, которым подтверждено подключение
+func (r *UserRepository) EnableTOTP(ctx context.Context, userID string, secret []byte, step int64, recoveryCodeHashes [][]byte) error {
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer rollback(tx)
+
+	query := `
+		UPDATE users
+		SET totp_secret = totp_pending_secret, totp_pending_secret = NULL, totp_last_step = ?3
+		WHERE id = ?1 AND totp_pending_secret = ?2
+	`
+
+	result, err := tx.ExecContext(ctx, query, userID, secret, step)
+	if err != nil {
+		return errorsutils.WrapError(err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return errorsutils.WrapError(err)
+	}
+	if affected == 0 {
+		return repository.ErrTOTPNotPending
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = ?1`, userID)
+	if err != nil {
+		return errorsutils.WrapError(err)
+	}
+
+	for _, hash := range recoveryCodeHashes {
+		_, err = tx.ExecContext(ctx, `INSERT INTO recovery_codes (user_id, code_hash) VALUES (?1, ?2)`, userID, hash)
+		if err != nil {
+			return errorsutils.WrapError(err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DisableTOTP удаляет секреты и коды восстановления
+func (r *UserRepository) DisableTOTP(ctx context.Context, userID string) error {
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer rollback(tx)
+
+	query := `
+		UPDATE users
+		SET totp_secret = NULL, totp_pending_secret = NULL, totp_last_step = 0
+		WHERE id = ?1
+	`
+
+	result, err := tx.ExecContext(ctx, query, userID)
+	if err != nil {
+		return errorsutils.WrapError(err)
+	}
+
+	if err = userAffected(result); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = ?1`, userID)
+	if err != nil {
+		return errorsutils.WrapError(err)
+	}
+
+	return tx.Commit()
+}
+
+// UseTOTPStep запоминает принятый шаг TOTP. false - этот или более поздний шаг уже использован
+func (r *UserRepository) UseTOTPStep(ctx context.Context, userID string, step int64) (bool, error) {
+	query := `
+		UPDATE users
+		SET totp_last_step = ?2
+		WHERE id = ?1 AND totp_last_step < ?2
+	`
+
+	result, err := r.db.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return false, errorsutils.WrapError(err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, errorsutils.WrapError(err)
+	}
+
+	return affected > 0, nil
+}
+
+// UseRecoveryCode гасит код восстановления. false - кода нет или он уже использован
+func (r *UserRepository) UseRecoveryCode(ctx context.Context, userID string, codeHash []byte) (bool, error) {
+	query := `
+		UPDATE recovery_codes
+		SET used_at = ?3
+		WHERE user_id = ?1 AND code_hash = ?2 AND used_at IS NULL
+	`
+
+	result, err := r.db.ExecContext(ctx, query, userID, codeHash, time.Now().UTC())
+	if err != nil {
+		return false, errorsutils.WrapError(err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, errorsutils.WrapError(err)
+	}
+
+	return affected > 0, nil
+}
+
+func userAffected(result sql.Result) error {
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return errorsutils.WrapError(err)
+	}
+
+	if affected == 0 {
+		return repository.ErrUserNotFound
+	}
+
+	return nil
+}
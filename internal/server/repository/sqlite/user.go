@@ -0,0 +1,243 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/s-turchinskiy/keeper/internal/server/models"
+	"github.com/s-turchinskiy/keeper/internal/server/repository"
+	"time"
+)
+
+type UserRepository struct {
+	db *sqlx.DB
+}
+
+func NewUserRepository(sqliteDB *SQLiteDB) *UserRepository {
+	return &UserRepository{
+		db: sqliteDB.db,
+	}
+}
+
+const userColumns = `id, login, password_hash, created_at, kdf_salt, kdf_time, kdf_memory_kib, kdf_threads`
+
+func (r *UserRepository) Create(ctx context.Context, login, passwordHash string, kdf *models.KDFParams) (*models.User, error) {
+	query := `
+		INSERT INTO users (id, login, password_hash, created_at, kdf_salt, kdf_time, kdf_memory_kib, kdf_threads)
+		VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8)
+		RETURNING ` + userColumns
+
+	salt, iterations, memory, threads := kdfArgs(kdf)
+	user, err := scanUser(r.db.QueryRowContext(ctx, query,
+		uuid.NewString(), login, passwordHash, time.Now().UTC(), salt, iterations, memory, threads))
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (r *UserRepository) GetByLogin(ctx context.Context, login string) (*models.User, error) {
+	query := `
+		SELECT ` + userColumns + `
+		FROM users
+		WHERE login = ?1
+	`
+
+	user, err := scanUser(r.db.QueryRowContext(ctx, query, login))
+	if err != nil {
+		return nil, repository.ErrUserNotFound
+	}
+
+	return user, nil
+}
+
+func (r *UserRepository) GetByID(ctx context.Context, userID string) (*models.User, error) {
+	query := `
+		SELECT ` + userColumns + `
+		FROM users
+		WHERE id = ?1
+	`
+
+	user, err := scanUser(r.db.QueryRowContext(ctx, query, userID))
+	if err != nil {
+		return nil, repository.ErrUserNotFound
+	}
+
+	return user, nil
+}
+
+// GetVaultKey зашифрованный ключ хранилища пользователя, nil если клиент еще не создал ключ
+func (r *UserRepository) GetVaultKey(ctx context.Context, userID string) ([]byte, error) {
+	query := `
+		SELECT vault_key
+		FROM users
+		WHERE id = ?1
+	`
+
+	var vaultKey []byte
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(&vaultKey)
+	if err != nil {
+		return nil, repository.ErrUserNotFound
+	}
+
+	return vaultKey, nil
+}
+
+// SetVaultKey сохраняет зашифрованный ключ хранилища. Без replace существующий ключ не перезаписывается
+func (r *UserRepository) SetVaultKey(ctx context.Context, userID string, vaultKey []byte, replace bool) error {
+	query := `
+		UPDATE users
+		SET vault_key = ?2
+		WHERE id = ?1 AND (vault_key IS NULL OR ?3)
+	`
+
+	result, err := r.db.ExecContext(ctx, query, userID, vaultKey, replace)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		if _, err = r.GetByID(ctx, userID); err != nil {
+			return err
+		}
+		return repository.ErrVaultKeySet
+	}
+
+	return nil
+}
+
+// UpdateCredentials меняет хеш пароля, параметры KDF и ключ хранилища одной командой
+func (r *UserRepository) UpdateCredentials(ctx context.Context, userID, passwordHash string, vaultKey []byte, kdf *models.KDFParams) error {
+	query := `
+		UPDATE users
+		SET password_hash = ?2, vault_key = ?3,
+		    kdf_salt = ?4, kdf_time = ?5, kdf_memory_kib = ?6, kdf_threads = ?7
+		WHERE id = ?1
+	`
+
+	salt, iterations, memory, threads := kdfArgs(kdf)
+	result, err := r.db.ExecContext(ctx, query, userID, passwordHash, vaultKey, salt, iterations, memory, threads)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return repository.ErrUserNotFound
+	}
+
+	return nil
+}
+
+// GetAll все пользователи в порядке регистрации
+func (r *UserRepository) GetAll(ctx context.Context) ([]*models.User, error) {
+	query := `
+		SELECT ` + userColumns + `
+		FROM users
+		ORDER BY created_at, login
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer closeRows(rows)
+
+	var users []*models.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
+// Delete удаляет пользователя, его секреты и история удаляются каскадно
+func (r *UserRepository) Delete(ctx context.Context, userID string) error {
+	query := `
+		DELETE FROM users
+		WHERE id = ?1
+	`
+
+	result, err := r.db.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return repository.ErrUserNotFound
+	}
+
+	return nil
+}
+
+// rowScanner одна строка результата, *sql.Row или *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanUser(row rowScanner) (*models.User, error) {
+	var (
+		user       models.User
+		salt       []byte
+		iterations sql.NullInt64
+		memory     sql.NullInt64
+		threads    sql.NullInt64
+	)
+
+	err := row.Scan(
+		&user.ID,
+		&user.Login,
+		&user.PasswordHash,
+		&user.CreatedAt,
+		&salt,
+		&iterations,
+		&memory,
+		&threads,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(salt) > 0 {
+		user.KDF = &models.KDFParams{
+			Salt:      salt,
+			Time:      uint32(iterations.Int64),
+			MemoryKiB: uint32(memory.Int64),
+			Threads:   uint8(threads.Int64),
+		}
+	}
+
+	return &user, nil
+}
+
+// kdfArgs значения колонок kdf_*, для nil все колонки NULL
+func kdfArgs(kdf *models.KDFParams) (salt []byte, iterations, memory, threads sql.NullInt64) {
+	if kdf == nil {
+		return nil, iterations, memory, threads
+	}
+
+	return kdf.Salt,
+		sql.NullInt64{Int64: int64(kdf.Time), Valid: true},
+		sql.NullInt64{Int64: int64(kdf.MemoryKiB), Valid: true},
+		sql.NullInt64{Int64: int64(kdf.Threads), Valid: true}
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/s-turchinskiy/keeper/internal/server/models"
+	"github.com/s-turchinskiy/keeper/internal/server/repository"
+	"github.com/s-turchinskiy/keeper/internal/utils/errorsutils"
+	"time"
+)
+
+const maxDeviceFieldLength = 255
+
+var (
+	ErrInvalidDevice  = errors.New("invalid device")
+	ErrDeviceRevoked  = repository.ErrDeviceRevoked
+	ErrDeviceNotFound = repository.ErrDeviceNotFound
+)
+
+// ListDevices устройства пользователя вместе с отозванными
+func (s *Service) ListDevices(ctx context.Context, userID string) ([]*models.Device, error) {
+	return s.deviceRepository.GetAll(ctx, userID)
+}
+
+// RevokeDevice отзывает устройство: оно больше не может войти, его сессии завершаются.
+// Возвращает ID завершенных сессий, чтобы закрыть их стримы
+func (s *Service) RevokeDevice(ctx context.Context, userID, deviceID string) ([]string, error) {
+
+	if uuid.Validate(deviceID) != nil {
+		return nil, ErrDeviceNotFound
+	}
+
+	if err := s.deviceRepository.Revoke(ctx, userID, deviceID); err != nil {
+		return nil, err
+	}
+
+	sessionIDs, err := s.sessionRepository.RevokeDevice(ctx, userID, deviceID)
+	if err != nil {
+		return nil, errorsutils.WrapError(err)
+	}
+
+	return sessionIDs, nil
+}
+
+// registerDevice запоминает устройство при входе и время последнего входа с него
+func (s *Service) registerDevice(ctx context.Context, userID string, device *models.Device) (*models.Device, error) {
+
+	if err := validateDevice(device); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	registered, err := s.deviceRepository.Register(ctx, &models.Device{
+		ID:            device.ID,
+		UserID:        userID,
+		Name:          device.Name,
+		OS:            device.OS,
+		ClientVersion: device.ClientVersion,
+		CreatedAt:     now,
+		LastSeenAt:    now,
+	})
+	if errors.Is(err, repository.ErrDeviceRevoked) {
+		return nil, ErrDeviceRevoked
+	}
+	if err != nil {
+		return nil, errorsutils.WrapError(err)
+	}
+
+	return registered, nil
+}
+
+func validateDevice(device *models.Device) error {
+
+	if uuid.Validate(device.ID) != nil {
+		return fmt.Errorf("%w: id must be a UUID", ErrInvalidDevice)
+	}
+
+	if device.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidDevice)
+	}
+
+	for _, field := range []string{device.Name, device.OS, device.ClientVersion} {
+		if len(field) > maxDeviceFieldLength {
+			return fmt.Errorf("%w: fields must be at most %d bytes", ErrInvalidDevice, maxDeviceFieldLength)
+		}
+	}
+
+	return nil
+}
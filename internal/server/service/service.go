@@ -15,15 +15,36 @@ import (
 
 type Servicer interface {
 	GetNewConnectionNumber(ctx context.Context) uint64
-	Register(ctx context.Context, login, password string) (*models.User, error)
-	Login(ctx context.Context, login, password string) (string, *models.User, error)
-
-	CreateSecret(ctx context.Context, secret *models.Secret) error
+	Register(ctx context.Context, login, password string, kdf *models.KDFParams) (*models.User, error)
+	Login(ctx context.Context, login, password string, device *models.Device) (*models.Tokens, *models.User, error)
+	LoginTwoFactor(ctx context.Context, challenge, code string, device *models.Device) (*models.Tokens, *models.User, error)
+	RefreshToken(ctx context.Context, refreshToken string) (*models.Tokens, error)
+	Logout(ctx context.Context, userID, sessionID string, allSessions bool) (int64, error)
+	Authenticate(ctx context.Context, accessToken string) (*token.Claims, error)
+	ListDevices(ctx context.Context, userID string) ([]*models.Device, error)
+	RevokeDevice(ctx context.Context, userID, deviceID string) ([]string, error)
+	EnableTwoFactor(ctx context.Context, userID string) ([]byte, string, error)
+	ConfirmTwoFactor(ctx context.Context, userID, code string) ([]string, error)
+	DisableTwoFactor(ctx context.Context, userID, code string) error
+	GetTwoFactorStatus(ctx context.Context, userID string) (*models.TwoFactor, error)
+	GetKDFParams(ctx context.Context, login string) (*models.KDFParams, error)
+	ChangePassword(ctx context.Context, userID, oldPassword, newPassword string, vaultKey []byte, kdf *models.KDFParams) error
+	GetVaultKey(ctx context.Context, userID string) ([]byte, error)
+	SetVaultKey(ctx context.Context, userID string, vaultKey []byte, replace bool) error
+
+	CreateSecret(ctx context.Context, secret *models.Secret, expected *models.ExpectedVersion) error
 	GetSecret(ctx context.Context, userID, secretID string) (*models.Secret, error)
-	UpdateSecret(ctx context.Context, secret *models.Secret) error
+	UpdateSecret(ctx context.Context, secret *models.Secret, expected *models.ExpectedVersion) error
 	DeleteSecret(ctx context.Context, userID, secretID string) error
+	UndeleteSecret(ctx context.Context, userID, secretID string) (*models.Secret, error)
+	ListDeletedSecrets(ctx context.Context, userID string) ([]*models.Secret, error)
+	PurgeDeletedSecrets(ctx context.Context, userID string) (int64, error)
 	ListSecrets(ctx context.Context, userID string) ([]*models.Secret, error)
-	SyncFromClient(ctx context.Context, userID string, clientSecrets []*models.Secret) (updateInClients []*models.Secret, err error)
+	SyncFromClient(ctx context.Context, userID string, clientSecrets []*models.Secret) (updateInClients, conflicts []*models.Secret, err error)
+	GetChangesSince(ctx context.Context, userID string, revision int64) ([]*models.Secret, error)
+	ListSecretVersions(ctx context.Context, userID, secretID string) ([]*models.SecretVersion, error)
+	GetSecretVersion(ctx context.Context, userID, secretID string, version int64) (*models.SecretVersion, error)
+	RekeySecrets(ctx context.Context, userID string, versions []*models.SecretVersion) (int64, error)
 }
 
 type OptionService func(*Service)
@@ -32,19 +53,39 @@ type Service struct {
 	TokenManager            token.TokenManager
 	usersRepository         repository.UserRepositorier
 	secretRepository        repository.SecretRepositorier
+	sessionRepository       repository.SessionRepositorier
+	deviceRepository        repository.DeviceRepositorier
+	sessionDuration         time.Duration
+	clock                   func() time.Time
+	totpIssuer              string
+	twoFactorAttempts       twoFactorLimiter
 	currentConnectionNumber uint64
-	redisClient             *redisclient.RedisClient
+	secretCache             SecretCache
+}
+
+// SecretCache кеш секретов для GetSecret, запись секрета сбрасывает его в кеше
+type SecretCache interface {
+	Get(ctx context.Context, userID, secretID string) (*models.Secret, error)
+	Set(ctx context.Context, secret *models.Secret) error
+	Del(ctx context.Context, userID, secretID string) error
 }
 
 func NewService(tokenManager token.TokenManager,
 	usersRepository repository.UserRepositorier,
 	secretRepository repository.SecretRepositorier,
+	sessionRepository repository.SessionRepositorier,
+	deviceRepository repository.DeviceRepositorier,
 	opts ...OptionService) *Service {
 
 	s := &Service{
-		TokenManager:     tokenManager,
-		usersRepository:  usersRepository,
-		secretRepository: secretRepository,
+		TokenManager:      tokenManager,
+		usersRepository:   usersRepository,
+		secretRepository:  secretRepository,
+		sessionRepository: sessionRepository,
+		deviceRepository:  deviceRepository,
+		sessionDuration:   DefaultSessionDuration,
+		clock:             time.Now,
+		totpIssuer:        DefaultTOTPIssuer,
 	}
 
 	for _, opt := range opts {
@@ -55,6 +96,16 @@ func NewService(tokenManager token.TokenManager,
 
 }
 
+// WithSessionDuration время жизни токена обновления: столько сессия живет без входа по паролю
+func WithSessionDuration(duration time.Duration) OptionService {
+
+	return func(s *Service) {
+		if duration > 0 {
+			s.sessionDuration = duration
+		}
+	}
+}
+
 func WithRedis(rdb *redis.Client, expiration time.Duration) OptionService {
 
 	return func(s *Service) {
@@ -65,8 +116,41 @@ func WithRedis(rdb *redis.Client, expiration time.Duration) OptionService {
 			return
 		}
 
-		s.redisClient = redisclient.NewRedisClient(rdb, expiration)
+		s.secretCache = redisclient.NewRedisClient(rdb, expiration)
 
 		fmt.Println("connect to redis success")
 	}
 }
+
+func WithSecretCache(cache SecretCache) OptionService {
+
+	return func(s *Service) {
+		s.secretCache = cache
+	}
+}
+
+func (s *Service) writeSecret(ctx context.Context, secret *models.Secret, expected *models.ExpectedVersion) error {
+	if len(secret.Data) > maxSecretSize {
+		return ErrSecretTooLarge
+	}
+
+	var err error
+	if expected == nil {
+		err = s.secretRepository.CreateUpdate(ctx, secret)
+	} else {
+		err = s.secretRepository.CreateUpdateIfMatch(ctx, secret, expected)
+	}
+	if err != nil {
+		return err
+	}
+
+	s.invalidateCache(ctx, secret.UserID, secret.ID)
+	return nil
+}
+
+// invalidateCache сбрасывает кеш секрета после успешной записи: неудавшаяся запись секрет не меняет
+func (s *Service) invalidateCache(ctx context.Context, userID, secretID string) {
+	if s.secretCache != nil {
+		_ = s.secretCache.Del(ctx, userID, secretID)
+	}
+}
@@ -4,10 +4,10 @@ import (
 	"context"
 	"errors"
 	"github.com/s-turchinskiy/keeper/internal/server/models"
+	"github.com/s-turchinskiy/keeper/internal/server/repository"
 	"github.com/s-turchinskiy/keeper/internal/utils/errorsutils"
 	"golang.org/x/crypto/bcrypt"
 	"golang.org/x/sync/errgroup"
-	"log"
 	"sync"
 	"sync/atomic"
 )
@@ -20,11 +20,10 @@ type secretsType struct {
 const maxSecretSize = 5 * 1024 * 1024 // 5MB
 
 var (
-	ErrUserNotFound         = errors.New("user not found")
-	ErrInvalidCredentials   = errors.New("invalid credentials")
-	ErrUserAlreadyExists    = errors.New("user already exists")
-	ErrSecretTooLarge       = errors.New("secret data too large")
-	ErrUnknownTypeOperation = errors.New("unknown type operation")
+	ErrUserNotFound       = errors.New("user not found")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrUserAlreadyExists  = errors.New("user already exists")
+	ErrSecretTooLarge     = errors.New("secret data too large")
 )
 
 func (s *Service) GetNewConnectionNumber(ctx context.Context) uint64 {
@@ -32,7 +31,15 @@ func (s *Service) GetNewConnectionNumber(ctx context.Context) uint64 {
 
 }
 
-func (s *Service) Register(ctx context.Context, login, password string) (*models.User, error) {
+// Register создает пользователя. kdf - соль и параметры, с которыми клиент вывел пароль из мастер-пароля,
+// nil для клиентов, которые выводят ключи из логина
+func (s *Service) Register(ctx context.Context, login, password string, kdf *models.KDFParams) (*models.User, error) {
+
+	if kdf != nil {
+		if err := kdf.Validate(); err != nil {
+			return nil, err
+		}
+	}
 
 	existing, _ := s.usersRepository.GetByLogin(ctx, login)
 	if existing != nil {
@@ -44,7 +51,7 @@ func (s *Service) Register(ctx context.Context, login, password string) (*models
 		return nil, err
 	}
 
-	createdUser, err := s.usersRepository.Create(ctx, login, string(passwordHash))
+	createdUser, err := s.usersRepository.Create(ctx, login, string(passwordHash), kdf)
 	if err != nil {
 		return nil, err
 	}
@@ -52,37 +59,60 @@ func (s *Service) Register(ctx context.Context, login, password string) (*models
 	return createdUser, nil
 }
 
-func (s *Service) Login(ctx context.Context, login, password string) (string, *models.User, error) {
+func (s *Service) GetVaultKey(ctx context.Context, userID string) ([]byte, error) {
+	return s.usersRepository.GetVaultKey(ctx, userID)
+}
+
+func (s *Service) SetVaultKey(ctx context.Context, userID string, vaultKey []byte, replace bool) error {
+	return s.usersRepository.SetVaultKey(ctx, userID, vaultKey, replace)
+}
+
+// GetKDFParams параметры KDF пользователя, нужны клиенту до входа, чтобы вывести пароль.
+// nil для пользователей без параметров
+func (s *Service) GetKDFParams(ctx context.Context, login string) (*models.KDFParams, error) {
 	user, err := s.usersRepository.GetByLogin(ctx, login)
 	if err != nil {
-		return "", nil, ErrUserNotFound
+		return nil, ErrUserNotFound
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
+	return user.KDF, nil
+}
+
+// ChangePassword проверяет текущий пароль и сохраняет новый вместе с ключом хранилища,
+// перешифрованным клиентом под новый пароль, и параметрами KDF. Без kdf параметры остаются прежними
+func (s *Service) ChangePassword(ctx context.Context, userID, oldPassword, newPassword string, vaultKey []byte, kdf *models.KDFParams) error {
+	user, err := s.usersRepository.GetByID(ctx, userID)
 	if err != nil {
-		return "", nil, ErrInvalidCredentials
+		return ErrUserNotFound
 	}
 
-	token, err := s.TokenManager.GenerateToken(user.ID)
-	if err != nil {
-		return "", nil, err
+	if kdf == nil {
+		kdf = user.KDF
+	} else if err = kdf.Validate(); err != nil {
+		return err
 	}
 
-	return token, user, nil
-}
+	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(oldPassword))
+	if err != nil {
+		return ErrInvalidCredentials
+	}
 
-func (s *Service) CreateSecret(ctx context.Context, secret *models.Secret) error {
-	if len(secret.Data) > maxSecretSize {
-		return ErrSecretTooLarge
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
 	}
 
-	return s.secretRepository.CreateUpdate(ctx, secret)
+	return s.usersRepository.UpdateCredentials(ctx, userID, string(passwordHash), vaultKey, kdf)
+}
+
+func (s *Service) CreateSecret(ctx context.Context, secret *models.Secret, expected *models.ExpectedVersion) error {
+	return s.writeSecret(ctx, secret, expected)
 }
 
 func (s *Service) GetSecret(ctx context.Context, userID, secretID string) (*models.Secret, error) {
 
-	if s.redisClient != nil {
-		secret, _ := s.redisClient.Get(ctx, userID, secretID)
+	if s.secretCache != nil {
+		secret, _ := s.secretCache.Get(ctx, userID, secretID)
 		if secret != nil {
 			return secret, nil
 		}
@@ -90,41 +120,99 @@ func (s *Service) GetSecret(ctx context.Context, userID, secretID string) (*mode
 
 	secret, err := s.secretRepository.GetByID(ctx, userID, secretID)
 
-	if s.redisClient != nil {
-		_ = s.redisClient.Set(ctx, secret)
+	if s.secretCache != nil && err == nil && !secret.Deleted {
+		_ = s.secretCache.Set(ctx, secret)
 	}
 
 	return secret, err
 }
 
-func (s *Service) UpdateSecret(ctx context.Context, secret *models.Secret) error {
-	if len(secret.Data) > maxSecretSize {
-		return ErrSecretTooLarge
+func (s *Service) UpdateSecret(ctx context.Context, secret *models.Secret, expected *models.ExpectedVersion) error {
+	return s.writeSecret(ctx, secret, expected)
+}
+
+func (s *Service) DeleteSecret(ctx context.Context, userID, secretID string) error {
+	if err := s.secretRepository.Delete(ctx, userID, secretID); err != nil {
+		return err
 	}
 
-	return s.secretRepository.CreateUpdate(ctx, secret)
+	s.invalidateCache(ctx, userID, secretID)
+	return nil
 }
 
-func (s *Service) DeleteSecret(ctx context.Context, userID, secretID string) error {
-	return s.secretRepository.Delete(ctx, userID, secretID)
+func (s *Service) UndeleteSecret(ctx context.Context, userID, secretID string) (*models.Secret, error) {
+	secret, err := s.secretRepository.Undelete(ctx, userID, secretID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.invalidateCache(ctx, userID, secretID)
+	return secret, nil
+}
+
+func (s *Service) ListDeletedSecrets(ctx context.Context, userID string) ([]*models.Secret, error) {
+	return s.secretRepository.GetDeleted(ctx, userID)
+}
+
+func (s *Service) PurgeDeletedSecrets(ctx context.Context, userID string) (int64, error) {
+	return s.secretRepository.PurgeDeleted(ctx, userID)
+}
+
+func (s *Service) GetChangesSince(ctx context.Context, userID string, revision int64) ([]*models.Secret, error) {
+	return s.secretRepository.GetChangesSince(ctx, userID, revision)
+}
+
+func (s *Service) ListSecretVersions(ctx context.Context, userID, secretID string) ([]*models.SecretVersion, error) {
+	return s.secretRepository.GetVersions(ctx, userID, secretID)
+}
+
+func (s *Service) GetSecretVersion(ctx context.Context, userID, secretID string, version int64) (*models.SecretVersion, error) {
+	return s.secretRepository.GetVersion(ctx, userID, secretID, version)
+}
+
+// RekeySecrets заменяет данные секретов в корзине и версий из истории, перешифрованные клиентом
+// после ротации ключа хранилища, возвращает число замененных записей
+func (s *Service) RekeySecrets(ctx context.Context, userID string, versions []*models.SecretVersion) (int64, error) {
+
+	for _, version := range versions {
+		if len(version.Data) > maxSecretSize {
+			return 0, ErrSecretTooLarge
+		}
+	}
+
+	rekeyed, err := s.secretRepository.Rekey(ctx, userID, versions)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, version := range versions {
+		if version.Version == 0 {
+			s.invalidateCache(ctx, userID, version.ID)
+		}
+	}
+
+	return rekeyed, nil
 }
 
 func (s *Service) ListSecrets(ctx context.Context, userID string) ([]*models.Secret, error) {
 	return s.secretRepository.GetAll(ctx, userID)
 }
 
-func (s *Service) SyncFromClient(ctx context.Context, userID string, clientSecrets []*models.Secret) ([]*models.Secret, error) {
+// SyncFromClient сверяет секреты клиента с сервером. Revision секрета клиента - ревизия на сервере,
+// от которой сделано изменение: изменение записывается, только если секрет на сервере с тех пор не менялся.
+// Возвращает секреты для рассылки клиентам и текущие версии секретов, измененных на сервере (конфликты)
+func (s *Service) SyncFromClient(ctx context.Context, userID string, clientSecrets []*models.Secret) ([]*models.Secret, []*models.Secret, error) {
 
-	var updateInClients []*models.Secret
+	var updateInClients, conflicts []*models.Secret
 
 	serverSecrets, err := s.secretRepository.GetAllWithStatuses(ctx, userID)
 	if err != nil {
-		return nil, errorsutils.WrapError(err)
+		return nil, nil, errorsutils.WrapError(err)
 	}
 
 	lenSecrets := len(serverSecrets)
-	if len(serverSecrets) > lenSecrets {
-		lenSecrets = len(serverSecrets)
+	if len(clientSecrets) > lenSecrets {
+		lenSecrets = len(clientSecrets)
 	}
 
 	comparisonMap := make(map[string]*secretsType, lenSecrets)
@@ -144,75 +232,100 @@ func (s *Service) SyncFromClient(ctx context.Context, userID string, clientSecre
 	}
 
 	grp, ctx := errgroup.WithContext(ctx)
-	var mutex *sync.Mutex
+	var mutex sync.Mutex
 
 	for _, scrt := range comparisonMap {
 		scrt := scrt
 		grp.Go(func() error {
-			secretForClient, err := s.syncSecret(ctx, scrt)
-			if err == nil && secretForClient != nil {
-				mutex.Lock()
-				defer mutex.Unlock()
+			secretForClient, conflict, err := s.syncSecret(ctx, scrt)
+			if err != nil || secretForClient == nil {
+				return err
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			if conflict {
+				conflicts = append(conflicts, secretForClient)
+			} else {
 				updateInClients = append(updateInClients, secretForClient)
 			}
-			return err
+			return nil
 		})
 	}
 
 	if err = grp.Wait(); err != nil {
-		return updateInClients, err
+		return updateInClients, conflicts, err
 	}
 
-	return updateInClients, nil
+	return updateInClients, conflicts, nil
 }
 
-func (s *Service) syncSecret(ctx context.Context, scrt *secretsType) (*models.Secret, error) {
+// syncSecret возвращает секрет для рассылки клиентам или, если conflict, текущую версию секрета на сервере
+func (s *Service) syncSecret(ctx context.Context, scrt *secretsType) (secret *models.Secret, conflict bool, err error) {
 
+	var expectedRevision int64
 	switch {
 	case (scrt.serverSecret == nil && scrt.clientSecret.Deleted) ||
-		(scrt.clientSecret == nil && scrt.serverSecret.Deleted) ||
-		scrt.clientSecret.LastModified.Equal(scrt.serverSecret.LastModified):
+		(scrt.clientSecret == nil && scrt.serverSecret.Deleted):
 
-		return nil, nil
+		return nil, false, nil
 
 	case scrt.clientSecret == nil:
 
-		return scrt.serverSecret, nil
+		return scrt.serverSecret, false, nil
 
 	case scrt.serverSecret == nil:
 
-		err := s.secretRepository.CreateUpdate(ctx, scrt.clientSecret)
-		if err != nil {
-			return nil, errorsutils.WrapError(err)
-		}
+		// секрет создается, если его не создали параллельно: отсутствующий секрет имеет ревизию 0
+		expectedRevision = 0
 
-	case scrt.clientSecret.LastModified.After(scrt.serverSecret.LastModified):
+	case scrt.clientSecret.Hash == scrt.serverSecret.Hash && scrt.clientSecret.Deleted == scrt.serverSecret.Deleted:
 
-		if scrt.clientSecret.Deleted {
-			err := s.secretRepository.Delete(ctx, scrt.clientSecret.UserID, scrt.clientSecret.ID)
-			if err != nil {
-				return nil, errorsutils.WrapError(err)
-			}
+		return nil, false, nil
 
-		} else {
-			err := s.secretRepository.CreateUpdate(ctx, scrt.clientSecret)
-			if err != nil {
-				return nil, errorsutils.WrapError(err)
-			}
+	case scrt.clientSecret.Revision != scrt.serverSecret.Revision:
+
+		return scrt.serverSecret, true, nil
+
+	case scrt.clientSecret.Deleted:
+
+		err = s.DeleteSecret(ctx, scrt.clientSecret.UserID, scrt.clientSecret.ID)
+		if err != nil {
+			return nil, false, errorsutils.WrapError(err)
 		}
 
-	case scrt.serverSecret.LastModified.After(scrt.clientSecret.LastModified):
+		return scrt.clientSecret, false, nil
 
-		return scrt.serverSecret, nil
 	default:
-		log.Println(ErrUnknownTypeOperation, "server secret:", scrt.serverSecret, "client secret:", scrt.clientSecret)
-		return nil, errorsutils.WrapError(ErrUnknownTypeOperation)
+
+		expectedRevision = scrt.clientSecret.Revision
+	}
+
+	err = s.writeSecret(ctx, scrt.clientSecret, &models.ExpectedVersion{Revision: &expectedRevision})
+	if errors.Is(err, repository.ErrSecretConflict) {
+		return s.currentSecret(ctx, scrt.clientSecret.UserID, scrt.clientSecret.ID)
+	}
+	if err != nil {
+		return nil, false, errorsutils.WrapError(err)
 	}
 
 	updatedSecret, err := s.secretRepository.GetByID(ctx, scrt.clientSecret.UserID, scrt.clientSecret.ID)
 	if err != nil {
-		return nil, errorsutils.WrapError(err)
+		return nil, false, errorsutils.WrapError(err)
+	}
+
+	return updatedSecret, false, nil
+}
+
+// currentSecret версия секрета на сервере для конфликта, удаленный секрет отдается с Deleted
+func (s *Service) currentSecret(ctx context.Context, userID, secretID string) (*models.Secret, bool, error) {
+	current, err := s.secretRepository.GetByID(ctx, userID, secretID)
+	if errors.Is(err, repository.ErrSecretNotFound) {
+		return &models.Secret{ID: secretID, UserID: userID, Deleted: true}, true, nil
+	}
+	if err != nil {
+		return nil, false, errorsutils.WrapError(err)
 	}
 
-	return updatedSecret, nil
+	return current, true, nil
 }
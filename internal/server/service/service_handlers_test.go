@@ -0,0 +1,143 @@
+package service_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/s-turchinskiy/keeper/internal/server/models"
+	"github.com/s-turchinskiy/keeper/internal/server/service"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryCache кеш секретов в памяти вместо Redis
+type memoryCache struct {
+	mu      sync.Mutex
+	secrets map[string]models.Secret
+}
+
+func (c *memoryCache) Get(_ context.Context, userID, secretID string) (*models.Secret, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	secret, ok := c.secrets[userID+":"+secretID]
+	if !ok {
+		return nil, nil
+	}
+	return &secret, nil
+}
+
+func (c *memoryCache) Set(_ context.Context, secret *models.Secret) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.secrets[secret.UserID+":"+secret.ID] = *secret
+	return nil
+}
+
+func (c *memoryCache) Del(_ context.Context, userID, secretID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.secrets, userID+":"+secretID)
+	return nil
+}
+
+func TestSyncFromClient(t *testing.T) {
+
+	ctx := context.Background()
+	s := newTestService(t)
+	_, user := login(t, s, "user")
+
+	secret := func(id, hash string, revision int64) *models.Secret {
+		return &models.Secret{ID: id, UserID: user.ID, Hash: hash, Data: []byte(hash), Revision: revision}
+	}
+
+	require.NoError(t, s.CreateSecret(ctx, secret("edited", "v1", 0), nil))
+	base, err := s.GetSecret(ctx, user.ID, "edited")
+	require.NoError(t, err)
+
+	// изменение от текущей ревизии записывается, новый секрет создается
+	updated, conflicts, err := s.SyncFromClient(ctx, user.ID, []*models.Secret{
+		secret("edited", "v2", base.Revision),
+		secret("created", "new", 0),
+	})
+	require.NoError(t, err)
+	require.Empty(t, conflicts)
+	require.Len(t, updated, 2)
+
+	current, err := s.GetSecret(ctx, user.ID, "edited")
+	require.NoError(t, err)
+	require.Equal(t, "v2", current.Hash)
+	require.Greater(t, current.Revision, base.Revision)
+
+	// изменение от устаревшей ревизии не записывается, клиент получает версию с сервера
+	updated, conflicts, err = s.SyncFromClient(ctx, user.ID, []*models.Secret{
+		secret("edited", "stale", base.Revision),
+		secret("created", "other device", 0),
+	})
+	require.NoError(t, err)
+	require.Empty(t, updated)
+	require.Len(t, conflicts, 2)
+
+	unchanged, err := s.GetSecret(ctx, user.ID, "edited")
+	require.NoError(t, err)
+	require.Equal(t, current, unchanged)
+
+	// совпадающий секрет не конфликтует, даже если клиент не знает его ревизию
+	updated, conflicts, err = s.SyncFromClient(ctx, user.ID, []*models.Secret{
+		secret("edited", "v2", 0),
+		secret("created", "new", 0),
+	})
+	require.NoError(t, err)
+	require.Empty(t, updated)
+	require.Empty(t, conflicts)
+
+	// удаление тоже применяется только к текущей ревизии
+	deleted := secret("edited", "", base.Revision)
+	deleted.Deleted = true
+	_, conflicts, err = s.SyncFromClient(ctx, user.ID, []*models.Secret{deleted})
+	require.NoError(t, err)
+	require.Len(t, conflicts, 1)
+
+	deleted.Revision = current.Revision
+	_, conflicts, err = s.SyncFromClient(ctx, user.ID, []*models.Secret{deleted})
+	require.NoError(t, err)
+	require.Empty(t, conflicts)
+
+	trashed, err := s.GetSecret(ctx, user.ID, "edited")
+	require.NoError(t, err)
+	require.True(t, trashed.Deleted)
+}
+
+func TestSyncFromClientInvalidatesCache(t *testing.T) {
+
+	ctx := context.Background()
+	s := newTestService(t, service.WithSecretCache(&memoryCache{secrets: make(map[string]models.Secret)}))
+	_, user := login(t, s, "user")
+
+	require.NoError(t, s.CreateSecret(ctx, &models.Secret{ID: "secret", UserID: user.ID, Hash: "v1", Data: []byte("v1")}, nil))
+	cached, err := s.GetSecret(ctx, user.ID, "secret")
+	require.NoError(t, err)
+
+	_, conflicts, err := s.SyncFromClient(ctx, user.ID, []*models.Secret{
+		{ID: "secret", UserID: user.ID, Hash: "v2", Data: []byte("v2"), Revision: cached.Revision},
+	})
+	require.NoError(t, err)
+	require.Empty(t, conflicts)
+
+	updated, err := s.GetSecret(ctx, user.ID, "secret")
+	require.NoError(t, err)
+	require.Equal(t, "v2", updated.Hash)
+	require.Equal(t, []byte("v2"), updated.Data)
+
+	_, conflicts, err = s.SyncFromClient(ctx, user.ID, []*models.Secret{
+		{ID: "secret", UserID: user.ID, Deleted: true, Revision: updated.Revision},
+	})
+	require.NoError(t, err)
+	require.Empty(t, conflicts)
+
+	deleted, err := s.GetSecret(ctx, user.ID, "secret")
+	require.NoError(t, err)
+	require.True(t, deleted.Deleted)
+}
@@ -0,0 +1,279 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/s-turchinskiy/keeper/internal/server/models"
+	"github.com/s-turchinskiy/keeper/internal/server/repository"
+	"github.com/s-turchinskiy/keeper/internal/server/token"
+	"github.com/s-turchinskiy/keeper/internal/utils/errorsutils"
+	"golang.org/x/crypto/bcrypt"
+	"log"
+	"strings"
+	"time"
+)
+
+// DefaultSessionDuration время жизни токена обновления по умолчанию
+const DefaultSessionDuration = 30 * 24 * time.Hour
+
+const refreshSecretSize = 32
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrTokenRevoked        = errors.New("token revoked")
+)
+
+// Login device - устройство клиента, nil для клиентов без реестра устройств.
+// Если у пользователя включен второй фактор, вместо токенов возвращается *TwoFactorRequiredError
+// и вход продолжается в LoginTwoFactor
+func (s *Service) Login(ctx context.Context, login, password string, device *models.Device) (*models.Tokens, *models.User, error) {
+	user, err := s.usersRepository.GetByLogin(ctx, login)
+	if err != nil {
+		return nil, nil, ErrUserNotFound
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
+	if err != nil {
+		return nil, nil, ErrInvalidCredentials
+	}
+
+	twoFactor, err := s.usersRepository.GetTwoFactor(ctx, user.ID)
+	if err != nil {
+		return nil, nil, errorsutils.WrapError(err)
+	}
+
+	if twoFactor.Enabled() {
+		challenge, expiresAt, err := s.TokenManager.GenerateChallenge(user.ID)
+		if err != nil {
+			return nil, nil, errorsutils.WrapError(err)
+		}
+		return nil, user, &TwoFactorRequiredError{Challenge: challenge, ExpiresAt: expiresAt}
+	}
+
+	tokens, err := s.completeLogin(ctx, user, device)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return tokens, user, nil
+}
+
+// completeLogin регистрирует устройство и открывает сессию пользователя, прошедшего все проверки входа
+func (s *Service) completeLogin(ctx context.Context, user *models.User, device *models.Device) (*models.Tokens, error) {
+
+	var deviceID string
+	if device != nil {
+		registered, err := s.registerDevice(ctx, user.ID, device)
+		if err != nil {
+			return nil, err
+		}
+		deviceID = registered.ID
+	}
+
+	return s.startSession(ctx, user.ID, deviceID)
+}
+
+// RefreshToken выдает новую пару токенов взамен токена обновления, старая пара отзывается.
+// Повторное предъявление уже замененного токена обновления завершает сессию: его могли украсть
+func (s *Service) RefreshToken(ctx context.Context, refreshToken string) (*models.Tokens, error) {
+
+	sessionID, secret, ok := parseRefreshToken(refreshToken)
+	if !ok {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	session, err := s.sessionRepository.GetByID(ctx, sessionID)
+	if errors.Is(err, repository.ErrSessionNotFound) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, errorsutils.WrapError(err)
+	}
+
+	now := time.Now().UTC()
+	if session.RevokedAt != nil || !now.Before(session.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	if subtle.ConstantTimeCompare(hashRefreshSecret(secret), session.RefreshTokenHash) != 1 {
+		log.Printf("refresh token reuse detected, session %s of user %s revoked", session.ID, session.UserID)
+		if err = s.sessionRepository.Revoke(ctx, session.UserID, session.ID); err != nil && !errors.Is(err, repository.ErrSessionNotFound) {
+			return nil, errorsutils.WrapError(err)
+		}
+		return nil, ErrInvalidRefreshToken
+	}
+
+	tokens, next, err := s.issueTokens(session.UserID, session.ID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.sessionRepository.Rotate(ctx, session, next)
+	if errors.Is(err, repository.ErrSessionNotFound) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, errorsutils.WrapError(err)
+	}
+
+	if session.DeviceID != "" {
+		if err = s.deviceRepository.Touch(ctx, session.DeviceID, now); err != nil {
+			log.Printf("device %s last seen update failed: %v", session.DeviceID, err)
+		}
+	}
+
+	return tokens, nil
+}
+
+// Logout завершает текущую сессию или все сессии пользователя, возвращает число завершенных сессий
+func (s *Service) Logout(ctx context.Context, userID, sessionID string, allSessions bool) (int64, error) {
+
+	if allSessions {
+		return s.sessionRepository.RevokeAll(ctx, userID)
+	}
+
+	err := s.sessionRepository.Revoke(ctx, userID, sessionID)
+	if errors.Is(err, repository.ErrSessionNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return 1, nil
+}
+
+// Authenticate проверяет подпись и срок токена доступа и что он не отозван
+func (s *Service) Authenticate(ctx context.Context, accessToken string) (*token.Claims, error) {
+
+	claims, err := s.TokenManager.ValidateToken(accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	revoked, err := s.sessionRepository.IsTokenRevoked(ctx, claims.ID)
+	if err != nil {
+		return nil, errorsutils.WrapError(err)
+	}
+	if revoked {
+		return nil, ErrTokenRevoked
+	}
+
+	return claims, nil
+}
+
+// RunSessionPurge раз в interval удаляет истекшие и отозванные сессии.
+// Блокируется до отмены ctx.
+func (s *Service) RunSessionPurge(ctx context.Context, interval time.Duration) {
+
+	if interval <= 0 {
+		log.Println("session purge disabled")
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.purgeExpiredSessions(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Service) purgeExpiredSessions(ctx context.Context) {
+
+	purged, err := s.sessionRepository.PurgeExpired(ctx, time.Now().UTC())
+	if err != nil {
+		log.Printf("session purge failed: %v", err)
+		return
+	}
+
+	if purged > 0 {
+		log.Printf("session purge: %d sessions deleted", purged)
+	}
+}
+
+func (s *Service) startSession(ctx context.Context, userID, deviceID string) (*models.Tokens, error) {
+
+	now := time.Now().UTC()
+	tokens, session, err := s.issueTokens(userID, uuid.NewString(), now)
+	if err != nil {
+		return nil, err
+	}
+
+	session.DeviceID = deviceID
+	session.CreatedAt = now
+	if err = s.sessionRepository.Create(ctx, session); err != nil {
+		return nil, errorsutils.WrapError(err)
+	}
+
+	return tokens, nil
+}
+
+// issueTokens новая пара токенов сессии и состояние сессии, которое надо сохранить
+func (s *Service) issueTokens(userID, sessionID string, now time.Time) (*models.Tokens, *models.Session, error) {
+
+	accessToken, claims, err := s.TokenManager.GenerateToken(userID, sessionID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	secret := make([]byte, refreshSecretSize)
+	if _, err = rand.Read(secret); err != nil {
+		return nil, nil, err
+	}
+
+	accessExpiresAt := claims.ExpiresAt.UTC()
+	refreshExpiresAt := now.Add(s.sessionDuration)
+
+	tokens := &models.Tokens{
+		SessionID:        sessionID,
+		AccessToken:      accessToken,
+		AccessExpiresAt:  accessExpiresAt,
+		RefreshToken:     sessionID + "." + base64.RawURLEncoding.EncodeToString(secret),
+		RefreshExpiresAt: refreshExpiresAt,
+	}
+
+	session := &models.Session{
+		ID:               sessionID,
+		UserID:           userID,
+		RefreshTokenHash: hashRefreshSecret(secret),
+		AccessTokenID:    claims.ID,
+		AccessExpiresAt:  accessExpiresAt,
+		LastUsedAt:       now,
+		ExpiresAt:        refreshExpiresAt,
+	}
+
+	return tokens, session, nil
+}
+
+// parseRefreshToken токен обновления имеет вид <id сессии>.<секрет в base64url>
+func parseRefreshToken(refreshToken string) (sessionID string, secret []byte, ok bool) {
+
+	sessionID, encoded, found := strings.Cut(refreshToken, ".")
+	if !found || uuid.Validate(sessionID) != nil {
+		return "", nil, false
+	}
+
+	secret, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(secret) != refreshSecretSize {
+		return "", nil, false
+	}
+
+	return sessionID, secret, true
+}
+
+func hashRefreshSecret(secret []byte) []byte {
+	sum := sha256.Sum256(secret)
+	return sum[:]
+}
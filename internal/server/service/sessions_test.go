@@ -0,0 +1,149 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/s-turchinskiy/keeper/internal/server/models"
+	"github.com/s-turchinskiy/keeper/internal/server/repository/sqlite"
+	"github.com/s-turchinskiy/keeper/internal/server/service"
+	"github.com/s-turchinskiy/keeper/internal/server/token"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestService сервис поверх SQLite в памяти
+func newTestService(t *testing.T, opts ...service.OptionService) *service.Service {
+
+	ctx := context.Background()
+	db, err := sqlite.NewSQLiteStorage(ctx, ":memory:", sqlite.WithMigrations())
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close(ctx) })
+
+	return service.NewService(token.NewJWTManager("secret", time.Hour),
+		sqlite.NewUserRepository(db),
+		sqlite.NewSecretRepository(db),
+		sqlite.NewSessionRepository(db),
+		sqlite.NewDeviceRepository(db),
+		opts...)
+}
+
+// login регистрирует пользователя и открывает ему сессию
+func login(t *testing.T, s *service.Service, name string) (*models.Tokens, *models.User) {
+
+	ctx := context.Background()
+	_, err := s.Register(ctx, name, "password", nil)
+	require.NoError(t, err)
+
+	tokens, user, err := s.Login(ctx, name, "password", nil)
+	require.NoError(t, err)
+
+	return tokens, user
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+
+	ctx := context.Background()
+	s := newTestService(t)
+	tokens, user := login(t, s, "user")
+
+	claims, err := s.Authenticate(ctx, tokens.AccessToken)
+	require.NoError(t, err)
+	require.Equal(t, user.ID, claims.UserID)
+	require.Equal(t, tokens.SessionID, claims.SessionID)
+
+	refreshed, err := s.RefreshToken(ctx, tokens.RefreshToken)
+	require.NoError(t, err)
+	require.Equal(t, tokens.SessionID, refreshed.SessionID)
+	require.NotEqual(t, tokens.RefreshToken, refreshed.RefreshToken)
+	require.NotEqual(t, tokens.AccessToken, refreshed.AccessToken)
+
+	// замененный токен доступа отозван, новый действует
+	_, err = s.Authenticate(ctx, tokens.AccessToken)
+	require.ErrorIs(t, err, service.ErrTokenRevoked)
+	_, err = s.Authenticate(ctx, refreshed.AccessToken)
+	require.NoError(t, err)
+
+	again, err := s.RefreshToken(ctx, refreshed.RefreshToken)
+	require.NoError(t, err)
+	_, err = s.Authenticate(ctx, again.AccessToken)
+	require.NoError(t, err)
+}
+
+func TestRefreshTokenReuse(t *testing.T) {
+
+	ctx := context.Background()
+	s := newTestService(t)
+	tokens, _ := login(t, s, "user")
+
+	refreshed, err := s.RefreshToken(ctx, tokens.RefreshToken)
+	require.NoError(t, err)
+
+	// старый токен обновления предъявлен повторно: сессия завершается для обоих владельцев
+	_, err = s.RefreshToken(ctx, tokens.RefreshToken)
+	require.ErrorIs(t, err, service.ErrInvalidRefreshToken)
+
+	_, err = s.RefreshToken(ctx, refreshed.RefreshToken)
+	require.ErrorIs(t, err, service.ErrInvalidRefreshToken)
+	_, err = s.Authenticate(ctx, refreshed.AccessToken)
+	require.ErrorIs(t, err, service.ErrTokenRevoked)
+}
+
+func TestRefreshTokenInvalid(t *testing.T) {
+
+	ctx := context.Background()
+	s := newTestService(t)
+	tokens, _ := login(t, s, "user")
+
+	for _, refreshToken := range []string{
+		"",
+		"not a token",
+		tokens.SessionID,
+		tokens.SessionID + ".short",
+		tokens.AccessToken,
+		"00000000-0000-0000-0000-000000000000" + tokens.RefreshToken[len(tokens.SessionID):],
+	} {
+		_, err := s.RefreshToken(ctx, refreshToken)
+		require.ErrorIs(t, err, service.ErrInvalidRefreshToken, "refresh token %q", refreshToken)
+	}
+
+	// неверные токены не завершают сессию
+	_, err := s.RefreshToken(ctx, tokens.RefreshToken)
+	require.NoError(t, err)
+}
+
+func TestLogout(t *testing.T) {
+
+	ctx := context.Background()
+	s := newTestService(t)
+	first, user := login(t, s, "user")
+	second, _, err := s.Login(ctx, "user", "password", nil)
+	require.NoError(t, err)
+	other, otherUser := login(t, s, "other")
+
+	revoked, err := s.Logout(ctx, user.ID, first.SessionID, false)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), revoked)
+
+	_, err = s.Authenticate(ctx, first.AccessToken)
+	require.ErrorIs(t, err, service.ErrTokenRevoked)
+	_, err = s.RefreshToken(ctx, first.RefreshToken)
+	require.ErrorIs(t, err, service.ErrInvalidRefreshToken)
+	_, err = s.Authenticate(ctx, second.AccessToken)
+	require.NoError(t, err)
+
+	// чужую сессию завершить нельзя
+	revoked, err = s.Logout(ctx, user.ID, other.SessionID, false)
+	require.NoError(t, err)
+	require.Zero(t, revoked)
+
+	revoked, err = s.Logout(ctx, user.ID, second.SessionID, true)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), revoked)
+	_, err = s.Authenticate(ctx, second.AccessToken)
+	require.ErrorIs(t, err, service.ErrTokenRevoked)
+
+	claims, err := s.Authenticate(ctx, other.AccessToken)
+	require.NoError(t, err)
+	require.Equal(t, otherUser.ID, claims.UserID)
+}
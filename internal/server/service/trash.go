@@ -0,0 +1,43 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// RunTrashPurge раз в interval окончательно удаляет секреты, пролежавшие в корзине дольше retention.
+// Блокируется до отмены ctx.
+func (s *Service) RunTrashPurge(ctx context.Context, retention, interval time.Duration) {
+
+	if retention <= 0 || interval <= 0 {
+		log.Println("trash purge disabled")
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.purgeExpiredSecrets(ctx, retention)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Service) purgeExpiredSecrets(ctx context.Context, retention time.Duration) {
+
+	purged, err := s.secretRepository.PurgeExpired(ctx, time.Now().Add(-retention))
+	if err != nil {
+		log.Printf("trash purge failed: %v", err)
+		return
+	}
+
+	if purged > 0 {
+		log.Printf("trash purge: %d secrets deleted permanently", purged)
+	}
+}
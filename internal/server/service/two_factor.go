@@ -0,0 +1,347 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/s-turchinskiy/keeper/internal/server/models"
+	"github.com/s-turchinskiy/keeper/internal/server/repository"
+	"github.com/s-turchinskiy/keeper/internal/utils/errorsutils"
+	"github.com/s-turchinskiy/keeper/internal/utils/otputils"
+)
+
+// DefaultTOTPIssuer издатель в otpauth URI, под ним ключ виден в приложении-аутентификаторе
+const DefaultTOTPIssuer = "Keeper"
+
+const (
+	// totpSkew допуск расхождения часов клиента и сервера в шагах TOTP
+	totpSkew = 1
+
+	recoveryCodesCount = 10
+	recoveryCodeLength = 10
+
+	// maxTwoFactorFailures неверных кодов подряд, после которых проверка кодов пользователя
+	// блокируется на twoFactorLockout
+	maxTwoFactorFailures = 5
+	twoFactorLockout     = 5 * time.Minute
+)
+
+var (
+	ErrInvalidChallenge         = errors.New("invalid two-factor challenge")
+	ErrInvalidTwoFactorCode     = errors.New("invalid two-factor code")
+	ErrTooManyTwoFactorAttempts = errors.New("too many two-factor attempts")
+	ErrTwoFactorAlreadyEnabled  = errors.New("two-factor authentication already enabled")
+	ErrTwoFactorNotEnabled      = errors.New("two-factor authentication not enabled")
+	ErrTwoFactorNotPending      = repository.ErrTOTPNotPending
+)
+
+// TwoFactorRequiredError пароль верный, но вход надо продолжить вторым шагом с Challenge
+type TwoFactorRequiredError struct {
+	Challenge string
+	ExpiresAt time.Time
+}
+
+func (e *TwoFactorRequiredError) Error() string {
+	return "two-factor code required"
+}
+
+// WithClock часы для проверки кодов TOTP, в тестах - детерминированные
+func WithClock(clock func() time.Time) OptionService {
+
+	return func(s *Service) {
+		if clock != nil {
+			s.clock = clock
+		}
+	}
+}
+
+// WithTOTPIssuer издатель в otpauth URI
+func WithTOTPIssuer(issuer string) OptionService {
+
+	return func(s *Service) {
+		if issuer != "" {
+			s.totpIssuer = issuer
+		}
+	}
+}
+
+// LoginTwoFactor второй шаг входа: вызов из первого шага и код TOTP или код восстановления
+func (s *Service) LoginTwoFactor(ctx context.Context, challenge, code string, device *models.Device) (*models.Tokens, *models.User, error) {
+
+	userID, err := s.TokenManager.ValidateChallenge(challenge)
+	if err != nil {
+		return nil, nil, ErrInvalidChallenge
+	}
+
+	user, err := s.usersRepository.GetByID(ctx, userID)
+	if err != nil {
+		return nil, nil, ErrInvalidChallenge
+	}
+
+	twoFactor, err := s.usersRepository.GetTwoFactor(ctx, userID)
+	if err != nil {
+		return nil, nil, errorsutils.WrapError(err)
+	}
+
+	// второй фактор отключили после первого шага: вход начинается заново
+	if !twoFactor.Enabled() {
+		return nil, nil, ErrInvalidChallenge
+	}
+
+	if err = s.verifySecondFactor(ctx, userID, twoFactor.Secret, code); err != nil {
+		return nil, nil, err
+	}
+
+	tokens, err := s.completeLogin(ctx, user, device)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return tokens, user, nil
+}
+
+// EnableTwoFactor начинает подключение TOTP: новый секрет и otpauth URI для приложения-аутентификатора.
+// Второй фактор заработает после подтверждения первым кодом в ConfirmTwoFactor
+func (s *Service) EnableTwoFactor(ctx context.Context, userID string) ([]byte, string, error) {
+
+	user, err := s.usersRepository.GetByID(ctx, userID)
+	if err != nil {
+		return nil, "", ErrUserNotFound
+	}
+
+	twoFactor, err := s.usersRepository.GetTwoFactor(ctx, userID)
+	if err != nil {
+		return nil, "", errorsutils.WrapError(err)
+	}
+
+	if twoFactor.Enabled() {
+		return nil, "", ErrTwoFactorAlreadyEnabled
+	}
+
+	secret, err := otputils.GenerateSecret()
+	if err != nil {
+		return nil, "", errorsutils.WrapError(err)
+	}
+
+	if err = s.usersRepository.SetPendingTOTP(ctx, userID, secret); err != nil {
+		return nil, "", errorsutils.WrapError(err)
+	}
+
+	key := otputils.Key{
+		Type:    otputils.TypeTOTP,
+		Issuer:  s.totpIssuer,
+		Account: user.Login,
+		Secret:  secret,
+		Params:  otputils.DefaultParams(),
+	}
+
+	return secret, key.URI(), nil
+}
+
+// ConfirmTwoFactor включает второй фактор, если code подходит к секрету из EnableTwoFactor.
+// Возвращает коды восстановления, сервер хранит только их хеши
+func (s *Service) ConfirmTwoFactor(ctx context.Context, userID, code string) ([]string, error) {
+
+	twoFactor, err := s.usersRepository.GetTwoFactor(ctx, userID)
+	if err != nil {
+		return nil, errorsutils.WrapError(err)
+	}
+
+	if twoFactor.Enabled() {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	if len(twoFactor.PendingSecret) == 0 {
+		return nil, ErrTwoFactorNotPending
+	}
+
+	now := s.clock()
+	if !s.twoFactorAttempts.allow(userID, now) {
+		return nil, ErrTooManyTwoFactorAttempts
+	}
+
+	step, ok := otputils.VerifyTOTP(twoFactor.PendingSecret, code, now, otputils.DefaultParams(), totpSkew)
+	if !ok {
+		s.twoFactorAttempts.fail(userID, now)
+		return nil, ErrInvalidTwoFactorCode
+	}
+	s.twoFactorAttempts.reset(userID)
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, errorsutils.WrapError(err)
+	}
+
+	err = s.usersRepository.EnableTOTP(ctx, userID, twoFactor.PendingSecret, int64(step), hashes)
+	if errors.Is(err, repository.ErrTOTPNotPending) {
+		return nil, ErrTwoFactorNotPending
+	}
+	if err != nil {
+		return nil, errorsutils.WrapError(err)
+	}
+
+	return codes, nil
+}
+
+// DisableTwoFactor отключает второй фактор, code - действующий код TOTP или код восстановления
+func (s *Service) DisableTwoFactor(ctx context.Context, userID, code string) error {
+
+	twoFactor, err := s.usersRepository.GetTwoFactor(ctx, userID)
+	if err != nil {
+		return errorsutils.WrapError(err)
+	}
+
+	if !twoFactor.Enabled() {
+		return ErrTwoFactorNotEnabled
+	}
+
+	if err = s.verifySecondFactor(ctx, userID, twoFactor.Secret, code); err != nil {
+		return err
+	}
+
+	return s.usersRepository.DisableTOTP(ctx, userID)
+}
+
+// GetTwoFactorStatus состояние второго фактора пользователя
+func (s *Service) GetTwoFactorStatus(ctx context.Context, userID string) (*models.TwoFactor, error) {
+
+	twoFactor, err := s.usersRepository.GetTwoFactor(ctx, userID)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, errorsutils.WrapError(err)
+	}
+
+	return twoFactor, nil
+}
+
+// verifySecondFactor проверяет код TOTP или код восстановления. Принятый шаг TOTP и код восстановления
+// повторно не принимаются, после maxTwoFactorFailures неверных кодов проверка временно блокируется
+func (s *Service) verifySecondFactor(ctx context.Context, userID string, secret []byte, code string) error {
+
+	now := s.clock()
+	if !s.twoFactorAttempts.allow(userID, now) {
+		return ErrTooManyTwoFactorAttempts
+	}
+
+	ok, err := s.useSecondFactor(ctx, userID, secret, code, now)
+	if err != nil {
+		return errorsutils.WrapError(err)
+	}
+
+	if !ok {
+		s.twoFactorAttempts.fail(userID, now)
+		return ErrInvalidTwoFactorCode
+	}
+
+	s.twoFactorAttempts.reset(userID)
+
+	return nil
+}
+
+func (s *Service) useSecondFactor(ctx context.Context, userID string, secret []byte, code string, now time.Time) (bool, error) {
+
+	code = strings.TrimSpace(code)
+	if step, ok := otputils.VerifyTOTP(secret, code, now, otputils.DefaultParams(), totpSkew); ok {
+		return s.usersRepository.UseTOTPStep(ctx, userID, int64(step))
+	}
+
+	codeHash, ok := hashRecoveryCode(code)
+	if !ok {
+		return false, nil
+	}
+
+	return s.usersRepository.UseRecoveryCode(ctx, userID, codeHash)
+}
+
+// generateRecoveryCodes коды восстановления вида XXXXX-XXXXX и их хеши для хранения
+func generateRecoveryCodes() ([]string, [][]byte, error) {
+
+	codes := make([]string, 0, recoveryCodesCount)
+	hashes := make([][]byte, 0, recoveryCodesCount)
+
+	for range recoveryCodesCount {
+		random := make([]byte, 8)
+		if _, err := rand.Read(random); err != nil {
+			return nil, nil, err
+		}
+
+		code := otputils.EncodeSecret(random)[:recoveryCodeLength]
+		hash, _ := hashRecoveryCode(code)
+
+		codes = append(codes, code[:recoveryCodeLength/2]+"-"+code[recoveryCodeLength/2:])
+		hashes = append(hashes, hash)
+	}
+
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode хеш кода без учета регистра, пробелов и дефисов
+func hashRecoveryCode(code string) ([]byte, bool) {
+
+	normalized := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+	if len(normalized) != recoveryCodeLength {
+		return nil, false
+	}
+
+	sum := sha256.Sum256([]byte(normalized))
+	return sum[:], true
+}
+
+// twoFactorLimiter счетчик неверных кодов второго фактора по пользователям
+type twoFactorLimiter struct {
+	mu       sync.Mutex
+	failures map[string]*twoFactorFailures
+}
+
+type twoFactorFailures struct {
+	count int
+	since time.Time
+}
+
+func (l *twoFactorLimiter) allow(userID string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	failures, ok := l.failures[userID]
+	if !ok {
+		return true
+	}
+
+	if now.Sub(failures.since) >= twoFactorLockout {
+		delete(l.failures, userID)
+		return true
+	}
+
+	return failures.count < maxTwoFactorFailures
+}
+
+func (l *twoFactorLimiter) fail(userID string, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.failures == nil {
+		l.failures = make(map[string]*twoFactorFailures)
+	}
+
+	failures, ok := l.failures[userID]
+	if !ok {
+		failures = &twoFactorFailures{since: now}
+		l.failures[userID] = failures
+	}
+
+	failures.count++
+}
+
+func (l *twoFactorLimiter) reset(userID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.failures, userID)
+}
@@ -1,6 +1,10 @@
 package token
 
+import "time"
+
 type TokenManager interface {
-	GenerateToken(userID string) (string, error)
-	ValidateToken(tokenString string) (string, error)
+	GenerateToken(userID, sessionID string) (string, *Claims, error)
+	ValidateToken(tokenString string) (*Claims, error)
+	GenerateChallenge(userID string) (string, time.Time, error)
+	ValidateChallenge(challenge string) (string, error)
 }
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
 var (
@@ -13,6 +14,20 @@ var (
 	ErrInvalidUserID = errors.New("invalid user id in token")
 )
 
+// ChallengeDuration сколько действует вызов второго шага входа
+const ChallengeDuration = 5 * time.Minute
+
+// challengeAudience отличает вызов второго шага от токена доступа: у вызова нет сессии,
+// а токен доступа не принимается как вызов
+const challengeAudience = "keeper-2fa"
+
+// Claims содержимое токена доступа: ID (jti) уникален для каждого токена, по нему токен отзывается
+type Claims struct {
+	UserID    string `json:"user_id"`
+	SessionID string `json:"sid"`
+	jwt.RegisteredClaims
+}
+
 type JWTManager struct {
 	secret string
 	expiry time.Duration
@@ -25,34 +40,90 @@ func NewJWTManager(secret string, expiry time.Duration) *JWTManager {
 	}
 }
 
-func (m *JWTManager) GenerateToken(userID string) (string, error) {
-	claims := jwt.MapClaims{
-		"user_id": userID,
-		"exp":     time.Now().Add(m.expiry).Unix(),
+func (m *JWTManager) GenerateToken(userID, sessionID string) (string, *Claims, error) {
+	now := time.Now()
+	claims := &Claims{
+		UserID:    userID,
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(m.expiry)),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	signed, err := token.SignedString([]byte(m.secret))
+	if err != nil {
+		return "", nil, err
+	}
+
+	return signed, claims, nil
+}
+
+func (m *JWTManager) ValidateToken(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (any, error) {
+		return []byte(m.secret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+
+	if claims.ID == "" || claims.SessionID == "" || len(claims.Audience) > 0 {
+		return nil, ErrInvalidClaims
+	}
+
+	if claims.UserID == "" {
+		return nil, ErrInvalidUserID
+	}
+
+	return claims, nil
+}
+
+// GenerateChallenge вызов второго шага входа: пароль пользователя проверен, ждем код второго фактора
+func (m *JWTManager) GenerateChallenge(userID string) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(ChallengeDuration)
+	claims := &Claims{
+		UserID: userID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Audience:  jwt.ClaimStrings{challengeAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(m.secret))
+	signed, err := token.SignedString([]byte(m.secret))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return signed, expiresAt, nil
 }
 
-func (m *JWTManager) ValidateToken(tokenString string) (string, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (any, error) {
+// ValidateChallenge id пользователя из вызова второго шага входа
+func (m *JWTManager) ValidateChallenge(challenge string) (string, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(challenge, claims, func(token *jwt.Token) (any, error) {
 		return []byte(m.secret), nil
-	})
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired(),
+		jwt.WithAudience(challengeAudience))
 
 	if err != nil || !token.Valid {
 		return "", ErrInvalidToken
 	}
 
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
+	if claims.SessionID != "" {
 		return "", ErrInvalidClaims
 	}
 
-	userID, ok := claims["user_id"].(string)
-	if !ok {
+	if claims.UserID == "" {
 		return "", ErrInvalidUserID
 	}
 
-	return userID, nil
+	return claims.UserID, nil
 }
@@ -0,0 +1,61 @@
+package token
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateToken(t *testing.T) {
+
+	manager := NewJWTManager("secret", time.Hour)
+
+	first, claims, err := manager.GenerateToken("user", "session")
+	require.NoError(t, err)
+	second, secondClaims, err := manager.GenerateToken("user", "session")
+	require.NoError(t, err)
+
+	// у каждого токена свой jti, иначе отзыв одного токена отзывает и другие
+	require.NotEqual(t, claims.ID, secondClaims.ID)
+
+	validated, err := manager.ValidateToken(first)
+	require.NoError(t, err)
+	require.Equal(t, claims.ID, validated.ID)
+	require.Equal(t, "user", validated.UserID)
+	require.Equal(t, "session", validated.SessionID)
+
+	_, err = manager.ValidateToken(second)
+	require.NoError(t, err)
+}
+
+func TestValidateToken(t *testing.T) {
+
+	manager := NewJWTManager("secret", time.Hour)
+
+	accessToken, _, err := manager.GenerateToken("user", "session")
+	require.NoError(t, err)
+	challenge, _, err := manager.GenerateChallenge("user")
+	require.NoError(t, err)
+	expired, _, err := NewJWTManager("secret", -time.Minute).GenerateToken("user", "session")
+	require.NoError(t, err)
+	withoutSession, _, err := manager.GenerateToken("user", "")
+	require.NoError(t, err)
+
+	_, err = NewJWTManager("other", time.Hour).ValidateToken(accessToken)
+	require.ErrorIs(t, err, ErrInvalidToken)
+	_, err = manager.ValidateToken(expired)
+	require.ErrorIs(t, err, ErrInvalidToken)
+	_, err = manager.ValidateToken(withoutSession)
+	require.ErrorIs(t, err, ErrInvalidClaims)
+
+	// вызов второго шага не заменяет токен доступа и наоборот
+	_, err = manager.ValidateToken(challenge)
+	require.ErrorIs(t, err, ErrInvalidClaims)
+	_, err = manager.ValidateChallenge(accessToken)
+	require.ErrorIs(t, err, ErrInvalidToken)
+
+	userID, err := manager.ValidateChallenge(challenge)
+	require.NoError(t, err)
+	require.Equal(t, "user", userID)
+}
@@ -5,6 +5,8 @@ cd /home/stanislav/go/keeper && export PATH=$PATH:$(go env GOPATH)/bin &&
 
 mockgen -destination=internal/server/repository/mock/mock_user_repository.go -package=mockserverrepository github.com/s-turchinskiy/keeper/internal/server/repository UserRepositorier
 mockgen -destination=internal/server/repository/mock/mock_secret_repository.go -package=mockserverrepository github.com/s-turchinskiy/keeper/internal/server/repository SecretRepositorier
+mockgen -destination=internal/server/repository/mock/mock_session_repository.go -package=mockserverrepository github.com/s-turchinskiy/keeper/internal/server/repository SessionRepositorier
+mockgen -destination=internal/server/repository/mock/mock_device_repository.go -package=mockserverrepository github.com/s-turchinskiy/keeper/internal/server/repository DeviceRepositorier
 mockgen -destination=internal/client/repository/mock/mock.go -package=mocksclientrepository github.com/s-turchinskiy/keeper/internal/client/repository Repositorier
 
 cd /home/stanislav/go/keeper && go test -v -coverpkg=./... -coverprofile=coverage.html ./...
@@ -0,0 +1,350 @@
+// Package otputils одноразовые пароли HOTP (RFC 4226) и TOTP (RFC 6238), ключи в формате otpauth://
+package otputils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Algorithm хеш-функция HMAC
+type Algorithm string
+
+const (
+	AlgorithmSHA1   Algorithm = "SHA1"
+	AlgorithmSHA256 Algorithm = "SHA256"
+	AlgorithmSHA512 Algorithm = "SHA512"
+)
+
+const (
+	DefaultDigits = 6
+	DefaultPeriod = 30 * time.Second
+	// SecretSize размер генерируемого секрета, 160 бит по рекомендации RFC 4226
+	SecretSize = 20
+)
+
+var (
+	ErrInvalidSecret    = errors.New("invalid otp secret")
+	ErrInvalidAlgorithm = errors.New("unsupported otp algorithm")
+	ErrInvalidDigits    = errors.New("otp digits must be from 6 to 8")
+	ErrInvalidPeriod    = errors.New("otp period must be a positive whole number of seconds")
+	ErrInvalidURI       = errors.New("invalid otpauth uri")
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// Params параметры генерации кодов
+type Params struct {
+	Algorithm Algorithm
+	Digits    int
+	Period    time.Duration
+}
+
+// DefaultParams параметры, которые понимают все приложения-аутентификаторы
+func DefaultParams() Params {
+	return Params{
+		Algorithm: AlgorithmSHA1,
+		Digits:    DefaultDigits,
+		Period:    DefaultPeriod,
+	}
+}
+
+// Validate проверка параметров
+func (p Params) Validate() error {
+
+	if _, err := p.Algorithm.hash(); err != nil {
+		return err
+	}
+
+	if p.Digits < 6 || p.Digits > 8 {
+		return ErrInvalidDigits
+	}
+
+	// шаги TOTP и время до смены кода считаются в целых секундах
+	if p.Period < time.Second || p.Period%time.Second != 0 {
+		return ErrInvalidPeriod
+	}
+
+	return nil
+}
+
+// ParseAlgorithm без учета регистра, пустая строка - SHA1
+func ParseAlgorithm(value string) (Algorithm, error) {
+
+	if value == "" {
+		return AlgorithmSHA1, nil
+	}
+
+	algorithm := Algorithm(strings.ToUpper(value))
+	if _, err := algorithm.hash(); err != nil {
+		return "", err
+	}
+
+	return algorithm, nil
+}
+
+func (a Algorithm) hash() (func() hash.Hash, error) {
+
+	switch a {
+	case AlgorithmSHA1:
+		return sha1.New, nil
+	case AlgorithmSHA256:
+		return sha256.New, nil
+	case AlgorithmSHA512:
+		return sha512.New, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrInvalidAlgorithm, a)
+	}
+}
+
+// GenerateSecret случайный секрет размера SecretSize
+func GenerateSecret() ([]byte, error) {
+
+	secret := make([]byte, SecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+
+	return secret, nil
+}
+
+// EncodeSecret base32 без выравнивания, как его ждут приложения-аутентификаторы
+func EncodeSecret(secret []byte) string {
+	return encoding.EncodeToString(secret)
+}
+
+// DecodeSecret обратное к EncodeSecret, допускает пробелы, нижний регистр и выравнивание
+func DecodeSecret(value string) ([]byte, error) {
+
+	value = strings.ToUpper(strings.Join(strings.Fields(value), ""))
+	value = strings.TrimRight(value, "=")
+
+	secret, err := encoding.DecodeString(value)
+	if err != nil || len(secret) == 0 {
+		return nil, ErrInvalidSecret
+	}
+
+	return secret, nil
+}
+
+// HOTP код для значения счетчика
+func HOTP(secret []byte, counter uint64, params Params) (string, error) {
+
+	if err := params.Validate(); err != nil {
+		return "", err
+	}
+
+	if len(secret) == 0 {
+		return "", ErrInvalidSecret
+	}
+
+	newHash, _ := params.Algorithm.hash()
+	mac := hmac.New(newHash, secret)
+
+	var message [8]byte
+	binary.BigEndian.PutUint64(message[:], counter)
+	mac.Write(message[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	modulo := uint32(1)
+	for range params.Digits {
+		modulo *= 10
+	}
+
+	return fmt.Sprintf("%0*d", params.Digits, value%modulo), nil
+}
+
+// Step номер временного шага TOTP для момента t, 0 для периода короче секунды
+func Step(t time.Time, period time.Duration) uint64 {
+	seconds := int64(period / time.Second)
+	if seconds <= 0 {
+		return 0
+	}
+	return uint64(t.Unix() / seconds)
+}
+
+// Remaining сколько осталось до смены кода TOTP, 0 для периода короче секунды
+func Remaining(t time.Time, period time.Duration) time.Duration {
+	seconds := int64(period / time.Second)
+	if seconds <= 0 {
+		return 0
+	}
+	return time.Duration(seconds-t.Unix()%seconds) * time.Second
+}
+
+// TOTP код для момента t
+func TOTP(secret []byte, t time.Time, params Params) (string, error) {
+
+	if err := params.Validate(); err != nil {
+		return "", err
+	}
+
+	return HOTP(secret, Step(t, params.Period), params)
+}
+
+// VerifyTOTP проверяет код с допуском skew шагов в обе стороны от t.
+// Возвращает шаг, на котором код совпал, чтобы вызывающий мог запретить его повторное использование
+func VerifyTOTP(secret []byte, code string, t time.Time, params Params, skew int) (uint64, bool) {
+
+	if params.Validate() != nil {
+		return 0, false
+	}
+
+	code = strings.TrimSpace(code)
+	if len(code) != params.Digits {
+		return 0, false
+	}
+
+	current := Step(t, params.Period)
+	for delta := -skew; delta <= skew; delta++ {
+
+		if delta < 0 && current < uint64(-delta) {
+			continue
+		}
+
+		step := current + uint64(delta)
+		expected, err := HOTP(secret, step, params)
+		if err != nil {
+			return 0, false
+		}
+
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
+
+// Key ключ в формате otpauth://, Type - "totp" или "hotp"
+type Key struct {
+	Type    string
+	Issuer  string
+	Account string
+	Secret  []byte
+	Params  Params
+	Counter uint64
+}
+
+const (
+	TypeTOTP = "totp"
+	TypeHOTP = "hotp"
+)
+
+// URI ключ в формате otpauth:// для QR кода приложения-аутентификатора
+func (k Key) URI() string {
+
+	label := k.Account
+	if k.Issuer != "" {
+		label = k.Issuer + ":" + k.Account
+	}
+
+	query := url.Values{}
+	query.Set("secret", EncodeSecret(k.Secret))
+	if k.Issuer != "" {
+		query.Set("issuer", k.Issuer)
+	}
+	query.Set("algorithm", string(k.Params.Algorithm))
+	query.Set("digits", strconv.Itoa(k.Params.Digits))
+
+	if k.Type == TypeHOTP {
+		query.Set("counter", strconv.FormatUint(k.Counter, 10))
+	} else {
+		query.Set("period", strconv.Itoa(int(k.Params.Period/time.Second)))
+	}
+
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     k.typeOrDefault(),
+		Path:     "/" + label,
+		RawQuery: query.Encode(),
+	}
+
+	return u.String()
+}
+
+func (k Key) typeOrDefault() string {
+	if k.Type == "" {
+		return TypeTOTP
+	}
+	return k.Type
+}
+
+// ParseURI разбирает ключ otpauth://totp/... или otpauth://hotp/..., отсутствующие параметры - по умолчанию
+func ParseURI(uri string) (*Key, error) {
+
+	u, err := url.Parse(strings.TrimSpace(uri))
+	if err != nil || u.Scheme != "otpauth" {
+		return nil, ErrInvalidURI
+	}
+
+	key := &Key{
+		Type:   strings.ToLower(u.Host),
+		Params: DefaultParams(),
+	}
+	if key.Type != TypeTOTP && key.Type != TypeHOTP {
+		return nil, fmt.Errorf("%w: unknown type %q", ErrInvalidURI, u.Host)
+	}
+
+	label := strings.TrimPrefix(u.Path, "/")
+	if issuer, account, found := strings.Cut(label, ":"); found {
+		key.Issuer = strings.TrimSpace(issuer)
+		key.Account = strings.TrimSpace(account)
+	} else {
+		key.Account = strings.TrimSpace(label)
+	}
+
+	query := u.Query()
+	if issuer := query.Get("issuer"); issuer != "" {
+		key.Issuer = issuer
+	}
+
+	if key.Secret, err = DecodeSecret(query.Get("secret")); err != nil {
+		return nil, err
+	}
+
+	if key.Params.Algorithm, err = ParseAlgorithm(query.Get("algorithm")); err != nil {
+		return nil, err
+	}
+
+	if value := query.Get("digits"); value != "" {
+		if key.Params.Digits, err = strconv.Atoi(value); err != nil {
+			return nil, ErrInvalidDigits
+		}
+	}
+
+	if value := query.Get("period"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds <= 0 {
+			return nil, ErrInvalidPeriod
+		}
+		key.Params.Period = time.Duration(seconds) * time.Second
+	}
+
+	if value := query.Get("counter"); value != "" {
+		if key.Counter, err = strconv.ParseUint(value, 10, 64); err != nil {
+			return nil, fmt.Errorf("%w: invalid counter", ErrInvalidURI)
+		}
+	}
+
+	if err = key.Params.Validate(); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
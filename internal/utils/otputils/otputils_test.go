@@ -0,0 +1,214 @@
+package otputils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// секреты тестовых векторов RFC 6238, Appendix B: для каждой хеш-функции свой размер
+var (
+	rfcSecretSHA1   = []byte("12345678901234567890")
+	rfcSecretSHA256 = []byte("12345678901234567890123456789012")
+	rfcSecretSHA512 = []byte("1234567890123456789012345678901234567890123456789012345678901234")
+)
+
+// TestHOTP RFC 4226, Appendix D
+func TestHOTP(t *testing.T) {
+
+	codes := []string{"755224", "287082", "359152", "969429", "338314", "254676", "287922", "162583", "399871", "520489"}
+
+	for counter, want := range codes {
+		code, err := HOTP(rfcSecretSHA1, uint64(counter), DefaultParams())
+		require.NoError(t, err)
+		require.Equal(t, want, code, "counter %d", counter)
+	}
+}
+
+// TestTOTP RFC 6238, Appendix B
+func TestTOTP(t *testing.T) {
+
+	tests := []struct {
+		unix   int64
+		sha1   string
+		sha256 string
+		sha512 string
+	}{
+		{unix: 59, sha1: "94287082", sha256: "46119246", sha512: "90693936"},
+		{unix: 1111111109, sha1: "07081804", sha256: "68084774", sha512: "25091201"},
+		{unix: 1111111111, sha1: "14050471", sha256: "67062674", sha512: "99943326"},
+		{unix: 1234567890, sha1: "89005924", sha256: "91819424", sha512: "93441116"},
+		{unix: 2000000000, sha1: "69279037", sha256: "90698825", sha512: "38618901"},
+		{unix: 20000000000, sha1: "65353130", sha256: "77737706", sha512: "47863826"},
+	}
+
+	for _, tt := range tests {
+		for _, vector := range []struct {
+			algorithm Algorithm
+			secret    []byte
+			want      string
+		}{
+			{algorithm: AlgorithmSHA1, secret: rfcSecretSHA1, want: tt.sha1},
+			{algorithm: AlgorithmSHA256, secret: rfcSecretSHA256, want: tt.sha256},
+			{algorithm: AlgorithmSHA512, secret: rfcSecretSHA512, want: tt.sha512},
+		} {
+			params := Params{Algorithm: vector.algorithm, Digits: 8, Period: DefaultPeriod}
+			code, err := TOTP(vector.secret, time.Unix(tt.unix, 0), params)
+			require.NoError(t, err)
+			require.Equal(t, vector.want, code, "%s at %d", vector.algorithm, tt.unix)
+		}
+	}
+}
+
+func TestInvalidParams(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		params Params
+		want   error
+	}{
+		{name: "algorithm", params: Params{Algorithm: "MD5", Digits: 6, Period: DefaultPeriod}, want: ErrInvalidAlgorithm},
+		{name: "too few digits", params: Params{Algorithm: AlgorithmSHA1, Digits: 5, Period: DefaultPeriod}, want: ErrInvalidDigits},
+		{name: "too many digits", params: Params{Algorithm: AlgorithmSHA1, Digits: 9, Period: DefaultPeriod}, want: ErrInvalidDigits},
+		{name: "zero period", params: Params{Algorithm: AlgorithmSHA1, Digits: 6}, want: ErrInvalidPeriod},
+		{name: "period under a second", params: Params{Algorithm: AlgorithmSHA1, Digits: 6, Period: time.Millisecond}, want: ErrInvalidPeriod},
+		{name: "fractional period", params: Params{Algorithm: AlgorithmSHA1, Digits: 6, Period: 1500 * time.Millisecond}, want: ErrInvalidPeriod},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := TOTP(rfcSecretSHA1, time.Unix(59, 0), tt.params)
+			require.ErrorIs(t, err, tt.want)
+		})
+	}
+
+	_, err := HOTP(nil, 0, DefaultParams())
+	require.ErrorIs(t, err, ErrInvalidSecret)
+}
+
+func TestSubSecondPeriod(t *testing.T) {
+
+	params := DefaultParams()
+	code, err := TOTP(rfcSecretSHA1, time.Unix(59, 0), params)
+	require.NoError(t, err)
+
+	// период короче секунды отклоняется, а не приводит к делению на ноль
+	params.Period = time.Millisecond
+	require.ErrorIs(t, params.Validate(), ErrInvalidPeriod)
+	require.NotPanics(t, func() {
+		_, ok := VerifyTOTP(rfcSecretSHA1, code, time.Unix(59, 0), params, 1)
+		require.False(t, ok)
+		require.Zero(t, Remaining(time.Unix(59, 0), params.Period))
+		require.Zero(t, Step(time.Unix(59, 0), params.Period))
+	})
+}
+
+func TestVerifyTOTP(t *testing.T) {
+
+	params := DefaultParams()
+	now := time.Unix(1111111111, 0)
+	current := Step(now, params.Period)
+
+	codeAt := func(step uint64) string {
+		code, err := HOTP(rfcSecretSHA1, step, params)
+		require.NoError(t, err)
+		return code
+	}
+
+	tests := []struct {
+		name     string
+		code     string
+		skew     int
+		wantStep uint64
+		wantOK   bool
+	}{
+		{name: "current step", code: codeAt(current), skew: 0, wantStep: current, wantOK: true},
+		{name: "spaces around code", code: " " + codeAt(current) + "\n", skew: 0, wantStep: current, wantOK: true},
+		{name: "previous step without skew", code: codeAt(current - 1), skew: 0},
+		{name: "previous step", code: codeAt(current - 1), skew: 1, wantStep: current - 1, wantOK: true},
+		{name: "next step", code: codeAt(current + 1), skew: 1, wantStep: current + 1, wantOK: true},
+		{name: "outside skew", code: codeAt(current - 2), skew: 1},
+		{name: "wrong length", code: codeAt(current)[1:], skew: 1},
+		{name: "wrong code", code: "000000", skew: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := VerifyTOTP(rfcSecretSHA1, tt.code, now, params, tt.skew)
+			require.Equal(t, tt.wantOK, ok)
+			require.Equal(t, tt.wantStep, step)
+		})
+	}
+
+	// шаг совпавшего кода не зависит от момента проверки: по нему вызывающий отклоняет повторное
+	// использование кода и в соседнем шаге
+	code := codeAt(current)
+	first, ok := VerifyTOTP(rfcSecretSHA1, code, now, params, 1)
+	require.True(t, ok)
+	replayed, ok := VerifyTOTP(rfcSecretSHA1, code, now.Add(params.Period), params, 1)
+	require.True(t, ok)
+	require.Equal(t, first, replayed)
+
+	// у начала эпохи нет предыдущих шагов
+	step, ok := VerifyTOTP(rfcSecretSHA1, codeAt(0), time.Unix(0, 0), params, 1)
+	require.True(t, ok)
+	require.Zero(t, step)
+}
+
+func TestParseURI(t *testing.T) {
+
+	secret, err := GenerateSecret()
+	require.NoError(t, err)
+
+	keys := []Key{
+		{Type: TypeTOTP, Issuer: "Keeper", Account: "user@example.com", Secret: secret, Params: DefaultParams()},
+		{Type: TypeTOTP, Account: "user", Secret: secret,
+			Params: Params{Algorithm: AlgorithmSHA512, Digits: 8, Period: 60 * time.Second}},
+		{Type: TypeHOTP, Issuer: "Bank", Account: "user", Secret: secret,
+			Params: Params{Algorithm: AlgorithmSHA256, Digits: 7, Period: DefaultPeriod}, Counter: 42},
+	}
+
+	for _, key := range keys {
+		parsed, err := ParseURI(key.URI())
+		require.NoError(t, err)
+		require.Equal(t, key, *parsed, key.URI())
+	}
+
+	// отсутствующие параметры по умолчанию, регистр алгоритма и секрета не важен
+	parsed, err := ParseURI("otpauth://totp/Issuer:account?secret=" + "gezdgnbvgy3tqojqgezdgnbvgy3tqojq" + "&algorithm=sha256")
+	require.NoError(t, err)
+	require.Equal(t, &Key{Type: TypeTOTP, Issuer: "Issuer", Account: "account", Secret: rfcSecretSHA1,
+		Params: Params{Algorithm: AlgorithmSHA256, Digits: DefaultDigits, Period: DefaultPeriod}}, parsed)
+}
+
+func TestParseURIInvalid(t *testing.T) {
+
+	const secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+	tests := []struct {
+		name string
+		uri  string
+		want error
+	}{
+		{name: "scheme", uri: "https://totp/user?secret=" + secret, want: ErrInvalidURI},
+		{name: "type", uri: "otpauth://motp/user?secret=" + secret, want: ErrInvalidURI},
+		{name: "no secret", uri: "otpauth://totp/user", want: ErrInvalidSecret},
+		{name: "bad secret", uri: "otpauth://totp/user?secret=1!", want: ErrInvalidSecret},
+		{name: "algorithm", uri: "otpauth://totp/user?algorithm=MD5&secret=" + secret, want: ErrInvalidAlgorithm},
+		{name: "digits not a number", uri: "otpauth://totp/user?digits=six&secret=" + secret, want: ErrInvalidDigits},
+		{name: "too few digits", uri: "otpauth://totp/user?digits=5&secret=" + secret, want: ErrInvalidDigits},
+		{name: "too many digits", uri: "otpauth://totp/user?digits=9&secret=" + secret, want: ErrInvalidDigits},
+		{name: "zero period", uri: "otpauth://totp/user?period=0&secret=" + secret, want: ErrInvalidPeriod},
+		{name: "negative period", uri: "otpauth://totp/user?period=-30&secret=" + secret, want: ErrInvalidPeriod},
+		{name: "period not a number", uri: "otpauth://totp/user?period=1m&secret=" + secret, want: ErrInvalidPeriod},
+		{name: "counter", uri: "otpauth://hotp/user?counter=-1&secret=" + secret, want: ErrInvalidURI},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseURI(tt.uri)
+			require.ErrorIs(t, err, tt.want)
+		})
+	}
+}
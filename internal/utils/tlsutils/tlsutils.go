@@ -0,0 +1,110 @@
+// Package tlsutils настройки TLS для GRPC сервера и клиента из файлов сертификатов в PEM
+package tlsutils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// DefaultMinVersion TLS 1.2, более старые версии не принимаются ни сервером, ни клиентом
+const DefaultMinVersion = tls.VersionTLS12
+
+var versions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// ParseVersion минимальная версия TLS: "1.2" или "1.3"
+func ParseVersion(value string) (uint16, error) {
+
+	version, ok := versions[value]
+	if !ok {
+		return 0, fmt.Errorf("unsupported TLS version %q, expected 1.2 or 1.3", value)
+	}
+
+	return version, nil
+}
+
+// VersionName обратное к ParseVersion
+func VersionName(version uint16) string {
+
+	for name, v := range versions {
+		if v == version {
+			return name
+		}
+	}
+
+	return tls.VersionName(version)
+}
+
+// ServerConfig сертификат сервера certFile и ключ keyFile. Если задан clientCAFile,
+// клиент обязан предъявить сертификат, подписанный одним из CA из этого файла
+func ServerConfig(certFile, keyFile, clientCAFile string, minVersion uint16) (*tls.Config, error) {
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load server certificate: %w", err)
+	}
+
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   minVersion,
+	}
+
+	if clientCAFile != "" {
+		pool, err := loadCertPool(clientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return cfg, nil
+}
+
+// ClientConfig caFile - сервер проверяется только этими CA вместо системных, serverName - имя в сертификате
+// сервера, если оно не совпадает с адресом подключения, certFile и keyFile - сертификат клиента для mTLS.
+// Пустые значения - поведение по умолчанию
+func ClientConfig(caFile, serverName, certFile, keyFile string) (*tls.Config, error) {
+
+	cfg := &tls.Config{
+		ServerName: serverName,
+		MinVersion: DefaultMinVersion,
+	}
+
+	if caFile != "" {
+		pool, err := loadCertPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = pool
+	}
+
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
+
+func loadCertPool(caFile string) (*x509.CertPool, error) {
+
+	data, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("read CA bundle: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("CA bundle %s contains no PEM certificates", caFile)
+	}
+
+	return pool, nil
+}
@@ -0,0 +1,196 @@
+package tlsutils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const serverName = "keeper.test"
+
+// testCA удостоверяющий центр, выпускающий сертификаты в файлы каталога dir
+type testCA struct {
+	dir  string
+	file string
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T, dir, name string) *testCA {
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	ca := &testCA{dir: dir, file: filepath.Join(dir, name+".pem"), cert: cert, key: key}
+	writePEM(t, ca.file, "CERTIFICATE", der)
+	return ca
+}
+
+// issue сертификат и ключ для name
+func (ca *testCA) issue(t *testing.T, serial int64, name string, usage x509.ExtKeyUsage) (certFile, keyFile string) {
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	certFile, keyFile = filepath.Join(ca.dir, name+".pem"), filepath.Join(ca.dir, name+".key")
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "PRIVATE KEY", keyDER)
+	return certFile, keyFile
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600))
+}
+
+// handshake соединяет клиента с сервером по TCP и возвращает ошибки рукопожатия сервера и клиента
+func handshake(t *testing.T, serverCfg, clientCfg *tls.Config) (serverErr, clientErr error) {
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", serverCfg)
+	require.NoError(t, err)
+	defer listener.Close()
+
+	serverErrs := make(chan error, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			serverErrs <- err
+			return
+		}
+		defer conn.Close()
+
+		err = conn.(*tls.Conn).Handshake()
+		if err == nil {
+			_, err = conn.Write([]byte{1})
+		}
+		serverErrs <- err
+	}()
+
+	conn, err := tls.Dial("tcp", listener.Addr().String(), clientCfg)
+	if err == nil {
+		// в TLS 1.3 клиент узнает об отказе сервера только при чтении
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, err = conn.Read(make([]byte, 1))
+		_ = conn.Close()
+	}
+
+	return <-serverErrs, err
+}
+
+func TestMutualTLS(t *testing.T) {
+
+	dir := t.TempDir()
+	ca := newTestCA(t, dir, "ca")
+	serverCert, serverKey := ca.issue(t, 2, serverName, x509.ExtKeyUsageServerAuth)
+	clientCert, clientKey := ca.issue(t, 3, "client", x509.ExtKeyUsageClientAuth)
+
+	untrusted := newTestCA(t, dir, "untrusted")
+	untrustedCert, untrustedKey := untrusted.issue(t, 2, "intruder", x509.ExtKeyUsageClientAuth)
+
+	serverCfg, err := ServerConfig(serverCert, serverKey, ca.file, DefaultMinVersion)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name          string
+		serverName    string
+		certFile      string
+		keyFile       string
+		wantServerErr bool
+		wantClientErr bool
+	}{
+		{name: "client certificate", serverName: serverName, certFile: clientCert, keyFile: clientKey},
+		{name: "no client certificate", serverName: serverName, wantServerErr: true, wantClientErr: true},
+		{name: "client certificate from untrusted CA", serverName: serverName, certFile: untrustedCert, keyFile: untrustedKey,
+			wantServerErr: true, wantClientErr: true},
+		{name: "wrong server name", serverName: "other.test", certFile: clientCert, keyFile: clientKey,
+			wantServerErr: true, wantClientErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientCfg, err := ClientConfig(ca.file, tt.serverName, tt.certFile, tt.keyFile)
+			require.NoError(t, err)
+
+			serverErr, clientErr := handshake(t, serverCfg, clientCfg)
+			require.Equal(t, tt.wantServerErr, serverErr != nil, "server error: %v", serverErr)
+			require.Equal(t, tt.wantClientErr, clientErr != nil, "client error: %v", clientErr)
+		})
+	}
+}
+
+func TestClientConfigUntrustedServer(t *testing.T) {
+
+	dir := t.TempDir()
+	ca := newTestCA(t, dir, "ca")
+	serverCert, serverKey := newTestCA(t, dir, "other").issue(t, 2, serverName, x509.ExtKeyUsageServerAuth)
+
+	serverCfg, err := ServerConfig(serverCert, serverKey, "", DefaultMinVersion)
+	require.NoError(t, err)
+	clientCfg, err := ClientConfig(ca.file, serverName, "", "")
+	require.NoError(t, err)
+
+	serverErr, clientErr := handshake(t, serverCfg, clientCfg)
+	require.Error(t, serverErr)
+	require.Error(t, clientErr)
+}
+
+func TestConfigFiles(t *testing.T) {
+
+	dir := t.TempDir()
+	notPEM := filepath.Join(dir, "empty.pem")
+	require.NoError(t, os.WriteFile(notPEM, []byte("not a certificate"), 0600))
+
+	_, err := ClientConfig(notPEM, "", "", "")
+	require.Error(t, err)
+	_, err = ClientConfig(filepath.Join(dir, "missing.pem"), "", "", "")
+	require.Error(t, err)
+	_, err = ClientConfig("", "", notPEM, notPEM)
+	require.Error(t, err)
+	_, err = ServerConfig(notPEM, notPEM, "", DefaultMinVersion)
+	require.Error(t, err)
+
+	version, err := ParseVersion("1.3")
+	require.NoError(t, err)
+	require.Equal(t, "1.3", VersionName(version))
+	_, err = ParseVersion("1.1")
+	require.Error(t, err)
+}
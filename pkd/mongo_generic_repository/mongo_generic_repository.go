@@ -87,6 +87,25 @@ func (r *Repository[T]) GetByKey(ctx context.Context, keyValue string) (*T, erro
 	return &doc, nil
 }
 
+func (r *Repository[T]) GetByField(ctx context.Context, fieldName, value string) (*T, error) {
+
+	filter := bson.D{{Key: fieldName, Value: value}}
+	result := r.collection.FindOne(ctx, filter)
+
+	if result.Err() != nil {
+		return nil, result.Err()
+	}
+
+	var doc T
+	err := result.Decode(&doc)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &doc, nil
+}
+
 func (r *Repository[T]) Update(ctx context.Context, id string, updateDoc *T) (*T, error) {
 	objectID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {